@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/dominant-strategies/go-quai/cmd/utils"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "exports the chain of all the slices into an archive",
+	Long: `writes the blocks of every slice in the data directory, along with the pending
+ETXs and rollups they carry, into a single archive ordered so that it can be
+imported back in one pass. Every record is checksummed and the archive is
+gzipped if the file name ends in .gz. --export.first and --export.last select a
+range of prime blocks, the blocks of the regions and zones coming with the prime
+block they are coincident with or lead to. The node must not be running.`,
+	Args:                       cobra.ExactArgs(1),
+	RunE:                       runExport,
+	SilenceUsage:               true,
+	SuggestionsMinimumDistance: 2,
+	Example:                    `go-quai export chain.qarch.gz --export.first 1 --export.last 5000`,
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "imports the chain of all the slices from an archive",
+	Long: `runs the slices of the hierarchy without networking and appends the blocks of
+an archive written by export to them. The checksums of the records are verified
+as they are read. Blocks already in the chain are skipped, so an interrupted
+import resumes by running it again on the same archive. The zones need a
+coinbase to build on the imported blocks, so --node.coinbases must be set.`,
+	Args:                       cobra.ExactArgs(1),
+	RunE:                       runImport,
+	SilenceUsage:               true,
+	SuggestionsMinimumDistance: 2,
+	Example:                    `go-quai import chain.qarch.gz --node.coinbases "0x00...,0x01..."`,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+
+	for _, flag := range utils.ExportFlags {
+		utils.CreateAndBindFlag(flag, exportCmd)
+	}
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	return utils.ExportArchive(args[0], viper.GetUint64(utils.ExportFirstFlag.Name), viper.GetUint64(utils.ExportLastFlag.Name))
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	return utils.ImportChain(args[0])
+}
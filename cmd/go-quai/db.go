@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/dominant-strategies/go-quai/cmd/utils"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "low level database operations",
+	Long: `operations on the databases of the slices in the data directory. The node
+must not be running while they are applied.`,
+	SilenceUsage:               true,
+	SuggestionsMinimumDistance: 2,
+}
+
+var pruneHistoryCmd = &cobra.Command{
+	Use:   "prune-history",
+	Short: "prunes the block history of the zones beyond the history limit",
+	Long: `removes the transactions, receipts and ETX sets of the blocks older than
+--node.history-limit blocks from the databases of the zones in --node.slices.
+Headers, termini, manifests and the transaction lookup index are kept, so the
+RPCs report the pruned blocks and transactions as such. A node started with the
+same limit keeps pruning the history as the chain grows.`,
+	Args:                       cobra.NoArgs,
+	RunE:                       runPruneHistory,
+	SilenceUsage:               true,
+	SuggestionsMinimumDistance: 2,
+	Example:                    `go-quai db prune-history --node.slices "[0 0]" --node.history-limit 100000`,
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "migrates the databases from a database engine to another",
+	Long: `copies the key-value data of the slice databases from the --db.from engine
+to the --db.to one, leveldb or pebble, without resyncing. The new database is
+built next to the old one and an interrupted migration resumes where it stopped.
+Both are checked to hold the same keys and values before the new one is swapped
+in, and the old one is kept with the engine name as suffix. The freezer is moved
+as is. A migration interrupted while swapping the databases is completed by the
+next migrate or node start. Every slice in the data directory is migrated
+unless --db.location is given.`,
+	Args:                       cobra.NoArgs,
+	RunE:                       runMigrate,
+	SilenceUsage:               true,
+	SuggestionsMinimumDistance: 2,
+	Example:                    `go-quai db migrate --db.from leveldb --db.to pebble --db.location zone-0-0`,
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(pruneHistoryCmd)
+	dbCmd.AddCommand(migrateCmd)
+
+	for _, flag := range utils.DBMigrateFlags {
+		utils.CreateAndBindFlag(flag, migrateCmd)
+	}
+}
+
+func runPruneHistory(cmd *cobra.Command, args []string) error {
+	return utils.PruneHistory()
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	return utils.MigrateDatabases(viper.GetString(utils.DBMigrateFromFlag.Name), viper.GetString(utils.DBMigrateToFlag.Name), viper.GetString(utils.DBMigrateLocationFlag.Name))
+}
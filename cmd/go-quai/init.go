@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/dominant-strategies/go-quai/cmd/utils"
+	"github.com/dominant-strategies/go-quai/log"
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init <genesis.json>",
+	Short: "initializes a custom network from a genesis file",
+	Long: `initializes the databases of a custom network from a genesis file. The file
+holds a full genesis specification: the chain config, difficulty, expansion
+number, duration limit, gas ceiling and the Quai and Qi allocations of every
+location. The genesis is written for every location running at the genesis
+expansion number and stored in the data directory, so that later starts run on
+the custom network and refuse a database with a different genesis.`,
+	Args:                       cobra.ExactArgs(1),
+	RunE:                       runInit,
+	SilenceUsage:               true,
+	SuggestionsMinimumDistance: 2,
+	Example:                    `go-quai init ./genesis.json --global.data-dir ./data`,
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+}
+
+func runInit(cmd *cobra.Command, args []string) error {
+	if err := utils.InitGenesis(args[0]); err != nil {
+		return err
+	}
+	log.Global.WithField("path", utils.CustomGenesisPath()).Info("Custom network initialized")
+	return nil
+}
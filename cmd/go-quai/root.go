@@ -77,6 +77,9 @@ func rootCmdPreRun(cmd *cobra.Command, args []string) error {
 	utils.InitConfig()
 
 	// set logger inmediately after parsing cobra flags
+	if err := log.SetLogFormat(viper.GetString(utils.LogFormatFlag.Name)); err != nil {
+		return err
+	}
 	logLevel := viper.GetString(utils.LogLevelFlag.Name)
 	log.SetGlobalLogger("", logLevel)
 
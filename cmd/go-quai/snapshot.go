@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/dominant-strategies/go-quai/cmd/utils"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "checkpoints of the chain to bootstrap new nodes from",
+	Long: `exports the heads of the slices in the data directory along with the state
+they need to carry on, and imports them into a new data directory so that the
+node syncs from there instead of from the genesis block. The node must not be
+running.`,
+	SilenceUsage:               true,
+	SuggestionsMinimumDistance: 2,
+}
+
+var snapshotExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "writes a snapshot of the heads of the slices",
+	Long: `writes for every slice in the data directory its head WorkObject and the
+blocks back to the prime block it builds on, their termini and manifests, the
+best pending header, the pending ETXs and rollups of the sub blocks not included
+yet, and for the zones the account, UTXO and ETX tries of the head. The file is
+gzipped if its name ends in .gz. The head hashes are logged, to be published as
+the trusted hashes of the snapshot.`,
+	Args:                       cobra.ExactArgs(1),
+	RunE:                       runSnapshotExport,
+	SilenceUsage:               true,
+	SuggestionsMinimumDistance: 2,
+	Example:                    `go-quai snapshot export snapshot.qsnap.gz`,
+}
+
+var snapshotImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "bootstraps a new data directory from a snapshot",
+	Long: `restores a snapshot written by snapshot export into a new data directory. The
+head of every slice in the snapshot must be one of the --snapshot.trusted-hash
+values, its blocks must link up to it and to the prime chain, and the tries of
+the zones must be complete under the roots of their heads. The heads are only
+written once all of this is verified, and the node syncs from them when started.`,
+	Args:                       cobra.ExactArgs(1),
+	RunE:                       runSnapshotImport,
+	PreRunE:                    snapshotImportCmdPreRun,
+	SilenceUsage:               true,
+	SuggestionsMinimumDistance: 2,
+	Example:                    `go-quai snapshot import snapshot.qsnap.gz --snapshot.trusted-hash 0x...,0x...,0x...`,
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotExportCmd)
+	snapshotCmd.AddCommand(snapshotImportCmd)
+
+	for _, flag := range utils.SnapshotImportFlags {
+		utils.CreateAndBindFlag(flag, snapshotImportCmd)
+	}
+}
+
+func runSnapshotExport(cmd *cobra.Command, args []string) error {
+	return utils.ExportSnapshot(args[0])
+}
+
+func snapshotImportCmdPreRun(cmd *cobra.Command, args []string) error {
+	// The slices are set up on the genesis of a custom network
+	_, err := utils.LoadCustomGenesis()
+	return err
+}
+
+func runSnapshotImport(cmd *cobra.Command, args []string) error {
+	return utils.ImportSnapshot(args[0], viper.GetStringSlice(utils.SnapshotTrustedHashFlag.Name))
+}
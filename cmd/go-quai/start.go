@@ -10,6 +10,7 @@ import (
 	godebug "runtime/debug"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -62,6 +63,10 @@ func startCmdPreRun(cmd *cobra.Command, args []string) error {
 		configDir := cmd.Flag(utils.ConfigDirFlag.Name).Value.String()
 		viper.Set(utils.KeyFileFlag.Name, filepath.Join(configDir, "private.key"))
 	}
+	// Parse the genesis of a custom network once, for the slices to use
+	if _, err := utils.LoadCustomGenesis(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -86,10 +91,23 @@ func runStart(cmd *cobra.Command, args []string) error {
 
 	logLevel := viper.GetString(utils.NodeLogLevelFlag.Name)
 
-	var startingExpansionNumber uint64
-	if viper.IsSet(utils.StartingExpansionNumberFlag.Name) {
-		startingExpansionNumber = viper.GetUint64(utils.StartingExpansionNumberFlag.Name)
+	startingExpansionNumber := utils.StartingExpansionNumber()
+	// export the tracing spans before the slices start appending blocks
+	var stopTracing func(context.Context) error
+	if viper.GetString(utils.TracingEndpointFlag.Name) != "" || viper.GetString(utils.TracingFileFlag.Name) != "" {
+		stopTracing, err = metrics_config.StartTracing(metrics_config.TracingConfig{
+			Endpoint:    viper.GetString(utils.TracingEndpointFlag.Name),
+			Insecure:    viper.GetBool(utils.TracingInsecureFlag.Name),
+			File:        viper.GetString(utils.TracingFileFlag.Name),
+			SampleRatio: viper.GetFloat64(utils.TracingSampleRatioFlag.Name),
+			ServiceName: "go-quai",
+		})
+		if err != nil {
+			log.Global.WithField("error", err).Fatal("error starting tracing")
+		}
+		log.Global.Info("Tracing started")
 	}
+
 	// Start the  hierarchical co-ordinator
 	var nodeWg sync.WaitGroup
 	hc := utils.NewHierarchicalCoordinator(node, logLevel, &nodeWg, startingExpansionNumber, quitCh)
@@ -103,6 +121,15 @@ func runStart(cmd *cobra.Command, args []string) error {
 		log.Global.WithField("error", err).Fatal("error starting node")
 	}
 
+	// start the unified rpc gateway in front of the slice endpoints
+	var gateway *utils.RPCGateway
+	if viper.GetBool(utils.RPCGatewayEnabledFlag.Name) {
+		gateway = utils.NewRPCGateway(hc.CurrentExpansionNumber)
+		if err := gateway.Start(); err != nil {
+			log.Global.WithField("error", err).Fatal("error starting rpc gateway")
+		}
+	}
+
 	if viper.IsSet(utils.MetricsEnabledFlag.Name) {
 		log.Global.Info("Starting metrics")
 		metrics_config.EnableMetrics()
@@ -115,11 +142,21 @@ func runStart(cmd *cobra.Command, args []string) error {
 	<-ch
 	log.Global.Warn("Received 'stop' signal, shutting down gracefully...")
 	cancel()
+	if gateway != nil {
+		gateway.Stop()
+	}
 	// stop the hierarchical co-ordinator
 	hc.Stop()
 	if err := node.Stop(); err != nil {
 		panic(err)
 	}
+	if stopTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := stopTracing(ctx); err != nil {
+			log.Global.WithField("error", err).Error("error flushing the tracing spans")
+		}
+		cancel()
+	}
 	log.Global.Warn("Node is offline")
 	return nil
 }
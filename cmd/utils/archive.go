@@ -0,0 +1,671 @@
+package utils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	p2pcore "github.com/libp2p/go-libp2p/core"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/crypto"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/internal/quaiapi"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/node"
+	"github.com/dominant-strategies/go-quai/quai"
+)
+
+// A chain archive holds the canonical blocks of all the slices of a data
+// directory, ordered so that every block comes after the blocks it depends on
+// in any slice. It starts with archiveMagic and the format version, followed by
+// the records and a trailer holding the number of records and the hash of all
+// of them. Every record is made of its kind, the location of the slice it
+// belongs to and its protobuf encoded payload, followed by a CRC32 checksum.
+const (
+	archiveMagic   = "QUAIARCH"
+	archiveVersion = 1
+
+	// c_archiveAppendTimeout is how long the import waits for a block to be
+	// appended before giving up
+	c_archiveAppendTimeout = time.Minute
+)
+
+type archiveRecordKind byte
+
+const (
+	archiveTrailer           archiveRecordKind = iota // number and hash of the records
+	archiveBlock                                      // WorkObject as stored by the slice
+	archivePendingEtxs                                // pending ETXs of a sub block, added to the slice
+	archivePendingEtxsRollup                          // pending ETX rollup of a sub block, added to the slice
+)
+
+var (
+	errArchiveCorrupted = errors.New("chain archive corrupted")
+	errArchiveTruncated = errors.New("chain archive truncated")
+
+	archiveCrcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// archiveRecord is a single entry of a chain archive.
+type archiveRecord struct {
+	kind     archiveRecordKind
+	location common.Location
+	data     []byte
+}
+
+// archiveWriter writes the records of a chain archive.
+type archiveWriter struct {
+	w      *bufio.Writer
+	hasher crypto.KeccakState
+	count  uint64
+}
+
+func newArchiveWriter(w io.Writer, magic string) (*archiveWriter, error) {
+	aw := &archiveWriter{w: bufio.NewWriter(w), hasher: crypto.NewKeccakState()}
+	if _, err := aw.w.WriteString(magic); err != nil {
+		return nil, err
+	}
+	if _, err := aw.w.Write(binary.AppendUvarint(nil, archiveVersion)); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// write appends a record to the archive.
+func (aw *archiveWriter) write(kind archiveRecordKind, location common.Location, data []byte) error {
+	if err := aw.writeRecord(kind, location, data); err != nil {
+		return err
+	}
+	aw.count++
+	return nil
+}
+
+func (aw *archiveWriter) writeRecord(kind archiveRecordKind, location common.Location, data []byte) error {
+	buf := make([]byte, 0, len(data)+len(location)+2*binary.MaxVarintLen64+5)
+	buf = append(buf, byte(kind))
+	buf = binary.AppendUvarint(buf, uint64(len(location)))
+	buf = append(buf, location...)
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	buf = append(buf, data...)
+	if kind != archiveTrailer {
+		aw.hasher.Write(buf)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, crc32.Checksum(buf, archiveCrcTable))
+	_, err := aw.w.Write(buf)
+	return err
+}
+
+// close writes the trailer of the archive and flushes it.
+func (aw *archiveWriter) close() error {
+	var hash common.Hash
+	aw.hasher.Read(hash[:])
+	trailer := binary.AppendUvarint(nil, aw.count)
+	trailer = append(trailer, hash.Bytes()...)
+	if err := aw.writeRecord(archiveTrailer, nil, trailer); err != nil {
+		return err
+	}
+	return aw.w.Flush()
+}
+
+// archiveReader reads the records of a chain archive, checking their checksums
+// and, once all of them are read, the trailer.
+type archiveReader struct {
+	r      *bufio.Reader
+	hasher crypto.KeccakState
+	count  uint64
+	done   bool
+}
+
+func newArchiveReader(r io.Reader, magic string) (*archiveReader, error) {
+	ar := &archiveReader{r: bufio.NewReader(r), hasher: crypto.NewKeccakState()}
+	prefix := make([]byte, len(magic))
+	if _, err := io.ReadFull(ar.r, prefix); err != nil || string(prefix) != magic {
+		return nil, errors.New("unknown archive format")
+	}
+	version, err := binary.ReadUvarint(ar.r)
+	if err != nil {
+		return nil, errArchiveTruncated
+	}
+	if version != archiveVersion {
+		return nil, fmt.Errorf("unsupported chain archive version %d", version)
+	}
+	return ar, nil
+}
+
+// next returns the next record of the archive, or io.EOF once the trailer has
+// been read and matches the records.
+func (ar *archiveReader) next() (*archiveRecord, error) {
+	if ar.done {
+		return nil, io.EOF
+	}
+	var buf []byte
+	kind, err := ar.r.ReadByte()
+	if err != nil {
+		return nil, errArchiveTruncated
+	}
+	buf = append(buf, kind)
+	location, buf, err := ar.readBytes(buf, common.MaxZones)
+	if err != nil {
+		return nil, err
+	}
+	data, buf, err := ar.readBytes(buf, 1<<30)
+	if err != nil {
+		return nil, err
+	}
+	var checksum [4]byte
+	if _, err := io.ReadFull(ar.r, checksum[:]); err != nil {
+		return nil, errArchiveTruncated
+	}
+	if binary.BigEndian.Uint32(checksum[:]) != crc32.Checksum(buf, archiveCrcTable) {
+		return nil, fmt.Errorf("%w: bad checksum of record %d", errArchiveCorrupted, ar.count)
+	}
+	record := &archiveRecord{kind: archiveRecordKind(kind), location: common.Location(location), data: data}
+	if record.kind != archiveTrailer {
+		ar.hasher.Write(buf)
+		ar.count++
+		return record, nil
+	}
+	count, n := binary.Uvarint(data)
+	if n <= 0 || len(data) != n+common.HashLength {
+		return nil, fmt.Errorf("%w: bad trailer", errArchiveCorrupted)
+	}
+	var hash common.Hash
+	ar.hasher.Read(hash[:])
+	if count != ar.count || common.BytesToHash(data[n:]) != hash {
+		return nil, fmt.Errorf("%w: trailer doesn't match the records", errArchiveCorrupted)
+	}
+	ar.done = true
+	return nil, io.EOF
+}
+
+// readBytes reads a length prefixed byte slice of at most max bytes, appending
+// its encoding to buf.
+func (ar *archiveReader) readBytes(buf []byte, max uint64) ([]byte, []byte, error) {
+	size, err := binary.ReadUvarint(ar.r)
+	if err != nil {
+		return nil, nil, errArchiveTruncated
+	}
+	if size > max {
+		return nil, nil, fmt.Errorf("%w: record of %d bytes", errArchiveCorrupted, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(ar.r, data); err != nil {
+		return nil, nil, errArchiveTruncated
+	}
+	buf = binary.AppendUvarint(buf, size)
+	return data, append(buf, data...), nil
+}
+
+// archiveCursor walks the canonical chain of a slice for the export.
+type archiveCursor struct {
+	location common.Location
+	db       ethdb.Database
+	number   uint64 // number of the current block in the slice
+	head     uint64
+	block    *types.WorkObject
+}
+
+// key orders the blocks of all the slices so that every block comes after its
+// parents in each context. A coincident block is written by the subordinate
+// slices first, as the dominant slice appends it into them.
+func (c *archiveCursor) key() [4]uint64 {
+	return [4]uint64{
+		c.block.NumberU64(common.PRIME_CTX),
+		c.block.NumberU64(common.REGION_CTX),
+		c.block.NumberU64(common.ZONE_CTX),
+		uint64(common.HierarchyDepth - c.location.Context()),
+	}
+}
+
+// advance moves the cursor to the next canonical block, returning false once
+// the head or the last prime number is passed.
+func (c *archiveCursor) advance(last uint64) bool {
+	if c.number >= c.head {
+		return false
+	}
+	c.number++
+	c.block = rawdb.ReadWorkObject(c.db, rawdb.ReadCanonicalHash(c.db, c.number), types.BlockObject)
+	return c.block != nil && c.block.NumberU64(common.PRIME_CTX) <= last
+}
+
+// archiveCursors is a heap of the cursors of the slices by block order.
+type archiveCursors []*archiveCursor
+
+func (h archiveCursors) Len() int { return len(h) }
+func (h archiveCursors) Less(i, j int) bool {
+	a, b := h[i].key(), h[j].key()
+	for k := range a {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return false
+}
+func (h archiveCursors) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *archiveCursors) Push(x interface{}) { *h = append(*h, x.(*archiveCursor)) }
+func (h *archiveCursors) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// ExportArchive writes the canonical blocks of all the slices in the data
+// directory to a chain archive, along with the pending ETXs and rollups their
+// dominant slices hold for them. Only the blocks whose prime number is between
+// first and last are written, a last of 0 meaning up to the heads. The archive
+// is gzipped if the path ends with .gz.
+func ExportArchive(path string, first, last uint64) error {
+	if last == 0 {
+		last = ^uint64(0)
+	}
+	if first > last {
+		return errors.New("first block is after the last one")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	dbs := make(map[string]ethdb.Database)
+	var cursors archiveCursors
+	for _, location := range sliceLocations() {
+		stack, db, err := openSliceDatabase(location, true)
+		if err != nil {
+			return err
+		} else if stack == nil {
+			continue
+		}
+		defer stack.Close()
+		dbs[SliceName(location)] = db
+
+		head := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadBlockHash(db))
+		if head == nil {
+			continue
+		}
+		// Start right before the first block of the range, the prime numbers
+		// only grow along the chain
+		start := sort.Search(int(*head), func(i int) bool {
+			block := rawdb.ReadWorkObject(db, rawdb.ReadCanonicalHash(db, uint64(i+1)), types.BlockObject)
+			return block == nil || block.NumberU64(common.PRIME_CTX) >= first
+		})
+		cursor := &archiveCursor{location: location, db: db, number: uint64(start), head: *head}
+		if cursor.advance(last) {
+			cursors = append(cursors, cursor)
+		}
+	}
+	if len(dbs) == 0 {
+		return errors.New("no database found in the data directory")
+	}
+	heap.Init(&cursors)
+
+	writer, closeFile, err := createArchiveFile(path)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+	aw, err := newArchiveWriter(writer, archiveMagic)
+	if err != nil {
+		return err
+	}
+	var (
+		blocks int
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for cursors.Len() > 0 {
+		cursor := cursors[0]
+		if err := exportBlock(aw, dbs, cursor.location, cursor.block); err != nil {
+			return err
+		}
+		blocks++
+		if time.Since(logged) > 8*time.Second {
+			log.Global.WithFields(log.Fields{
+				"blocks":   blocks,
+				"location": SliceName(cursor.location),
+				"number":   cursor.number,
+				"elapsed":  common.PrettyDuration(time.Since(start)),
+			}).Info("Exporting chain")
+			logged = time.Now()
+		}
+		if cursor.advance(last) {
+			heap.Fix(&cursors, 0)
+		} else {
+			heap.Pop(&cursors)
+		}
+	}
+	if err := aw.close(); err != nil {
+		return err
+	}
+	if err := closeFile(); err != nil {
+		return err
+	}
+	log.Global.WithFields(log.Fields{
+		"path":    path,
+		"blocks":  blocks,
+		"records": aw.count,
+		"elapsed": common.PrettyDuration(time.Since(start)),
+	}).Info("Exported chain")
+	return nil
+}
+
+// exportBlock writes a block of a slice, followed by the pending ETXs and
+// rollup its dominant slice holds for it.
+func exportBlock(aw *archiveWriter, dbs map[string]ethdb.Database, location common.Location, block *types.WorkObject) error {
+	protoBlock, err := block.ProtoEncode(types.BlockObject)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(protoBlock)
+	if err != nil {
+		return err
+	}
+	if err := aw.write(archiveBlock, location, data); err != nil {
+		return err
+	}
+	if location.Context() == common.PRIME_CTX {
+		return nil
+	}
+	dom := location[:location.Context()-1]
+	domDb, ok := dbs[SliceName(dom)]
+	if !ok {
+		return nil
+	}
+	if pEtxs := rawdb.ReadPendingEtxs(domDb, block.Hash()); pEtxs != nil {
+		protoPEtxs, err := pEtxs.ProtoEncode()
+		if err != nil {
+			return err
+		}
+		if data, err = proto.Marshal(protoPEtxs); err != nil {
+			return err
+		}
+		if err := aw.write(archivePendingEtxs, dom, data); err != nil {
+			return err
+		}
+	}
+	if rollup := rawdb.ReadPendingEtxsRollup(domDb, block.Hash()); rollup != nil {
+		protoRollup, err := rollup.ProtoEncode()
+		if err != nil {
+			return err
+		}
+		if data, err = proto.Marshal(protoRollup); err != nil {
+			return err
+		}
+		if err := aw.write(archivePendingEtxsRollup, dom, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportArchive feeds the records of a chain archive to the slices running in
+// this process, waiting for every block to be appended by the slice that
+// dominates it. The blocks already appended are skipped, so that an
+// interrupted import resumes by importing the same archive again.
+func ImportArchive(consensus quai.ConsensusAPI, path string) error {
+	reader, closeFile, err := openArchiveFile(path)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+	ar, err := newArchiveReader(reader, archiveMagic)
+	if err != nil {
+		return err
+	}
+	if err := waitPendingHeaders(consensus); err != nil {
+		return err
+	}
+	var (
+		imported, skipped int
+		start             = time.Now()
+		logged            = time.Now()
+	)
+	for {
+		record, err := ar.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		backendPtr := consensus.GetBackend(record.location)
+		if backendPtr == nil {
+			return fmt.Errorf("slice %s of the archive is not running", SliceName(record.location))
+		}
+		backend := *backendPtr
+		switch record.kind {
+		case archiveBlock:
+			protoBlock := new(types.ProtoWorkObject)
+			if err := proto.Unmarshal(record.data, protoBlock); err != nil {
+				return err
+			}
+			block := new(types.WorkObject)
+			if err := block.ProtoDecode(protoBlock, record.location, types.BlockObject); err != nil {
+				return err
+			}
+			if header, _ := backend.HeaderByHash(context.Background(), block.Hash()); header != nil {
+				skipped++
+				continue
+			}
+			if err := importBlock(backend, block); err != nil {
+				return fmt.Errorf("block %s of %s: %w", block.Hash().Hex(), SliceName(record.location), err)
+			}
+			imported++
+
+		case archivePendingEtxs:
+			protoPEtxs := new(types.ProtoPendingEtxs)
+			if err := proto.Unmarshal(record.data, protoPEtxs); err != nil {
+				return err
+			}
+			pEtxs := types.PendingEtxs{}
+			if err := pEtxs.ProtoDecode(protoPEtxs, record.location); err != nil {
+				return err
+			}
+			if err := backend.AddPendingEtxs(pEtxs); err != nil && !errors.Is(err, core.ErrPendingEtxAlreadyKnown) {
+				return err
+			}
+
+		case archivePendingEtxsRollup:
+			protoRollup := new(types.ProtoPendingEtxsRollup)
+			if err := proto.Unmarshal(record.data, protoRollup); err != nil {
+				return err
+			}
+			rollup := types.PendingEtxsRollup{}
+			if err := rollup.ProtoDecode(protoRollup, record.location); err != nil {
+				return err
+			}
+			if err := backend.AddPendingEtxsRollup(rollup); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("%w: unknown record kind %d", errArchiveCorrupted, record.kind)
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Global.WithFields(log.Fields{
+				"imported": imported,
+				"skipped":  skipped,
+				"elapsed":  common.PrettyDuration(time.Since(start)),
+			}).Info("Importing chain")
+			logged = time.Now()
+		}
+	}
+	log.Global.WithFields(log.Fields{
+		"path":     path,
+		"imported": imported,
+		"skipped":  skipped,
+		"elapsed":  common.PrettyDuration(time.Since(start)),
+	}).Info("Imported chain")
+	return nil
+}
+
+// importBlock writes a block into a slice. If the slice dominates the block,
+// it waits for the block to be appended, which appends it into the
+// subordinate slices as well.
+func importBlock(backend quaiapi.Backend, block *types.WorkObject) error {
+	_, order, err := backend.CalcOrder(block)
+	if err != nil {
+		return err
+	}
+	if order != backend.NodeCtx() {
+		backend.WriteBlock(block)
+		return nil
+	}
+	// Subscribe before writing the block so that its append can't be missed
+	appendCh := make(chan core.BlockAppendEvent, 16)
+	appendSub := backend.SubscribeBlockAppendEvent(appendCh)
+	defer appendSub.Unsubscribe()
+
+	backend.WriteBlock(block)
+	timeout := time.NewTimer(c_archiveAppendTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case ev := <-appendCh:
+			if ev.Block.Hash() == block.Hash() {
+				return nil
+			}
+		case err := <-appendSub.Err():
+			return err
+		case <-timeout.C:
+			return errors.New("block was not appended, its parents may be missing")
+		}
+	}
+}
+
+// waitPendingHeaders waits for the zones running in this process to have a
+// pending header, which the prime slice sets up in the background on a new
+// chain, as the zones can't append blocks before that.
+func waitPendingHeaders(consensus quai.ConsensusAPI) error {
+	timeout := time.NewTimer(c_archiveAppendTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for _, location := range sliceLocations() {
+		backend := consensus.GetBackend(location)
+		if backend == nil || location.Context() != common.ZONE_CTX {
+			continue
+		}
+		for {
+			if _, err := (*backend).GetPendingHeader(); err == nil {
+				break
+			}
+			select {
+			case <-ticker.C:
+			case <-timeout.C:
+				return fmt.Errorf("slice %s has no pending header", SliceName(location))
+			}
+		}
+	}
+	return nil
+}
+
+// createArchiveFile creates the file of an archive, gzipped if the path ends
+// with .gz. The returned function flushes and closes it.
+func createArchiveFile(path string) (io.Writer, func() error, error) {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return out, out.Close, nil
+	}
+	gz := gzip.NewWriter(out)
+	return gz, func() error {
+		if err := gz.Close(); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	}, nil
+}
+
+// openArchiveFile opens the file of an archive, gunzipping it if the path ends
+// with .gz. The returned function closes it.
+func openArchiveFile(path string) (io.Reader, func(), error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return in, func() { in.Close() }, nil
+	}
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		in.Close()
+		return nil, nil, err
+	}
+	return gz, func() {
+		gz.Close()
+		in.Close()
+	}, nil
+}
+
+// openSliceDatabase opens the chain database of the slice at the location. If
+// readonly is set, it returns a nil stack when the data directory holds no
+// database for the slice.
+func openSliceDatabase(location common.Location, readonly bool) (*node.Node, ethdb.Database, error) {
+	cfg := defaultNodeConfig()
+	cfg.NodeLocation = location
+	SetNodeConfig(&cfg, location, log.Global)
+	if _, err := os.Stat(cfg.ResolvePath("chaindata")); readonly && os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	stack, err := node.New(&cfg, log.Global)
+	if err != nil {
+		return nil, nil, err
+	}
+	return stack, MakeChainDatabase(stack, readonly), nil
+}
+
+// ImportChain starts the slices of the hierarchy without networking and imports
+// a chain archive into them.
+func ImportChain(path string) error {
+	// The zones build a pending header on every block they append, which they
+	// refuse to do without a coinbase
+	if viper.GetString(CoinbaseAddressFlag.Name) == "" {
+		return errors.New("importing a chain requires the coinbases of the zones")
+	}
+	var nodeWg sync.WaitGroup
+	hc := NewHierarchicalCoordinator(offlineNetwork{}, viper.GetString(NodeLogLevelFlag.Name), &nodeWg, StartingExpansionNumber(), make(chan struct{}))
+	defer hc.Stop()
+	return ImportArchive(hc.ConsensusBackend(), path)
+}
+
+// offlineNetwork is the networking backend of the slices importing a chain
+// archive, which neither broadcast nor request anything.
+type offlineNetwork struct{}
+
+func (offlineNetwork) Start() error                                   { return nil }
+func (offlineNetwork) Stop() error                                    { return nil }
+func (offlineNetwork) Subscribe(common.Location, interface{}) error   { return nil }
+func (offlineNetwork) Unsubscribe(common.Location, interface{}) error { return nil }
+func (offlineNetwork) Broadcast(common.Location, interface{}) error   { return nil }
+func (offlineNetwork) SetConsensusBackend(quai.ConsensusAPI)          {}
+func (offlineNetwork) MarkLivelyPeer(p2pcore.PeerID, string)          {}
+func (offlineNetwork) MarkLatentPeer(p2pcore.PeerID, string)          {}
+func (offlineNetwork) ProtectPeer(p2pcore.PeerID)                     {}
+func (offlineNetwork) UnprotectPeer(p2pcore.PeerID)                   {}
+func (offlineNetwork) BanPeer(p2pcore.PeerID)                         {}
+func (offlineNetwork) PeerCount() int                                 { return 0 }
+
+// Request answers every request with no data.
+func (offlineNetwork) Request(common.Location, interface{}, interface{}) chan interface{} {
+	resultCh := make(chan interface{})
+	close(resultCh)
+	return resultCh
+}
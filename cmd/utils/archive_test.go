@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/event"
+	"github.com/dominant-strategies/go-quai/internal/quaiapi"
+)
+
+func writeTestArchive(t *testing.T, records []archiveRecord) []byte {
+	var buf bytes.Buffer
+	aw, err := newArchiveWriter(&buf, archiveMagic)
+	require.NoError(t, err)
+	for _, record := range records {
+		require.NoError(t, aw.write(record.kind, record.location, record.data))
+	}
+	require.NoError(t, aw.close())
+	return buf.Bytes()
+}
+
+func readTestArchive(archive []byte) ([]archiveRecord, error) {
+	ar, err := newArchiveReader(bytes.NewReader(archive), archiveMagic)
+	if err != nil {
+		return nil, err
+	}
+	var records []archiveRecord
+	for {
+		record, err := ar.next()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		records = append(records, *record)
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	records := []archiveRecord{
+		{kind: archiveBlock, location: common.Location{0, 1}, data: []byte("zone block")},
+		{kind: archivePendingEtxs, location: common.Location{0}, data: []byte("pending etxs")},
+		{kind: archivePendingEtxsRollup, location: common.Location{}, data: []byte("rollup")},
+		{kind: archiveBlock, location: common.Location{}, data: []byte{}},
+	}
+	read, err := readTestArchive(writeTestArchive(t, records))
+	require.NoError(t, err)
+	require.Len(t, read, len(records))
+	for i, record := range records {
+		require.Equal(t, record.kind, read[i].kind)
+		require.True(t, record.location.Equal(read[i].location))
+		require.Equal(t, record.data, read[i].data)
+	}
+}
+
+func TestArchiveCorruption(t *testing.T) {
+	records := []archiveRecord{
+		{kind: archiveBlock, location: common.Location{0, 0}, data: []byte("first block")},
+		{kind: archiveBlock, location: common.Location{0, 0}, data: []byte("second block")},
+	}
+	archive := writeTestArchive(t, records)
+
+	// Flipping a bit of a record fails its checksum
+	corrupted := bytes.Clone(archive)
+	corrupted[len(archiveMagic)+4] ^= 1
+	_, err := readTestArchive(corrupted)
+	require.True(t, errors.Is(err, errArchiveCorrupted))
+
+	// Dropping the trailer or cutting a record short is caught as well
+	for _, size := range []int{len(archive) - 1, len(archive) - 20, len(archiveMagic) + 6} {
+		_, err := readTestArchive(archive[:size])
+		require.True(t, errors.Is(err, errArchiveTruncated), "size %d: %v", size, err)
+	}
+
+	// Dropping a whole record is caught by the trailer, which takes 40 bytes
+	// with less than 128 records
+	single := writeTestArchive(t, records[:1])
+	_, err = readTestArchive(append(single[:len(single)-40], archive[len(archive)-40:]...))
+	require.True(t, errors.Is(err, errArchiveCorrupted), err)
+
+	_, err = readTestArchive([]byte("NOTANARCHIVE"))
+	require.Error(t, err)
+}
+
+// importTestBackend is a zone announcing the given blocks as appended once a
+// block is written to it.
+type importTestBackend struct {
+	quaiapi.Backend
+	order    int
+	announce []*types.WorkObject
+	written  []*types.WorkObject
+	feed     event.Feed
+}
+
+func (b *importTestBackend) NodeCtx() int { return common.ZONE_CTX }
+
+func (b *importTestBackend) CalcOrder(header *types.WorkObject) (*big.Int, int, error) {
+	return new(big.Int), b.order, nil
+}
+
+func (b *importTestBackend) WriteBlock(block *types.WorkObject) {
+	b.written = append(b.written, block)
+	go func() {
+		for _, appended := range b.announce {
+			b.feed.Send(core.BlockAppendEvent{Block: appended})
+		}
+	}()
+}
+
+func (b *importTestBackend) SubscribeBlockAppendEvent(ch chan<- core.BlockAppendEvent) event.Subscription {
+	return b.feed.Subscribe(ch)
+}
+
+func newImportTestBlock(number int64) *types.WorkObject {
+	block := types.EmptyHeader(common.ZONE_CTX)
+	block.SetNumber(big.NewInt(number), common.ZONE_CTX)
+	return block
+}
+
+func TestImportBlock(t *testing.T) {
+	block, other := newImportTestBlock(1), newImportTestBlock(2)
+
+	// A block of the slice is imported once it is appended, whatever else
+	// is appended meanwhile
+	backend := &importTestBackend{order: common.ZONE_CTX, announce: []*types.WorkObject{other, block}}
+	require.NoError(t, importBlock(backend, block))
+	require.Equal(t, []*types.WorkObject{block}, backend.written)
+	require.Zero(t, backend.feed.Send(core.BlockAppendEvent{Block: block}), "append subscription left behind")
+
+	// A block dominated by another slice is only written, its dominant slice
+	// appending it
+	backend = &importTestBackend{order: common.REGION_CTX}
+	require.NoError(t, importBlock(backend, block))
+	require.Equal(t, []*types.WorkObject{block}, backend.written)
+}
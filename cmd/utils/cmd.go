@@ -1,17 +1,22 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/spf13/viper"
 
 	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
 	"github.com/dominant-strategies/go-quai/core/types"
 	"github.com/dominant-strategies/go-quai/internal/quaiapi"
 	"github.com/dominant-strategies/go-quai/log"
@@ -24,6 +29,10 @@ import (
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
+// customGenesisFileName is the name of the file in the prime data directory
+// holding the genesis of a custom network written by `go-quai init`
+const customGenesisFileName = "genesis.json"
+
 func OpenBackendDB() (*leveldb.DB, error) {
 	dataDir := viper.GetString(DataDirFlag.Name)
 	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
@@ -61,6 +70,124 @@ func GetRunningZones() []common.Location {
 	return runningSlices
 }
 
+// SliceName returns the name of the slice at the given location as used for
+// its data directory, e.g. prime, region-0 or zone-0-1
+func SliceName(location common.Location) string {
+	switch location.Context() {
+	case common.PRIME_CTX:
+		return "prime"
+	case common.REGION_CTX:
+		return fmt.Sprintf("region-%d", location.Region())
+	default:
+		return fmt.Sprintf("zone-%d-%d", location.Region(), location.Zone())
+	}
+}
+
+// sliceLocations returns the locations of all the slices a data directory can
+// hold, dominant slices first.
+func sliceLocations() []common.Location {
+	locations := []common.Location{{}}
+	for i := 0; i < common.MaxRegions; i++ {
+		locations = append(locations, common.Location{byte(i)})
+	}
+	for i := 0; i < common.MaxRegions; i++ {
+		for j := 0; j < common.MaxZones; j++ {
+			locations = append(locations, common.Location{byte(i), byte(j)})
+		}
+	}
+	return locations
+}
+
+// ContextName returns the name of the given context, i.e. prime, region or
+// zone
+func ContextName(ctx int) string {
+	switch ctx {
+	case common.PRIME_CTX:
+		return "prime"
+	case common.REGION_CTX:
+		return "region"
+	default:
+		return "zone"
+	}
+}
+
+// ParseSliceName returns the location of a slice name produced by SliceName
+func ParseSliceName(name string) (common.Location, error) {
+	var region, zone int
+	switch {
+	case name == "prime":
+		return common.Location{}, nil
+	case strings.HasPrefix(name, "region-"):
+		if _, err := fmt.Sscanf(name, "region-%d", &region); err != nil {
+			return nil, fmt.Errorf("invalid slice name %q", name)
+		}
+		if region < 0 || region >= common.MaxRegions {
+			return nil, fmt.Errorf("invalid slice name %q", name)
+		}
+		return common.Location{byte(region)}, nil
+	case strings.HasPrefix(name, "zone-"):
+		if _, err := fmt.Sscanf(name, "zone-%d-%d", &region, &zone); err != nil {
+			return nil, fmt.Errorf("invalid slice name %q", name)
+		}
+		if region < 0 || region >= common.MaxRegions || zone < 0 || zone >= common.MaxZones {
+			return nil, fmt.Errorf("invalid slice name %q", name)
+		}
+		return common.Location{byte(region), byte(zone)}, nil
+	}
+	return nil, fmt.Errorf("invalid slice name %q", name)
+}
+
+// GetLocalSlices returns the slices hosted by this process, or nil if the
+// process hosts the whole hierarchy
+func GetLocalSlices() []common.Location {
+	names := SplitAndTrim(viper.GetString(LocalSlicesFlag.Name))
+	if len(names) == 0 {
+		return nil
+	}
+	localSlices := []common.Location{}
+	for _, name := range names {
+		location, err := ParseSliceName(name)
+		if err != nil {
+			Fatalf("%v", err)
+		}
+		localSlices = append(localSlices, location)
+	}
+	return localSlices
+}
+
+// GetRemoteSlices returns the authenticated RPC endpoints of the slices
+// hosted by other processes, keyed by slice name
+func GetRemoteSlices() map[string]string {
+	remoteSlices := make(map[string]string)
+	for _, entry := range SplitAndTrim(viper.GetString(RemoteSlicesFlag.Name)) {
+		name, url, found := strings.Cut(entry, "=")
+		if !found {
+			Fatalf("invalid remote slice %q, expected <slice>=<url>", entry)
+		}
+		location, err := ParseSliceName(name)
+		if err != nil {
+			Fatalf("%v", err)
+		}
+		remoteSlices[SliceName(location)] = url
+	}
+	return remoteSlices
+}
+
+// SplitSlicesEnabled returns true if the slices of the hierarchy are spread
+// over several processes
+func SplitSlicesEnabled() bool {
+	return viper.GetString(LocalSlicesFlag.Name) != "" || viper.GetString(RemoteSlicesFlag.Name) != ""
+}
+
+// JWTSecretPath returns the path of the secret authenticating the slices
+// running in separate processes
+func JWTSecretPath() string {
+	if secret := viper.GetString(JWTSecretFlag.Name); secret != "" {
+		return secret
+	}
+	return filepath.Join(viper.GetString(DataDirFlag.Name), "jwtsecret")
+}
+
 // getRegionsRunning returns the regions running
 func GetRunningRegions(runningSlices []common.Location) []byte {
 	runningRegions := []byte{}
@@ -72,6 +199,258 @@ func GetRunningRegions(runningSlices []common.Location) []byte {
 	return runningRegions
 }
 
+// CustomGenesisPath returns the path of the custom network genesis in the prime
+// data directory, or an empty string if the node runs on memory databases.
+func CustomGenesisPath() string {
+	cfg := defaultNodeConfig()
+	setDataDir(&cfg)
+	if cfg.DataDir == "" {
+		return ""
+	}
+	return filepath.Join(cfg.DataDir, customGenesisFileName)
+}
+
+// customGenesis caches the custom network genesis of the data directory, so
+// that it is only parsed once.
+var customGenesis struct {
+	sync.Mutex
+	loaded  bool
+	path    string
+	genesis *core.Genesis
+	err     error
+}
+
+// LoadCustomGenesis parses the custom network genesis written by `go-quai init`
+// into the data directory, or returns nil if the node runs on a hard coded
+// network. The result is cached until the data directory changes.
+func LoadCustomGenesis() (*core.Genesis, error) {
+	genesisPath := CustomGenesisPath()
+	customGenesis.Lock()
+	defer customGenesis.Unlock()
+	if !customGenesis.loaded || customGenesis.path != genesisPath {
+		customGenesis.genesis, customGenesis.err = readCustomGenesis(genesisPath)
+		customGenesis.loaded, customGenesis.path = true, genesisPath
+	}
+	return customGenesis.genesis, customGenesis.err
+}
+
+func readCustomGenesis(genesisPath string) (*core.Genesis, error) {
+	if genesisPath == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(genesisPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	genesis, err := core.ReadGenesis(genesisPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read custom genesis: %w", err)
+	}
+	return genesis, nil
+}
+
+// ReadCustomGenesis returns the custom network genesis of the data directory,
+// or nil if the node runs on a hard coded network. The commands setting up
+// slices load it with LoadCustomGenesis before running, failing if it is invalid.
+func ReadCustomGenesis() *core.Genesis {
+	genesis, _ := LoadCustomGenesis()
+	return genesis
+}
+
+// StartingExpansionNumber returns the expansion number the network started at,
+// the flag takes precedence over the custom network genesis.
+func StartingExpansionNumber() uint64 {
+	if !viper.IsSet(StartingExpansionNumberFlag.Name) {
+		if genesis := ReadCustomGenesis(); genesis != nil {
+			return genesis.ExpansionNumber
+		}
+	}
+	return viper.GetUint64(StartingExpansionNumberFlag.Name)
+}
+
+// InitGenesis commits the genesis of a custom network to the database of every
+// location running at its expansion number, and stores it in the data directory
+// so that the node starts on that network from then on.
+func InitGenesis(genesisPath string) error {
+	genesis, err := core.ReadGenesis(genesisPath)
+	if err != nil {
+		return err
+	}
+	targetPath := CustomGenesisPath()
+	if targetPath == "" {
+		return errors.New("a data directory is required to initialize a custom network")
+	}
+	existing, err := LoadCustomGenesis()
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		existingHash := existing.ToBlock(existing.ExpansionNumber).Hash()
+		newHash := genesis.ToBlock(genesis.ExpansionNumber).Hash()
+		if existingHash != newHash {
+			return &core.GenesisMismatchError{Stored: existingHash, New: newHash}
+		}
+	}
+
+	locations := []common.Location{nil}
+	regions, zones := common.GetHierarchySizeForExpansionNumber(uint8(genesis.ExpansionNumber))
+	for i := 0; i < int(regions); i++ {
+		locations = append(locations, common.Location{byte(i)})
+	}
+	for i := 0; i < int(regions); i++ {
+		for j := 0; j < int(zones); j++ {
+			locations = append(locations, common.Location{byte(i), byte(j)})
+		}
+	}
+	for _, location := range locations {
+		if err := initGenesisAt(genesis, location); err != nil {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(genesisPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(targetPath, data, 0644); err != nil {
+		return err
+	}
+	customGenesis.Lock()
+	customGenesis.loaded = false
+	customGenesis.Unlock()
+	return nil
+}
+
+// initGenesisAt writes the genesis block into the database of a single location.
+func initGenesisAt(genesis *core.Genesis, location common.Location) error {
+	cfg := defaultNodeConfig()
+	cfg.NodeLocation = location
+	SetNodeConfig(&cfg, location, log.Global)
+	stack, err := node.New(&cfg, log.Global)
+	if err != nil {
+		return err
+	}
+	defer stack.Close()
+	chainDb := MakeChainDatabase(stack, false)
+
+	// Every location carries its own copy of the chain config
+	chainConfig := *genesis.Config
+	chainConfig.Location = location
+	locationGenesis := *genesis
+	locationGenesis.Config = &chainConfig
+
+	_, hash, err := core.SetupGenesisBlockWithOverride(chainDb, &locationGenesis, location, genesis.ExpansionNumber, log.Global)
+	if err != nil {
+		return err
+	}
+	log.Global.WithFields(log.Fields{
+		"location": location.Name(),
+		"hash":     hash,
+	}).Info("Wrote custom genesis block")
+	return nil
+}
+
+// PruneHistory applies the history limit to the databases of the zones in the
+// running slices, removing the bodies and receipts of the blocks below it.
+func PruneHistory() error {
+	limit := viper.GetUint64(HistoryLimitFlag.Name)
+	if limit == 0 {
+		return fmt.Errorf("--%s is required to prune the history", HistoryLimitFlag.Name)
+	}
+	if limit < core.MinHistoryLimit {
+		return fmt.Errorf("--%s must be at least %d", HistoryLimitFlag.Name, core.MinHistoryLimit)
+	}
+	for _, location := range GetRunningZones() {
+		if err := pruneHistoryAt(location, limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneHistoryAt prunes the history of the database of a single zone.
+func pruneHistoryAt(location common.Location, limit uint64) error {
+	cfg := defaultNodeConfig()
+	cfg.NodeLocation = location
+	SetNodeConfig(&cfg, location, log.Global)
+	stack, err := node.New(&cfg, log.Global)
+	if err != nil {
+		return err
+	}
+	defer stack.Close()
+	chainDb := MakeChainDatabase(stack, false)
+
+	headHash := rawdb.ReadHeadBlockHash(chainDb)
+	head := rawdb.ReadHeaderNumber(chainDb, headHash)
+	if head == nil {
+		return fmt.Errorf("no head block found in the database of %s", SliceName(location))
+	}
+	tail, err := core.PruneHistory(chainDb, *head, limit, 0)
+	if err != nil {
+		return err
+	}
+	log.Global.WithFields(log.Fields{
+		"location": location.Name(),
+		"head":     *head,
+		"tail":     tail,
+	}).Info("Pruned history")
+	return nil
+}
+
+// MigrateDatabases moves the key-value store of the slice with the given name,
+// or of every slice in the data directory if empty, from the from database
+// engine to the to one. The freezer is left as is.
+func MigrateDatabases(from, to, name string) error {
+	locations := sliceLocations()
+	if name != "" {
+		location, err := ParseSliceName(name)
+		if err != nil {
+			return err
+		}
+		locations = []common.Location{location}
+	}
+	migrated := 0
+	for _, location := range locations {
+		cfg := defaultNodeConfig()
+		cfg.NodeLocation = location
+		SetNodeConfig(&cfg, location, log.Global)
+		if _, err := os.Stat(cfg.ResolvePath("chaindata")); os.IsNotExist(err) {
+			if name != "" {
+				return fmt.Errorf("no database found for %s", name)
+			}
+			continue
+		}
+		if err := migrateDatabaseAt(&cfg, from, to); err != nil {
+			return fmt.Errorf("%s: %w", SliceName(location), err)
+		}
+		migrated++
+	}
+	if migrated == 0 {
+		return errors.New("no database found in the data directory")
+	}
+	return nil
+}
+
+// migrateDatabaseAt migrates the key-value store of a single slice, holding the
+// instance lock so that no node runs on it meanwhile.
+func migrateDatabaseAt(cfg *node.Config, from, to string) error {
+	stack, err := node.New(cfg, log.Global)
+	if err != nil {
+		return err
+	}
+	defer stack.Close()
+
+	cache := viper.GetInt(CacheFlag.Name) * viper.GetInt(CacheDatabaseFlag.Name) / 100
+	log.Global.WithFields(log.Fields{
+		"location": cfg.NodeLocation.Name(),
+		"from":     from,
+		"to":       to,
+	}).Info("Migrating database")
+	return rawdb.MigrateDatabase(stack.ResolvePath("chaindata"), from, to, cache, MakeDatabaseHandles(), log.Global, cfg.NodeLocation)
+}
+
 func StartNode(stack *node.Node) {
 	if err := stack.Start(); err != nil {
 		Fatalf("Error starting protocol stack: %v", err)
@@ -120,7 +499,7 @@ func defaultNodeConfig() node.Config {
 // makeFullNode loads quai configuration and creates the Quai backend.
 func makeFullNode(p2p quai.NetworkingAPI, nodeLocation common.Location, slicesRunning []common.Location, currentExpansionNumber uint8, genesisBlock *types.WorkObject, logger *log.Logger) (*node.Node, quaiapi.Backend) {
 	stack, cfg := makeConfigNode(slicesRunning, nodeLocation, currentExpansionNumber, logger)
-	startingExpansionNumber := viper.GetUint64(StartingExpansionNumberFlag.Name)
+	startingExpansionNumber := StartingExpansionNumber()
 	backend, _ := RegisterQuaiService(stack, p2p, cfg.Quai, cfg.Node.NodeLocation.Context(), currentExpansionNumber, startingExpansionNumber, genesisBlock, logger)
 	sendfullstats := viper.GetBool(SendFullStatsFlag.Name)
 	// Add the Quai Stats daemon if requested.
@@ -39,12 +39,15 @@ import (
 )
 
 const (
-	c_GlobalFlagPrefix  = "global."
-	c_NodeFlagPrefix    = "node."
-	c_TXPoolPrefix      = "txpool."
-	c_RPCFlagPrefix     = "rpc."
-	c_PeersFlagPrefix   = "peers."
-	c_MetricsFlagPrefix = "metrics."
+	c_GlobalFlagPrefix   = "global."
+	c_NodeFlagPrefix     = "node."
+	c_TXPoolPrefix       = "txpool."
+	c_RPCFlagPrefix      = "rpc."
+	c_PeersFlagPrefix    = "peers."
+	c_MetricsFlagPrefix  = "metrics."
+	c_DBFlagPrefix       = "db."
+	c_ExportFlagPrefix   = "export."
+	c_SnapshotFlagPrefix = "snapshot."
 )
 
 var Flags = [][]Flag{
@@ -61,6 +64,7 @@ var GlobalFlags = []Flag{
 	DataDirFlag,
 	AncientDirFlag,
 	LogLevelFlag,
+	LogFormatFlag,
 }
 
 var NodeFlags = []Flag{
@@ -75,14 +79,18 @@ var NodeFlags = []Flag{
 	LocationFlag,
 	SoloFlag,
 	DBEngineFlag,
+	GCModeFlag,
 	NetworkIdFlag,
 	SlicesRunningFlag,
+	LocalSlicesFlag,
+	RemoteSlicesFlag,
 	GenesisNonceFlag,
 	DevPeriodFlag,
 	IdentityFlag,
 	DocRootFlag,
 	SnapshotFlag,
 	TxLookupLimitFlag,
+	HistoryLimitFlag,
 	WhitelistFlag,
 	BloomFilterSizeFlag,
 	CacheFlag,
@@ -96,6 +104,7 @@ var NodeFlags = []Flag{
 	CachePreimagesFlag,
 	ConsensusEngineFlag,
 	MinerGasPriceFlag,
+	BlockBuilderFlag,
 	UnlockedAccountFlag,
 	PasswordFileFlag,
 	VMEnableDebugFlag,
@@ -112,6 +121,8 @@ var NodeFlags = []Flag{
 	IndexAddressUtxos,
 	StartingExpansionNumberFlag,
 	NodeLogLevelFlag,
+	ReadyMaxHeadAgeFlag,
+	ReadyMaxAppendQueueFlag,
 }
 
 var TXPoolFlags = []Flag{
@@ -134,15 +145,21 @@ var RPCFlags = []Flag{
 	HTTPCORSDomainFlag,
 	HTTPVirtualHostsFlag,
 	HTTPApiFlag,
+	HTTPAuthApiFlag,
 	HTTPPathPrefixFlag,
 	WSEnabledFlag,
 	WSListenAddrFlag,
 	WSApiFlag,
+	WSAuthApiFlag,
 	WSAllowedOriginsFlag,
 	WSPathPrefixFlag,
 	PreloadJSFlag,
 	RPCGlobalTxFeeCapFlag,
 	RPCGlobalGasCapFlag,
+	RPCGatewayEnabledFlag,
+	RPCGatewayPortFlag,
+	AuthListenAddrFlag,
+	JWTSecretFlag,
 }
 
 var PeersFlags = []Flag{
@@ -154,6 +171,25 @@ var MetricsFlags = []Flag{
 	MetricsEnabledExpensiveFlag,
 	MetricsHTTPFlag,
 	MetricsPortFlag,
+	TracingEndpointFlag,
+	TracingInsecureFlag,
+	TracingFileFlag,
+	TracingSampleRatioFlag,
+}
+
+var DBMigrateFlags = []Flag{
+	DBMigrateFromFlag,
+	DBMigrateToFlag,
+	DBMigrateLocationFlag,
+}
+
+var ExportFlags = []Flag{
+	ExportFirstFlag,
+	ExportLastFlag,
+}
+
+var SnapshotImportFlags = []Flag{
+	SnapshotTrustedHashFlag,
 }
 
 var (
@@ -188,6 +224,12 @@ var (
 		Value:        "info",
 		Usage:        "log level (trace, debug, info, warn, error, fatal, panic)" + generateEnvDoc(c_GlobalFlagPrefix+"log-level"),
 	}
+
+	LogFormatFlag = Flag{
+		Name:  c_GlobalFlagPrefix + "log-format",
+		Value: "text",
+		Usage: "log output format (text, json)" + generateEnvDoc(c_GlobalFlagPrefix+"log-format"),
+	}
 )
 
 var (
@@ -267,6 +309,12 @@ var (
 		Usage: "Backing database implementation to use ('leveldb' or 'pebble')" + generateEnvDoc(c_NodeFlagPrefix+"db-engine"),
 	}
 
+	GCModeFlag = Flag{
+		Name:  c_NodeFlagPrefix + "gcmode",
+		Value: "full",
+		Usage: `Blockchain garbage collection mode ("full", "archive")` + generateEnvDoc(c_NodeFlagPrefix+"gcmode"),
+	}
+
 	NetworkIdFlag = Flag{
 		Name:  c_NodeFlagPrefix + "networkid",
 		Value: 1,
@@ -279,6 +327,18 @@ var (
 		Usage: "All the slices that are running on this node" + generateEnvDoc(c_NodeFlagPrefix+"slices"),
 	}
 
+	LocalSlicesFlag = Flag{
+		Name:  c_NodeFlagPrefix + "local-slices",
+		Value: "",
+		Usage: "Slices hosted by this process, e.g. prime,region-0,zone-0-0 (all slices if empty)" + generateEnvDoc(c_NodeFlagPrefix+"local-slices"),
+	}
+
+	RemoteSlicesFlag = Flag{
+		Name:  c_NodeFlagPrefix + "remote-slices",
+		Value: "",
+		Usage: "Authenticated RPC endpoints of the dom and sub slices hosted by other processes, e.g. zone-0-1=http://10.0.0.2:7201" + generateEnvDoc(c_NodeFlagPrefix+"remote-slices"),
+	}
+
 	GenesisNonceFlag = Flag{
 		Name:  c_NodeFlagPrefix + "nonce",
 		Value: 0,
@@ -315,6 +375,12 @@ var (
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)" + generateEnvDoc(c_NodeFlagPrefix+"txlookuplimit"),
 	}
 
+	HistoryLimitFlag = Flag{
+		Name:  c_NodeFlagPrefix + "history-limit",
+		Value: quaiconfig.Defaults.HistoryLimit,
+		Usage: fmt.Sprintf("Number of recent blocks to keep the bodies and receipts of in zones, at least %d (0 = entire chain)", core.MinHistoryLimit) + generateEnvDoc(c_NodeFlagPrefix+"history-limit"),
+	}
+
 	WhitelistFlag = Flag{
 		Name:  c_NodeFlagPrefix + "whitelist",
 		Value: "",
@@ -459,6 +525,12 @@ var (
 		Usage: "Minimum gas price for mining a transaction" + generateEnvDoc(c_NodeFlagPrefix+"miner-gasprice"),
 	}
 
+	BlockBuilderFlag = Flag{
+		Name:  c_NodeFlagPrefix + "block-builder",
+		Value: quaiconfig.Defaults.Miner.BlockBuilder,
+		Usage: "Strategy choosing and ordering the transactions of mined blocks (" + strings.Join(core.BlockBuilders, ", ") + ")" + generateEnvDoc(c_NodeFlagPrefix+"block-builder"),
+	}
+
 	UnlockedAccountFlag = Flag{
 		Name:  c_NodeFlagPrefix + "unlock",
 		Value: "",
@@ -560,6 +632,18 @@ var (
 		Value: "info",
 		Usage: "log level (trace, debug, info, warn, error, fatal, panic)" + generateEnvDoc(c_GlobalFlagPrefix+"log-level"),
 	}
+
+	ReadyMaxHeadAgeFlag = Flag{
+		Name:  c_NodeFlagPrefix + "ready-max-head-age",
+		Value: 10 * time.Minute,
+		Usage: "Age of the head of a slice above which /ready reports it as syncing, 0 disables the check" + generateEnvDoc(c_NodeFlagPrefix+"ready-max-head-age"),
+	}
+
+	ReadyMaxAppendQueueFlag = Flag{
+		Name:  c_NodeFlagPrefix + "ready-max-append-queue",
+		Value: 100,
+		Usage: "Number of blocks waiting in the append queue of a slice above which /ready reports it as syncing" + generateEnvDoc(c_NodeFlagPrefix+"ready-max-append-queue"),
+	}
 )
 
 var (
@@ -598,6 +682,12 @@ var (
 		Usage: "API's offered over the HTTP-RPC interface" + generateEnvDoc(c_RPCFlagPrefix+"http-api"),
 	}
 
+	HTTPAuthApiFlag = Flag{
+		Name:  c_RPCFlagPrefix + "http-auth-api",
+		Value: "",
+		Usage: "API's offered over the HTTP-RPC interface only to requests carrying a JWT signed with the --rpc.jwtsecret secret" + generateEnvDoc(c_RPCFlagPrefix+"http-auth-api"),
+	}
+
 	HTTPPathPrefixFlag = Flag{
 		Name:  c_RPCFlagPrefix + "http-rpcprefix",
 		Value: "",
@@ -622,6 +712,12 @@ var (
 		Usage: "API's offered over the WS-RPC interface" + generateEnvDoc(c_RPCFlagPrefix+"ws-api"),
 	}
 
+	WSAuthApiFlag = Flag{
+		Name:  c_RPCFlagPrefix + "ws-auth-api",
+		Value: "",
+		Usage: "API's offered over the WS-RPC interface only to connections opened with a JWT signed with the --rpc.jwtsecret secret" + generateEnvDoc(c_RPCFlagPrefix+"ws-auth-api"),
+	}
+
 	WSAllowedOriginsFlag = Flag{
 		Name:  c_RPCFlagPrefix + "ws-origins",
 		Value: "",
@@ -651,6 +747,30 @@ var (
 		Value: quaiconfig.Defaults.RPCGasCap,
 		Usage: "Sets a cap on gas that can be used in eth_call/estimateGas (0=infinite)" + generateEnvDoc(c_RPCFlagPrefix+"gascap"),
 	}
+
+	AuthListenAddrFlag = Flag{
+		Name:  c_RPCFlagPrefix + "auth-addr",
+		Value: "127.0.0.1",
+		Usage: "Listening interface of the authenticated endpoint used by slices in other processes" + generateEnvDoc(c_RPCFlagPrefix+"auth-addr"),
+	}
+
+	JWTSecretFlag = Flag{
+		Name:  c_RPCFlagPrefix + "jwtsecret",
+		Value: "",
+		Usage: "Path to a hex encoded JWT secret shared by the processes of a node and authenticating the --rpc.http-auth-api and --rpc.ws-auth-api calls (generated in the data directory if empty)" + generateEnvDoc(c_RPCFlagPrefix+"jwtsecret"),
+	}
+
+	RPCGatewayEnabledFlag = Flag{
+		Name:  c_RPCFlagPrefix + "gateway",
+		Value: false,
+		Usage: "Enable the unified RPC gateway which routes requests to the running slices" + generateEnvDoc(c_RPCFlagPrefix+"gateway"),
+	}
+
+	RPCGatewayPortFlag = Flag{
+		Name:  c_RPCFlagPrefix + "gateway-port",
+		Value: 9000,
+		Usage: "Port of the unified RPC gateway" + generateEnvDoc(c_RPCFlagPrefix+"gateway-port"),
+	}
 )
 
 var (
@@ -692,6 +812,80 @@ var (
 		Value: metrics_config.DefaultConfig.Port,
 		Usage: "Metrics HTTP server listening port" + generateEnvDoc(c_MetricsFlagPrefix+"metrics-port"),
 	}
+	TracingEndpointFlag = Flag{
+		Name:  c_MetricsFlagPrefix + "tracing-endpoint",
+		Value: "",
+		Usage: "OTLP gRPC collector address the tracing spans are exported to, e.g. localhost:4317" + generateEnvDoc(c_MetricsFlagPrefix+"tracing-endpoint"),
+	}
+	TracingInsecureFlag = Flag{
+		Name:  c_MetricsFlagPrefix + "tracing-insecure",
+		Value: false,
+		Usage: "Connect to the tracing collector without TLS" + generateEnvDoc(c_MetricsFlagPrefix+"tracing-insecure"),
+	}
+	TracingFileFlag = Flag{
+		Name:  c_MetricsFlagPrefix + "tracing-file",
+		Value: "",
+		Usage: "File the tracing spans are written to as JSON" + generateEnvDoc(c_MetricsFlagPrefix+"tracing-file"),
+	}
+	TracingSampleRatioFlag = Flag{
+		Name:  c_MetricsFlagPrefix + "tracing-sample-ratio",
+		Value: 1.0,
+		Usage: "Fraction of the traces that are recorded" + generateEnvDoc(c_MetricsFlagPrefix+"tracing-sample-ratio"),
+	}
+)
+
+var (
+	// ****************************************
+	// **                                    **
+	// **           DB FLAGS                 **
+	// **                                    **
+	// ****************************************
+	DBMigrateFromFlag = Flag{
+		Name:  c_DBFlagPrefix + "from",
+		Value: "leveldb",
+		Usage: "Database engine to migrate from ('leveldb' or 'pebble')" + generateEnvDoc(c_DBFlagPrefix+"from"),
+	}
+	DBMigrateToFlag = Flag{
+		Name:  c_DBFlagPrefix + "to",
+		Value: "pebble",
+		Usage: "Database engine to migrate to ('leveldb' or 'pebble')" + generateEnvDoc(c_DBFlagPrefix+"to"),
+	}
+	DBMigrateLocationFlag = Flag{
+		Name:  c_DBFlagPrefix + "location",
+		Value: "",
+		Usage: "Slice to migrate, e.g. prime, region-0 or zone-0-0 (all slices if empty)" + generateEnvDoc(c_DBFlagPrefix+"location"),
+	}
+)
+
+var (
+	// ****************************************
+	// **                                    **
+	// **           EXPORT FLAGS             **
+	// **                                    **
+	// ****************************************
+	ExportFirstFlag = Flag{
+		Name:  c_ExportFlagPrefix + "first",
+		Value: uint64(1),
+		Usage: "Number of the first prime block to export" + generateEnvDoc(c_ExportFlagPrefix+"first"),
+	}
+	ExportLastFlag = Flag{
+		Name:  c_ExportFlagPrefix + "last",
+		Value: uint64(0),
+		Usage: "Number of the last prime block to export (head if 0)" + generateEnvDoc(c_ExportFlagPrefix+"last"),
+	}
+)
+
+var (
+	// ****************************************
+	// **                                    **
+	// **           SNAPSHOT FLAGS           **
+	// **                                    **
+	// ****************************************
+	SnapshotTrustedHashFlag = Flag{
+		Name:  c_SnapshotFlagPrefix + "trusted-hash",
+		Value: []string{},
+		Usage: "Trusted head hashes of the slices of the snapshot" + generateEnvDoc(c_SnapshotFlagPrefix+"trusted-hash"),
+	}
 )
 
 /*
@@ -757,6 +951,8 @@ func CreateAndBindFlag(flag Flag, cmd *cobra.Command) {
 		cmd.PersistentFlags().Int64P(flag.GetName(), flag.GetAbbreviation(), val, flag.GetUsage())
 	case uint64:
 		cmd.PersistentFlags().Uint64P(flag.GetName(), flag.GetAbbreviation(), val, flag.GetUsage())
+	case float64:
+		cmd.PersistentFlags().Float64P(flag.GetName(), flag.GetAbbreviation(), val, flag.GetUsage())
 	case *TextMarshalerValue:
 		cmd.PersistentFlags().VarP(val, flag.GetName(), flag.GetAbbreviation(), flag.GetUsage())
 	case *BigIntValue:
@@ -816,6 +1012,11 @@ func setHTTP(cfg *node.Config, nodeLocation common.Location) {
 		cfg.HTTPModules = SplitAndTrim(viper.GetString(HTTPApiFlag.Name))
 	}
 
+	if viper.IsSet(HTTPAuthApiFlag.Name) {
+		cfg.HTTPAuthModules = SplitAndTrim(viper.GetString(HTTPAuthApiFlag.Name))
+		cfg.JWTSecret = JWTSecretPath()
+	}
+
 	if viper.IsSet(HTTPVirtualHostsFlag.Name) {
 		cfg.HTTPVirtualHosts = SplitAndTrim(viper.GetString(HTTPVirtualHostsFlag.Name))
 	}
@@ -857,6 +1058,11 @@ func setWS(cfg *node.Config, nodeLocation common.Location) {
 		cfg.WSModules = SplitAndTrim(viper.GetString(WSApiFlag.Name))
 	}
 
+	if viper.IsSet(WSAuthApiFlag.Name) {
+		cfg.WSAuthModules = SplitAndTrim(viper.GetString(WSAuthApiFlag.Name))
+		cfg.JWTSecret = JWTSecretPath()
+	}
+
 	if viper.IsSet(WSPathPrefixFlag.Name) {
 		cfg.WSPathPrefix = viper.GetString(WSPathPrefixFlag.Name)
 	}
@@ -874,6 +1080,29 @@ func GetWSPort(nodeLocation common.Location) int {
 	panic("node location is not valid")
 }
 
+// setAuth configures the authenticated endpoint serving the dom/sub
+// coordination apis when slices run in separate processes.
+func setAuth(cfg *node.Config, nodeLocation common.Location) {
+	if !SplitSlicesEnabled() {
+		return
+	}
+	cfg.AuthHost = viper.GetString(AuthListenAddrFlag.Name)
+	cfg.AuthPort = GetAuthPort(nodeLocation)
+	cfg.JWTSecret = JWTSecretPath()
+}
+
+func GetAuthPort(nodeLocation common.Location) int {
+	switch nodeLocation.Context() {
+	case common.PRIME_CTX:
+		return 7001
+	case common.REGION_CTX:
+		return 7002 + nodeLocation.Region()
+	case common.ZONE_CTX:
+		return 7200 + 20*nodeLocation.Region() + nodeLocation.Zone()
+	}
+	panic("node location is not valid")
+}
+
 // setGasLimitCeil sets the gas limit ceils based on the network that is
 // running
 func setGasLimitCeil(cfg *quaiconfig.Config) {
@@ -891,6 +1120,9 @@ func setGasLimitCeil(cfg *quaiconfig.Config) {
 	default:
 		cfg.Miner.GasCeil = params.ColosseumGasCeil
 	}
+	if genesis := ReadCustomGenesis(); genesis != nil && genesis.GasCeil != 0 {
+		cfg.Miner.GasCeil = genesis.GasCeil
+	}
 }
 
 // MakeDatabaseHandles raises out the number of allowed file handles per process
@@ -958,6 +1190,7 @@ func MakePasswordList() []string {
 func SetNodeConfig(cfg *node.Config, nodeLocation common.Location, logger *log.Logger) {
 	setHTTP(cfg, nodeLocation)
 	setWS(cfg, nodeLocation)
+	setAuth(cfg, nodeLocation)
 	setNodeUserIdent(cfg)
 	setDataDir(cfg)
 
@@ -1141,6 +1374,36 @@ func setConsensusEngineConfig(cfg *quaiconfig.Config) {
 
 		}
 	}
+	// Custom networks carry their own configs in the genesis
+	if genesis := ReadCustomGenesis(); genesis != nil {
+		minDifficulty := new(big.Int).Div(genesis.Difficulty, common.Big2)
+		quaiAlloc, qiAlloc := genesis.Alloc[cfg.NodeLocation.Name()], genesis.QiAlloc[cfg.NodeLocation.Name()]
+		if quaiAlloc == nil {
+			quaiAlloc = make(map[string]core.GenesisAccount)
+		}
+		if qiAlloc == nil {
+			qiAlloc = make(map[string]core.GenesisUTXO)
+		}
+		if cfg.ConsensusEngine == "blake3" {
+			if genesis.DurationLimit != nil {
+				cfg.Blake3Pow.DurationLimit = genesis.DurationLimit
+			}
+			if genesis.GasCeil != 0 {
+				cfg.Blake3Pow.GasCeil = genesis.GasCeil
+			}
+			cfg.Blake3Pow.MinDifficulty = minDifficulty
+			cfg.Blake3Pow.GenesisAlloc, cfg.Blake3Pow.GenesisQiAlloc = quaiAlloc, qiAlloc
+		} else {
+			if genesis.DurationLimit != nil {
+				cfg.Progpow.DurationLimit = genesis.DurationLimit
+			}
+			if genesis.GasCeil != 0 {
+				cfg.Progpow.GasCeil = genesis.GasCeil
+			}
+			cfg.Progpow.MinDifficulty = minDifficulty
+			cfg.Progpow.GenesisAlloc, cfg.Progpow.GenesisQiAlloc = quaiAlloc, qiAlloc
+		}
+	}
 }
 
 func setWhitelist(cfg *quaiconfig.Config) {
@@ -1247,6 +1510,13 @@ func SetQuaiConfig(stack *node.Node, cfg *quaiconfig.Config, slicesRunning []com
 	// set the gas limit ceil
 	setGasLimitCeil(cfg)
 
+	if viper.IsSet(BlockBuilderFlag.Name) {
+		cfg.Miner.BlockBuilder = viper.GetString(BlockBuilderFlag.Name)
+		if _, err := core.NewBlockBuilder(cfg.Miner.BlockBuilder, nodeLocation); err != nil {
+			Fatalf("--%s: %v", BlockBuilderFlag.Name, err)
+		}
+	}
+
 	// Cap the cache allowance and tune the garbage collector
 	mem, err := gopsutil.VirtualMemory()
 	if err == nil {
@@ -1287,6 +1557,10 @@ func SetQuaiConfig(stack *node.Node, cfg *quaiconfig.Config, slicesRunning []com
 	if viper.IsSet(CacheNoPrefetchFlag.Name) {
 		cfg.NoPrefetch = viper.GetBool(CacheNoPrefetchFlag.Name)
 	}
+	if gcmode := viper.GetString(GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
+		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
+	}
+	cfg.NoPruning = viper.GetString(GCModeFlag.Name) == "archive"
 	// Read the value from the flag no matter if it's set or not.
 	cfg.Preimages = viper.GetBool(CachePreimagesFlag.Name)
 	if cfg.NoPruning && !cfg.Preimages {
@@ -1296,6 +1570,12 @@ func SetQuaiConfig(stack *node.Node, cfg *quaiconfig.Config, slicesRunning []com
 	if viper.IsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = viper.GetUint64(TxLookupLimitFlag.Name)
 	}
+	if viper.IsSet(HistoryLimitFlag.Name) {
+		cfg.HistoryLimit = viper.GetUint64(HistoryLimitFlag.Name)
+		if cfg.HistoryLimit != 0 && cfg.HistoryLimit < core.MinHistoryLimit {
+			Fatalf("--%s must be 0 or at least %d", HistoryLimitFlag.Name, core.MinHistoryLimit)
+		}
+	}
 	if viper.IsSet(CacheFlag.Name) || viper.IsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = viper.GetInt(CacheFlag.Name) * viper.GetInt(CacheTrieFlag.Name) / 100
 	}
@@ -1406,7 +1686,15 @@ func SetQuaiConfig(stack *node.Node, cfg *quaiconfig.Config, slicesRunning []com
 			cfg.Miner.GasPrice = big.NewInt(1)
 		}
 	}
-	if viper.GetString(EnvironmentFlag.Name) != params.LocalName {
+	// A custom network initialized with `go-quai init` takes precedence over
+	// the environment, the genesis hash check refuses a mismatched database
+	if genesis := ReadCustomGenesis(); genesis != nil {
+		if !viper.IsSet(NetworkIdFlag.Name) && genesis.Config.ChainID != nil {
+			cfg.NetworkId = genesis.Config.ChainID.Uint64()
+		}
+		cfg.Genesis = genesis
+		cfg.DefaultGenesisHash = genesis.ToBlock(StartingExpansionNumber()).Hash()
+	} else if viper.GetString(EnvironmentFlag.Name) != params.LocalName {
 		cfg.Genesis.Nonce = viper.GetUint64(GenesisNonceFlag.Name)
 	}
 
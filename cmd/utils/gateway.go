@@ -0,0 +1,376 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/crypto"
+	"github.com/dominant-strategies/go-quai/log"
+)
+
+const (
+	// c_gatewayMaxRequestSize is the largest request body the gateway will
+	// buffer in order to inspect it, mirroring the limit of the rpc servers
+	c_gatewayMaxRequestSize = 1024 * 1024 * 5
+	// c_gatewayInvalidRequest is the json-rpc error code returned when a
+	// request cannot be routed to a slice
+	c_gatewayInvalidRequest = -32600
+)
+
+var (
+	errGatewayUnroutable = errors.New("request does not reference an address of an active slice, use the /prime, /region/<r> or /zone/<r>-<z> endpoints")
+	errGatewayMixedBatch = errors.New("batch references addresses in more than one slice")
+)
+
+// RPCGateway serves a single RPC endpoint in front of the per slice HTTP and
+// WebSocket servers. Requests are routed to a slice either by path (/prime,
+// /region/<r>, /zone/<r>-<z>) or, on the root path, by the location of the
+// address the request operates on.
+type RPCGateway struct {
+	host      string
+	port      int
+	expansion func() uint8 // current expansion number, bounding the zones addresses route to
+	server    *http.Server
+	listener  net.Listener
+}
+
+// NewRPCGateway creates the gateway from the rpc configuration flags.
+func NewRPCGateway(expansion func() uint8) *RPCGateway {
+	host := "127.0.0.1"
+	if viper.IsSet(HTTPListenAddrFlag.Name) {
+		host = viper.GetString(HTTPListenAddrFlag.Name)
+	}
+	return &RPCGateway{
+		host:      host,
+		port:      viper.GetInt(RPCGatewayPortFlag.Name),
+		expansion: expansion,
+	}
+}
+
+// Start opens the gateway listener and begins serving requests.
+func (g *RPCGateway) Start() error {
+	if !viper.GetBool(HTTPEnabledFlag.Name) && !viper.GetBool(WSEnabledFlag.Name) {
+		log.Global.Warn("RPC gateway enabled without the HTTP or WS servers, requests will fail")
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(g.host, strconv.Itoa(g.port)))
+	if err != nil {
+		return err
+	}
+	g.listener = listener
+	g.server = &http.Server{Handler: g, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Global.WithFields(log.Fields{
+					"error": r,
+				}).Error("Go-Quai Panicked")
+			}
+		}()
+		if err := g.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Global.WithField("err", err).Error("RPC gateway stopped")
+		}
+	}()
+	log.Global.WithField("url", "http://"+listener.Addr().String()).Info("RPC gateway started")
+	return nil
+}
+
+// Stop shuts the gateway down.
+func (g *RPCGateway) Stop() {
+	if g.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	g.server.Shutdown(ctx)
+	log.Global.WithField("url", "http://"+g.listener.Addr().String()).Info("RPC gateway stopped")
+}
+
+// ServeHTTP routes the request to the slice it is addressed to.
+func (g *RPCGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	location, rest, routed, err := parseGatewayPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !routed {
+		if isWebsocketRequest(r) {
+			http.Error(w, "websocket connections must use the /prime, /region/<r> or /zone/<r>-<z> endpoints", http.StatusBadRequest)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, c_gatewayMaxRequestSize+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body) > c_gatewayMaxRequestSize {
+			http.Error(w, "content length too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		location, err = routeRPCRequest(body, g.expansion())
+		if err != nil {
+			writeGatewayError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		rest = "/"
+	}
+	g.proxy(location, rest, isWebsocketRequest(r)).ServeHTTP(w, r)
+}
+
+// proxy returns a reverse proxy forwarding to the HTTP or WS server of the
+// given slice. The Host header of the client is kept so that the virtual
+// host checks of the slice still apply.
+func (g *RPCGateway) proxy(location common.Location, rest string, ws bool) *httputil.ReverseProxy {
+	port, prefix := GetHttpPort(location), viper.GetString(HTTPPathPrefixFlag.Name)
+	if ws {
+		port, prefix = GetWSPort(location), viper.GetString(WSPathPrefixFlag.Name)
+	}
+	target := &url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(gatewayDialHost(g.host), strconv.Itoa(port)),
+		Path:   strings.TrimSuffix(prefix, "/") + rest,
+	}
+	return &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = target.Path
+			req.URL.RawPath = ""
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Global.WithFields(log.Fields{
+				"location": location.Name(),
+				"err":      err,
+			}).Debug("RPC gateway failed to reach slice")
+			http.Error(w, fmt.Sprintf("slice %s is not reachable", location.Name()), http.StatusBadGateway)
+		},
+	}
+}
+
+// gatewayDialHost returns the address the gateway uses to reach the slice
+// servers listening on the given interface.
+func gatewayDialHost(host string) string {
+	switch host {
+	case "", "0.0.0.0", "::":
+		return "127.0.0.1"
+	}
+	return host
+}
+
+// parseGatewayPath extracts the slice location from paths of the form
+// /prime, /region/<r> and /zone/<r>-<z>, returning the remainder of the path.
+// The root path is reported as not routed.
+func parseGatewayPath(path string) (common.Location, string, bool, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+	if parts[0] == "" {
+		return nil, "", false, nil
+	}
+	var (
+		location common.Location
+		rest     []string
+	)
+	switch parts[0] {
+	case "prime":
+		location, rest = common.Location{}, parts[1:]
+	case "region":
+		if len(parts) < 2 {
+			return nil, "", false, errors.New("missing region index")
+		}
+		region, err := strconv.ParseUint(parts[1], 10, 8)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("invalid region %q", parts[1])
+		}
+		location, rest = common.Location{byte(region)}, parts[2:]
+	case "zone":
+		if len(parts) < 2 {
+			return nil, "", false, errors.New("missing zone index")
+		}
+		indices := strings.Split(parts[1], "-")
+		if len(indices) != 2 {
+			return nil, "", false, fmt.Errorf("invalid zone %q, expected <region>-<zone>", parts[1])
+		}
+		region, err := strconv.ParseUint(indices[0], 10, 8)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("invalid zone %q", parts[1])
+		}
+		zone, err := strconv.ParseUint(indices[1], 10, 8)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("invalid zone %q", parts[1])
+		}
+		location, rest = common.Location{byte(region), byte(zone)}, parts[2:]
+	default:
+		return nil, "", false, fmt.Errorf("unknown slice path %q", path)
+	}
+	if location.Region() >= common.MaxRegions || (location.Context() == common.ZONE_CTX && location.Zone() >= common.MaxZones) {
+		return nil, "", false, fmt.Errorf("slice %s does not exist", location.Name())
+	}
+	return location, "/" + strings.Join(rest, "/"), true, nil
+}
+
+// gatewayMessage is the subset of a json-rpc request needed for routing.
+type gatewayMessage struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// routeRPCRequest determines the slice a single or batched json-rpc request
+// is addressed to. Every routable call in a batch must resolve to the same
+// slice, which must be active at the given expansion number.
+func routeRPCRequest(body []byte, expansion uint8) (common.Location, error) {
+	var msgs []gatewayMessage
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &msgs); err != nil {
+			return nil, err
+		}
+	} else {
+		var msg gatewayMessage
+		if err := json.Unmarshal(trimmed, &msg); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	var location common.Location
+	for _, msg := range msgs {
+		msgLocation, err := messageLocation(msg)
+		if err != nil {
+			return nil, err
+		}
+		if msgLocation == nil {
+			continue
+		}
+		if !activeZone(msgLocation, expansion) {
+			return nil, errGatewayUnroutable
+		}
+		if location != nil && !location.Equal(msgLocation) {
+			return nil, errGatewayMixedBatch
+		}
+		location = msgLocation
+	}
+	if location == nil {
+		return nil, errGatewayUnroutable
+	}
+	return location, nil
+}
+
+// messageLocation returns the location of the address a call operates on,
+// or nil if the call does not carry one. Raw transactions are routed by
+// their sender.
+func messageLocation(msg gatewayMessage) (common.Location, error) {
+	if len(msg.Params) == 0 {
+		return nil, nil
+	}
+	if strings.HasSuffix(msg.Method, "_sendRawTransaction") {
+		var input hexutil.Bytes
+		if err := json.Unmarshal(msg.Params[0], &input); err != nil {
+			return nil, err
+		}
+		return rawTransactionLocation(input)
+	}
+	var addr string
+	if err := json.Unmarshal(msg.Params[0], &addr); err == nil {
+		return addressLocation(addr), nil
+	}
+	// Calls such as quai_call and quai_estimateGas take a call object,
+	// those are routed by the recipient and then by the sender.
+	var args struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.Unmarshal(msg.Params[0], &args); err == nil {
+		if location := addressLocation(args.To); location != nil {
+			return location, nil
+		}
+		return addressLocation(args.From), nil
+	}
+	return nil, nil
+}
+
+// addressLocation returns the zone of a hex encoded address, or nil if the
+// string is not an address.
+func addressLocation(addr string) common.Location {
+	if !common.IsHexAddress(addr) {
+		return nil
+	}
+	return *common.HexToAddressBytes(addr).Location()
+}
+
+// rawTransactionLocation returns the zone of the sender of a protobuf
+// encoded transaction. Qi transactions are routed by their first input.
+func rawTransactionLocation(input []byte) (common.Location, error) {
+	protoTx := new(types.ProtoTransaction)
+	if err := proto.Unmarshal(input, protoTx); err != nil {
+		return nil, err
+	}
+	// The location is only used to construct addresses, the zone is taken
+	// from the recovered address bytes
+	location := common.Location{0, 0}
+	tx := new(types.Transaction)
+	if err := tx.ProtoDecode(protoTx, location); err != nil {
+		return nil, err
+	}
+	if tx.Type() == types.QiTxType {
+		if len(tx.TxIn()) == 0 {
+			return nil, errors.New("qi transaction has no inputs")
+		}
+		return common.LocationFromAddressBytes(crypto.PubkeyBytesToAddress(tx.TxIn()[0].PubKey, location).Bytes()), nil
+	}
+	from, err := types.Sender(types.NewSigner(tx.ChainId(), location), tx)
+	if err != nil {
+		return nil, err
+	}
+	return common.LocationFromAddressBytes(from.Bytes()), nil
+}
+
+// activeZone reports whether the zone derived from an address exists at the
+// given expansion number.
+func activeZone(location common.Location, expansion uint8) bool {
+	if location.Region() >= common.MaxRegions || location.Zone() >= common.MaxZones {
+		return false
+	}
+	regions, zones := common.GetHierarchySizeForExpansionNumber(expansion)
+	return location.Region() < int(regions) && location.Zone() < int(zones)
+}
+
+// isWebsocketRequest checks the header of an http request for a websocket
+// upgrade request.
+func isWebsocketRequest(r *http.Request) bool {
+	return strings.ToLower(r.Header.Get("Upgrade")) == "websocket" &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// writeGatewayError replies with a json-rpc error for requests that could not
+// be routed.
+func writeGatewayError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      nil,
+		"error": map[string]interface{}{
+			"code":    c_gatewayInvalidRequest,
+			"message": err.Error(),
+		},
+	})
+}
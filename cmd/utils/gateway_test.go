@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGatewayPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		location common.Location
+		rest     string
+		routed   bool
+		fail     bool
+	}{
+		{path: "/", routed: false},
+		{path: "/prime", location: common.Location{}, rest: "/", routed: true},
+		{path: "/region/2", location: common.Location{2}, rest: "/", routed: true},
+		{path: "/zone/0-2", location: common.Location{0, 2}, rest: "/", routed: true},
+		{path: "/zone/1-0/extra", location: common.Location{1, 0}, rest: "/extra", routed: true},
+		{path: "/zone/1", fail: true},
+		{path: "/region/16", fail: true},
+		{path: "/unknown", fail: true},
+	}
+	for _, tt := range tests {
+		location, rest, routed, err := parseGatewayPath(tt.path)
+		if tt.fail {
+			require.Error(t, err, tt.path)
+			continue
+		}
+		require.NoError(t, err, tt.path)
+		require.Equal(t, tt.routed, routed, tt.path)
+		if routed {
+			require.True(t, tt.location.Equal(location), tt.path)
+			require.Equal(t, tt.rest, rest, tt.path)
+		}
+	}
+}
+
+func TestRouteRPCRequest(t *testing.T) {
+	location, err := routeRPCRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"quai_getBalance","params":["0x1200000000000000000000000000000000000000","latest"]}`), common.MaxExpansionNumber)
+	require.NoError(t, err)
+	require.True(t, common.Location{1, 2}.Equal(location))
+
+	location, err = routeRPCRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"quai_call","params":[{"to":"0x0100000000000000000000000000000000000000"},"latest"]}`), common.MaxExpansionNumber)
+	require.NoError(t, err)
+	require.True(t, common.Location{0, 1}.Equal(location))
+
+	_, err = routeRPCRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"quai_blockNumber","params":[]}`), common.MaxExpansionNumber)
+	require.ErrorIs(t, err, errGatewayUnroutable)
+
+	_, err = routeRPCRequest([]byte(`[{"jsonrpc":"2.0","id":1,"method":"quai_getBalance","params":["0x0000000000000000000000000000000000000000","latest"]},{"jsonrpc":"2.0","id":2,"method":"quai_getBalance","params":["0x0100000000000000000000000000000000000000","latest"]}]`), common.MaxExpansionNumber)
+	require.ErrorIs(t, err, errGatewayMixedBatch)
+
+	// Addresses of zones not active at the expansion number are not routed
+	_, err = routeRPCRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"quai_getBalance","params":["0x1200000000000000000000000000000000000000","latest"]}`), 1)
+	require.ErrorIs(t, err, errGatewayUnroutable)
+
+	location, err = routeRPCRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"quai_getBalance","params":["0x0100000000000000000000000000000000000000","latest"]}`), 1)
+	require.NoError(t, err)
+	require.True(t, common.Location{0, 1}.Equal(location))
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/internal/quaiapi"
+	"github.com/dominant-strategies/go-quai/params"
+	"github.com/dominant-strategies/go-quai/quai"
+)
+
+// c_healthProbeKey is the key read from the database of a slice to check
+// that it is still open
+var c_healthProbeKey = []byte("healthProbe")
+
+// badHashChecks caches, for each slice, whether a block of the bad hashes
+// list is in its database. The blocks of the list are rejected on append, so
+// the lookup only runs on the first probe after the slice started.
+var badHashChecks = struct {
+	sync.Mutex
+	results map[string]badHashCheck
+}{results: make(map[string]badHashCheck)}
+
+type badHashCheck struct {
+	backend quaiapi.Backend
+	exists  bool
+}
+
+// badHashExistsInChain returns the cached result of the bad hashes lookup of
+// the backend of the slice at the location
+func badHashExistsInChain(location common.Location, backend quaiapi.Backend) bool {
+	badHashChecks.Lock()
+	defer badHashChecks.Unlock()
+	name := SliceName(location)
+	if check, ok := badHashChecks.results[name]; ok && check.backend == backend {
+		return check.exists
+	}
+	exists := backend.BadHashExistsInChain()
+	badHashChecks.results[name] = badHashCheck{backend: backend, exists: exists}
+	return exists
+}
+
+// sliceHealth is the status of a slice reported by the health endpoints
+type sliceHealth struct {
+	Location        string      `json:"location"`
+	Healthy         bool        `json:"healthy"`
+	Ready           bool        `json:"ready"`
+	Reasons         []string    `json:"reasons,omitempty"`
+	DatabaseOpen    bool        `json:"databaseOpen"`
+	ProcessingState bool        `json:"processingState"`
+	HeadNumber      uint64      `json:"headNumber"`
+	HeadHash        common.Hash `json:"headHash"`
+	HeadAge         uint64      `json:"headAge"` // seconds since the head was mined
+	AppendQueue     int         `json:"appendQueue"`
+	BadHashInChain  bool        `json:"badHashInChain"`
+}
+
+// healthReport is the body of the /health and /ready responses
+type healthReport struct {
+	Healthy bool          `json:"healthy"`
+	Ready   bool          `json:"ready"`
+	Reasons []string      `json:"reasons,omitempty"`
+	Peers   int           `json:"peers"`
+	Slices  []sliceHealth `json:"slices"`
+}
+
+// newHealthHandler returns the handler of the /health endpoint, or of the
+// /ready endpoint if ready is set. Both reply with the status of every slice
+// running in this process, and with 503 if the node is unhealthy or, for
+// /ready, not ready to serve requests.
+func newHealthHandler(hc *HierarchicalCoordinator, consensus quai.ConsensusAPI, ready bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := hc.healthReport(consensus)
+		status := http.StatusOK
+		if !report.Healthy || (ready && !report.Ready) {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// healthReport checks the status of the slices running in this process.
+//
+// A slice is unhealthy if its backend or database is gone, or if a block of
+// the bad hashes list is part of its chain. A healthy slice is not ready
+// while it is syncing: its head is older than --node.ready-max-head-age or
+// its append queue holds more than --node.ready-max-append-queue blocks.
+// Outside of the local environment the node is not ready without peers.
+func (hc *HierarchicalCoordinator) healthReport(consensus quai.ConsensusAPI) healthReport {
+	hc.nodesMu.RLock()
+	locations := make([]common.Location, 0, len(hc.nodes))
+	for _, sn := range hc.nodes {
+		locations = append(locations, sn.location)
+	}
+	hc.nodesMu.RUnlock()
+	sort.Slice(locations, func(i, j int) bool {
+		return SliceName(locations[i]) < SliceName(locations[j])
+	})
+
+	report := healthReport{
+		Healthy: true,
+		Ready:   true,
+		Peers:   hc.p2p.PeerCount(),
+		Slices:  make([]sliceHealth, 0, len(locations)),
+	}
+	if report.Peers == 0 && viper.GetString(EnvironmentFlag.Name) != params.LocalName {
+		report.Ready = false
+		report.Reasons = append(report.Reasons, "no peers connected")
+	}
+	for _, location := range locations {
+		slice := sliceStatus(consensus, location)
+		report.Healthy = report.Healthy && slice.Healthy
+		report.Ready = report.Ready && slice.Ready
+		report.Slices = append(report.Slices, slice)
+	}
+	return report
+}
+
+// sliceStatus checks the status of the slice at the location
+func sliceStatus(consensus quai.ConsensusAPI, location common.Location) sliceHealth {
+	status := sliceHealth{Location: location.Name()}
+	unhealthy := func(reason string) sliceHealth {
+		status.Reasons = append(status.Reasons, reason)
+		return status
+	}
+
+	backendPtr := consensus.GetBackend(location)
+	if backendPtr == nil || *backendPtr == nil {
+		return unhealthy("slice backend is not running")
+	}
+	backend := *backendPtr
+	if _, err := backend.ChainDb().Has(c_healthProbeKey); err != nil {
+		return unhealthy(fmt.Sprintf("database unavailable: %v", err))
+	}
+	status.DatabaseOpen = true
+	status.ProcessingState = backend.ProcessingState()
+
+	head := backend.CurrentHeader()
+	if head == nil {
+		return unhealthy("no current header")
+	}
+	status.HeadNumber = head.NumberU64(location.Context())
+	status.HeadHash = head.Hash()
+	if now := uint64(time.Now().Unix()); now > head.Time() {
+		status.HeadAge = now - head.Time()
+	}
+	status.AppendQueue = backend.AppendQueueLen()
+	status.BadHashInChain = badHashExistsInChain(location, backend)
+	if status.BadHashInChain {
+		return unhealthy("a bad hash is part of the chain")
+	}
+	status.Healthy = true
+
+	status.Ready = true
+	if maxAge := viper.GetDuration(ReadyMaxHeadAgeFlag.Name); maxAge > 0 && time.Duration(status.HeadAge)*time.Second > maxAge {
+		status.Ready = false
+		status.Reasons = append(status.Reasons, fmt.Sprintf("head is %ds old, the slice is syncing", status.HeadAge))
+	}
+	if maxQueue := viper.GetInt(ReadyMaxAppendQueueFlag.Name); status.AppendQueue > maxQueue {
+		status.Ready = false
+		status.Reasons = append(status.Reasons, fmt.Sprintf("%d blocks in the append queue, the slice is behind its peers", status.AppendQueue))
+	}
+	return status
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/internal/quaiapi"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/quai"
+)
+
+// healthBackend implements the parts of the backend read by the health checks
+type healthBackend struct {
+	quaiapi.Backend
+	db          ethdb.Database
+	head        *types.WorkObject
+	appendQueue int
+	badHash     bool
+	badChecks   int
+}
+
+func (b *healthBackend) ChainDb() ethdb.Database          { return b.db }
+func (b *healthBackend) ProcessingState() bool            { return true }
+func (b *healthBackend) CurrentHeader() *types.WorkObject { return b.head }
+func (b *healthBackend) AppendQueueLen() int              { return b.appendQueue }
+func (b *healthBackend) BadHashExistsInChain() bool {
+	b.badChecks++
+	return b.badHash
+}
+
+type healthConsensus struct {
+	quai.ConsensusAPI
+	backends map[string]quaiapi.Backend
+}
+
+func (c *healthConsensus) GetBackend(location common.Location) *quaiapi.Backend {
+	backend, ok := c.backends[SliceName(location)]
+	if !ok {
+		return nil
+	}
+	return &backend
+}
+
+func newHealthBackend(age time.Duration) *healthBackend {
+	head := types.EmptyHeader(common.ZONE_CTX)
+	head.WorkObjectHeader().SetNumber(big.NewInt(10))
+	head.WorkObjectHeader().SetTime(uint64(time.Now().Add(-age).Unix()))
+	return &healthBackend{db: rawdb.NewMemoryDatabase(log.Global), head: head}
+}
+
+func TestSliceStatus(t *testing.T) {
+	viper.Set(ReadyMaxHeadAgeFlag.Name, time.Minute)
+	viper.Set(ReadyMaxAppendQueueFlag.Name, 10)
+	defer viper.Reset()
+
+	location := common.Location{0, 0}
+	backend := newHealthBackend(0)
+	consensus := &healthConsensus{backends: map[string]quaiapi.Backend{SliceName(location): backend}}
+
+	status := sliceStatus(consensus, location)
+	require.True(t, status.Healthy)
+	require.True(t, status.Ready, status.Reasons)
+	require.Equal(t, uint64(10), status.HeadNumber)
+
+	// A stale head or a long append queue means the slice is syncing
+	backend.head = newHealthBackend(time.Hour).head
+	status = sliceStatus(consensus, location)
+	require.True(t, status.Healthy)
+	require.False(t, status.Ready)
+
+	backend.head = newHealthBackend(0).head
+	backend.appendQueue = 11
+	status = sliceStatus(consensus, location)
+	require.True(t, status.Healthy)
+	require.False(t, status.Ready)
+
+	// The bad hashes are looked up once for each start of the slice
+	require.Equal(t, 1, backend.badChecks)
+
+	// A bad hash in the chain or a closed database is unhealthy
+	backend = newHealthBackend(0)
+	backend.badHash = true
+	consensus.backends[SliceName(location)] = backend
+	status = sliceStatus(consensus, location)
+	require.False(t, status.Healthy)
+
+	backend = newHealthBackend(0)
+	consensus.backends[SliceName(location)] = backend
+	status = sliceStatus(consensus, location)
+	require.True(t, status.Healthy)
+	backend.db.Close()
+	status = sliceStatus(consensus, location)
+	require.False(t, status.Healthy)
+	require.False(t, status.DatabaseOpen)
+
+	// A slice without a backend is unhealthy
+	status = sliceStatus(consensus, common.Location{0, 1})
+	require.False(t, status.Healthy)
+}
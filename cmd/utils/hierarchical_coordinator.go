@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"runtime/debug"
 	"sync"
@@ -11,7 +12,10 @@ import (
 	"github.com/dominant-strategies/go-quai/core/types"
 	"github.com/dominant-strategies/go-quai/event"
 	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/node"
 	"github.com/dominant-strategies/go-quai/quai"
+	"github.com/dominant-strategies/go-quai/quaiclient"
+	"github.com/dominant-strategies/go-quai/rpc"
 	"github.com/syndtr/goleveldb/leveldb"
 	"google.golang.org/protobuf/proto"
 )
@@ -26,6 +30,14 @@ var (
 	c_currentExpansionNumberKey = []byte("cexp")
 )
 
+// sliceNode is a slice node started by the coordinator
+type sliceNode struct {
+	location common.Location
+	stack    *node.Node
+	quit     chan struct{} // closed to stop this node alone
+	done     chan struct{} // closed once the node has shut down
+}
+
 type HierarchicalCoordinator struct {
 	db *leveldb.DB
 	// APIS
@@ -35,9 +47,24 @@ type HierarchicalCoordinator struct {
 	logLevel string
 
 	currentExpansionNumber uint8
+	expansionMu            sync.RWMutex // guards currentExpansionNumber for readers outside the coordinator
 
 	slicesRunning []common.Location
 
+	// localSlices are the slices hosted by this process, nil if the process
+	// hosts the whole hierarchy. The dom and sub slices hosted elsewhere are
+	// reached over their authenticated endpoints listed in remoteSlices.
+	localSlices  []common.Location
+	remoteSlices map[string]string
+	jwtSecret    []byte
+
+	// nodes are the slice nodes running in this process, keyed by slice
+	// name. sliceMu serializes the changes to the running slices, nodesMu
+	// guards the map for the readers that must not wait on a restart.
+	nodes   map[string]*sliceNode
+	nodesMu sync.RWMutex
+	sliceMu sync.Mutex
+
 	expansionCh  chan core.ExpansionEvent
 	expansionSub event.Subscription
 	wg           *sync.WaitGroup
@@ -59,10 +86,22 @@ func NewHierarchicalCoordinator(p2p quai.NetworkingAPI, logLevel string, nodeWg
 		p2p:                         p2p,
 		logLevel:                    logLevel,
 		slicesRunning:               GetRunningZones(),
+		localSlices:                 GetLocalSlices(),
+		remoteSlices:                GetRemoteSlices(),
+		nodes:                       make(map[string]*sliceNode),
 		treeExpansionTriggerStarted: false,
 		quitCh:                      quitCh,
 	}
 
+	if SplitSlicesEnabled() {
+		// Obtain the secret before the nodes start so that all the slices of
+		// this process share it
+		hc.jwtSecret, err = node.ObtainJWTSecret(JWTSecretPath())
+		if err != nil {
+			log.Global.WithField("err", err).Fatal("Error obtaining the jwt secret")
+		}
+	}
+
 	if startingExpansionNumber > common.MaxExpansionNumber {
 		log.Global.Fatal("Starting expansion number is greater than the maximum expansion number")
 	}
@@ -73,6 +112,10 @@ func NewHierarchicalCoordinator(p2p quai.NetworkingAPI, logLevel string, nodeWg
 	}
 	hc.currentExpansionNumber = uint8(expansionNumber)
 
+	if err := hc.checkRemoteSlices(); err != nil {
+		log.Global.WithField("err", err).Fatal("Invalid remote slices")
+	}
+
 	// Start the QuaiBackend and set the consensus backend
 	backend, err := hc.StartQuaiBackend()
 	if err != nil {
@@ -84,6 +127,12 @@ func NewHierarchicalCoordinator(p2p quai.NetworkingAPI, logLevel string, nodeWg
 }
 
 func (hc *HierarchicalCoordinator) StartHierarchicalCoordinator() error {
+	if hc.localSlices != nil {
+		// The tree expansion starts new slices inside this process, which is
+		// not possible when the hierarchy is spread over several processes
+		log.Global.Warn("Slices are hosted by separate processes, tree expansion requires restarting them with the new expansion number")
+		return nil
+	}
 	// get the prime backend
 	primeApiBackend := *hc.consensus.GetBackend(common.Location{})
 	if primeApiBackend == nil {
@@ -102,6 +151,9 @@ func (hc *HierarchicalCoordinator) StartHierarchicalCoordinator() error {
 
 // Create a new instance of the QuaiBackend consensus service
 func (hc *HierarchicalCoordinator) StartQuaiBackend() (*quai.QuaiBackend, error) {
+	hc.sliceMu.Lock()
+	defer hc.sliceMu.Unlock()
+
 	quaiBackend, _ := quai.NewQuaiBackend()
 	// Set the consensus backend and subscribe to the new topics
 	hc.p2p.SetConsensusBackend(quaiBackend)
@@ -110,43 +162,124 @@ func (hc *HierarchicalCoordinator) StartQuaiBackend() (*quai.QuaiBackend, error)
 
 	currentRegions, currentZones := common.GetHierarchySizeForExpansionNumber(hc.currentExpansionNumber)
 	// Start nodes in separate goroutines
-	hc.startNode("prime.log", quaiBackend, nil, nil)
+	if hc.hostsSlice(common.Location{}) {
+		hc.startNode("prime.log", quaiBackend, nil, nil)
+	}
 	for i := 0; i < int(currentRegions); i++ {
-		nodelogsFileName := "region-" + fmt.Sprintf("%d", i) + ".log"
-		hc.startNode(nodelogsFileName, quaiBackend, common.Location{byte(i)}, nil)
+		if hc.hostsSlice(common.Location{byte(i)}) {
+			nodelogsFileName := "region-" + fmt.Sprintf("%d", i) + ".log"
+			hc.startNode(nodelogsFileName, quaiBackend, common.Location{byte(i)}, nil)
+		}
 	}
 	for i := 0; i < int(currentRegions); i++ {
 		for j := 0; j < int(currentZones); j++ {
-			nodelogsFileName := "zone-" + fmt.Sprintf("%d", i) + "-" + fmt.Sprintf("%d", j) + ".log"
-			hc.startNode(nodelogsFileName, quaiBackend, common.Location{byte(i), byte(j)}, nil)
+			if hc.hostsSlice(common.Location{byte(i), byte(j)}) {
+				nodelogsFileName := "zone-" + fmt.Sprintf("%d", i) + "-" + fmt.Sprintf("%d", j) + ".log"
+				hc.startNode(nodelogsFileName, quaiBackend, common.Location{byte(i), byte(j)}, nil)
+			}
 		}
 	}
 
 	// Set the Dom Interface for all the regions and zones
 	for i := 0; i < int(currentRegions); i++ {
-		primeBackend := *quaiBackend.GetBackend(common.Location{})
-		regionBackend := *quaiBackend.GetBackend(common.Location{byte(i)})
-		// set the Prime with the sub interfaces
-		primeBackend.SetSubInterface(regionBackend, common.Location{byte(i)})
-		// set the Dom Interface for each region
-		regionBackend.SetDomInterface(primeBackend)
+		hc.connectDomSub(quaiBackend, common.Location{}, common.Location{byte(i)})
 	}
 	for i := 0; i < int(currentRegions); i++ {
-		regionBackend := *quaiBackend.GetBackend(common.Location{byte(i)})
 		for j := 0; j < int(currentZones); j++ {
-			zoneBackend := *quaiBackend.GetBackend(common.Location{byte(i), byte(j)})
-			// Set the Sub Interface for each of the regions
-			regionBackend.SetSubInterface(zoneBackend, common.Location{byte(i), byte(j)})
-			// Set the Dom Interface for each of the zones
-			zoneBackend.SetDomInterface(regionBackend)
+			hc.connectDomSub(quaiBackend, common.Location{byte(i)}, common.Location{byte(i), byte(j)})
 		}
 	}
 	return quaiBackend, nil
 }
 
+// hostsSlice returns true if the slice at the location runs in this process
+func (hc *HierarchicalCoordinator) hostsSlice(location common.Location) bool {
+	if hc.localSlices == nil {
+		return true
+	}
+	for _, slice := range hc.localSlices {
+		if slice.Equal(location) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRemoteSlices verifies that every dom or sub of the slices hosted by
+// this process, at the current expansion, is either hosted here too or has a
+// remote endpoint configured
+func (hc *HierarchicalCoordinator) checkRemoteSlices() error {
+	if hc.localSlices == nil {
+		return nil
+	}
+	currentRegions, currentZones := common.GetHierarchySizeForExpansionNumber(hc.currentExpansionNumber)
+	check := func(dom common.Location, sub common.Location) error {
+		for _, pair := range [][2]common.Location{{dom, sub}, {sub, dom}} {
+			local, target := pair[0], pair[1]
+			if !hc.hostsSlice(local) || hc.hostsSlice(target) {
+				continue
+			}
+			if _, ok := hc.remoteSlices[SliceName(target)]; !ok {
+				return fmt.Errorf("%s is not hosted by this process and has no endpoint in --%s, it is needed by %s", SliceName(target), RemoteSlicesFlag.Name, SliceName(local))
+			}
+		}
+		return nil
+	}
+	for i := 0; i < int(currentRegions); i++ {
+		if err := check(common.Location{}, common.Location{byte(i)}); err != nil {
+			return err
+		}
+		for j := 0; j < int(currentZones); j++ {
+			if err := check(common.Location{byte(i)}, common.Location{byte(i), byte(j)}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// connectDomSub sets the sub interface of the dom and the dom interface of
+// the sub for the slices hosted by this process
+func (hc *HierarchicalCoordinator) connectDomSub(quaiBackend quai.ConsensusAPI, dom common.Location, sub common.Location) {
+	if hc.hostsSlice(dom) {
+		domBackend := *quaiBackend.GetBackend(dom)
+		domBackend.SetSubInterface(hc.sliceInterface(quaiBackend, sub, dom), sub)
+	}
+	if hc.hostsSlice(sub) {
+		subBackend := *quaiBackend.GetBackend(sub)
+		subBackend.SetDomInterface(hc.sliceInterface(quaiBackend, dom, sub))
+	}
+}
+
+// sliceInterface returns the interface the local slice uses to reach the
+// target slice, connecting to its authenticated endpoint if the target is
+// hosted by another process
+func (hc *HierarchicalCoordinator) sliceInterface(quaiBackend quai.ConsensusAPI, target common.Location, local common.Location) core.CoreBackend {
+	if hc.hostsSlice(target) {
+		return *quaiBackend.GetBackend(target)
+	}
+	url := hc.remoteSlices[SliceName(target)]
+	client, err := quaiclient.DialSlice(url, hc.jwtSecret, local, target, log.Global)
+	if err != nil {
+		log.Global.WithFields(log.Fields{
+			"slice": SliceName(target),
+			"url":   url,
+			"err":   err,
+		}).Fatal("Error connecting to the remote slice")
+	}
+	log.Global.WithFields(log.Fields{
+		"slice": SliceName(target),
+		"url":   url,
+	}).Info("Connected to remote slice")
+	return client
+}
+
 func (hc *HierarchicalCoordinator) startNode(logPath string, quaiBackend quai.ConsensusAPI, location common.Location, genesisBlock *types.WorkObject) {
 	hc.wg.Add(1)
-	logger := log.NewLogger(logPath, hc.logLevel)
+	logger := log.NewLogger(logPath, hc.logLevel, log.Fields{
+		"location": location.Name(),
+		"context":  ContextName(location.Context()),
+	})
 	logger.Info("Starting Node at location", "location", location)
 	stack, apiBackend := makeFullNode(hc.p2p, location, hc.slicesRunning, hc.currentExpansionNumber, genesisBlock, logger)
 	quaiBackend.SetApiBackend(&apiBackend, location)
@@ -163,10 +296,29 @@ func (hc *HierarchicalCoordinator) startNode(logPath string, quaiBackend quai.Co
 		hc.p2p.Subscribe(location, &types.WorkObjectBlockView{})
 	}
 
+	// The admin api controls the slices running in this process
+	stack.RegisterAPIs([]rpc.API{
+		{
+			Namespace: "admin",
+			Version:   "1.0",
+			Service:   NewPrivateSliceAdminAPI(hc),
+		},
+	})
+
+	// The health endpoints report on all the slices of this process
+	stack.RegisterHandler("Health", "/health", newHealthHandler(hc, quaiBackend, false))
+	stack.RegisterHandler("Readiness", "/ready", newHealthHandler(hc, quaiBackend, true))
+
 	StartNode(stack)
 
+	sn := &sliceNode{location: location, stack: stack, quit: make(chan struct{}), done: make(chan struct{})}
+	hc.nodesMu.Lock()
+	hc.nodes[SliceName(location)] = sn
+	hc.nodesMu.Unlock()
+
 	go func() {
 		defer hc.wg.Done()
+		defer close(sn.done)
 		defer func() {
 			if r := recover(); r != nil {
 				logger.WithFields(log.Fields{
@@ -175,15 +327,130 @@ func (hc *HierarchicalCoordinator) startNode(logPath string, quaiBackend quai.Co
 				}).Fatal("Go-Quai Panicked")
 			}
 		}()
-		<-hc.quitCh
-		logger.Info("Context cancelled, shutting down node")
+		select {
+		case <-hc.quitCh:
+			logger.Info("Context cancelled, shutting down node")
+		case <-sn.quit:
+			logger.Info("Stopping node at location", "location", location)
+		}
 		stack.Close()
 		stack.Wait()
 	}()
 }
 
+// SetSliceProcessing brings the state processing of a zone hosted by this
+// process online or offline by restarting its node with the new set of
+// running slices. The prime and region nodes keep running untouched. The
+// restart happens in the background, as the request may be served by the
+// very node being restarted.
+func (hc *HierarchicalCoordinator) SetSliceProcessing(location common.Location, processing bool) error {
+	hc.sliceMu.Lock()
+	err := hc.updateSlicesRunning(location, processing)
+	hc.sliceMu.Unlock()
+	if err != nil {
+		return err
+	}
+	// The slice is restarted with the slices running at that time, so the
+	// restarts of concurrent changes leave it in the latest state whatever
+	// their order
+	hc.wg.Add(1)
+	go func() {
+		defer hc.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Global.WithFields(log.Fields{
+					"error":      r,
+					"stacktrace": string(debug.Stack()),
+				}).Fatal("Go-Quai Panicked")
+			}
+		}()
+		hc.sliceMu.Lock()
+		defer hc.sliceMu.Unlock()
+		log.Global.WithFields(log.Fields{
+			"location":   location.Name(),
+			"processing": processing,
+		}).Info("Restarting slice")
+		hc.stopNode(location)
+		hc.startNode(SliceName(location)+".log", hc.consensus, location, nil)
+		hc.connectDomSub(hc.consensus, common.Location{byte(location.Region())}, location)
+	}()
+	return nil
+}
+
+// updateSlicesRunning validates the change of the processing state of the
+// zone and records it in the running slices
+func (hc *HierarchicalCoordinator) updateSlicesRunning(location common.Location, processing bool) error {
+	if location.Context() != common.ZONE_CTX {
+		return errors.New("only zones can start or stop processing state")
+	}
+	currentRegions, currentZones := common.GetHierarchySizeForExpansionNumber(hc.currentExpansionNumber)
+	if location.Region() >= int(currentRegions) || location.Zone() >= int(currentZones) {
+		return fmt.Errorf("slice %s is not active in the current expansion", SliceName(location))
+	}
+	if !hc.hostsSlice(location) {
+		return fmt.Errorf("slice %s is not hosted by this process", SliceName(location))
+	}
+	running := false
+	slicesRunning := make([]common.Location, 0, len(hc.slicesRunning)+1)
+	for _, slice := range hc.slicesRunning {
+		if slice.Equal(location) {
+			running = true
+			continue
+		}
+		slicesRunning = append(slicesRunning, slice)
+	}
+	if running == processing {
+		if processing {
+			return fmt.Errorf("slice %s is already running", SliceName(location))
+		}
+		return fmt.Errorf("slice %s is not running", SliceName(location))
+	}
+	region := common.Location{byte(location.Region())}
+	if processing {
+		// The region decides at startup whether it processes state, so its
+		// zones can only be brought online if it already does
+		if hc.hostsSlice(region) && !hc.consensus.ProcessingState(region) {
+			return fmt.Errorf("region %d does not process state, restart the node with %s in --%s", location.Region(), SliceName(location), SlicesRunningFlag.Name)
+		}
+		slicesRunning = append(slicesRunning, location)
+	}
+	hc.slicesRunning = slicesRunning
+	return nil
+}
+
+// stopNode shuts down the node of the slice, closing its database and rpc
+// endpoints, and leaves the gossip topics of its location
+func (hc *HierarchicalCoordinator) stopNode(location common.Location) {
+	sn, ok := hc.nodes[SliceName(location)]
+	if !ok {
+		return
+	}
+	for _, datatype := range []interface{}{&types.WorkObjectHeaderView{}, &types.WorkObjectHeader{}, &types.Transactions{}, &types.WorkObjectBlockView{}} {
+		if err := hc.p2p.Unsubscribe(location, datatype); err != nil {
+			log.Global.WithFields(log.Fields{
+				"location": location.Name(),
+				"err":      err,
+			}).Error("Error unsubscribing from topic")
+		}
+	}
+	// Detach the node from the dom and the consensus backend before closing
+	// it so that nothing reaches its closed database
+	if location.Context() == common.ZONE_CTX && hc.hostsSlice(common.Location{byte(location.Region())}) {
+		regionBackend := *hc.consensus.GetBackend(common.Location{byte(location.Region())})
+		regionBackend.SetSubInterface(nil, location)
+	}
+	hc.consensus.SetApiBackend(nil, location)
+	hc.nodesMu.Lock()
+	delete(hc.nodes, SliceName(location))
+	hc.nodesMu.Unlock()
+	close(sn.quit)
+	<-sn.done
+}
+
 func (hc *HierarchicalCoordinator) Stop() {
-	hc.expansionSub.Unsubscribe()
+	if hc.expansionSub != nil {
+		hc.expansionSub.Unsubscribe()
+	}
 	hc.db.Close()
 	close(hc.quitCh)
 	hc.wg.Wait()
@@ -238,6 +505,9 @@ func (hc *HierarchicalCoordinator) expansionEventLoop() {
 }
 
 func (hc *HierarchicalCoordinator) TriggerTreeExpansion(block *types.WorkObject) error {
+	hc.sliceMu.Lock()
+	defer hc.sliceMu.Unlock()
+
 	// set the current expansion on all the backends
 	currentRegions, currentZones := common.GetHierarchySizeForExpansionNumber(hc.currentExpansionNumber)
 	newRegions, newZones := common.GetHierarchySizeForExpansionNumber(hc.currentExpansionNumber + 1)
@@ -303,6 +573,13 @@ func (hc *HierarchicalCoordinator) TriggerTreeExpansion(block *types.WorkObject)
 	return nil
 }
 
+// CurrentExpansionNumber returns the expansion number the hierarchy runs at.
+func (hc *HierarchicalCoordinator) CurrentExpansionNumber() uint8 {
+	hc.expansionMu.RLock()
+	defer hc.expansionMu.RUnlock()
+	return hc.currentExpansionNumber
+}
+
 // getCurrentExpansionNumber gets the current expansion number from the database
 func (hc *HierarchicalCoordinator) readCurrentExpansionNumber() uint64 {
 	currentExpansionNumber, _ := hc.db.Get(c_currentExpansionNumberKey, nil)
@@ -325,7 +602,9 @@ func (hc *HierarchicalCoordinator) writeCurrentExpansionNumber(number uint8) err
 	if number > common.MaxExpansionNumber {
 		number = common.MaxExpansionNumber
 	}
+	hc.expansionMu.Lock()
 	hc.currentExpansionNumber = number
+	hc.expansionMu.Unlock()
 	protoExpansionNumber := &common.ProtoNumber{Value: uint64(hc.currentExpansionNumber)}
 	protoNumber, err := proto.Marshal(protoExpansionNumber)
 	if err != nil {
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/quai"
+)
+
+// processingConsensus reports which regions process state
+type processingConsensus struct {
+	quai.ConsensusAPI
+	processing map[string]bool
+}
+
+func (c *processingConsensus) ProcessingState(location common.Location) bool {
+	return c.processing[SliceName(location)]
+}
+
+func TestCheckRemoteSlices(t *testing.T) {
+	// The whole hierarchy runs in this process
+	hc := &HierarchicalCoordinator{currentExpansionNumber: 1}
+	require.NoError(t, hc.checkRemoteSlices())
+
+	// A zone process needs the endpoint of its region
+	hc = &HierarchicalCoordinator{
+		currentExpansionNumber: 1,
+		localSlices:            []common.Location{{0, 1}},
+		remoteSlices:           map[string]string{"zone-0-0": "http://127.0.0.1:9003"},
+	}
+	require.ErrorContains(t, hc.checkRemoteSlices(), "region-0")
+	hc.remoteSlices["region-0"] = "http://127.0.0.1:9002"
+	require.NoError(t, hc.checkRemoteSlices())
+
+	// A prime and region process needs the endpoints of all the zones of
+	// the region at the expansion
+	hc = &HierarchicalCoordinator{
+		currentExpansionNumber: 1,
+		localSlices:            []common.Location{{}, {0}},
+		remoteSlices:           map[string]string{"zone-0-0": "http://127.0.0.1:9003"},
+	}
+	require.ErrorContains(t, hc.checkRemoteSlices(), "zone-0-1")
+	hc.remoteSlices["zone-0-1"] = "http://127.0.0.1:9004"
+	require.NoError(t, hc.checkRemoteSlices())
+	hc.currentExpansionNumber = 2
+	require.ErrorContains(t, hc.checkRemoteSlices(), "region-1")
+}
+
+func TestUpdateSlicesRunning(t *testing.T) {
+	consensus := &processingConsensus{processing: map[string]bool{"region-0": true}}
+	hc := &HierarchicalCoordinator{
+		consensus:              consensus,
+		currentExpansionNumber: 2,
+		slicesRunning:          []common.Location{{0, 0}},
+	}
+
+	// Only active zones hosted by this process can change
+	require.ErrorContains(t, hc.updateSlicesRunning(common.Location{0}, true), "only zones")
+	require.ErrorContains(t, hc.updateSlicesRunning(common.Location{0, 2}, true), "not active")
+	hc.localSlices = []common.Location{{0}, {1}, {0, 0}, {0, 1}, {1, 0}}
+	require.ErrorContains(t, hc.updateSlicesRunning(common.Location{1, 1}, true), "not hosted")
+
+	// Start and stop a zone
+	require.ErrorContains(t, hc.updateSlicesRunning(common.Location{0, 0}, true), "already running")
+	require.NoError(t, hc.updateSlicesRunning(common.Location{0, 1}, true))
+	require.Equal(t, []common.Location{{0, 0}, {0, 1}}, hc.slicesRunning)
+	require.NoError(t, hc.updateSlicesRunning(common.Location{0, 0}, false))
+	require.Equal(t, []common.Location{{0, 1}}, hc.slicesRunning)
+	require.ErrorContains(t, hc.updateSlicesRunning(common.Location{0, 0}, false), "not running")
+
+	// A zone cannot process state under a hosted region that does not
+	require.ErrorContains(t, hc.updateSlicesRunning(common.Location{1, 0}, true), "does not process state")
+	require.Equal(t, []common.Location{{0, 1}}, hc.slicesRunning)
+	consensus.processing["region-1"] = true
+	require.NoError(t, hc.updateSlicesRunning(common.Location{1, 0}, true))
+	require.Equal(t, []common.Location{{0, 1}, {1, 0}}, hc.slicesRunning)
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"github.com/dominant-strategies/go-quai/log"
+)
+
+// PrivateSliceAdminAPI is the collection of APIs exposed over the private
+// admin endpoint to manage the slices and loggers of this process.
+type PrivateSliceAdminAPI struct {
+	hc *HierarchicalCoordinator
+}
+
+// NewPrivateSliceAdminAPI creates a new API definition for the slice
+// management methods of the hierarchical coordinator.
+func NewPrivateSliceAdminAPI(hc *HierarchicalCoordinator) *PrivateSliceAdminAPI {
+	return &PrivateSliceAdminAPI{hc: hc}
+}
+
+// StartSlice brings the state processing of the zone online, e.g.
+// admin.startSlice("zone-0-1"). The zone restarts with its state, gossip
+// topics and rpc endpoints in the background.
+func (api *PrivateSliceAdminAPI) StartSlice(name string) (bool, error) {
+	location, err := ParseSliceName(name)
+	if err != nil {
+		return false, err
+	}
+	if err := api.hc.SetSliceProcessing(location, true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// StopSlice takes the state processing of the zone offline, leaving it to
+// follow the headers only.
+func (api *PrivateSliceAdminAPI) StopSlice(name string) (bool, error) {
+	location, err := ParseSliceName(name)
+	if err != nil {
+		return false, err
+	}
+	if err := api.hc.SetSliceProcessing(location, false); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetLogLevel changes the verbosity of the logger of a slice or subsystem,
+// e.g. admin.setLogLevel("zone-0-1", "core", "debug"). The module is a
+// package path such as core or p2p/node; "*" or an empty module changes the
+// level of the whole logger.
+func (api *PrivateSliceAdminAPI) SetLogLevel(name string, module string, level string) (bool, error) {
+	if err := log.SetLogLevel(name, module, level); err != nil {
+		return false, err
+	}
+	log.Global.WithFields(log.Fields{
+		"logger": name,
+		"module": module,
+		"level":  level,
+	}).Info("Log level changed")
+	return true, nil
+}
+
+// GetLogLevels returns the levels of all the loggers of the process, keyed by
+// logger and module.
+func (api *PrivateSliceAdminAPI) GetLogLevels() map[string]map[string]string {
+	return log.LogLevels()
+}
@@ -0,0 +1,1138 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/consensus"
+	"github.com/dominant-strategies/go-quai/core"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/core/state"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/crypto"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/node"
+	"github.com/dominant-strategies/go-quai/params"
+	"github.com/dominant-strategies/go-quai/quai/quaiconfig"
+	"github.com/dominant-strategies/go-quai/trie"
+)
+
+// A chain snapshot holds what the slices of a data directory need to carry on
+// from their heads without the blocks before them: for every slice its head
+// and the blocks back to the prime block it builds on, the termini, manifests
+// and interlink hashes of these blocks, the best pending header and its body,
+// the pending ETXs and rollups of the blocks of its subordinate slices not
+// included yet, and for the zones the inbound ETXs and the account, UTXO and
+// ETX tries of the head. It uses the record format of the chain archives with
+// its own magic.
+const snapshotMagic = "QUAISNAP"
+
+// snapshotStagingName is the database of a slice the records of a snapshot
+// are staged in until they are verified.
+const snapshotStagingName = "snapshotstaging"
+
+const (
+	snapshotHead              archiveRecordKind = iota + 1 // hash of the head of the slice
+	snapshotBlock                                          // WorkObject of the head or of an ancestor
+	snapshotTermini                                        // hash and termini of a block
+	snapshotManifest                                       // hash and manifest of a block
+	snapshotInterlinkHashes                                // hash and interlink hashes of a prime block
+	snapshotInboundEtxs                                    // hash and inbound ETXs of the head of a zone
+	snapshotPendingHeader                                  // key and best pending header of the slice
+	snapshotPendingBody                                    // seal hash and body of the best pending header
+	snapshotPendingEtxs                                    // pending ETXs of a sub block
+	snapshotPendingEtxsRollup                              // pending ETX rollup of a sub block
+	snapshotTrieNode                                       // hash and encoding of a trie node
+	snapshotCode                                           // hash and contract code
+)
+
+// snapshotSlice is a slice being exported to or imported from a snapshot.
+type snapshotSlice struct {
+	location common.Location
+	stack    *node.Node
+	db       ethdb.Database
+	staging  ethdb.Database   // when importing, holds the records until verified
+	batch    ethdb.Batch      // into staging
+	engine   consensus.Engine // when importing
+	genesis  common.Hash
+	head     common.Hash
+	chain    []*types.WorkObject // head first
+
+	// The blocks and chain data read from a snapshot, the chain data is only
+	// written once checked against the blocks
+	blocks          map[common.Hash]*types.WorkObject
+	termini         map[common.Hash]types.Termini
+	manifests       map[common.Hash]types.BlockManifest
+	interlinkHashes map[common.Hash]common.Hashes
+	inboundEtxs     map[common.Hash]types.Transactions
+	phKey           common.Hash
+	ph              *types.PendingHeader
+	bodies          map[common.Hash]*types.WorkObject
+}
+
+// newSnapshotSlice returns a slice to import a snapshot into, db holding its
+// genesis block and staging being empty.
+func newSnapshotSlice(location common.Location, stack *node.Node, db, staging ethdb.Database, genesis common.Hash, engine consensus.Engine) *snapshotSlice {
+	return &snapshotSlice{
+		location:        location,
+		stack:           stack,
+		db:              db,
+		staging:         staging,
+		batch:           staging.NewBatch(),
+		engine:          engine,
+		genesis:         genesis,
+		blocks:          make(map[common.Hash]*types.WorkObject),
+		termini:         make(map[common.Hash]types.Termini),
+		manifests:       make(map[common.Hash]types.BlockManifest),
+		interlinkHashes: make(map[common.Hash]common.Hashes),
+		inboundEtxs:     make(map[common.Hash]types.Transactions),
+		bodies:          make(map[common.Hash]*types.WorkObject),
+	}
+}
+
+// close closes the slice, dropping its staging database.
+func (s *snapshotSlice) close() {
+	if s.staging != nil {
+		s.staging.Close()
+	}
+	if s.stack != nil {
+		os.RemoveAll(s.stack.ResolvePath(snapshotStagingName))
+		s.stack.Close()
+	}
+}
+
+// IsGenesisHash returns whether hash is the genesis block of the slice, to
+// rank its blocks.
+func (s *snapshotSlice) IsGenesisHash(hash common.Hash) bool {
+	return hash == s.genesis
+}
+
+// ExportSnapshot writes a snapshot of the heads of all the slices in the data
+// directory. The node must be stopped, so that the slices are in a consistent
+// state. The heads are logged, to be given as the trusted hashes on import.
+func ExportSnapshot(path string) error {
+	var slices []*snapshotSlice
+	for _, location := range sliceLocations() {
+		stack, db, err := openSliceDatabase(location, true)
+		if err != nil {
+			return err
+		} else if stack == nil {
+			continue
+		}
+		defer stack.Close()
+		s := &snapshotSlice{location: location, stack: stack, db: db, genesis: rawdb.ReadCanonicalHash(db, 0)}
+		if s.head = rawdb.ReadHeadBlockHash(db); s.head == (common.Hash{}) {
+			return fmt.Errorf("slice %s has no head", SliceName(location))
+		}
+		slices = append(slices, s)
+	}
+	if len(slices) == 0 || slices[0].location.Context() != common.PRIME_CTX {
+		return errors.New("no prime database found in the data directory")
+	}
+	if err := collectSnapshotChains(slices); err != nil {
+		return err
+	}
+
+	writer, closeFile, err := createArchiveFile(path)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+	aw, err := newArchiveWriter(writer, snapshotMagic)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	for _, s := range slices {
+		if err := exportSnapshotSlice(aw, s, slices); err != nil {
+			return fmt.Errorf("%s: %w", SliceName(s.location), err)
+		}
+	}
+	if err := aw.close(); err != nil {
+		return err
+	}
+	if err := closeFile(); err != nil {
+		return err
+	}
+	for _, s := range slices {
+		log.Global.WithFields(log.Fields{
+			"location": SliceName(s.location),
+			"hash":     s.head,
+			"blocks":   len(s.chain),
+		}).Info("Snapshot head")
+	}
+	log.Global.WithFields(log.Fields{
+		"path":    path,
+		"records": aw.count,
+		"elapsed": common.PrettyDuration(time.Since(start)),
+	}).Info("Exported snapshot")
+	return nil
+}
+
+// collectSnapshotChains sets the chains of the slices to export, prime first.
+// Every slice is written back to the prime block it builds on, and prime back
+// to the oldest of them.
+func collectSnapshotChains(slices []*snapshotSlice) error {
+	prime := slices[0]
+	termini := make(map[common.Hash]string)
+	for _, s := range slices[1:] {
+		if s.head == s.genesis {
+			continue
+		}
+		head := rawdb.ReadHeader(s.db, s.head)
+		if head == nil {
+			return fmt.Errorf("head %s of %s not found", s.head.Hex(), SliceName(s.location))
+		}
+		terminus := head.PrimeTerminus()
+		chain, err := snapshotChain(s, head, func(hash common.Hash) bool { return hash == terminus })
+		if err != nil {
+			return err
+		}
+		s.chain = chain
+		if terminus != prime.genesis {
+			termini[terminus] = SliceName(s.location)
+		}
+	}
+	primeHead := rawdb.ReadHeader(prime.db, prime.head)
+	if primeHead == nil {
+		return fmt.Errorf("head %s of prime not found", prime.head.Hex())
+	}
+	chain, err := snapshotChain(prime, primeHead, func(hash common.Hash) bool {
+		delete(termini, hash)
+		return len(termini) == 0
+	})
+	if err != nil {
+		return err
+	}
+	prime.chain = chain
+	for hash, name := range termini {
+		return fmt.Errorf("prime block %s that %s builds on is not in the prime chain", hash.Hex(), name)
+	}
+	return nil
+}
+
+// snapshotChain returns the head and its ancestors in the context of the
+// slice, back to the first block for which reached returns true and deep
+// enough for the work shares of the next blocks to be checked. The genesis
+// block is never included.
+func snapshotChain(s *snapshotSlice, head *types.WorkObject, reached func(common.Hash) bool) ([]*types.WorkObject, error) {
+	var (
+		ctx   = s.location.Context()
+		chain []*types.WorkObject
+		done  bool
+	)
+	for header := head; header.Hash() != s.genesis; {
+		chain = append(chain, header)
+		done = done || reached(header.Hash())
+		if done && len(chain) > params.WorkSharesInclusionDepth {
+			break
+		}
+		parentHash := header.ParentHash(ctx)
+		if header = rawdb.ReadHeader(s.db, parentHash); header == nil {
+			return nil, fmt.Errorf("header %s of %s not found", parentHash.Hex(), SliceName(s.location))
+		}
+	}
+	return chain, nil
+}
+
+// exportSnapshotSlice writes the records of a slice.
+func exportSnapshotSlice(aw *archiveWriter, s *snapshotSlice, slices []*snapshotSlice) error {
+	ctx := s.location.Context()
+	if err := aw.write(snapshotHead, s.location, s.head.Bytes()); err != nil {
+		return err
+	}
+	for _, header := range s.chain {
+		hash := header.Hash()
+		block := rawdb.ReadWorkObject(s.db, hash, types.BlockObject)
+		if block == nil {
+			// The body of the block may have been pruned
+			if block = rawdb.ReadWorkObjectHeaderOnly(s.db, hash, types.BlockObject); block == nil {
+				return fmt.Errorf("block %s not found", hash.Hex())
+			}
+		}
+		protoBlock, err := block.ProtoEncode(types.BlockObject)
+		if err != nil {
+			return err
+		}
+		if err := writeSnapshotProto(aw, snapshotBlock, s.location, nil, protoBlock); err != nil {
+			return err
+		}
+		if termini := rawdb.ReadTermini(s.db, hash); termini != nil {
+			if err := writeSnapshotProto(aw, snapshotTermini, s.location, hash.Bytes(), termini.ProtoEncode()); err != nil {
+				return err
+			}
+		}
+		if manifest := rawdb.ReadManifest(s.db, hash); manifest != nil {
+			protoManifest, err := manifest.ProtoEncode()
+			if err != nil {
+				return err
+			}
+			if err := writeSnapshotProto(aw, snapshotManifest, s.location, hash.Bytes(), protoManifest); err != nil {
+				return err
+			}
+		}
+		if ctx == common.PRIME_CTX {
+			if interlinkHashes := rawdb.ReadInterlinkHashes(s.db, hash); interlinkHashes != nil {
+				if err := writeSnapshotProto(aw, snapshotInterlinkHashes, s.location, hash.Bytes(), interlinkHashes.ProtoEncode()); err != nil {
+					return err
+				}
+			}
+		}
+		// Only the child of the head is processed from the snapshot, and it
+		// takes the inbound ETXs of its parent
+		if ctx == common.ZONE_CTX && hash == s.head {
+			if inboundEtxs := rawdb.ReadInboundEtxs(s.db, hash); len(inboundEtxs) > 0 {
+				protoEtxs, err := inboundEtxs.ProtoEncode()
+				if err != nil {
+					return err
+				}
+				if err := writeSnapshotProto(aw, snapshotInboundEtxs, s.location, hash.Bytes(), protoEtxs); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	phKey := rawdb.ReadBestPhKey(s.db)
+	if ph := rawdb.ReadPendingHeader(s.db, phKey); ph != nil {
+		protoPh, err := ph.ProtoEncode()
+		if err != nil {
+			return err
+		}
+		if err := writeSnapshotProto(aw, snapshotPendingHeader, s.location, phKey.Bytes(), protoPh); err != nil {
+			return err
+		}
+		// Without the body of its pending header the worker of the slice
+		// has nothing to mine on until it gets a new block
+		sealHash := ph.WorkObject().SealHash()
+		for _, key := range rawdb.ReadPbBodyKeys(s.db) {
+			if key != sealHash {
+				continue
+			}
+			if body := rawdb.ReadPbCacheBody(s.db, key); body != nil {
+				protoBody, err := body.ProtoEncode(types.PhObject)
+				if err != nil {
+					return err
+				}
+				if err := writeSnapshotProto(aw, snapshotPendingBody, s.location, key.Bytes(), protoBody); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// The next blocks of this slice include the blocks of its subordinate
+	// slices since their last coincident block, which are listed in the
+	// manifests of their heads
+	for _, sub := range slices {
+		if sub.location.Context() != ctx+1 || !sub.location.InSameSliceAs(s.location) || sub.head == sub.genesis {
+			continue
+		}
+		hashes := append(rawdb.ReadManifest(sub.db, sub.head), sub.head)
+		for _, hash := range hashes {
+			if pEtxs := rawdb.ReadPendingEtxs(s.db, hash); pEtxs != nil {
+				protoPEtxs, err := pEtxs.ProtoEncode()
+				if err != nil {
+					return err
+				}
+				if err := writeSnapshotProto(aw, snapshotPendingEtxs, s.location, nil, protoPEtxs); err != nil {
+					return err
+				}
+			}
+			if rollup := rawdb.ReadPendingEtxsRollup(s.db, hash); rollup != nil {
+				protoRollup, err := rollup.ProtoEncode()
+				if err != nil {
+					return err
+				}
+				if err := writeSnapshotProto(aw, snapshotPendingEtxsRollup, s.location, nil, protoRollup); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if ctx != common.ZONE_CTX || s.head == s.genesis {
+		return nil
+	}
+	return exportSnapshotState(aw, s, s.chain[0])
+}
+
+// exportSnapshotState writes the nodes of the account, UTXO and ETX tries of
+// the head of a zone, and the code of its contracts.
+func exportSnapshotState(aw *archiveWriter, s *snapshotSlice, head *types.WorkObject) error {
+	var (
+		nodes, codes int
+		start        = time.Now()
+		logged       = time.Now()
+	)
+	onNode := func(hash common.Hash, blob []byte) error {
+		nodes++
+		if time.Since(logged) > 8*time.Second {
+			log.Global.WithFields(log.Fields{
+				"location": SliceName(s.location),
+				"nodes":    nodes,
+				"codes":    codes,
+				"elapsed":  common.PrettyDuration(time.Since(start)),
+			}).Info("Exporting state")
+			logged = time.Now()
+		}
+		return aw.write(snapshotTrieNode, s.location, append(hash.Bytes(), blob...))
+	}
+	onCode := func(hash common.Hash, code []byte) error {
+		codes++
+		return aw.write(snapshotCode, s.location, append(hash.Bytes(), code...))
+	}
+	db := state.NewDatabase(s.db)
+	if err := state.ForEachStateNode(db, head.EVMRoot(), onNode, onCode); err != nil {
+		return fmt.Errorf("account trie of the head: %w", err)
+	}
+	if err := state.ForEachTrieNode(db, head.UTXORoot(), onNode); err != nil {
+		return fmt.Errorf("UTXO trie of the head: %w", err)
+	}
+	if err := state.ForEachTrieNode(db, head.EtxSetRoot(), onNode); err != nil {
+		return fmt.Errorf("ETX trie of the head: %w", err)
+	}
+	return nil
+}
+
+// writeSnapshotProto writes a record made of prefix and the encoding of msg.
+func writeSnapshotProto(aw *archiveWriter, kind archiveRecordKind, location common.Location, prefix []byte, msg proto.Message) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return aw.write(kind, location, append(common.CopyBytes(prefix), data...))
+}
+
+// ImportSnapshot restores a snapshot into a new data directory. The head of
+// every slice in the snapshot must be one of the trusted hashes. The blocks of
+// each slice must link up to its head and to the prime chain, and the tries of
+// the zones must be complete under the roots of their heads. The chain data of
+// the blocks is rebuilt from them or checked against them. The heads are only
+// written once all of this is verified, the node then carries on syncing from
+// them.
+func ImportSnapshot(path string, trustedHashes []string) error {
+	trusted := make(map[common.Hash]bool)
+	for _, hex := range trustedHashes {
+		if len(common.FromHex(hex)) != common.HashLength {
+			return fmt.Errorf("invalid trusted hash %q", hex)
+		}
+		trusted[common.HexToHash(hex)] = false
+	}
+	if len(trusted) == 0 {
+		return errors.New("no trusted hash given")
+	}
+	reader, closeFile, err := openArchiveFile(path)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+	ar, err := newArchiveReader(reader, snapshotMagic)
+	if err != nil {
+		return err
+	}
+	slices := make(map[string]*snapshotSlice)
+	defer func() {
+		for _, s := range slices {
+			s.close()
+		}
+	}()
+	start := time.Now()
+	records, err := importSnapshot(ar, trusted, slices, openSnapshotSlice)
+	if err != nil {
+		return err
+	}
+	log.Global.WithFields(log.Fields{
+		"path":    path,
+		"records": records,
+		"elapsed": common.PrettyDuration(time.Since(start)),
+	}).Info("Imported snapshot, the node syncs from it when started")
+	return nil
+}
+
+// importSnapshot reads the records of a snapshot into the slices, opening the
+// missing ones with open, and writes their heads once verified. It returns the
+// number of records read.
+func importSnapshot(ar *archiveReader, trusted map[common.Hash]bool, slices map[string]*snapshotSlice, open func(common.Location) (*snapshotSlice, error)) (int, error) {
+	known := make(map[string]bool)
+	for _, location := range sliceLocations() {
+		known[SliceName(location)] = true
+	}
+	var (
+		records int
+		start   = time.Now()
+		logged  = time.Now()
+	)
+	for {
+		record, err := ar.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return records, err
+		}
+		name := SliceName(record.location)
+		if !known[name] {
+			return records, fmt.Errorf("%w: unknown location %v", errArchiveCorrupted, record.location)
+		}
+		s, ok := slices[name]
+		if !ok {
+			if s, err = open(record.location); err != nil {
+				return records, err
+			}
+			slices[name] = s
+		}
+		if err := importSnapshotRecord(s, record); err != nil {
+			return records, fmt.Errorf("%s: %w", name, err)
+		}
+		if s.batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := s.batch.Write(); err != nil {
+				return records, err
+			}
+			s.batch.Reset()
+		}
+		records++
+		if time.Since(logged) > 8*time.Second {
+			log.Global.WithFields(log.Fields{
+				"records": records,
+				"elapsed": common.PrettyDuration(time.Since(start)),
+			}).Info("Importing snapshot")
+			logged = time.Now()
+		}
+	}
+	for _, s := range slices {
+		if err := s.batch.Write(); err != nil {
+			return records, err
+		}
+		s.batch.Reset()
+	}
+
+	// Check the slices against the trusted hashes and each other before
+	// writing their heads
+	prime, ok := slices[SliceName(common.Location{})]
+	if !ok {
+		return records, errors.New("snapshot has no prime slice")
+	}
+	if err := verifySnapshotChain(prime, trusted); err != nil {
+		return records, err
+	}
+	primeHashes := make(map[common.Hash]bool)
+	for _, block := range prime.chain {
+		primeHashes[block.Hash()] = true
+	}
+	primeHashes[prime.genesis] = true
+	for name, s := range slices {
+		if s != prime {
+			if err := verifySnapshotChain(s, trusted); err != nil {
+				return records, err
+			}
+			linked := s.head == s.genesis
+			for _, block := range s.chain {
+				linked = linked || primeHashes[block.Hash()] || primeHashes[block.ParentHash(common.PRIME_CTX)]
+			}
+			if !linked {
+				return records, fmt.Errorf("%s doesn't build on the prime chain of the snapshot", name)
+			}
+			if s.location.Context() == common.ZONE_CTX && len(s.chain) > 0 {
+				if err := verifySnapshotState(s, s.chain[0]); err != nil {
+					return records, err
+				}
+			}
+		}
+		if err := verifySnapshotChainData(s); err != nil {
+			return records, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	for hash, used := range trusted {
+		if !used {
+			return records, fmt.Errorf("trusted hash %s is not the head of any slice of the snapshot", hash.Hex())
+		}
+	}
+	for name, s := range slices {
+		if err := writeSnapshotHead(s); err != nil {
+			return records, err
+		}
+		log.Global.WithFields(log.Fields{
+			"location": name,
+			"hash":     s.head,
+			"blocks":   len(s.chain),
+		}).Info("Imported snapshot")
+	}
+	return records, nil
+}
+
+// openSnapshotSlice opens the database of a slice to import a snapshot into,
+// writing its genesis block. The slice must not have a chain yet.
+func openSnapshotSlice(location common.Location) (*snapshotSlice, error) {
+	expansionNumber := StartingExpansionNumber()
+	stack, cfg := makeConfigNode(nil, location, uint8(expansionNumber), log.Global)
+	db := MakeChainDatabase(stack, false)
+	_, genesis, err := core.SetupGenesisBlockWithOverride(db, cfg.Quai.Genesis, location, expansionNumber, log.Global)
+	if err != nil {
+		stack.Close()
+		return nil, err
+	}
+	if head := rawdb.ReadHeadBlockHash(db); head != (common.Hash{}) && head != genesis {
+		stack.Close()
+		return nil, fmt.Errorf("slice %s already has a chain, a snapshot can only be imported into a new data directory", SliceName(location))
+	}
+	// The records are staged apart until verified, so that a rejected snapshot
+	// leaves nothing behind. A staging database left by an interrupted import
+	// is dropped
+	os.RemoveAll(stack.ResolvePath(snapshotStagingName))
+	staging, err := stack.OpenDatabase(snapshotStagingName, 16, MakeDatabaseHandles(), "", false)
+	if err != nil {
+		stack.Close()
+		return nil, err
+	}
+	// The engine gives the order and rank of the head, to rebuild the chain
+	// data its child commits to
+	var engine consensus.Engine
+	if cfg.Quai.ConsensusEngine == "blake3" {
+		blake3Config := cfg.Quai.Blake3Pow
+		blake3Config.NodeLocation = location
+		engine = quaiconfig.CreateBlake3ConsensusEngine(stack, location, &blake3Config, nil, false, db, log.Global)
+	} else {
+		progpowConfig := cfg.Quai.Progpow
+		progpowConfig.NodeLocation = location
+		engine = quaiconfig.CreateProgpowConsensusEngine(stack, location, &progpowConfig, nil, false, db, log.Global)
+	}
+	return newSnapshotSlice(location, stack, db, staging, genesis, engine), nil
+}
+
+// importSnapshotRecord reads a record of a snapshot into its slice, checking
+// the hashes of the ones that have one. The blocks, pending ETXs and trie
+// nodes are staged right away, the chain data of the blocks is kept to be
+// checked against them.
+func importSnapshotRecord(s *snapshotSlice, record *archiveRecord) error {
+	ctx := s.location.Context()
+	var hash common.Hash
+	data := record.data
+	switch record.kind {
+	case snapshotHead, snapshotTermini, snapshotManifest, snapshotInterlinkHashes, snapshotInboundEtxs, snapshotPendingHeader, snapshotPendingBody, snapshotTrieNode, snapshotCode:
+		if len(data) < common.HashLength {
+			return fmt.Errorf("%w: record of kind %d too short", errArchiveCorrupted, record.kind)
+		}
+		hash, data = common.BytesToHash(data[:common.HashLength]), data[common.HashLength:]
+	}
+	switch record.kind {
+	case snapshotHead:
+		s.head = hash
+
+	case snapshotBlock:
+		protoBlock := new(types.ProtoWorkObject)
+		if err := proto.Unmarshal(data, protoBlock); err != nil {
+			return err
+		}
+		block := new(types.WorkObject)
+		if err := block.ProtoDecode(protoBlock, s.location, types.BlockObject); err != nil {
+			return err
+		}
+		if block.Body() == nil || block.Body().Header() == nil || block.Body().Header().Hash() != block.HeaderHash() {
+			return fmt.Errorf("%w: header of block %s doesn't match its hash", errArchiveCorrupted, block.Hash().Hex())
+		}
+		rawdb.WriteWorkObject(s.batch, block.Hash(), block, types.BlockObject, ctx)
+		s.blocks[block.Hash()] = block
+
+	case snapshotTermini:
+		protoTermini := new(types.ProtoTermini)
+		if err := proto.Unmarshal(data, protoTermini); err != nil {
+			return err
+		}
+		termini := types.Termini{}
+		if err := termini.ProtoDecode(protoTermini); err != nil {
+			return err
+		}
+		s.termini[hash] = termini
+
+	case snapshotManifest:
+		protoManifest := new(types.ProtoManifest)
+		if err := proto.Unmarshal(data, protoManifest); err != nil {
+			return err
+		}
+		manifest := types.BlockManifest{}
+		if err := manifest.ProtoDecode(protoManifest); err != nil {
+			return err
+		}
+		s.manifests[hash] = manifest
+
+	case snapshotInterlinkHashes:
+		protoHashes := new(common.ProtoHashes)
+		if err := proto.Unmarshal(data, protoHashes); err != nil {
+			return err
+		}
+		interlinkHashes := common.Hashes{}
+		interlinkHashes.ProtoDecode(protoHashes)
+		s.interlinkHashes[hash] = interlinkHashes
+
+	case snapshotInboundEtxs:
+		protoEtxs := new(types.ProtoTransactions)
+		if err := proto.Unmarshal(data, protoEtxs); err != nil {
+			return err
+		}
+		inboundEtxs := types.Transactions{}
+		if err := inboundEtxs.ProtoDecode(protoEtxs, s.location); err != nil {
+			return err
+		}
+		s.inboundEtxs[hash] = inboundEtxs
+
+	case snapshotPendingHeader:
+		protoPh := new(types.ProtoPendingHeader)
+		if err := proto.Unmarshal(data, protoPh); err != nil {
+			return err
+		}
+		ph := types.PendingHeader{}
+		if err := ph.ProtoDecode(protoPh, s.location); err != nil {
+			return err
+		}
+		s.phKey, s.ph = hash, &ph
+
+	case snapshotPendingBody:
+		protoBody := new(types.ProtoWorkObject)
+		if err := proto.Unmarshal(data, protoBody); err != nil {
+			return err
+		}
+		body := new(types.WorkObject)
+		if err := body.ProtoDecode(protoBody, s.location, types.PhObject); err != nil {
+			return err
+		}
+		s.bodies[hash] = body
+
+	case snapshotPendingEtxs:
+		protoPEtxs := new(types.ProtoPendingEtxs)
+		if err := proto.Unmarshal(data, protoPEtxs); err != nil {
+			return err
+		}
+		pEtxs := types.PendingEtxs{}
+		if err := pEtxs.ProtoDecode(protoPEtxs, s.location); err != nil {
+			return err
+		}
+		if !pEtxs.IsValid(trie.NewStackTrie(nil)) {
+			return fmt.Errorf("%w: pending ETXs of block %s don't match its ETX hash", errArchiveCorrupted, pEtxs.Header.Hash().Hex())
+		}
+		rawdb.WritePendingEtxs(s.batch, pEtxs)
+
+	case snapshotPendingEtxsRollup:
+		protoRollup := new(types.ProtoPendingEtxsRollup)
+		if err := proto.Unmarshal(data, protoRollup); err != nil {
+			return err
+		}
+		rollup := types.PendingEtxsRollup{}
+		if err := rollup.ProtoDecode(protoRollup, s.location); err != nil {
+			return err
+		}
+		if !rollup.IsValid(trie.NewStackTrie(nil)) {
+			return fmt.Errorf("%w: pending ETX rollup of block %s doesn't match its rollup hash", errArchiveCorrupted, rollup.Header.Hash().Hex())
+		}
+		rawdb.WritePendingEtxsRollup(s.batch, rollup)
+
+	case snapshotTrieNode, snapshotCode:
+		if crypto.Keccak256Hash(data) != hash {
+			return fmt.Errorf("%w: trie node or code %s doesn't match its hash", errArchiveCorrupted, hash.Hex())
+		}
+		if record.kind == snapshotTrieNode {
+			rawdb.WriteTrieNode(s.batch, hash, data)
+		} else {
+			rawdb.WriteCode(s.batch, hash, data)
+		}
+
+	default:
+		return fmt.Errorf("%w: unknown record kind %d", errArchiveCorrupted, record.kind)
+	}
+	return nil
+}
+
+// verifySnapshotChain checks that the head of a slice is trusted and that its
+// imported blocks form its chain, which it sets head first.
+func verifySnapshotChain(s *snapshotSlice, trusted map[common.Hash]bool) error {
+	name := SliceName(s.location)
+	if s.head == (common.Hash{}) {
+		return fmt.Errorf("snapshot has no head for %s", name)
+	}
+	if _, ok := trusted[s.head]; !ok {
+		return fmt.Errorf("head %s of %s is not a trusted hash", s.head.Hex(), name)
+	}
+	trusted[s.head] = true
+	if s.head == s.genesis {
+		return nil
+	}
+	var chain []*types.WorkObject
+	for hash := s.head; hash != s.genesis; {
+		block, ok := s.blocks[hash]
+		if !ok {
+			break
+		}
+		chain = append(chain, block)
+		hash = block.ParentHash(s.location.Context())
+	}
+	if len(chain) == 0 {
+		return fmt.Errorf("head %s of %s is missing from the snapshot", s.head.Hex(), name)
+	}
+	if len(chain) != len(s.blocks) {
+		return fmt.Errorf("%w: %d blocks of %s are not ancestors of its head", errArchiveCorrupted, len(s.blocks)-len(chain), name)
+	}
+	s.chain = chain
+	return nil
+}
+
+// verifySnapshotState checks that the tries of the head of a zone are complete.
+// Their nodes were checked against their hashes on import, so this also checks
+// them against the roots of the head.
+func verifySnapshotState(s *snapshotSlice, head *types.WorkObject) error {
+	db := state.NewDatabase(s.staging)
+	if err := state.ForEachStateNode(db, head.EVMRoot(), nil, nil); err != nil {
+		return fmt.Errorf("account trie of the head of %s: %w", SliceName(s.location), err)
+	}
+	if err := state.ForEachTrieNode(db, head.UTXORoot(), nil); err != nil {
+		return fmt.Errorf("UTXO trie of the head of %s: %w", SliceName(s.location), err)
+	}
+	if err := state.ForEachTrieNode(db, head.EtxSetRoot(), nil); err != nil {
+		return fmt.Errorf("ETX trie of the head of %s: %w", SliceName(s.location), err)
+	}
+	return nil
+}
+
+// verifySnapshotChainData checks the chain data read for a slice against its
+// imported chain, and replaces it with the data rebuilt from the blocks the
+// way the slice writes it when appending them. Only the blocks of the chain
+// get chain data, then:
+//   - the manifest of a block is committed to by the manifest hash of its
+//     child, the one of the head follows from its order
+//   - the termini of a block follow from the ones of its parent and its order,
+//     those of the oldest block are taken from the snapshot and checked for
+//     the entries it sets and the ones the slice never sets
+//   - the interlink hashes stored for a prime block are committed to by the
+//     interlink root hash of its child, those of the head follow from its rank
+//   - the inbound ETXs of a zone head must come from a coincident block and
+//     go to the zone
+//   - the pending header must build on a block of the chain, with its termini
+func verifySnapshotChainData(s *snapshotSlice) error {
+	ctx := s.location.Context()
+	inChain := make(map[common.Hash]bool)
+	for _, block := range s.chain {
+		inChain[block.Hash()] = true
+	}
+	for hash := range s.termini {
+		if !inChain[hash] {
+			return fmt.Errorf("%w: termini of %s which is not a block of the snapshot", errArchiveCorrupted, hash.Hex())
+		}
+	}
+	for hash := range s.manifests {
+		if !inChain[hash] {
+			return fmt.Errorf("%w: manifest of %s which is not a block of the snapshot", errArchiveCorrupted, hash.Hex())
+		}
+	}
+	for hash := range s.interlinkHashes {
+		if !inChain[hash] || ctx != common.PRIME_CTX {
+			return fmt.Errorf("%w: interlink hashes of %s which is not a prime block of the snapshot", errArchiveCorrupted, hash.Hex())
+		}
+	}
+	for hash := range s.inboundEtxs {
+		if hash != s.head || len(s.chain) == 0 || ctx != common.ZONE_CTX {
+			return fmt.Errorf("%w: inbound ETXs of %s which is not the head of a zone", errArchiveCorrupted, hash.Hex())
+		}
+	}
+	if len(s.chain) == 0 {
+		// A slice still at its genesis block sets itself up when started
+		s.ph, s.bodies = nil, nil
+		return nil
+	}
+
+	var (
+		termini         = make(map[common.Hash]types.Termini)
+		manifests       = make(map[common.Hash]types.BlockManifest)
+		interlinkHashes = make(map[common.Hash]common.Hashes)
+		headCoincident  bool
+	)
+	if s.chain[len(s.chain)-1].ParentHash(ctx) == s.genesis {
+		// The chain data of the genesis block is the one a slice starting
+		// from it writes
+		genesisTermini := types.EmptyTermini()
+		for i := range genesisTermini.DomTermini() {
+			genesisTermini.SetDomTerminiAtIndex(s.genesis, i)
+		}
+		for i := range genesisTermini.SubTermini() {
+			genesisTermini.SetSubTerminiAtIndex(s.genesis, i)
+		}
+		termini[s.genesis] = genesisTermini
+		manifests[s.genesis] = types.BlockManifest{s.genesis}
+		if ctx == common.PRIME_CTX {
+			interlinkHashes[s.genesis] = common.Hashes{s.genesis, s.genesis, s.genesis, s.genesis}
+		}
+	}
+	for i := len(s.chain) - 1; i >= 0; i-- {
+		var (
+			block      = s.chain[i]
+			hash       = block.Hash()
+			parentHash = block.ParentHash(ctx)
+			child      *types.WorkObject
+		)
+		if i > 0 {
+			child = s.chain[i-1]
+		}
+		manifest, err := rebuildSnapshotManifest(s, block, child, manifests[parentHash])
+		if err != nil {
+			return err
+		}
+		manifests[hash] = manifest
+		coincident := ctx == common.PRIME_CTX || len(manifest) == 1
+		headCoincident = coincident
+
+		var parentTermini *types.Termini
+		if t, ok := termini[parentHash]; ok {
+			parentTermini = &t
+		}
+		if termini[hash], err = rebuildSnapshotTermini(s, block, coincident, parentTermini); err != nil {
+			return err
+		}
+		if ctx == common.PRIME_CTX {
+			if interlinkHashes[hash], err = rebuildSnapshotInterlinkHashes(s, block, child, interlinkHashes[parentHash]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if inboundEtxs, ok := s.inboundEtxs[s.head]; ok {
+		if !headCoincident {
+			return fmt.Errorf("%w: inbound ETXs of head %s which is not coincident with its dom", errArchiveCorrupted, s.head.Hex())
+		}
+		for _, etx := range inboundEtxs {
+			if etx.Type() != types.ExternalTxType || etx.To() == nil {
+				return fmt.Errorf("%w: inbound ETX %s is not an external transaction", errArchiveCorrupted, etx.Hash().Hex())
+			}
+		}
+		if len(inboundEtxs.FilterToSub(s.location, common.REGION_CTX)) != len(inboundEtxs) {
+			return fmt.Errorf("%w: inbound ETXs of head %s go to another zone", errArchiveCorrupted, s.head.Hex())
+		}
+	}
+	if s.ph != nil {
+		wo := s.ph.WorkObject()
+		phTermini := s.ph.Termini()
+		parentHash := wo.ParentHash(ctx)
+		switch {
+		case !inChain[parentHash]:
+			return fmt.Errorf("%w: pending header doesn't build on a block of the snapshot", errArchiveCorrupted)
+		case wo.NumberU64(ctx) != s.blocks[parentHash].NumberU64(ctx)+1:
+			return fmt.Errorf("%w: pending header number doesn't follow its parent", errArchiveCorrupted)
+		case !phTermini.IsValid() || phTermini.DomTerminus(s.location) != s.phKey:
+			return fmt.Errorf("%w: pending header doesn't match its key %s", errArchiveCorrupted, s.phKey.Hex())
+		case !equalSnapshotHashes(phTermini.SubTermini(), termini[parentHash].SubTermini()):
+			return fmt.Errorf("%w: sub termini of the pending header don't match the ones of its parent", errArchiveCorrupted)
+		}
+	}
+	for key, body := range s.bodies {
+		if s.ph == nil || key != s.ph.WorkObject().SealHash() || key != body.SealHash() {
+			return fmt.Errorf("%w: pending body %s doesn't match the pending header", errArchiveCorrupted, key.Hex())
+		}
+	}
+	delete(termini, s.genesis)
+	delete(manifests, s.genesis)
+	delete(interlinkHashes, s.genesis)
+	s.termini, s.manifests, s.interlinkHashes = termini, manifests, interlinkHashes
+	return nil
+}
+
+// rebuildSnapshotManifest returns the manifest of a block, the blocks of its
+// slice since the last coincident one. The manifest hash of the child of the
+// block commits to it, without a child it follows from the order of the
+// block. Prime blocks have an empty manifest.
+func rebuildSnapshotManifest(s *snapshotSlice, block, child *types.WorkObject, parentManifest types.BlockManifest) (types.BlockManifest, error) {
+	var (
+		ctx        = s.location.Context()
+		hash       = block.Hash()
+		coincident = types.BlockManifest{hash}
+		manifest   types.BlockManifest
+	)
+	switch {
+	case ctx == common.PRIME_CTX:
+		manifest = types.BlockManifest{}
+
+	case child != nil:
+		committed := child.ManifestHash(ctx)
+		switch {
+		case types.DeriveSha(coincident, trie.NewStackTrie(nil)) == committed:
+			manifest = coincident
+		case parentManifest != nil:
+			manifest = append(append(types.BlockManifest{}, parentManifest...), hash)
+		default:
+			// The manifest of the oldest block lists blocks before the
+			// snapshot, it can only be checked against its child
+			manifest = s.manifests[hash]
+		}
+		if len(manifest) == 0 || manifest[len(manifest)-1] != hash || types.DeriveSha(manifest, trie.NewStackTrie(nil)) != committed {
+			return nil, fmt.Errorf("%w: manifest of block %s doesn't match the manifest hash of its child", errArchiveCorrupted, hash.Hex())
+		}
+
+	default:
+		_, order, err := s.engine.CalcOrder(block)
+		if err != nil {
+			return nil, err
+		}
+		if order < ctx {
+			manifest = coincident
+		} else if parentManifest != nil {
+			manifest = append(append(types.BlockManifest{}, parentManifest...), hash)
+		} else {
+			return nil, fmt.Errorf("%w: too few blocks to rebuild the manifest of head %s", errArchiveCorrupted, hash.Hex())
+		}
+	}
+	if given, ok := s.manifests[hash]; ok && !equalSnapshotHashes(given, manifest) {
+		return nil, fmt.Errorf("%w: manifest of block %s doesn't match the one rebuilt from the chain", errArchiveCorrupted, hash.Hex())
+	}
+	return manifest, nil
+}
+
+// rebuildSnapshotTermini returns the termini of a block from the ones of its
+// parent, as the slice computes them on append. Without the termini of the
+// parent, for the oldest block, the ones of the snapshot are the base.
+func rebuildSnapshotTermini(s *snapshotSlice, block *types.WorkObject, coincident bool, parentTermini *types.Termini) (types.Termini, error) {
+	var (
+		ctx      = s.location.Context()
+		hash     = block.Hash()
+		domIndex = s.location.DomIndex(s.location)
+	)
+	given, ok := s.termini[hash]
+	if parentTermini == nil {
+		if !ok || !given.IsValid() {
+			return types.Termini{}, fmt.Errorf("%w: termini of oldest block %s missing", errArchiveCorrupted, hash.Hex())
+		}
+		// The slice only sets its own dom terminus, and the sub termini of
+		// regions and prime
+		for i, terminus := range given.DomTermini() {
+			if i != domIndex && terminus != s.genesis {
+				return types.Termini{}, fmt.Errorf("%w: termini of block %s set a dom terminus of another slice", errArchiveCorrupted, hash.Hex())
+			}
+		}
+		for _, terminus := range given.SubTermini() {
+			if ctx == common.ZONE_CTX && terminus != s.genesis {
+				return types.Termini{}, fmt.Errorf("%w: termini of zone block %s set a sub terminus", errArchiveCorrupted, hash.Hex())
+			}
+		}
+		parentTermini = &given
+	}
+	termini := types.CopyTermini(*parentTermini)
+	if ctx != common.ZONE_CTX {
+		termini.SetSubTerminiAtIndex(hash, block.Location().SubIndex(ctx))
+	}
+	if coincident {
+		termini.SetDomTerminiAtIndex(hash, domIndex)
+	}
+	if ok && !(equalSnapshotHashes(given.DomTermini(), termini.DomTermini()) && equalSnapshotHashes(given.SubTermini(), termini.SubTermini())) {
+		return types.Termini{}, fmt.Errorf("%w: termini of block %s don't match the ones rebuilt from the chain", errArchiveCorrupted, hash.Hex())
+	}
+	return termini, nil
+}
+
+// rebuildSnapshotInterlinkHashes returns the interlink hashes stored for a
+// prime block, the ones of its child. The interlink root hash of the child
+// commits to them, without a child they follow from the rank of the block as
+// the worker computes them.
+func rebuildSnapshotInterlinkHashes(s *snapshotSlice, block, child *types.WorkObject, parentInterlinkHashes common.Hashes) (common.Hashes, error) {
+	hash := block.Hash()
+	given, ok := s.interlinkHashes[hash]
+	if child != nil {
+		interlinkHashes := given
+		if !ok {
+			interlinkHashes = child.InterlinkHashes()
+		}
+		if types.DeriveSha(interlinkHashes, trie.NewStackTrie(nil)) != child.InterlinkRootHash() {
+			return nil, fmt.Errorf("%w: interlink hashes of block %s don't match the interlink root hash of its child", errArchiveCorrupted, hash.Hex())
+		}
+		return interlinkHashes, nil
+	}
+	if parentInterlinkHashes == nil {
+		return nil, fmt.Errorf("%w: too few blocks to rebuild the interlink hashes of head %s", errArchiveCorrupted, hash.Hex())
+	}
+	rank, err := s.engine.CalcRank(s, block)
+	if err != nil {
+		return nil, err
+	}
+	if rank > len(parentInterlinkHashes) {
+		return nil, fmt.Errorf("rank %d of head %s above the interlink depth", rank, hash.Hex())
+	}
+	interlinkHashes := append(common.Hashes{}, parentInterlinkHashes...)
+	for i := 0; i < rank; i++ {
+		interlinkHashes[i] = hash
+	}
+	if ok && !equalSnapshotHashes(given, interlinkHashes) {
+		return nil, fmt.Errorf("%w: interlink hashes of head %s don't match the ones rebuilt from the chain", errArchiveCorrupted, hash.Hex())
+	}
+	return interlinkHashes, nil
+}
+
+// equalSnapshotHashes returns whether two lists of hashes are the same, an
+// empty list being the same as none.
+func equalSnapshotHashes(a, b []common.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeSnapshotHead moves the staged records of a slice into its database,
+// writes their verified chain data, makes its imported chain canonical and
+// sets its head, so that the slice starts from it. Only the state of the head
+// of a zone is imported, so it is the only block marked as processed and a
+// reorg below it doesn't build on missing state.
+func writeSnapshotHead(s *snapshotSlice) error {
+	ctx := s.location.Context()
+	s.batch = s.db.NewBatch()
+	it := s.staging.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		if err := s.batch.Put(it.Key(), it.Value()); err != nil {
+			return err
+		}
+		if s.batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := s.batch.Write(); err != nil {
+				return err
+			}
+			s.batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	for _, block := range s.chain {
+		rawdb.WriteCanonicalHash(s.batch, block.Hash(), block.NumberU64(ctx))
+	}
+	if ctx == common.ZONE_CTX && len(s.chain) > 0 {
+		rawdb.WriteProcessedState(s.batch, s.chain[0].Hash())
+	}
+	for hash, termini := range s.termini {
+		rawdb.WriteTermini(s.batch, hash, termini)
+	}
+	for hash, manifest := range s.manifests {
+		rawdb.WriteManifest(s.batch, hash, manifest)
+	}
+	for hash, interlinkHashes := range s.interlinkHashes {
+		rawdb.WriteInterlinkHashes(s.batch, hash, interlinkHashes)
+	}
+	for hash, inboundEtxs := range s.inboundEtxs {
+		rawdb.WriteInboundEtxs(s.batch, hash, inboundEtxs)
+	}
+	if s.ph != nil {
+		rawdb.WritePendingHeader(s.batch, s.phKey, *s.ph)
+		rawdb.WriteBestPhKey(s.batch, s.phKey)
+	}
+	if len(s.bodies) > 0 {
+		var keys common.Hashes
+		for key, body := range s.bodies {
+			rawdb.WritePbCacheBody(s.batch, key, body)
+			keys = append(keys, key)
+		}
+		rawdb.WritePbBodyKeys(s.batch, keys)
+	}
+	rawdb.WriteHeadsHashes(s.batch, common.Hashes{s.head})
+	rawdb.WriteHeadHeaderHash(s.batch, s.head)
+	rawdb.WriteHeadBlockHash(s.batch, s.head)
+	return s.batch.Write()
+}
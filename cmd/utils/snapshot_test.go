@@ -0,0 +1,376 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/consensus"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/trie"
+)
+
+// snapshotTestEngine gives the orders and ranks of the test blocks.
+type snapshotTestEngine struct {
+	consensus.Engine
+	orders map[common.Hash]int
+	ranks  map[common.Hash]int
+}
+
+func (e *snapshotTestEngine) CalcOrder(header *types.WorkObject) (*big.Int, int, error) {
+	return new(big.Int), e.orders[header.Hash()], nil
+}
+
+func (e *snapshotTestEngine) CalcRank(chain consensus.GenesisReader, header *types.WorkObject) (int, error) {
+	return e.ranks[header.Hash()], nil
+}
+
+var snapshotTestLocations = []common.Location{{}, {0}, {0, 0}}
+
+// snapshotTestChain is a chain of zone blocks of the given orders, with the
+// chain data each slice writes for them in its own database.
+type snapshotTestChain struct {
+	genesis common.Hash
+	engine  *snapshotTestEngine
+	slices  []*snapshotSlice // prime, region and zone
+}
+
+func newSnapshotTestChain(orders []int) *snapshotTestChain {
+	var (
+		zoneLocation = snapshotTestLocations[common.ZONE_CTX]
+		engine       = &snapshotTestEngine{orders: make(map[common.Hash]int), ranks: make(map[common.Hash]int)}
+		genesis      = types.EmptyHeader(common.ZONE_CTX)
+	)
+	genesis.WorkObjectHeader().SetLocation(zoneLocation)
+	genesisHash := genesis.Hash()
+
+	// Chain data of every context, starting from the genesis one
+	var (
+		parents   [common.HierarchyDepth]common.Hash
+		numbers   [common.HierarchyDepth]uint64
+		manifests [common.HierarchyDepth]map[common.Hash]types.BlockManifest
+		termini   [common.HierarchyDepth]map[common.Hash]types.Termini
+		slices    = make([]*snapshotSlice, common.HierarchyDepth)
+
+		interlinkHashes = map[common.Hash]common.Hashes{genesisHash: {genesisHash, genesisHash, genesisHash, genesisHash}}
+	)
+	genesisTermini := types.EmptyTermini()
+	for i := 0; i < common.MaxWidth; i++ {
+		genesisTermini.SetDomTerminiAtIndex(genesisHash, i)
+		genesisTermini.SetSubTerminiAtIndex(genesisHash, i)
+	}
+	for ctx := common.PRIME_CTX; ctx <= common.ZONE_CTX; ctx++ {
+		parents[ctx] = genesisHash
+		manifests[ctx] = map[common.Hash]types.BlockManifest{genesisHash: {genesisHash}}
+		termini[ctx] = map[common.Hash]types.Termini{genesisHash: genesisTermini}
+		slices[ctx] = &snapshotSlice{location: snapshotTestLocations[ctx], db: rawdb.NewMemoryDatabase(log.Global), genesis: genesisHash}
+		rawdb.WriteWorkObject(slices[ctx].db, genesisHash, genesis, types.BlockObject, ctx)
+	}
+
+	for i, order := range orders {
+		wo := types.EmptyHeader(common.ZONE_CTX)
+		wo.WorkObjectHeader().SetLocation(zoneLocation)
+		wo.Header().SetCoinbase(common.ZeroAddress(zoneLocation))
+		for ctx := common.PRIME_CTX; ctx <= common.ZONE_CTX; ctx++ {
+			wo.SetParentHash(parents[ctx], ctx)
+			wo.SetNumber(new(big.Int).SetUint64(numbers[ctx]+1), ctx)
+			wo.Header().SetManifestHash(types.DeriveSha(manifests[ctx][parents[ctx]], trie.NewStackTrie(nil)), ctx)
+		}
+		wo.Header().SetPrimeTerminus(parents[common.PRIME_CTX])
+		wo.Header().SetInterlinkRootHash(types.DeriveSha(interlinkHashes[parents[common.PRIME_CTX]], trie.NewStackTrie(nil)))
+		wo.WorkObjectHeader().SetHeaderHash(wo.Header().Hash())
+		hash := wo.Hash()
+		engine.orders[hash] = order
+		engine.ranks[hash] = i % 3
+
+		// The block is in the chains of its order and of the contexts below
+		for ctx := order; ctx <= common.ZONE_CTX; ctx++ {
+			parent := parents[ctx]
+			manifest := types.BlockManifest{}
+			if ctx != common.PRIME_CTX && order < ctx {
+				manifest = types.BlockManifest{hash}
+			} else if ctx != common.PRIME_CTX {
+				manifest = append(append(types.BlockManifest{}, manifests[ctx][parent]...), hash)
+			}
+			blockTermini := types.CopyTermini(termini[ctx][parent])
+			if ctx != common.ZONE_CTX {
+				blockTermini.SetSubTerminiAtIndex(hash, zoneLocation.SubIndex(ctx))
+			}
+			if ctx == common.PRIME_CTX || order < ctx {
+				blockTermini.SetDomTerminiAtIndex(hash, 0)
+			}
+			manifests[ctx][hash], termini[ctx][hash] = manifest, blockTermini
+
+			db := slices[ctx].db
+			rawdb.WriteWorkObject(db, hash, wo, types.BlockObject, ctx)
+			rawdb.WriteManifest(db, hash, manifest)
+			rawdb.WriteTermini(db, hash, blockTermini)
+			if ctx == common.PRIME_CTX {
+				blockInterlinkHashes := append(common.Hashes{}, interlinkHashes[parent]...)
+				for j := 0; j < engine.ranks[hash]; j++ {
+					blockInterlinkHashes[j] = hash
+				}
+				interlinkHashes[hash] = blockInterlinkHashes
+				rawdb.WriteInterlinkHashes(db, hash, blockInterlinkHashes)
+			}
+			parents[ctx] = hash
+			numbers[ctx]++
+		}
+	}
+
+	// Every slice has a pending header on its head, the zone its body and the
+	// inbound ETXs of its head as well
+	for ctx, s := range slices {
+		s.head = parents[ctx]
+		wo := types.EmptyHeader(common.ZONE_CTX)
+		wo.WorkObjectHeader().SetLocation(zoneLocation)
+		wo.SetParentHash(s.head, ctx)
+		wo.SetNumber(new(big.Int).SetUint64(numbers[ctx]+1), ctx)
+		wo.SetTx(nil)
+		ph := types.NewPendingHeader(wo, termini[ctx][s.head])
+		key := ph.Termini().DomTerminus(s.location)
+		rawdb.WritePendingHeader(s.db, key, ph)
+		rawdb.WriteBestPhKey(s.db, key)
+		if ctx == common.ZONE_CTX {
+			rawdb.WritePbCacheBody(s.db, wo.SealHash(), types.CopyWorkObject(wo))
+			rawdb.WritePbBodyKeys(s.db, common.Hashes{wo.SealHash()})
+			rawdb.WriteInboundEtxs(s.db, s.head, types.Transactions{newSnapshotTestEtx(zoneLocation)})
+		}
+	}
+	return &snapshotTestChain{genesis: genesisHash, engine: engine, slices: slices}
+}
+
+func newSnapshotTestEtx(location common.Location) *types.Transaction {
+	to := common.ZeroAddress(location)
+	return types.NewTx(&types.ExternalTx{OriginatingTxHash: common.Hash{1}, Gas: 21000, To: &to, Value: new(big.Int), Sender: to})
+}
+
+func (c *snapshotTestChain) export(t *testing.T) []byte {
+	require.NoError(t, collectSnapshotChains(c.slices))
+	var buf bytes.Buffer
+	aw, err := newArchiveWriter(&buf, snapshotMagic)
+	require.NoError(t, err)
+	for _, s := range c.slices {
+		require.NoError(t, exportSnapshotSlice(aw, s, c.slices))
+	}
+	require.NoError(t, aw.close())
+	return buf.Bytes()
+}
+
+// importInto imports a snapshot into new databases, trusting the given hashes.
+func (c *snapshotTestChain) importInto(snapshot []byte, trustedHashes []common.Hash) (map[string]*snapshotSlice, error) {
+	ar, err := newArchiveReader(bytes.NewReader(snapshot), snapshotMagic)
+	if err != nil {
+		return nil, err
+	}
+	trusted := make(map[common.Hash]bool)
+	for _, hash := range trustedHashes {
+		trusted[hash] = false
+	}
+	slices := make(map[string]*snapshotSlice)
+	_, err = importSnapshot(ar, trusted, slices, func(location common.Location) (*snapshotSlice, error) {
+		return newSnapshotSlice(location, nil, rawdb.NewMemoryDatabase(log.Global), rawdb.NewMemoryDatabase(log.Global), c.genesis, c.engine), nil
+	})
+	return slices, err
+}
+
+func (c *snapshotTestChain) heads() []common.Hash {
+	var heads []common.Hash
+	for _, s := range c.slices {
+		heads = append(heads, s.head)
+	}
+	return heads
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	P, R, Z := common.PRIME_CTX, common.REGION_CTX, common.ZONE_CTX
+	tests := map[string][]int{
+		"from genesis":       {P, Z, R, P},
+		"past the dom block": {P, Z, R, P, Z, R, Z, P, Z, R, P, Z, P, R},
+	}
+	for name, orders := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := newSnapshotTestChain(orders)
+			slices, err := c.importInto(c.export(t), c.heads())
+			require.NoError(t, err)
+			require.Len(t, slices, len(c.slices))
+
+			// The imported slices hold the same chain data as the exported ones
+			for _, src := range c.slices {
+				ctx := src.location.Context()
+				dst := slices[SliceName(src.location)]
+				require.NotNil(t, dst)
+				require.Equal(t, src.head, rawdb.ReadHeadBlockHash(dst.db))
+				for _, block := range src.chain {
+					hash := block.Hash()
+					require.Equal(t, hash, rawdb.ReadCanonicalHash(dst.db, block.NumberU64(ctx)))
+					require.True(t, equalSnapshotHashes(rawdb.ReadManifest(src.db, hash), rawdb.ReadManifest(dst.db, hash)), "manifest of %s", hash)
+					srcTermini, dstTermini := rawdb.ReadTermini(src.db, hash), rawdb.ReadTermini(dst.db, hash)
+					require.NotNil(t, dstTermini)
+					require.Equal(t, srcTermini.DomTermini(), dstTermini.DomTermini())
+					require.Equal(t, srcTermini.SubTermini(), dstTermini.SubTermini())
+					if ctx == common.PRIME_CTX {
+						require.Equal(t, rawdb.ReadInterlinkHashes(src.db, hash), rawdb.ReadInterlinkHashes(dst.db, hash))
+					}
+				}
+				key := rawdb.ReadBestPhKey(src.db)
+				require.Equal(t, key, rawdb.ReadBestPhKey(dst.db))
+				ph := rawdb.ReadPendingHeader(dst.db, key)
+				require.NotNil(t, ph)
+				require.Equal(t, rawdb.ReadPendingHeader(src.db, key).WorkObject().SealHash(), ph.WorkObject().SealHash())
+				if ctx == common.ZONE_CTX {
+					require.Len(t, rawdb.ReadInboundEtxs(dst.db, src.head), 1)
+					require.Equal(t, rawdb.ReadPbBodyKeys(src.db), rawdb.ReadPbBodyKeys(dst.db))
+				}
+			}
+		})
+	}
+}
+
+// processedAncestor walks back from the parent of a block the way
+// HeaderChain.SetCurrentState does, returning the first ancestor with a
+// processed state or false if the walk runs out of headers.
+func processedAncestor(db ethdb.Reader, block *types.WorkObject) (common.Hash, bool) {
+	hash := block.ParentHash(common.ZONE_CTX)
+	for {
+		header := rawdb.ReadHeader(db, hash)
+		if header == nil {
+			return common.Hash{}, false
+		}
+		if rawdb.ReadProcessedState(db, hash) {
+			return hash, true
+		}
+		hash = header.ParentHash(common.ZONE_CTX)
+	}
+}
+
+func TestSnapshotReorgBelowHead(t *testing.T) {
+	P, R, Z := common.PRIME_CTX, common.REGION_CTX, common.ZONE_CTX
+	c := newSnapshotTestChain([]int{P, Z, R, P, Z, R, Z, P, Z, R, P, Z, P, R})
+	slices, err := c.importInto(c.export(t), c.heads())
+	require.NoError(t, err)
+	src := c.slices[Z]
+	require.Greater(t, len(src.chain), 1)
+	dst := slices[SliceName(src.location)]
+
+	// Only the head of the zone has its state imported
+	require.True(t, rawdb.ReadProcessedState(dst.db, src.head))
+	for _, block := range src.chain[1:] {
+		require.False(t, rawdb.ReadProcessedState(dst.db, block.Hash()), "block %d", block.NumberU64(Z))
+	}
+
+	// A block on the head is processed from it
+	child := types.CopyWorkObject(src.chain[0])
+	child.SetParentHash(src.head, Z)
+	ancestor, ok := processedAncestor(dst.db, child)
+	require.True(t, ok)
+	require.Equal(t, src.head, ancestor)
+
+	// A block forking below the head finds no imported state to build on
+	fork := types.CopyWorkObject(src.chain[0])
+	fork.SetParentHash(src.chain[1].Hash(), Z)
+	_, ok = processedAncestor(dst.db, fork)
+	require.False(t, ok)
+}
+
+func TestSnapshotUntrustedHead(t *testing.T) {
+	c := newSnapshotTestChain([]int{common.PRIME_CTX, common.ZONE_CTX, common.REGION_CTX, common.PRIME_CTX, common.ZONE_CTX})
+	snapshot := c.export(t)
+
+	// The zone head is not trusted
+	heads := c.heads()
+	_, err := c.importInto(snapshot, heads[:common.ZONE_CTX])
+	require.Error(t, err)
+
+	// A trusted hash must be the head of a slice
+	_, err = c.importInto(snapshot, append(heads, common.Hash{1}))
+	require.Error(t, err)
+}
+
+func TestSnapshotTamperedRecords(t *testing.T) {
+	P, R, Z := common.PRIME_CTX, common.REGION_CTX, common.ZONE_CTX
+	orders := []int{P, Z, R, P, Z, R, Z, P, Z, R, P, Z, P, R}
+	bogus := common.Hash{0xba, 0xd}
+
+	tests := map[string]func(c *snapshotTestChain){
+		"termini": func(c *snapshotTestChain) {
+			zone := c.slices[Z]
+			termini := rawdb.ReadTermini(zone.db, zone.head)
+			termini.SetDomTerminiAtIndex(bogus, 0)
+			rawdb.WriteTermini(zone.db, zone.head, *termini)
+		},
+		"termini of the oldest block": func(c *snapshotTestChain) {
+			region := c.slices[R]
+			oldest := region.chain[len(region.chain)-1].Hash()
+			termini := rawdb.ReadTermini(region.db, oldest)
+			termini.SetDomTerminiAtIndex(bogus, 1)
+			rawdb.WriteTermini(region.db, oldest, *termini)
+		},
+		"manifest": func(c *snapshotTestChain) {
+			region := c.slices[R]
+			oldest := region.chain[len(region.chain)-1].Hash()
+			rawdb.WriteManifest(region.db, oldest, types.BlockManifest{bogus, oldest})
+		},
+		"manifest of the head": func(c *snapshotTestChain) {
+			zone := c.slices[Z]
+			rawdb.WriteManifest(zone.db, zone.head, types.BlockManifest{bogus, zone.head})
+		},
+		"interlink hashes": func(c *snapshotTestChain) {
+			prime := c.slices[P]
+			rawdb.WriteInterlinkHashes(prime.db, prime.chain[1].Hash(), common.Hashes{bogus, bogus, bogus, bogus})
+		},
+		"interlink hashes of the head": func(c *snapshotTestChain) {
+			prime := c.slices[P]
+			rawdb.WriteInterlinkHashes(prime.db, prime.head, common.Hashes{bogus, bogus, bogus, bogus})
+		},
+		"pending header key": func(c *snapshotTestChain) {
+			region := c.slices[R]
+			ph := rawdb.ReadPendingHeader(region.db, rawdb.ReadBestPhKey(region.db))
+			rawdb.WritePendingHeader(region.db, bogus, *ph)
+			rawdb.WriteBestPhKey(region.db, bogus)
+		},
+		"pending header termini": func(c *snapshotTestChain) {
+			region := c.slices[R]
+			key := rawdb.ReadBestPhKey(region.db)
+			ph := rawdb.ReadPendingHeader(region.db, key)
+			termini := ph.Termini()
+			termini.SetSubTerminiAtIndex(bogus, 1)
+			ph.SetTermini(termini)
+			rawdb.WritePendingHeader(region.db, key, *ph)
+		},
+		"inbound ETXs": func(c *snapshotTestChain) {
+			zone := c.slices[Z]
+			rawdb.WriteInboundEtxs(zone.db, zone.head, types.Transactions{newSnapshotTestEtx(common.Location{0, 1})})
+		},
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := newSnapshotTestChain(orders)
+			require.NoError(t, collectSnapshotChains(c.slices))
+			tamper(c)
+			slices, err := c.importInto(c.export(t), c.heads())
+			require.True(t, errors.Is(err, errArchiveCorrupted), "%v", err)
+
+			// The rejected snapshot leaves nothing behind
+			for name, s := range slices {
+				it := s.db.NewIterator(nil, nil)
+				require.False(t, it.Next(), "%s holds %x", name, it.Key())
+				it.Release()
+			}
+		})
+	}
+
+	// The inbound ETXs of a head not coincident with its dom are refused
+	c := newSnapshotTestChain(orders[:12])
+	zone := c.slices[Z]
+	rawdb.WriteInboundEtxs(zone.db, zone.head, types.Transactions{newSnapshotTestEtx(zone.location)})
+	_, err := c.importInto(c.export(t), c.heads())
+	require.True(t, errors.Is(err, errArchiveCorrupted), "%v", err)
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core"
 	"github.com/dominant-strategies/go-quai/log"
 )
 
@@ -38,6 +39,11 @@ type Config struct {
 
 	MinDifficulty *big.Int
 
+	// GenesisAlloc and GenesisQiAlloc hold the genesis allocations of custom
+	// networks, when nil they are read from the genallocs directory
+	GenesisAlloc   map[string]core.GenesisAccount
+	GenesisQiAlloc map[string]core.GenesisUTXO
+
 	// When set, notifications sent by the remote sealer will
 	// be block header JSON objects instead of work package arrays.
 	NotifyFull bool
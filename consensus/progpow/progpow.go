@@ -16,6 +16,7 @@ import (
 	"unsafe"
 
 	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core"
 	"github.com/dominant-strategies/go-quai/log"
 	mmap "github.com/edsrzf/mmap-go"
 	"github.com/hashicorp/golang-lru/simplelru"
@@ -152,6 +153,11 @@ type Config struct {
 
 	NodeLocation common.Location
 
+	// GenesisAlloc and GenesisQiAlloc hold the genesis allocations of custom
+	// networks, when nil they are read from the genallocs directory
+	GenesisAlloc   map[string]core.GenesisAccount
+	GenesisQiAlloc map[string]core.GenesisUTXO
+
 	// When set, notifications sent by the remote sealer will
 	// be block header JSON objects instead of work package arrays.
 	NotifyFull bool
@@ -0,0 +1,298 @@
+package core
+
+import (
+	"container/heap"
+	"fmt"
+	"math/big"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/consensus/misc"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/params"
+)
+
+const (
+	// DefaultBlockBuilder orders the Quai and Qi transactions by their miner
+	// fee, the way the worker always has.
+	DefaultBlockBuilder = "default"
+	// FeesBlockBuilder orders the Quai and Qi transactions by the Quai value of
+	// the fee they leave to the miner per unit of block gas.
+	FeesBlockBuilder = "fees"
+)
+
+// BlockBuilders lists the names of the available block building strategies.
+var BlockBuilders = []string{DefaultBlockBuilder, FeesBlockBuilder}
+
+// TransactionSet is an ordered set of pending transactions that the worker
+// commits into a block one at a time.
+type TransactionSet interface {
+	// Peek returns the next transaction to commit, or nil if the set is empty.
+	Peek() *types.Transaction
+	// Shift replaces the next transaction with the following one from the same
+	// account.
+	Shift(acc common.AddressBytes, sort bool)
+	// PopNoSort drops the next transaction without replacing it.
+	PopNoSort()
+}
+
+// EtxQueue is the queue of inbound ETXs of a pending block.
+type EtxQueue interface {
+	GetOldestIndex() (*big.Int, error)
+	ReadETX(index *big.Int) (*types.Transaction, error)
+	PopETX() (*types.Transaction, error)
+}
+
+// EtxSet is the sequence of ETXs that the worker commits into a block before
+// any Quai or Qi transaction.
+type EtxSet interface {
+	// Next removes the next ETX to commit from the queue, given the gas used by
+	// the block so far, or returns nil once no more ETXs are to be included.
+	Next(gasUsed uint64) (*types.Transaction, error)
+}
+
+// BlockBuilder chooses and orders the transactions the worker commits into a
+// pending block.
+type BlockBuilder interface {
+	// Name returns the name the builder is selected by.
+	Name() string
+
+	// Etxs returns the ETXs of the queue to commit into a block of the given gas
+	// limit. Consensus requires the ETXs to be included in the order they were
+	// queued and, while any are queued, to use between the minimum and maximum
+	// ETX gas of the block, so a builder chooses how far into the queue to go.
+	// pendingGas is the most gas the pending Quai and Qi transactions can use.
+	Etxs(queue EtxQueue, gasLimit uint64, pendingGas uint64) EtxSet
+
+	// Transactions returns the pending Quai and Qi transactions in the order the
+	// worker should try them. The pending maps are owned by the set afterwards.
+	Transactions(signer types.Signer, parent *types.WorkObject, baseFee *big.Int, qiTxs map[common.Hash]*types.TxWithMinerFee, txs map[common.AddressBytes]types.Transactions) TransactionSet
+}
+
+// NewBlockBuilder returns the block building strategy with the given name for
+// a node at the given location.
+func NewBlockBuilder(name string, location common.Location) (BlockBuilder, error) {
+	switch name {
+	case "", DefaultBlockBuilder:
+		return &defaultBlockBuilder{}, nil
+	case FeesBlockBuilder:
+		return &feesBlockBuilder{location: location}, nil
+	default:
+		return nil, fmt.Errorf("unknown block builder %q, must be one of %v", name, BlockBuilders)
+	}
+}
+
+// defaultBlockBuilder fills the minimum ETX gas and orders the transactions by
+// miner fee through types.TransactionsByPriceAndNonce.
+type defaultBlockBuilder struct{}
+
+func (b *defaultBlockBuilder) Name() string { return DefaultBlockBuilder }
+
+func (b *defaultBlockBuilder) Etxs(queue EtxQueue, gasLimit uint64, pendingGas uint64) EtxSet {
+	minEtxGas, maxEtxGas := etxGasRange(gasLimit)
+	return &etxsUpToGas{queue: queue, target: minEtxGas, minEtxGas: minEtxGas, maxEtxGas: maxEtxGas}
+}
+
+func (b *defaultBlockBuilder) Transactions(signer types.Signer, parent *types.WorkObject, baseFee *big.Int, qiTxs map[common.Hash]*types.TxWithMinerFee, txs map[common.AddressBytes]types.Transactions) TransactionSet {
+	return types.NewTransactionsByPriceAndNonce(signer, qiTxs, txs, baseFee, true)
+}
+
+// feesBlockBuilder orders the Quai and Qi transactions together by fee per
+// gas. The Qi fees are converted to Quai at the rate of the parent block. ETXs
+// leave no fee to the miner, so it fills the minimum ETX gas, and only goes on
+// up to the maximum with the gas the pending transactions leave unused.
+type feesBlockBuilder struct {
+	location common.Location
+}
+
+func (b *feesBlockBuilder) Name() string { return FeesBlockBuilder }
+
+func (b *feesBlockBuilder) Etxs(queue EtxQueue, gasLimit uint64, pendingGas uint64) EtxSet {
+	minEtxGas, maxEtxGas := etxGasRange(gasLimit)
+	target := minEtxGas
+	if pendingGas < gasLimit && gasLimit-pendingGas > target {
+		target = gasLimit - pendingGas
+	}
+	if target > maxEtxGas {
+		target = maxEtxGas
+	}
+	return &etxsUpToGas{queue: queue, target: target, minEtxGas: minEtxGas, maxEtxGas: maxEtxGas}
+}
+
+func (b *feesBlockBuilder) Transactions(signer types.Signer, parent *types.WorkObject, baseFee *big.Int, qiTxs map[common.Hash]*types.TxWithMinerFee, txs map[common.AddressBytes]types.Transactions) TransactionSet {
+	set := &txsByFeePerGas{
+		txs:     txs,
+		heads:   make(feePerGasHeap, 0, len(txs)+len(qiTxs)),
+		baseFee: baseFee,
+	}
+	for from, accTxs := range txs {
+		acc, err := types.Sender(signer, accTxs[0])
+		if err != nil || acc.Bytes20() != from {
+			delete(txs, from)
+			continue
+		}
+		head, err := newQuaiFeePerGas(accTxs[0], baseFee)
+		if err != nil {
+			delete(txs, from)
+			continue
+		}
+		set.heads = append(set.heads, head)
+		txs[from] = accTxs[1:]
+	}
+	for _, qiTx := range qiTxs {
+		set.heads = append(set.heads, b.qiFeePerGas(parent, qiTx))
+	}
+	heap.Init(&set.heads)
+	return set
+}
+
+// qiFeePerGas converts the fee a Qi transaction leaves to the miner into Quai
+// and spreads it over the block gas the transaction uses.
+func (b *feesBlockBuilder) qiFeePerGas(parent *types.WorkObject, qiTx *types.TxWithMinerFee) *txFeePerGas {
+	fee := new(big.Int)
+	if qiTx.MinerFee() != nil && parent != nil {
+		fee = misc.QiToQuai(parent, qiTx.MinerFee())
+	}
+	if gas := types.CalculateBlockQiTxGas(qiTx.Tx(), b.location); gas > 0 {
+		fee.Div(fee, new(big.Int).SetUint64(gas))
+	}
+	return &txFeePerGas{tx: qiTx.Tx(), feePerGas: fee}
+}
+
+// newQuaiFeePerGas wraps a Quai transaction with its effective miner tip.
+func newQuaiFeePerGas(tx *types.Transaction, baseFee *big.Int) (*txFeePerGas, error) {
+	tip, err := tx.EffectiveGasTip(baseFee)
+	if err != nil {
+		return nil, err
+	}
+	return &txFeePerGas{tx: tx, feePerGas: tip}, nil
+}
+
+// txFeePerGas wraps a transaction with the Quai fee per gas left to the miner.
+type txFeePerGas struct {
+	tx        *types.Transaction
+	feePerGas *big.Int
+}
+
+// feePerGasHeap is a max heap of transactions by fee per gas, breaking ties by
+// the time the transactions were first seen.
+type feePerGasHeap []*txFeePerGas
+
+func (h feePerGasHeap) Len() int { return len(h) }
+func (h feePerGasHeap) Less(i, j int) bool {
+	cmp := h[i].feePerGas.Cmp(h[j].feePerGas)
+	if cmp == 0 {
+		return h[i].tx.Time().Before(h[j].tx.Time())
+	}
+	return cmp > 0
+}
+func (h feePerGasHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *feePerGasHeap) Push(x interface{}) {
+	*h = append(*h, x.(*txFeePerGas))
+}
+
+func (h *feePerGasHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// txsByFeePerGas is the transaction set of the fees block builder. It keeps the
+// heads sorted at all times, so the sort hints of the worker are ignored.
+type txsByFeePerGas struct {
+	txs     map[common.AddressBytes]types.Transactions // Per account nonce-sorted list of Quai transactions
+	heads   feePerGasHeap                              // Next transaction for each account and all the Qi transactions
+	baseFee *big.Int                                   // Current base fee
+}
+
+// Peek returns the next transaction by fee per gas.
+func (t *txsByFeePerGas) Peek() *types.Transaction {
+	if len(t.heads) == 0 {
+		return nil
+	}
+	return t.heads[0].tx
+}
+
+// Shift replaces the current head with the next transaction from the same
+// account.
+func (t *txsByFeePerGas) Shift(acc common.AddressBytes, sort bool) {
+	if txs, ok := t.txs[acc]; ok && len(txs) > 0 {
+		if head, err := newQuaiFeePerGas(txs[0], t.baseFee); err == nil {
+			t.heads[0], t.txs[acc] = head, txs[1:]
+			heap.Fix(&t.heads, 0)
+			return
+		}
+	}
+	t.PopNoSort()
+}
+
+// PopNoSort removes the current head without replacing it.
+func (t *txsByFeePerGas) PopNoSort() {
+	if len(t.heads) > 0 {
+		heap.Pop(&t.heads)
+	}
+}
+
+// etxGasRange returns the minimum and maximum gas the ETXs of a block with the
+// given gas limit must use while any are queued.
+func etxGasRange(gasLimit uint64) (uint64, uint64) {
+	minEtxGas := gasLimit / params.MinimumEtxGasDivisor
+	return minEtxGas, minEtxGas * params.MaximumEtxGasMultiplier
+}
+
+// etxsUpToGas takes ETXs from the front of the queue until the block uses the
+// target gas. Past the minimum ETX gas, an ETX is only taken if it cannot
+// push the block beyond the maximum ETX gas.
+type etxsUpToGas struct {
+	queue     EtxQueue
+	target    uint64 // Gas used by the block after which no more ETXs are taken
+	minEtxGas uint64 // Gas below which ETXs are taken unconditionally
+	maxEtxGas uint64 // Gas that the ETXs past the minimum must fit in
+}
+
+// Next pops the next ETX of the queue if the block has not used the target gas.
+func (s *etxsUpToGas) Next(gasUsed uint64) (*types.Transaction, error) {
+	if gasUsed >= s.target {
+		return nil, nil
+	}
+	if gasUsed >= s.minEtxGas {
+		oldestIndex, err := s.queue.GetOldestIndex()
+		if err != nil {
+			return nil, err
+		}
+		etx, err := s.queue.ReadETX(oldestIndex)
+		if err != nil || etx == nil {
+			return nil, err
+		}
+		if gasUsed+maxEtxGasUsed(etx) > s.maxEtxGas {
+			return nil, nil
+		}
+	}
+	return s.queue.PopETX()
+}
+
+// maxEtxGasUsed returns the most gas the ETX can use in a block, which is its
+// gas limit or the gas of a plain transfer if rejected.
+func maxEtxGasUsed(etx *types.Transaction) uint64 {
+	if gas := etx.Gas(); gas > params.TxGas {
+		return gas
+	}
+	return params.TxGas
+}
+
+// pendingTransactionsGas returns the most gas the pending Quai and Qi
+// transactions can use in a block at the given location.
+func pendingTransactionsGas(qiTxs map[common.Hash]*types.TxWithMinerFee, txs map[common.AddressBytes]types.Transactions, location common.Location) uint64 {
+	var gas uint64
+	for _, qiTx := range qiTxs {
+		gas += types.CalculateBlockQiTxGas(qiTx.Tx(), location)
+	}
+	for _, accTxs := range txs {
+		for _, tx := range accTxs {
+			gas += tx.Gas()
+		}
+	}
+	return gas
+}
@@ -0,0 +1,220 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/crypto"
+)
+
+var builderTestLocation = common.Location{0, 0}
+
+// testEtxQueue is an in-memory ETX queue for the block builder tests.
+type testEtxQueue struct {
+	etxs   []*types.Transaction
+	popped int
+}
+
+func newTestEtxQueue(gas ...uint64) *testEtxQueue {
+	queue := new(testEtxQueue)
+	for i, g := range gas {
+		to := common.ZeroAddress(builderTestLocation)
+		queue.etxs = append(queue.etxs, types.NewTx(&types.ExternalTx{ETXIndex: uint16(i), Gas: g, To: &to, Value: new(big.Int)}))
+	}
+	return queue
+}
+
+func (q *testEtxQueue) GetOldestIndex() (*big.Int, error) {
+	return big.NewInt(int64(q.popped)), nil
+}
+
+func (q *testEtxQueue) ReadETX(index *big.Int) (*types.Transaction, error) {
+	if i := int(index.Int64()); i < len(q.etxs) {
+		return q.etxs[i], nil
+	}
+	return nil, nil
+}
+
+func (q *testEtxQueue) PopETX() (*types.Transaction, error) {
+	if q.popped == len(q.etxs) {
+		return nil, nil
+	}
+	q.popped++
+	return q.etxs[q.popped-1], nil
+}
+
+// commitTestEtxs drains an ETX set the way the worker does, charging every ETX
+// its full gas, and returns the number of ETXs and the gas they used.
+func commitTestEtxs(t *testing.T, etxs EtxSet) (int, uint64) {
+	t.Helper()
+	var (
+		count   int
+		gasUsed uint64
+	)
+	for {
+		etx, err := etxs.Next(gasUsed)
+		if err != nil {
+			t.Fatalf("failed to get next etx: %v", err)
+		}
+		if etx == nil {
+			return count, gasUsed
+		}
+		count++
+		gasUsed += etx.Gas()
+	}
+}
+
+func TestBlockBuilderEtxs(t *testing.T) {
+	const gasLimit = 1000000 // ETXs must use between 200000 and 400000 gas
+
+	tests := []struct {
+		builder    string
+		pendingGas uint64
+		etxGas     []uint64
+		count      int
+		gasUsed    uint64
+	}{
+		// The default builder always stops at the minimum ETX gas
+		{DefaultBlockBuilder, 0, []uint64{50000, 50000, 50000, 50000, 50000, 50000}, 4, 200000},
+		{DefaultBlockBuilder, gasLimit, []uint64{50000, 50000, 50000, 50000, 50000, 50000}, 4, 200000},
+		{DefaultBlockBuilder, 0, []uint64{150000, 150000, 150000}, 2, 300000},
+		// The fees builder stops at the minimum ETX gas if the pending
+		// transactions can fill the rest of the block
+		{FeesBlockBuilder, gasLimit, []uint64{50000, 50000, 50000, 50000, 50000, 50000}, 4, 200000},
+		{FeesBlockBuilder, gasLimit - 200000, []uint64{50000, 50000, 50000, 50000, 50000, 50000}, 4, 200000},
+		// and fills the gas they leave unused up to the maximum ETX gas
+		{FeesBlockBuilder, gasLimit - 300000, []uint64{50000, 50000, 50000, 50000, 50000, 50000, 50000, 50000}, 6, 300000},
+		{FeesBlockBuilder, 0, []uint64{50000, 50000, 50000, 50000, 50000, 50000, 50000, 50000, 50000, 50000}, 8, 400000},
+		// without taking an ETX which could go beyond the maximum
+		{FeesBlockBuilder, 0, []uint64{150000, 150000, 150000}, 2, 300000},
+		{FeesBlockBuilder, 0, []uint64{150000, 150000, 100000}, 3, 400000},
+		// An empty or short queue is drained
+		{FeesBlockBuilder, 0, nil, 0, 0},
+		{DefaultBlockBuilder, 0, []uint64{50000}, 1, 50000},
+	}
+	for i, tt := range tests {
+		builder, err := NewBlockBuilder(tt.builder, builderTestLocation)
+		if err != nil {
+			t.Fatalf("test %d: failed to create block builder: %v", i, err)
+		}
+		queue := newTestEtxQueue(tt.etxGas...)
+		count, gasUsed := commitTestEtxs(t, builder.Etxs(queue, gasLimit, tt.pendingGas))
+		if count != tt.count || gasUsed != tt.gasUsed {
+			t.Errorf("test %d (%s): etxs mismatch: have %d using %d gas, want %d using %d gas", i, tt.builder, count, gasUsed, tt.count, tt.gasUsed)
+		}
+		// ETXs are taken from the front of the queue in order and the ones not
+		// included are left queued
+		if queue.popped != count {
+			t.Errorf("test %d (%s): popped etxs mismatch: have %d, want %d", i, tt.builder, queue.popped, count)
+		}
+	}
+}
+
+// builderTestTxs creates the pending transactions of the builder tests: two
+// Quai transactions of one account, one of another and a Qi transaction.
+func builderTestTxs(t *testing.T, signer types.Signer) (map[common.AddressBytes]types.Transactions, map[common.Hash]*types.TxWithMinerFee, []*types.Transaction) {
+	t.Helper()
+	keyA, _ := crypto.GenerateKey()
+	keyB, _ := crypto.GenerateKey()
+
+	quaiTx := func(key *ecdsa.PrivateKey, nonce uint64, tip int64) *types.Transaction {
+		to := common.ZeroAddress(builderTestLocation)
+		tx, err := types.SignTx(types.NewTx(&types.QuaiTx{
+			ChainID:   big.NewInt(1),
+			Nonce:     nonce,
+			GasTipCap: big.NewInt(tip),
+			GasFeeCap: big.NewInt(tip),
+			Gas:       21000,
+			To:        &to,
+			Value:     new(big.Int),
+		}), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		return tx
+	}
+	a0, a1 := quaiTx(keyA, 0, 100000000000), quaiTx(keyA, 1, 100000000)
+	b0 := quaiTx(keyB, 0, 1000000000)
+
+	// A Qi transaction leaving 1 qit to the miner, worth 10^15 its at the rate
+	// of the test parent, over 12800 gas
+	address := make([]byte, common.AddressLength)
+	address[1] = 0x80 // Qi ledger
+	qi := types.NewTx(&types.QiTx{
+		ChainID: big.NewInt(1),
+		TxIn:    types.TxIns{{PreviousOutPoint: *types.NewOutPoint(&common.Hash{1}, 0)}},
+		TxOut:   types.TxOuts{{Denomination: 1, Address: address}},
+	})
+	qiTx, err := types.NewTxWithMinerFee(qi, nil, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("failed to wrap qi transaction: %v", err)
+	}
+	txs := map[common.AddressBytes]types.Transactions{
+		crypto.PubkeyToAddress(keyA.PublicKey, builderTestLocation).Bytes20(): {a0, a1},
+		crypto.PubkeyToAddress(keyB.PublicKey, builderTestLocation).Bytes20(): {b0},
+	}
+	return txs, map[common.Hash]*types.TxWithMinerFee{qi.Hash(): qiTx}, []*types.Transaction{a0, a1, b0, qi}
+}
+
+// drainTestTxs returns the transactions of a set in the order the worker
+// commits them if all succeed.
+func drainTestTxs(txs TransactionSet) []*types.Transaction {
+	var ordered []*types.Transaction
+	for tx := txs.Peek(); tx != nil; tx = txs.Peek() {
+		ordered = append(ordered, tx)
+		if tx.Type() == types.QiTxType {
+			txs.PopNoSort()
+			continue
+		}
+		from, _ := types.Sender(types.LatestSignerForChainID(big.NewInt(1), builderTestLocation), tx)
+		txs.Shift(from.Bytes20(), true)
+	}
+	return ordered
+}
+
+func TestBlockBuilderTransactions(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1), builderTestLocation)
+	parent := types.EmptyHeader(common.ZONE_CTX)
+
+	tests := []struct {
+		builder string
+		order   []int // indexes into a0, a1, b0, qi
+	}{
+		// The default builder compares the Qi fee in qits to the Quai tips
+		{DefaultBlockBuilder, []int{0, 2, 1, 3}},
+		// while the fees builder compares both in its per gas
+		{FeesBlockBuilder, []int{0, 3, 2, 1}},
+	}
+	for _, tt := range tests {
+		builder, err := NewBlockBuilder(tt.builder, builderTestLocation)
+		if err != nil {
+			t.Fatalf("failed to create block builder: %v", err)
+		}
+		if builder.Name() != tt.builder {
+			t.Fatalf("block builder name mismatch: have %s, want %s", builder.Name(), tt.builder)
+		}
+		txs, qiTxs, all := builderTestTxs(t, signer)
+		ordered := drainTestTxs(builder.Transactions(signer, parent, new(big.Int), qiTxs, txs))
+		if len(ordered) != len(tt.order) {
+			t.Fatalf("%s: transaction count mismatch: have %d, want %d", tt.builder, len(ordered), len(tt.order))
+		}
+		for i, index := range tt.order {
+			if ordered[i].Hash() != all[index].Hash() {
+				t.Errorf("%s: transaction %d mismatch: have %x, want %x", tt.builder, i, ordered[i].Hash(), all[index].Hash())
+			}
+		}
+	}
+}
+
+func TestNewBlockBuilder(t *testing.T) {
+	builder, err := NewBlockBuilder("", builderTestLocation)
+	if err != nil || builder.Name() != DefaultBlockBuilder {
+		t.Fatalf("empty name does not select the default block builder: %v", err)
+	}
+	if _, err := NewBlockBuilder("unknown", builderTestLocation); err == nil {
+		t.Fatalf("unknown block builder accepted")
+	}
+}
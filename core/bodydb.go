@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -91,7 +92,7 @@ func NewBodyDb(db ethdb.Database, engine consensus.Engine, hc *HeaderChain, chai
 }
 
 // Append
-func (bc *BodyDb) Append(block *types.WorkObject) ([]*types.Log, error) {
+func (bc *BodyDb) Append(ctx context.Context, block *types.WorkObject) ([]*types.Log, error) {
 	bc.chainmu.Lock()
 	defer bc.chainmu.Unlock()
 
@@ -102,7 +103,7 @@ func (bc *BodyDb) Append(block *types.WorkObject) ([]*types.Log, error) {
 	var err error
 	if nodeCtx == common.ZONE_CTX && bc.ProcessingState() {
 		// Process our block
-		logs, err = bc.processor.Apply(batch, block)
+		logs, err = bc.processor.Apply(ctx, batch, block)
 		if err != nil {
 			return nil, err
 		}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"io"
 	"math/big"
@@ -25,6 +26,7 @@ import (
 	"github.com/dominant-strategies/go-quai/ethdb"
 	"github.com/dominant-strategies/go-quai/event"
 	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/metrics_config"
 	"github.com/dominant-strategies/go-quai/params"
 	"github.com/dominant-strategies/go-quai/rlp"
 	"github.com/dominant-strategies/go-quai/trie"
@@ -71,6 +73,8 @@ type Core struct {
 
 	normalListBackoff uint64 // normalListBackoff is the multiple on c_normalListProcCounter which delays the proc on normal list
 
+	sync syncTracker // progress of the sync against the blocks known from the peers
+
 	quit chan struct{} // core quit channel
 
 	logger *log.Logger
@@ -102,6 +106,7 @@ func NewCore(db ethdb.Database, config *Config, isLocalBlock func(block *types.W
 
 	go c.updateAppendQueue()
 	go c.startStatsTimer()
+	go c.startSyncTracker()
 	if c.NodeCtx() == common.ZONE_CTX && c.ProcessingState() {
 		go c.startRemoteTxQueue()
 	}
@@ -134,7 +139,7 @@ func (c *Core) InsertChain(blocks types.WorkObjects) (int, error) {
 				}).Info("Already processing block")
 				return idx, errors.New("Already in process of appending this block")
 			}
-			newPendingEtxs, _, _, err := c.sl.Append(block, types.EmptyHeader(c.NodeCtx()), common.Hash{}, false, nil)
+			newPendingEtxs, _, _, err := c.sl.Append(context.Background(), block, types.EmptyHeader(c.NodeCtx()), common.Hash{}, false, nil)
 			c.processingCache.Remove(block.Hash())
 			if err == nil {
 				// If we have a dom, send the dom any pending ETXs which will become
@@ -179,8 +184,10 @@ func (c *Core) InsertChain(blocks types.WorkObjects) (int, error) {
 				}
 				if err.Error() == ErrSubNotSyncedToDom.Error() ||
 					err.Error() == ErrPendingEtxNotFound.Error() {
-					if nodeCtx != common.ZONE_CTX && c.sl.subInterface[block.Location().SubIndex(c.NodeCtx())] != nil {
-						c.sl.subInterface[block.Location().SubIndex(c.NodeCtx())].DownloadBlocksInManifest(block.Hash(), block.Manifest(), block.ParentEntropy(nodeCtx))
+					if nodeCtx != common.ZONE_CTX {
+						if sub := c.sl.getSubInterface(block.Location().SubIndex(c.NodeCtx())); sub != nil {
+							sub.DownloadBlocksInManifest(block.Hash(), block.Manifest(), block.ParentEntropy(nodeCtx))
+						}
 					}
 				}
 				return idx, ErrPendingBlock
@@ -566,6 +573,7 @@ func (c *Core) WriteBlock(block *types.WorkObject) {
 	if c.sl.IsBlockHashABadHash(block.Hash()) {
 		return
 	}
+	c.RecordKnownBlock(block.NumberU64(nodeCtx))
 	if c.GetHeaderByHash(block.Hash()) == nil {
 		// Only add non dom blocks to the append queue
 		_, order, err := c.CalcOrder(block)
@@ -592,11 +600,13 @@ func (c *Core) WriteBlock(block *types.WorkObject) {
 	}
 }
 
-func (c *Core) Append(header *types.WorkObject, manifest types.BlockManifest, domPendingHeader *types.WorkObject, domTerminus common.Hash, domOrigin bool, newInboundEtxs types.Transactions) (types.Transactions, bool, bool, error) {
+func (c *Core) Append(ctx context.Context, header *types.WorkObject, manifest types.BlockManifest, domPendingHeader *types.WorkObject, domTerminus common.Hash, domOrigin bool, newInboundEtxs types.Transactions) (types.Transactions, bool, bool, error) {
 	nodeCtx := c.NodeCtx()
 	// Set the coinbase into the right interface before calling append in the sub
 	header.Header().SetCoinbase(common.BytesToAddress(header.Coinbase().Bytes(), c.NodeLocation()))
-	newPendingEtxs, subReorg, setHead, err := c.sl.Append(header, domPendingHeader, domTerminus, domOrigin, newInboundEtxs)
+	ctx, span := metrics_config.StartBlockSpan(ctx, "Core.Append", header.Hash(), c.NodeLocation().Name())
+	newPendingEtxs, subReorg, setHead, err := c.sl.Append(ctx, header, domPendingHeader, domTerminus, domOrigin, newInboundEtxs)
+	span.End(err)
 	if err != nil {
 		if err.Error() == ErrBodyNotFound.Error() || err.Error() == consensus.ErrUnknownAncestor.Error() || err.Error() == ErrSubNotSyncedToDom.Error() {
 			// Fetch the blocks for each hash in the manifest
@@ -639,8 +649,8 @@ func (c *Core) DownloadBlocksInManifest(blockHash common.Hash, manifest types.Bl
 		block := c.GetBlockOrCandidateByHash(blockHash)
 		if block != nil {
 			// If a prime block comes in
-			if c.sl.subInterface[block.Location().SubIndex(c.NodeCtx())] != nil {
-				c.sl.subInterface[block.Location().SubIndex(c.NodeCtx())].DownloadBlocksInManifest(block.Hash(), block.Manifest(), block.ParentEntropy(c.NodeCtx()))
+			if sub := c.sl.getSubInterface(block.Location().SubIndex(c.NodeCtx())); sub != nil {
+				sub.DownloadBlocksInManifest(block.Hash(), block.Manifest(), block.ParentEntropy(c.NodeCtx()))
 			}
 		}
 	}
@@ -651,8 +661,8 @@ func (c *Core) ConstructLocalMinedBlock(woHeader *types.WorkObject) (*types.Work
 	return c.sl.ConstructLocalMinedBlock(woHeader)
 }
 
-func (c *Core) SubRelayPendingHeader(slPendingHeader types.PendingHeader, newEntropy *big.Int, location common.Location, subReorg bool, order int) {
-	c.sl.SubRelayPendingHeader(slPendingHeader, newEntropy, location, subReorg, order)
+func (c *Core) SubRelayPendingHeader(ctx context.Context, slPendingHeader types.PendingHeader, newEntropy *big.Int, location common.Location, subReorg bool, order int) {
+	c.sl.SubRelayPendingHeader(ctx, slPendingHeader, newEntropy, location, subReorg, order)
 }
 
 func (c *Core) UpdateDom(oldTerminus common.Hash, pendingHeader types.PendingHeader, location common.Location) {
@@ -723,6 +733,11 @@ func (c *Core) IsBlockHashABadHash(hash common.Hash) bool {
 	return c.sl.IsBlockHashABadHash(hash)
 }
 
+// AppendQueueLen returns the number of blocks waiting in the append queue
+func (c *Core) AppendQueueLen() int {
+	return c.appendQueue.Len()
+}
+
 func (c *Core) ProcessingState() bool {
 	return c.sl.ProcessingState()
 }
@@ -751,6 +766,11 @@ func (c *Core) SubscribeExpansionEvent(ch chan<- ExpansionEvent) event.Subscript
 	return c.sl.SubscribeExpansionEvent(ch)
 }
 
+// SubscribeBlockAppendEvent registers a subscription of BlockAppendEvent.
+func (c *Core) SubscribeBlockAppendEvent(ch chan<- BlockAppendEvent) event.Subscription {
+	return c.sl.SubscribeBlockAppendEvent(ch)
+}
+
 func (c *Core) SetDomInterface(domInterface CoreBackend) {
 	c.sl.SetDomInterface(domInterface)
 }
@@ -787,6 +807,12 @@ func (c *Core) GetBlockByNumber(number uint64) *types.WorkObject {
 	return c.sl.hc.GetBlockByNumber(number)
 }
 
+// HistoryPruned returns true if the bodies and receipts of the block with the
+// given hash and number have been pruned by history expiry.
+func (c *Core) HistoryPruned(hash common.Hash, number uint64) bool {
+	return c.sl.hc.HistoryPruned(hash, number)
+}
+
 // GetBlocksFromHash returns the block corresponding to hash and up to n-1 ancestors.
 // [deprecated by eth/62]
 func (c *Core) GetBlocksFromHash(hash common.Hash, n int) []*types.WorkObject {
@@ -913,6 +939,11 @@ func (c *Core) SubscribeChainSideEvent(ch chan<- ChainSideEvent) event.Subscript
 	return c.sl.hc.SubscribeChainSideEvent(ch)
 }
 
+// SubscribeReorgEvent registers a subscription of ReorgEvent.
+func (c *Core) SubscribeReorgEvent(ch chan<- ReorgEvent) event.Subscription {
+	return c.sl.hc.SubscribeReorgEvent(ch)
+}
+
 // ComputeEfficiencyScore computes the efficiency score for the given prime
 // block This data is is only valid if called from Prime context, otherwise
 // there is no guarantee for this data to be accurate
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/dominant-strategies/go-quai/metrics_config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Chain metrics, labeled by the name of the location, e.g. cyprus1
+	headMetrics       *prometheus.GaugeVec
+	appendTimeMetrics *prometheus.HistogramVec
+	reorgDepthMetrics *prometheus.HistogramVec
+	etxSetMetrics     *prometheus.GaugeVec
+	pEtxRetryMetrics  *prometheus.CounterVec
+
+	// Txpool metrics, labeled by location
+	txpoolSizeMetrics      *prometheus.GaugeVec
+	txpoolRejectionMetrics *prometheus.CounterVec
+
+	// Worker and state processor metrics, labeled by location
+	pendingHeaderTimeMetrics *prometheus.HistogramVec
+	cacheMetrics             *prometheus.CounterVec
+)
+
+func init() {
+	registerMetrics()
+}
+
+func registerMetrics() {
+	headMetrics = metrics_config.NewLabeledGaugeVec("ChainHead", "Number and entropy of the current head", "location", "label")
+	appendTimeMetrics = metrics_config.NewHistogramVec("AppendTime", "Time spent appending a block in seconds", prometheus.ExponentialBuckets(0.005, 2, 12), "location")
+	reorgDepthMetrics = metrics_config.NewHistogramVec("ReorgDepth", "Number of blocks removed from the canonical chain by a reorg", prometheus.ExponentialBuckets(1, 2, 8), "location")
+	etxSetMetrics = metrics_config.NewLabeledGaugeVec("EtxSetSize", "Number of ETXs waiting in the ETX set", "location")
+	pEtxRetryMetrics = metrics_config.NewLabeledCounterVec("PendingEtxRetries", "Retries of the pending ETX collection and fetches from the sub after the retry threshold", "location", "label")
+
+	txpoolSizeMetrics = metrics_config.NewLabeledGaugeVec("TxpoolSizes", "Number of transactions in the pending, queued and Qi pools", "location", "pool")
+	txpoolRejectionMetrics = metrics_config.NewLabeledCounterVec("TxpoolRejections", "Transactions rejected by the txpool", "location", "reason")
+
+	pendingHeaderTimeMetrics = metrics_config.NewHistogramVec("PendingHeaderTime", "Time spent generating a pending header in seconds", prometheus.ExponentialBuckets(0.005, 2, 12), "location")
+	cacheMetrics = metrics_config.NewLabeledCounterVec("LookupCacheAccesses", "Hits and misses of the receipts and transaction lookup caches", "location", "cache", "result")
+}
+
+// recordCacheAccess counts a lookup in the receipts or transaction lookup cache
+func recordCacheAccess(location string, cache string, hit bool) {
+	if hit {
+		cacheMetrics.WithLabelValues(location, cache, "hit").Inc()
+	} else {
+		cacheMetrics.WithLabelValues(location, cache, "miss").Inc()
+	}
+}
+
+// txpoolRejectionReasons maps the errors returned by the txpool to the
+// reason label of the rejection metrics
+var txpoolRejectionReasons = []struct {
+	err    error
+	reason string
+}{
+	{ErrAlreadyKnown, "known"},
+	{ErrInvalidSender, "invalidSender"},
+	{ErrUnderpriced, "underpriced"},
+	{ErrTxPoolOverflow, "overflow"},
+	{ErrReplaceUnderpriced, "replaceUnderpriced"},
+	{errGasLimit, "gasLimit"},
+	{ErrNegativeValue, "negativeValue"},
+	{ErrOversizedData, "oversized"},
+	{ErrNonceTooLow, "nonceTooLow"},
+	{ErrNonceTooHigh, "nonceTooHigh"},
+	{ErrInsufficientFunds, "insufficientFunds"},
+	{ErrIntrinsicGas, "intrinsicGas"},
+	{ErrFeeCapTooLow, "feeCapTooLow"},
+	{ErrEtxLimitReached, "etxLimit"},
+}
+
+// recordTxpoolRejections counts the transactions rejected by an addition to
+// the pool by reason
+func recordTxpoolRejections(location string, errs []error) {
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		reason := "other"
+		for _, known := range txpoolRejectionReasons {
+			if errors.Is(err, known.err) {
+				reason = known.reason
+				break
+			}
+		}
+		txpoolRejectionMetrics.WithLabelValues(location, reason).Inc()
+	}
+}
@@ -74,6 +74,10 @@ var (
 	// ErrBadBlockHash is returned when block being appended is in the badBlockHashes list
 	ErrBadBlockHash = errors.New("block hash exists in bad block hashes list")
 
+	// ErrHistoryPruned is returned when the bodies and receipts of a block have
+	// been removed by history expiry
+	ErrHistoryPruned = errors.New("history pruned")
+
 	// ErrPendingHeaderNotInCache is returned when a coord gives an update but the slice has not yet created the referenced ph
 	ErrPendingHeaderNotInCache = errors.New("no pending header found in cache")
 )
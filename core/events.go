@@ -24,10 +24,21 @@ type ChainSideEvent struct {
 	Blocks []*types.WorkObject
 }
 
+// ReorgEvent is posted when the canonical head switches to a competing branch
+type ReorgEvent struct {
+	Reorg *types.Reorg
+}
+
 type ChainHeadEvent struct {
 	Block *types.WorkObject
 }
 
+// BlockAppendEvent is posted when a block has been appended to the slice,
+// whether it became the head or not.
+type BlockAppendEvent struct {
+	Block *types.WorkObject
+}
+
 type ExpansionEvent struct {
 	Block *types.WorkObject
 }
@@ -0,0 +1,280 @@
+package core
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/ethdb/memorydb"
+	"github.com/dominant-strategies/go-quai/log"
+)
+
+// freezerTestStore is a key-value store outliving the freezer databases
+// opened on top of it, so that the freezer can be reopened.
+type freezerTestStore struct {
+	ethdb.KeyValueStore
+}
+
+func (s freezerTestStore) Close() error { return nil }
+
+func openFreezerTestDb(t *testing.T, kv ethdb.KeyValueStore, dir string) ethdb.Database {
+	t.Helper()
+	db, err := rawdb.NewDatabaseWithFreezer(freezerTestStore{kv}, dir, "", false, common.REGION_CTX, log.Global, common.Location{0})
+	if err != nil {
+		t.Fatalf("failed to open freezer database: %v", err)
+	}
+	return db
+}
+
+func freezerTestDomData(number uint64) (types.BlockManifest, types.Termini, common.Hashes) {
+	termini := types.EmptyTermini()
+	termini.SetDomTermini([]common.Hash{{byte(number), 1}, {byte(number), 2}, {byte(number), 3}})
+	return types.BlockManifest{{byte(number), 4}}, termini, common.Hashes{{byte(number), 5}, {byte(number), 6}}
+}
+
+// newFreezerTestBlock creates a region block that survives the protobuf round
+// trip with its hash unchanged.
+func newFreezerTestBlock(number uint64) *types.WorkObject {
+	wo := types.EmptyHeader(common.REGION_CTX)
+	wo.SetNumber(new(big.Int).SetUint64(number), common.REGION_CTX)
+	wo.WorkObjectHeader().SetNumber(new(big.Int).SetUint64(number))
+	wo.Header().SetCoinbase(common.ZeroAddress(common.Location{0, 0}))
+	wo.SetTx(nil)
+	return wo
+}
+
+// newFreezerTestChain writes a region chain of the given length with its dom
+// chain data to the key-value store, opens a freezer on top of it and freezes
+// all the blocks but the head.
+func newFreezerTestChain(t *testing.T, length uint64) (ethdb.KeyValueStore, string, ethdb.Database, []common.Hash) {
+	t.Helper()
+	var (
+		kv     = memorydb.New(log.Global)
+		dir    = t.TempDir()
+		hashes = make([]common.Hash, length)
+	)
+	for number := uint64(0); number < length; number++ {
+		wo := newFreezerTestBlock(number)
+		hash := wo.Hash()
+
+		// Region blocks have no receipts nor etx sets
+		rawdb.WriteWorkObject(kv, hash, wo, types.BlockObject, common.REGION_CTX)
+		rawdb.WriteCanonicalHash(kv, hash, number)
+
+		manifest, termini, interlinkHashes := freezerTestDomData(number)
+		rawdb.WriteManifest(kv, hash, manifest)
+		rawdb.WriteTermini(kv, hash, termini)
+		rawdb.WriteInterlinkHashes(kv, hash, interlinkHashes)
+		hashes[number] = hash
+	}
+	rawdb.WriteHeadHeaderHash(kv, hashes[length-1])
+	rawdb.WriteHeadBlockHash(kv, hashes[length-1])
+
+	db := openFreezerTestDb(t, kv, dir)
+	if err := db.(interface{ Freeze(uint64) error }).Freeze(1); err != nil {
+		t.Fatalf("failed to freeze chain: %v", err)
+	}
+	if frozen, _ := db.Ancients(); frozen != length-1 {
+		t.Fatalf("frozen blocks mismatch: have %d, want %d", frozen, length-1)
+	}
+	return kv, dir, db, hashes
+}
+
+// checkFreezerDomData verifies the dom chain data served for a block.
+func checkFreezerDomData(t *testing.T, db ethdb.Reader, hash common.Hash, number uint64, stored bool) {
+	t.Helper()
+	manifest, termini, interlinkHashes := freezerTestDomData(number)
+	if !stored {
+		manifest, interlinkHashes = nil, nil
+	}
+	if have := rawdb.ReadManifest(db, hash); !reflect.DeepEqual(have, manifest) {
+		t.Errorf("block %d: manifest mismatch: have %v, want %v", number, have, manifest)
+	}
+	if have := rawdb.ReadInterlinkHashes(db, hash); !reflect.DeepEqual(have, interlinkHashes) {
+		t.Errorf("block %d: interlink hashes mismatch: have %v, want %v", number, have, interlinkHashes)
+	}
+	have := rawdb.ReadTermini(db, hash)
+	if (have != nil) != stored {
+		t.Fatalf("block %d: termini mismatch: have %v, stored %v", number, have, stored)
+	}
+	if stored && !reflect.DeepEqual(have.DomTermini(), termini.DomTermini()) {
+		t.Errorf("block %d: termini mismatch: have %v, want %v", number, have.DomTermini(), termini.DomTermini())
+	}
+}
+
+// truncateFreezerTestTable drops the items of a raw freezer table beyond the
+// given count, as a crash in the middle of appending to it would.
+func truncateFreezerTestTable(t *testing.T, dir string, name string, items int64) {
+	t.Helper()
+	if err := os.Truncate(filepath.Join(dir, name+".ridx"), (items+1)*6); err != nil {
+		t.Fatalf("failed to truncate %s table: %v", name, err)
+	}
+}
+
+func TestFreezerBlocks(t *testing.T) {
+	kv, _, db, hashes := newFreezerTestChain(t, 5)
+	defer db.Close()
+
+	// The frozen blocks are moved out of the key-value store apart from the
+	// genesis one, while the freezer database serves all of them
+	nofreezedb := rawdb.NewDatabase(kv)
+	for number, hash := range hashes {
+		stored := number == 0 || number == 4
+		if have := rawdb.ReadWorkObject(nofreezedb, hash, types.BlockObject); (have != nil) != stored {
+			t.Errorf("block %d: key-value store mismatch: have %v, stored %v", number, have != nil, stored)
+		}
+		want := newFreezerTestBlock(uint64(number))
+		if have := rawdb.ReadWorkObject(db, hash, types.BlockObject); have == nil || have.Hash() != hash {
+			t.Errorf("block %d: frozen block mismatch: have %v, want %x", number, have, hash)
+		} else if have.NumberU64(common.REGION_CTX) != want.NumberU64(common.REGION_CTX) {
+			t.Errorf("block %d: frozen block number mismatch: have %d", number, have.NumberU64(common.REGION_CTX))
+		}
+		if have := rawdb.ReadHeader(db, hash); have == nil || have.Hash() != hash {
+			t.Errorf("block %d: frozen header mismatch: have %v, want %x", number, have, hash)
+		}
+	}
+	// An unknown hash is not served from the ancients
+	if have := rawdb.ReadWorkObjectHeader(db, common.Hash{0xff}, types.BlockObject); have != nil {
+		t.Errorf("header served for unknown hash: %v", have)
+	}
+}
+
+func TestFreezerDomChainData(t *testing.T) {
+	kv, _, db, hashes := newFreezerTestChain(t, 5)
+	defer db.Close()
+
+	// The frozen dom chain data is moved out of the key-value store apart
+	// from the genesis one, while the freezer database serves all of it
+	nofreezedb := rawdb.NewDatabase(kv)
+	for number, hash := range hashes {
+		checkFreezerDomData(t, nofreezedb, hash, uint64(number), number == 0 || number == 4)
+		checkFreezerDomData(t, db, hash, uint64(number), true)
+	}
+	if rollup := rawdb.ReadPendingEtxsRollup(db, hashes[2]); rollup != nil {
+		t.Errorf("missing pending etxs rollup frozen as %v", rollup)
+	}
+	// A hash not matching the frozen block is not served
+	if manifest := rawdb.ReadManifest(db, common.Hash{0xff}); manifest != nil {
+		t.Errorf("manifest served for unknown hash: %v", manifest)
+	}
+}
+
+func TestFreezerBackfill(t *testing.T) {
+	kv, dir, db, hashes := newFreezerTestChain(t, 5)
+	db.Close()
+
+	// Drop the manifest table as a freezer of an older release misses it
+	// and put back some of the manifests it held in the key-value store
+	files, _ := filepath.Glob(filepath.Join(dir, "manifests.*"))
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			t.Fatalf("failed to remove %s: %v", file, err)
+		}
+	}
+	manifest, _, _ := freezerTestDomData(1)
+	rawdb.WriteManifest(kv, hashes[1], manifest)
+
+	db = openFreezerTestDb(t, kv, dir)
+	defer db.Close()
+	if frozen, _ := db.Ancients(); frozen != 4 {
+		t.Fatalf("frozen blocks mismatch: have %d, want %d", frozen, 4)
+	}
+	// The manifests are frozen back from the key-value store, or empty if
+	// it lost them
+	rawdb.DeleteManifest(kv, hashes[0])
+	rawdb.DeleteManifest(kv, hashes[1])
+	for number, want := range map[int]bool{0: true, 1: true, 2: false, 3: false} {
+		manifest, _, _ := freezerTestDomData(uint64(number))
+		if !want {
+			manifest = nil
+		}
+		if have := rawdb.ReadManifest(db, hashes[number]); !reflect.DeepEqual(have, manifest) {
+			t.Errorf("block %d: manifest mismatch: have %v, want %v", number, have, manifest)
+		}
+		// while the other tables are untouched
+		if have := rawdb.ReadInterlinkHashes(db, hashes[number]); have == nil {
+			t.Errorf("block %d: interlink hashes lost", number)
+		}
+	}
+	if size, err := db.AncientSize("manifests"); err != nil || size == 0 {
+		t.Errorf("backfilled manifest table size mismatch: have %d (%v)", size, err)
+	}
+}
+
+func TestFreezerRepair(t *testing.T) {
+	kv, dir, db, hashes := newFreezerTestChain(t, 5)
+	db.Close()
+
+	// An interrupted append to a dom chain data table doesn't truncate the
+	// other tables, the missing items are backfilled from the key-value store
+	truncateFreezerTestTable(t, dir, "termini", 2)
+	_, termini, _ := freezerTestDomData(2)
+	rawdb.WriteTermini(kv, hashes[2], termini)
+
+	db = openFreezerTestDb(t, kv, dir)
+	if frozen, _ := db.Ancients(); frozen != 4 {
+		t.Fatalf("frozen blocks mismatch: have %d, want %d", frozen, 4)
+	}
+	rawdb.DeleteTermini(kv, hashes[2])
+	for number := uint64(1); number < 3; number++ {
+		checkFreezerDomData(t, db, hashes[number], number, true)
+	}
+	if have := rawdb.ReadTermini(db, hashes[3]); have != nil {
+		t.Errorf("lost termini served: %v", have)
+	}
+	db.Close()
+
+	// An interrupted append to the block tables truncates all of them, the
+	// block being frozen is still in the key-value store then
+	truncateFreezerTestTable(t, dir, "hashes", 2)
+	rawdb.WriteCanonicalHash(kv, hashes[2], 2)
+
+	db = openFreezerTestDb(t, kv, dir)
+	defer db.Close()
+	if frozen, _ := db.Ancients(); frozen != 2 {
+		t.Fatalf("frozen blocks mismatch: have %d, want %d", frozen, 2)
+	}
+	checkFreezerDomData(t, db, hashes[1], 1, true)
+	checkFreezerDomData(t, db, hashes[2], 2, false)
+	for _, kind := range []string{"manifests", "termini", "pendingEtxsRollups", "interlinkHashes"} {
+		if data, err := db.Ancient(kind, 2); err == nil {
+			t.Errorf("%s table not repaired: have %x", kind, data)
+		}
+	}
+}
+
+func TestFreezerTruncate(t *testing.T) {
+	_, _, db, hashes := newFreezerTestChain(t, 5)
+	defer db.Close()
+
+	// Keep the frozen items of block 2 to append them again
+	items := make(map[string][]byte)
+	for _, kind := range []string{"hashes", "headers", "bodies", "receipts", "etxSets", "manifests", "termini", "pendingEtxsRollups", "interlinkHashes"} {
+		data, err := db.Ancient(kind, 2)
+		if err != nil {
+			t.Fatalf("failed to read frozen %s: %v", kind, err)
+		}
+		items[kind] = data
+	}
+	if err := db.TruncateAncients(2); err != nil {
+		t.Fatalf("failed to truncate freezer: %v", err)
+	}
+	if frozen, _ := db.Ancients(); frozen != 2 {
+		t.Fatalf("frozen blocks mismatch: have %d, want %d", frozen, 2)
+	}
+	checkFreezerDomData(t, db, hashes[1], 1, true)
+	for number := uint64(2); number < 4; number++ {
+		checkFreezerDomData(t, db, hashes[number], number, false)
+	}
+	// The dom chain data tables are appended from the truncation point on
+	if err := db.AppendAncient(2, items["hashes"], items["headers"], items["bodies"], items["receipts"], items["etxSets"], items["manifests"], items["termini"], items["pendingEtxsRollups"], items["interlinkHashes"]); err != nil {
+		t.Fatalf("failed to append to truncated freezer: %v", err)
+	}
+	checkFreezerDomData(t, db, hashes[2], 2, true)
+}
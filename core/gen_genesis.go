@@ -18,56 +18,70 @@ var _ = (*genesisSpecMarshaling)(nil)
 // MarshalJSON marshals as JSON.
 func (g Genesis) MarshalJSON() ([]byte, error) {
 	type Genesis struct {
-		Config     *params.ChainConfig                         `json:"config"`
-		Nonce      math.HexOrDecimal64                         `json:"nonce"`
-		Timestamp  math.HexOrDecimal64                         `json:"timestamp"`
-		ExtraData  hexutil.Bytes                               `json:"extraData"`
-		GasLimit   math.HexOrDecimal64                         `json:"gasLimit"   gencodec:"required"`
-		Difficulty *math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
-		Mixhash    common.Hash                                 `json:"mixHash"`
-		Coinbase   common.Address                              `json:"coinbase"`
-		Alloc      map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
-		Number     []math.HexOrDecimal64                       `json:"number"`
-		GasUsed    math.HexOrDecimal64                         `json:"gasUsed"`
-		ParentHash []common.Hash                               `json:"parentHash"`
-		BaseFee    *math.HexOrDecimal256                       `json:"baseFeePerGas"`
+		Config          *params.ChainConfig                  `json:"config"`
+		Nonce           math.HexOrDecimal64                  `json:"nonce"`
+		Timestamp       math.HexOrDecimal64                  `json:"timestamp"`
+		ExtraData       hexutil.Bytes                        `json:"extraData"`
+		GasLimit        math.HexOrDecimal64                  `json:"gasLimit"   gencodec:"required"`
+		Difficulty      *math.HexOrDecimal256                `json:"difficulty" gencodec:"required"`
+		Mixhash         common.Hash                          `json:"mixHash"`
+		Coinbase        common.Address                       `json:"coinbase"`
+		ExpansionNumber math.HexOrDecimal64                  `json:"expansionNumber"`
+		DurationLimit   *math.HexOrDecimal256                `json:"durationLimit,omitempty"`
+		GasCeil         math.HexOrDecimal64                  `json:"gasCeil,omitempty"`
+		Alloc           map[string]map[string]GenesisAccount `json:"alloc"      gencodec:"required"`
+		QiAlloc         map[string]map[string]GenesisUTXO    `json:"qiAlloc,omitempty"`
+		Number          []math.HexOrDecimal64                `json:"number"`
+		GasUsed         math.HexOrDecimal64                  `json:"gasUsed"`
+		ParentHash      []common.Hash                        `json:"parentHash"`
+		BaseFee         *math.HexOrDecimal256                `json:"baseFeePerGas"`
 	}
 	var enc Genesis
 	enc.Config = g.Config
 	enc.Nonce = math.HexOrDecimal64(g.Nonce)
 	enc.Timestamp = math.HexOrDecimal64(g.Timestamp)
 	enc.ExtraData = g.ExtraData
+	enc.GasLimit = math.HexOrDecimal64(g.GasLimit)
+	enc.Difficulty = (*math.HexOrDecimal256)(g.Difficulty)
 	enc.Mixhash = g.Mixhash
 	enc.Coinbase = g.Coinbase
-	enc.Number = make([]math.HexOrDecimal64, common.HierarchyDepth)
-	enc.ParentHash = make([]common.Hash, common.HierarchyDepth)
-	for i := 0; i < common.HierarchyDepth-1; i++ {
-		enc.Number[i] = math.HexOrDecimal64(g.Number[i])
-		enc.ParentHash[i] = g.ParentHash[i]
+	enc.ExpansionNumber = math.HexOrDecimal64(g.ExpansionNumber)
+	enc.DurationLimit = (*math.HexOrDecimal256)(g.DurationLimit)
+	enc.GasCeil = math.HexOrDecimal64(g.GasCeil)
+	enc.Alloc = g.Alloc
+	enc.QiAlloc = g.QiAlloc
+	if g.Number != nil {
+		enc.Number = make([]math.HexOrDecimal64, len(g.Number))
+		for k, v := range g.Number {
+			enc.Number[k] = math.HexOrDecimal64(v)
+		}
 	}
-	enc.GasLimit = math.HexOrDecimal64(g.GasLimit)
 	enc.GasUsed = math.HexOrDecimal64(g.GasUsed)
+	enc.ParentHash = g.ParentHash
 	enc.BaseFee = (*math.HexOrDecimal256)(g.BaseFee)
-	enc.Difficulty = (*math.HexOrDecimal256)(g.Difficulty)
 	return json.Marshal(&enc)
 }
 
 // UnmarshalJSON unmarshals from JSON.
 func (g *Genesis) UnmarshalJSON(input []byte) error {
 	type Genesis struct {
-		Config     *params.ChainConfig                         `json:"config"`
-		Nonce      *math.HexOrDecimal64                        `json:"nonce"`
-		Timestamp  *math.HexOrDecimal64                        `json:"timestamp"`
-		ExtraData  *hexutil.Bytes                              `json:"extraData"`
-		GasLimit   *math.HexOrDecimal64                        `json:"gasLimit"   gencodec:"required"`
-		Difficulty *math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
-		Mixhash    *common.Hash                                `json:"mixHash"`
-		Coinbase   *common.Address                             `json:"coinbase"`
-		Alloc      map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
-		Number     []*math.HexOrDecimal64                      `json:"number"`
-		GasUsed    *math.HexOrDecimal64                        `json:"gasUsed"`
-		ParentHash []*common.Hash                              `json:"parentHash"`
-		BaseFee    *math.HexOrDecimal256                       `json:"baseFeePerGas"`
+		Config          *params.ChainConfig                  `json:"config"`
+		Nonce           *math.HexOrDecimal64                 `json:"nonce"`
+		Timestamp       *math.HexOrDecimal64                 `json:"timestamp"`
+		ExtraData       *hexutil.Bytes                       `json:"extraData"`
+		GasLimit        *math.HexOrDecimal64                 `json:"gasLimit"   gencodec:"required"`
+		Difficulty      *math.HexOrDecimal256                `json:"difficulty" gencodec:"required"`
+		Mixhash         *common.Hash                         `json:"mixHash"`
+		Coinbase        *common.Address                      `json:"coinbase"`
+		ExpansionNumber *math.HexOrDecimal64                 `json:"expansionNumber"`
+		DurationLimit   *math.HexOrDecimal256                `json:"durationLimit,omitempty"`
+		GasCeil         *math.HexOrDecimal64                 `json:"gasCeil,omitempty"`
+		Alloc           map[string]map[string]GenesisAccount `json:"alloc"      gencodec:"required"`
+		QiAlloc         map[string]map[string]GenesisUTXO    `json:"qiAlloc,omitempty"`
+		Number          []math.HexOrDecimal64                `json:"number"`
+		GasUsed         *math.HexOrDecimal64                 `json:"gasUsed"`
+		ParentHash      []common.Hash                        `json:"parentHash"`
+		BaseFee         *math.HexOrDecimal256                `json:"baseFeePerGas"`
 	}
 	var dec Genesis
 	if err := json.Unmarshal(input, &dec); err != nil {
@@ -85,36 +99,50 @@ func (g *Genesis) UnmarshalJSON(input []byte) error {
 	if dec.ExtraData != nil {
 		g.ExtraData = *dec.ExtraData
 	}
-	if dec.Mixhash != nil {
-		g.Mixhash = *dec.Mixhash
-	}
-	if dec.Alloc == nil {
-		return errors.New("missing required field 'alloc' for Genesis")
-	}
 	if dec.GasLimit == nil {
 		return errors.New("missing required field 'gasLimit' for Genesis")
 	}
 	g.GasLimit = uint64(*dec.GasLimit)
-	if dec.GasUsed != nil {
-		g.GasUsed = uint64(*dec.GasUsed)
-	}
 	if dec.Difficulty == nil {
 		return errors.New("missing required field 'difficulty' for Genesis")
 	}
 	g.Difficulty = (*big.Int)(dec.Difficulty)
-	if dec.BaseFee != nil {
-		g.BaseFee = (*big.Int)(dec.BaseFee)
+	if dec.Mixhash != nil {
+		g.Mixhash = *dec.Mixhash
 	}
 	if dec.Coinbase != nil {
 		g.Coinbase = *dec.Coinbase
 	}
-	for i := 0; i < common.HierarchyDepth; i++ {
-		if dec.Number[i] != nil {
-			g.Number[i] = uint64(*dec.Number[i])
-		}
-		if dec.ParentHash[i] != nil {
-			g.ParentHash[i] = *dec.ParentHash[i]
+	if dec.ExpansionNumber != nil {
+		g.ExpansionNumber = uint64(*dec.ExpansionNumber)
+	}
+	if dec.DurationLimit != nil {
+		g.DurationLimit = (*big.Int)(dec.DurationLimit)
+	}
+	if dec.GasCeil != nil {
+		g.GasCeil = uint64(*dec.GasCeil)
+	}
+	if dec.Alloc == nil {
+		return errors.New("missing required field 'alloc' for Genesis")
+	}
+	g.Alloc = dec.Alloc
+	if dec.QiAlloc != nil {
+		g.QiAlloc = dec.QiAlloc
+	}
+	if dec.Number != nil {
+		g.Number = make([]uint64, len(dec.Number))
+		for k, v := range dec.Number {
+			g.Number[k] = uint64(v)
 		}
 	}
+	if dec.GasUsed != nil {
+		g.GasUsed = uint64(*dec.GasUsed)
+	}
+	if dec.ParentHash != nil {
+		g.ParentHash = dec.ParentHash
+	}
+	if dec.BaseFee != nil {
+		g.BaseFee = (*big.Int)(dec.BaseFee)
+	}
 	return nil
 }
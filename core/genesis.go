@@ -56,6 +56,15 @@ type Genesis struct {
 	Mixhash    common.Hash         `json:"mixHash"`
 	Coinbase   common.Address      `json:"coinbase"`
 
+	// These fields are only used by custom networks bootstrapped with
+	// `go-quai init`, the hard coded networks take them from params and the
+	// genallocs directory.
+	ExpansionNumber uint64                               `json:"expansionNumber"`
+	DurationLimit   *big.Int                             `json:"durationLimit,omitempty"`
+	GasCeil         uint64                               `json:"gasCeil,omitempty"`
+	Alloc           map[string]map[string]GenesisAccount `json:"alloc"      gencodec:"required"` // location name -> address -> account
+	QiAlloc         map[string]map[string]GenesisUTXO    `json:"qiAlloc,omitempty"`              // location name -> address -> utxo
+
 	// These fields are used for consensus tests. Please don't use them
 	// in actual genesis blocks.
 	Number     []uint64      `json:"number"`
@@ -102,10 +111,13 @@ type genesisSpecMarshaling struct {
 	ExtraData  hexutil.Bytes
 	GasLimit   math.HexOrDecimal64
 	GasUsed    math.HexOrDecimal64
-	Number     math.HexOrDecimal64
+	Number     []math.HexOrDecimal64
 	Difficulty *math.HexOrDecimal256
 	BaseFee    *math.HexOrDecimal256
-	Alloc      map[common.UnprefixedAddress]GenesisAccount
+
+	ExpansionNumber math.HexOrDecimal64
+	DurationLimit   *math.HexOrDecimal256
+	GasCeil         math.HexOrDecimal64
 }
 
 type genesisAccountMarshaling struct {
@@ -186,7 +198,7 @@ func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, nodeLoca
 	// We have the genesis block in database(perhaps in ancient database)
 	// but the corresponding state is missing.
 	header := rawdb.ReadHeader(db, stored)
-	if _, err := state.New(header.EVMRoot(), header.UTXORoot(), header.EtxSetRoot(), state.NewDatabaseWithConfig(db, nil), state.NewDatabaseWithConfig(db, nil), state.NewDatabaseWithConfig(db, nil), nil, nodeLocation, logger); err != nil {
+	if _, err := state.New(header.EVMRoot(), header.UTXORoot(), header.EtxSetRoot(), state.NewDatabaseWithConfig(db, nil), state.NewDatabaseWithConfig(db, nil), state.NewDatabaseWithConfig(db, nil), nil, nil, nodeLocation, logger); err != nil {
 		if genesis == nil {
 			genesis = DefaultGenesisBlock()
 		}
@@ -511,9 +523,34 @@ func ReadGenesisQiAlloc(filename string, logger *log.Logger) map[string]GenesisU
 	return data
 }
 
-// WriteGenesisUtxoSet writes the genesis utxo set to the database
-func AddGenesisUtxos(state *state.StateDB, nodeLocation common.Location, addressOutpointMap map[string]map[string]*types.OutpointAndDenomination, logger *log.Logger) {
-	qiAlloc := ReadGenesisQiAlloc("genallocs/gen_alloc_qi_"+nodeLocation.Name()+".json", logger)
+// ReadGenesis reads a custom network genesis specification from a JSON file.
+func ReadGenesis(filename string) (*Genesis, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	genesis := new(Genesis)
+	if err := json.Unmarshal(data, genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %v", filename, err)
+	}
+	if genesis.Config == nil {
+		return nil, errGenesisNoConfig
+	}
+	if genesis.Difficulty == nil || genesis.Difficulty.Sign() <= 0 {
+		return nil, errors.New("genesis difficulty must be positive")
+	}
+	if genesis.ExpansionNumber > uint64(common.MaxExpansionNumber) {
+		return nil, fmt.Errorf("genesis expansion number %d is greater than the maximum %d", genesis.ExpansionNumber, common.MaxExpansionNumber)
+	}
+	return genesis, nil
+}
+
+// AddGenesisUtxos adds the genesis utxo set to the state, qiAlloc overrides the
+// allocation read from the genallocs directory
+func AddGenesisUtxos(state *state.StateDB, nodeLocation common.Location, qiAlloc map[string]GenesisUTXO, addressOutpointMap map[string]map[string]*types.OutpointAndDenomination, logger *log.Logger) {
+	if qiAlloc == nil {
+		qiAlloc = ReadGenesisQiAlloc("genallocs/gen_alloc_qi_"+nodeLocation.Name()+".json", logger)
+	}
 	// logger.WithField("alloc", len(qiAlloc)).Info("Allocating genesis accounts")
 	for addressString, utxo := range qiAlloc {
 		addr := common.HexToAddress(addressString, nodeLocation)
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
 	"github.com/dominant-strategies/go-quai/consensus"
 	"github.com/dominant-strategies/go-quai/consensus/misc"
 	"github.com/dominant-strategies/go-quai/core/rawdb"
@@ -51,6 +53,7 @@ type HeaderChain struct {
 
 	chainHeadFeed event.Feed
 	chainSideFeed event.Feed
+	reorgFeed     event.Feed
 	scope         event.SubscriptionScope
 
 	headerDb      ethdb.Database
@@ -68,7 +71,12 @@ type HeaderChain struct {
 	blooms            *lru.Cache[common.Hash, types.Bloom]
 	subRollupCache    *lru.Cache[common.Hash, types.Transactions]
 
+	historyLimit   uint64        // Number of recent blocks to keep the bodies and receipts of (0 = entire chain)
+	historyTail    atomic.Uint64 // Oldest block whose bodies and receipts are kept
+	historyPruneCh chan struct{} // Notification channel of the history loop when the head moves
+
 	wg            sync.WaitGroup // chain processing wait group for shutting down
+	quit          chan struct{}  // headerchain quit channel
 	running       int32          // 0 if chain is running, 1 when stopped
 	procInterrupt int32          // interrupt signaler for block processing
 
@@ -98,6 +106,14 @@ func NewHeaderChain(db ethdb.Database, engine consensus.Engine, pEtxsRollupFetch
 		fetchPEtx:              pEtxsFetcher,
 		logger:                 logger,
 		currentExpansionNumber: currentExpansionNumber,
+		quit:                   make(chan struct{}),
+	}
+
+	if cacheConfig != nil {
+		hc.historyLimit = cacheConfig.HistoryLimit
+	}
+	if tail := rawdb.ReadHistoryTail(db); tail != nil {
+		hc.historyTail.Store(*tail)
 	}
 
 	genesisHash := hc.GetGenesisHashes()[0]
@@ -124,6 +140,7 @@ func NewHeaderChain(db ethdb.Database, engine consensus.Engine, pEtxsRollupFetch
 
 	// Record if the chain is processing state
 	hc.processingState = hc.setStateProcessing()
+	hc.updateHeadMetrics(hc.CurrentHeader())
 
 	pendingEtxsRollup, _ := lru.New[common.Hash, types.PendingEtxsRollup](c_maxPendingEtxsRollup)
 	hc.pendingEtxsRollup = pendingEtxsRollup
@@ -144,6 +161,14 @@ func NewHeaderChain(db ethdb.Database, engine consensus.Engine, pEtxsRollupFetch
 	heads := make([]*types.WorkObject, 0)
 	hc.heads = heads
 
+	// Prune the history in the background, catching up with the head first
+	if hc.historyLimit > 0 && nodeCtx == common.ZONE_CTX {
+		hc.historyPruneCh = make(chan struct{}, 1)
+		hc.notifyHistoryPrune()
+
+		hc.wg.Add(1)
+		go hc.historyLoop()
+	}
 	return hc, nil
 }
 
@@ -328,10 +353,10 @@ func (hc *HeaderChain) setStateProcessing() bool {
 }
 
 // Append
-func (hc *HeaderChain) AppendBlock(block *types.WorkObject) error {
+func (hc *HeaderChain) AppendBlock(ctx context.Context, block *types.WorkObject) error {
 	blockappend := time.Now()
 	// Append block else revert header append
-	logs, err := hc.bc.Append(block)
+	logs, err := hc.bc.Append(ctx, block)
 	if err != nil {
 		return err
 	}
@@ -363,10 +388,12 @@ func (hc *HeaderChain) SetCurrentHeader(head *types.WorkObject) error {
 		"Number": head.NumberArray(),
 	}).Info("Setting the current header")
 	hc.currentHeader.Store(head)
+	hc.updateHeadMetrics(head)
 
 	// If head is the normal extension of canonical head, we can return by just wiring the canonical hash.
 	if prevHeader.Hash() == head.ParentHash(hc.NodeCtx()) {
 		rawdb.WriteCanonicalHash(hc.headerDb, head.Hash(), head.NumberU64(hc.NodeCtx()))
+		hc.notifyHistoryPrune()
 		return nil
 	}
 
@@ -391,6 +418,7 @@ func (hc *HeaderChain) SetCurrentHeader(head *types.WorkObject) error {
 			break
 		}
 	}
+	oldHead := prevHeader
 	var prevHashStack []*types.WorkObject
 	for {
 		if prevHeader.Hash() == commonHeader.Hash() {
@@ -413,6 +441,12 @@ func (hc *HeaderChain) SetCurrentHeader(head *types.WorkObject) error {
 		rawdb.WriteCanonicalHash(hc.headerDb, hashStack[i].Hash(), hashStack[i].NumberU64(hc.NodeCtx()))
 	}
 
+	// Skipping ahead on the same branch is not a reorg
+	if len(prevHashStack) > 0 {
+		hc.recordReorg(oldHead, head, commonHeader, prevHashStack, hashStack)
+	}
+	hc.notifyHistoryPrune()
+
 	if hc.NodeCtx() == common.ZONE_CTX && hc.ProcessingState() {
 		// Every Block that got removed from the canonical hash db is sent in the side feed to be
 		// recorded as uncles
@@ -439,8 +473,80 @@ func (hc *HeaderChain) SetCurrentHeader(head *types.WorkObject) error {
 	return nil
 }
 
+// updateHeadMetrics reports the number and entropy of the current head and,
+// in a zone processing state, the size of its etx set
+func (hc *HeaderChain) updateHeadMetrics(head *types.WorkObject) {
+	location := hc.NodeLocation().Name()
+	headMetrics.WithLabelValues(location, "number").Set(float64(head.NumberU64(hc.NodeCtx())))
+	entropy, _ := common.BigBitsToBitsFloat(hc.engine.TotalLogS(hc, head)).Float64()
+	headMetrics.WithLabelValues(location, "entropy").Set(entropy)
+
+	// Track the number of ETXs left in the set of the head
+	if hc.NodeCtx() != common.ZONE_CTX || !hc.ProcessingState() {
+		return
+	}
+	statedb, err := hc.StateAt(head.EVMRoot(), head.UTXORoot(), head.EtxSetRoot())
+	if err != nil {
+		hc.logger.WithField("err", err).Warn("Failed to open the state of the head")
+		return
+	}
+	if newestIndex, err := statedb.GetNewestIndex(); err != nil {
+		hc.logger.WithField("err", err).Error("Failed to read the newest etx set index")
+	} else if oldestIndex, err := statedb.GetOldestIndex(); err != nil {
+		hc.logger.WithField("err", err).Error("Failed to read the oldest etx set index")
+	} else {
+		etxSetMetrics.WithLabelValues(location).Set(float64(new(big.Int).Sub(newestIndex, oldestIndex).Uint64()))
+	}
+}
+
+// recordReorg persists the switch of the canonical chain from oldHead onto head
+// in the reorg history and notifies the reorg subscribers. The removed and added
+// stacks are ordered from the heads down to the common ancestor.
+func (hc *HeaderChain) recordReorg(oldHead, head, commonHeader *types.WorkObject, removed, added []*types.WorkObject) {
+	ancestorEntropy := hc.engine.TotalLogS(hc, commonHeader)
+	reorg := &types.Reorg{
+		OldHead:        oldHead.Hash(),
+		NewHead:        head.Hash(),
+		CommonAncestor: commonHeader.Hash(),
+		Number:         hexutil.Uint64(commonHeader.NumberU64(hc.NodeCtx())),
+		Depth:          hexutil.Uint64(len(removed)),
+		Removed:        make([]common.Hash, 0, len(removed)),
+		Added:          make([]common.Hash, 0, len(added)),
+		OldEntropy:     (*hexutil.Big)(new(big.Int).Sub(hc.engine.TotalLogS(hc, oldHead), ancestorEntropy)),
+		NewEntropy:     (*hexutil.Big)(new(big.Int).Sub(hc.engine.TotalLogS(hc, head), ancestorEntropy)),
+		Time:           hexutil.Uint64(time.Now().Unix()),
+	}
+	for i := len(removed) - 1; i >= 0; i-- {
+		reorg.Removed = append(reorg.Removed, removed[i].Hash())
+	}
+	for i := len(added) - 1; i >= 0; i-- {
+		reorg.Added = append(reorg.Added, added[i].Hash())
+	}
+	rawdb.WriteReorg(hc.headerDb, reorg)
+	reorgDepthMetrics.WithLabelValues(hc.NodeLocation().Name()).Observe(float64(len(removed)))
+	hc.logger.WithFields(log.Fields{
+		"oldHead":        reorg.OldHead,
+		"newHead":        reorg.NewHead,
+		"commonAncestor": reorg.CommonAncestor,
+		"depth":          len(removed),
+		"added":          len(added),
+	}).Info("Chain reorg detected")
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				hc.logger.WithFields(log.Fields{
+					"error":      r,
+					"stacktrace": string(debug.Stack()),
+				}).Fatal("Go-Quai Panicked")
+			}
+		}()
+		hc.reorgFeed.Send(ReorgEvent{Reorg: reorg})
+	}()
+}
+
 // SetCurrentState updates the current Quai state and Qi UTXO set upon which the current pending block is built
-func (hc *HeaderChain) SetCurrentState(head *types.WorkObject) error {
+func (hc *HeaderChain) SetCurrentState(ctx context.Context, head *types.WorkObject) error {
 	hc.headermu.Lock()
 	defer hc.headermu.Unlock()
 
@@ -475,7 +581,7 @@ func (hc *HeaderChain) SetCurrentState(head *types.WorkObject) error {
 		if block == nil {
 			return errors.New("could not find block during SetCurrentState: " + headersWithoutState[i].Hash().String())
 		}
-		err := hc.AppendBlock(block)
+		err := hc.AppendBlock(ctx, block)
 		if err != nil {
 			return err
 		}
@@ -581,6 +687,7 @@ func (hc *HeaderChain) Stop() {
 	// Unsubscribe all subscriptions registered from blockchain
 	hc.scope.Close()
 	hc.bc.scope.Close()
+	close(hc.quit)
 	hc.wg.Wait()
 	if hc.NodeCtx() == common.ZONE_CTX && hc.ProcessingState() {
 		hc.bc.processor.Stop()
@@ -989,6 +1096,11 @@ func (hc *HeaderChain) SubscribeChainSideEvent(ch chan<- ChainSideEvent) event.S
 	return hc.scope.Track(hc.chainSideFeed.Subscribe(ch))
 }
 
+// SubscribeReorgEvent registers a subscription of ReorgEvent.
+func (hc *HeaderChain) SubscribeReorgEvent(ch chan<- ReorgEvent) event.Subscription {
+	return hc.scope.Track(hc.reorgFeed.Subscribe(ch))
+}
+
 func (hc *HeaderChain) StateAt(root, utxoRoot, etxRoot common.Hash) (*state.StateDB, error) {
 	return hc.bc.processor.StateAt(root, utxoRoot, etxRoot)
 }
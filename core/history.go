@@ -0,0 +1,149 @@
+package core
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/log"
+)
+
+const (
+	// MinHistoryLimit is the smallest number of recent blocks a zone can keep
+	// the history of. Reorgs never go this deep, so the blocks the chain reads
+	// back to process new ones are never pruned.
+	MinHistoryLimit = 4096
+
+	// c_historyPruneBatch is the maximum number of blocks pruned at once by the
+	// history loop, so that enabling the limit on a long chain doesn't hold up
+	// the shutdown.
+	c_historyPruneBatch = 1024
+)
+
+// PruneHistory removes the transactions, external transactions, receipts and
+// ETX sets of the blocks more than limit blocks below head, pruning at most max
+// heights (0 = no maximum). Headers, termini, manifests and uncles are kept,
+// as well as the transaction lookup entries, so that the lookups of pruned
+// transactions can be told apart from unknown ones. It returns the number of
+// the oldest block whose history is kept.
+func PruneHistory(db ethdb.Database, head uint64, limit uint64, max uint64) (uint64, error) {
+	var tail uint64
+	if stored := rawdb.ReadHistoryTail(db); stored != nil {
+		tail = *stored
+	}
+	if limit == 0 || head < limit {
+		return tail, nil
+	}
+	if limit < MinHistoryLimit {
+		return tail, fmt.Errorf("history limit %d is below the minimum of %d blocks", limit, MinHistoryLimit)
+	}
+	// The genesis block has no history to prune
+	start := tail
+	if start == 0 {
+		start = 1
+	}
+	target := head - limit + 1
+	if max > 0 && target > start+max {
+		target = start + max
+	}
+	if target <= start {
+		return tail, nil
+	}
+	batch := db.NewBatch()
+	for number := start; number < target; number++ {
+		hash := rawdb.ReadCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			return tail, fmt.Errorf("canonical hash of block %d not found", number)
+		}
+		rawdb.PruneWorkObjectBody(db, batch, hash)
+		rawdb.DeleteReceipts(batch, hash, number)
+		rawdb.DeleteEtxSet(batch, hash, number)
+		rawdb.DeleteInboundEtxs(batch, hash)
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return tail, err
+			}
+			batch.Reset()
+		}
+	}
+	rawdb.WriteHistoryTail(batch, target)
+	if err := batch.Write(); err != nil {
+		return tail, err
+	}
+	return target, nil
+}
+
+// HistoryTail returns the number of the oldest block whose bodies and receipts
+// are kept, or 0 if no history has been pruned.
+func (hc *HeaderChain) HistoryTail() uint64 {
+	return hc.historyTail.Load()
+}
+
+// HistoryPruned returns true if the bodies and receipts of the block with the
+// given hash and number have been pruned. Only the canonical blocks are pruned,
+// so the side blocks below the history tail are still complete.
+func (hc *HeaderChain) HistoryPruned(hash common.Hash, number uint64) bool {
+	return number > 0 && number < hc.HistoryTail() && hc.GetCanonicalHash(number) == hash
+}
+
+// notifyHistoryPrune signals the history loop that the head moved.
+func (hc *HeaderChain) notifyHistoryPrune() {
+	if hc.historyPruneCh == nil {
+		return
+	}
+	select {
+	case hc.historyPruneCh <- struct{}{}:
+	default:
+	}
+}
+
+// historyLoop prunes the history of the blocks that fall out of the history
+// limit as the head moves, away from the block processing.
+func (hc *HeaderChain) historyLoop() {
+	defer hc.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			hc.logger.WithFields(log.Fields{
+				"error":      r,
+				"stacktrace": string(debug.Stack()),
+			}).Error("Go-Quai Panicked")
+		}
+	}()
+	for {
+		select {
+		case <-hc.historyPruneCh:
+			hc.pruneHistory()
+		case <-hc.quit:
+			return
+		}
+	}
+}
+
+// pruneHistory prunes the history of the blocks that fell out of the history
+// limit with the current head, one batch at a time until caught up.
+func (hc *HeaderChain) pruneHistory() {
+	for {
+		number := hc.CurrentHeader().NumberU64(common.ZONE_CTX)
+		if number < hc.historyLimit || number-hc.historyLimit+1 <= hc.HistoryTail() {
+			return
+		}
+		tail, err := PruneHistory(hc.headerDb, number, hc.historyLimit, c_historyPruneBatch)
+		if err != nil {
+			hc.logger.WithField("err", err).Error("Failed to prune history")
+			return
+		}
+		prev := hc.historyTail.Swap(tail)
+		hc.logger.WithFields(log.Fields{
+			"from": prev,
+			"to":   tail,
+		}).Debug("Pruned history")
+
+		select {
+		case <-hc.quit:
+			return
+		default:
+		}
+	}
+}
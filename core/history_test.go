@@ -0,0 +1,175 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/log"
+)
+
+// historyTestBlock writes a block with one transaction, its receipts and its
+// inbound etxs, returning its hash. The canonical hash is only written if the
+// block is canonical.
+func historyTestBlock(t *testing.T, db ethdb.Database, number uint64, side bool, canonical bool) common.Hash {
+	t.Helper()
+	to := common.ZeroAddress(common.Location{0, 0})
+	index := uint16(0)
+	if side {
+		index = 1
+	}
+	tx := types.NewTx(&types.ExternalTx{OriginatingTxHash: common.BigToHash(new(big.Int).SetUint64(number)), ETXIndex: index, Gas: 21000, To: &to, Value: new(big.Int), Sender: to})
+
+	wo := types.EmptyHeader(common.ZONE_CTX)
+	wo.SetNumber(new(big.Int).SetUint64(number), common.ZONE_CTX)
+	wo.Header().SetTxHash(tx.Hash())
+	wo.WorkObjectHeader().SetTxHash(tx.Hash())
+	wo.Body().SetTransactions(types.Transactions{tx})
+	hash := wo.Hash()
+
+	rawdb.WriteWorkObjectBody(db, hash, wo, types.BlockObject, common.ZONE_CTX)
+	rawdb.WriteReceipts(db, hash, number, types.Receipts{{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000, TxHash: tx.Hash(), Logs: []*types.Log{}, Etxs: types.Transactions{}}})
+	rawdb.WriteInboundEtxs(db, hash, types.Transactions{tx})
+	if canonical {
+		rawdb.WriteCanonicalHash(db, hash, number)
+	}
+	return hash
+}
+
+// checkHistoryBlock verifies whether the body, receipts and inbound etxs of a
+// block are still stored.
+func checkHistoryBlock(t *testing.T, db ethdb.Database, hash common.Hash, number uint64, kept bool) {
+	t.Helper()
+	body := rawdb.ReadWorkObjectBody(db, hash, types.BlockObject)
+	if body == nil {
+		t.Fatalf("block %d: body missing", number)
+	}
+	if have := len(body.Transactions()); (have == 1) != kept {
+		t.Errorf("block %d: transaction count mismatch: have %d, kept %v", number, have, kept)
+	}
+	if have := rawdb.ReadRawReceipts(db, hash, number); (have != nil) != kept {
+		t.Errorf("block %d: receipts mismatch: have %v, kept %v", number, have, kept)
+	}
+	if have := rawdb.ReadInboundEtxs(db, hash); (len(have) == 1) != kept {
+		t.Errorf("block %d: inbound etxs mismatch: have %d, kept %v", number, len(have), kept)
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase(log.Global)
+		limit  = uint64(MinHistoryLimit)
+		head   = limit + 10 // Blocks 1 to 10 fall out of the limit
+		hashes = make(map[uint64]common.Hash)
+	)
+	for number := uint64(1); number <= 12; number++ {
+		hashes[number] = historyTestBlock(t, db, number, false, true)
+	}
+	side := historyTestBlock(t, db, 5, true, false)
+
+	if _, err := PruneHistory(db, head, MinHistoryLimit-1, 0); err == nil {
+		t.Fatalf("history limit below the minimum accepted")
+	}
+	// Prune a first batch, then the rest
+	tail, err := PruneHistory(db, head, limit, 4)
+	if err != nil {
+		t.Fatalf("failed to prune history: %v", err)
+	}
+	if tail != 5 {
+		t.Fatalf("history tail mismatch: have %d, want %d", tail, 5)
+	}
+	checkHistoryBlock(t, db, hashes[4], 4, false)
+	checkHistoryBlock(t, db, hashes[5], 5, true)
+
+	if tail, err = PruneHistory(db, head, limit, 0); err != nil {
+		t.Fatalf("failed to prune history: %v", err)
+	}
+	if tail != 11 {
+		t.Fatalf("history tail mismatch: have %d, want %d", tail, 11)
+	}
+	if stored := rawdb.ReadHistoryTail(db); stored == nil || *stored != 11 {
+		t.Fatalf("stored history tail mismatch: have %v, want %d", stored, 11)
+	}
+	for number := uint64(1); number <= 12; number++ {
+		checkHistoryBlock(t, db, hashes[number], number, number >= 11)
+	}
+	// Side blocks are not pruned
+	checkHistoryBlock(t, db, side, 5, true)
+
+	// Nothing more is pruned until the head moves
+	if tail, err = PruneHistory(db, head, limit, 0); err != nil || tail != 11 {
+		t.Fatalf("history tail mismatch: have %d (%v), want %d", tail, err, 11)
+	}
+}
+
+func TestHistoryPruned(t *testing.T) {
+	db := rawdb.NewMemoryDatabase(log.Global)
+	hc := &HeaderChain{headerDb: db}
+	hc.historyTail.Store(11)
+
+	canonical := historyTestBlock(t, db, 5, false, true)
+	side := historyTestBlock(t, db, 5, true, false)
+	kept := historyTestBlock(t, db, 11, false, true)
+
+	if !hc.HistoryPruned(canonical, 5) {
+		t.Errorf("canonical block below the tail not reported pruned")
+	}
+	if hc.HistoryPruned(side, 5) {
+		t.Errorf("side block below the tail reported pruned")
+	}
+	if hc.HistoryPruned(kept, 11) {
+		t.Errorf("block at the tail reported pruned")
+	}
+	if hc.HistoryPruned(rawdb.ReadCanonicalHash(db, 0), 0) {
+		t.Errorf("genesis block reported pruned")
+	}
+}
+
+func TestHistoryLoop(t *testing.T) {
+	var (
+		db    = rawdb.NewMemoryDatabase(log.Global)
+		limit = uint64(MinHistoryLimit)
+	)
+	for number := uint64(1); number <= 14; number++ {
+		historyTestBlock(t, db, number, false, true)
+	}
+	hc := &HeaderChain{
+		headerDb:       db,
+		historyLimit:   limit,
+		historyPruneCh: make(chan struct{}, 1),
+		quit:           make(chan struct{}),
+		logger:         log.Global,
+	}
+	setHead := func(number uint64) {
+		head := types.EmptyHeader(common.ZONE_CTX)
+		head.SetNumber(new(big.Int).SetUint64(number), common.ZONE_CTX)
+		hc.currentHeader.Store(head)
+		hc.notifyHistoryPrune()
+	}
+	waitTail := func(want uint64) {
+		t.Helper()
+		for start := time.Now(); hc.HistoryTail() != want; time.Sleep(time.Millisecond) {
+			if time.Since(start) > 3*time.Second {
+				t.Fatalf("history tail mismatch: have %d, want %d", hc.HistoryTail(), want)
+			}
+		}
+	}
+	hc.wg.Add(1)
+	go hc.historyLoop()
+
+	setHead(limit + 10)
+	waitTail(11)
+	setHead(limit + 12)
+	waitTail(13)
+
+	close(hc.quit)
+	hc.wg.Wait()
+
+	if stored := rawdb.ReadHistoryTail(db); stored == nil || *stored != 13 {
+		t.Fatalf("stored history tail mismatch: have %v, want %d", stored, 13)
+	}
+}
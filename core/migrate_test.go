@@ -0,0 +1,162 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/log"
+)
+
+var migrateTestLocation = common.Location{0, 0}
+
+// migrateTestData is the content of the migrated test databases, large enough
+// to be copied in several batches.
+func migrateTestData() map[string][]byte {
+	data := make(map[string][]byte)
+	for i := 0; i < 500; i++ {
+		data[fmt.Sprintf("key-%04d", i)] = bytes.Repeat([]byte{byte(i)}, 1024)
+	}
+	return data
+}
+
+// newMigrateTestDatabase creates a leveldb database in dir holding the test
+// data, with a freezer file in its ancient directory.
+func newMigrateTestDatabase(t *testing.T, dir string) {
+	t.Helper()
+	db, err := rawdb.NewLevelDBDatabase(dir, 16, 16, "", false, log.Global, migrateTestLocation)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	for key, value := range migrateTestData() {
+		if err := db.Put([]byte(key), value); err != nil {
+			t.Fatalf("failed to write database: %v", err)
+		}
+	}
+	db.Close()
+	if err := os.MkdirAll(filepath.Join(dir, "ancient"), 0755); err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ancient", "FLOCK"), nil, 0644); err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+}
+
+// checkMigrateTestDatabase verifies that the database in dir is of the given
+// engine, holds the test data and got the freezer.
+func checkMigrateTestDatabase(t *testing.T, dir string, engine string) {
+	t.Helper()
+	db, err := rawdb.Open(rawdb.OpenOptions{Type: engine, Directory: dir, Cache: 16, Handles: 16}, common.ZONE_CTX, log.Global, migrateTestLocation)
+	if err != nil {
+		t.Fatalf("failed to open %s database: %v", engine, err)
+	}
+	defer db.Close()
+
+	data := migrateTestData()
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	count := 0
+	for it.Next() {
+		if want, ok := data[string(it.Key())]; !ok || !bytes.Equal(it.Value(), want) {
+			t.Fatalf("unexpected entry %q in %s database", it.Key(), engine)
+		}
+		count++
+	}
+	if count != len(data) {
+		t.Errorf("%s database key count mismatch: have %d, want %d", engine, count, len(data))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ancient", "FLOCK")); err != nil {
+		t.Errorf("freezer not moved to the %s database: %v", engine, err)
+	}
+}
+
+func TestMigrateDatabase(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "chaindata")
+	newMigrateTestDatabase(t, dir)
+
+	if err := rawdb.MigrateDatabase(dir, "pebble", "leveldb", 16, 16, log.Global, migrateTestLocation); err == nil {
+		t.Fatalf("migration from the wrong engine accepted")
+	}
+	if err := rawdb.MigrateDatabase(dir, "leveldb", "pebble", 16, 16, log.Global, migrateTestLocation); err != nil {
+		t.Fatalf("failed to migrate to pebble: %v", err)
+	}
+	checkMigrateTestDatabase(t, dir, "pebble")
+
+	if err := rawdb.MigrateDatabase(dir, "pebble", "leveldb", 16, 16, log.Global, migrateTestLocation); err != nil {
+		t.Fatalf("failed to migrate back to leveldb: %v", err)
+	}
+	checkMigrateTestDatabase(t, dir, "leveldb")
+
+	// Both old databases are kept, without the freezer
+	for _, engine := range []string{"leveldb", "pebble"} {
+		if _, err := os.Stat(dir + "." + engine); err != nil {
+			t.Errorf("old %s database not kept: %v", engine, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir+"."+engine, "ancient")); err == nil {
+			t.Errorf("freezer left in the old %s database", engine)
+		}
+	}
+	if _, err := os.Stat(dir + ".migrating"); err == nil {
+		t.Errorf("staging database left behind")
+	}
+}
+
+func TestMigrateDatabaseInterruptedSwap(t *testing.T) {
+	rename := func(t *testing.T, from, to string) {
+		t.Helper()
+		if err := os.Rename(from, to); err != nil {
+			t.Fatalf("failed to rename %s: %v", from, err)
+		}
+	}
+	// Each crash point is rebuilt from a completed migration by undoing the
+	// renames done after it
+	tests := []struct {
+		name string
+		undo func(t *testing.T, dir string)
+	}{
+		{"before renaming", func(t *testing.T, dir string) {
+			rename(t, dir, dir+".migrating")
+			rename(t, dir+".leveldb", dir)
+			rename(t, filepath.Join(dir+".migrating", "ancient"), filepath.Join(dir, "ancient"))
+		}},
+		{"after moving the old database", func(t *testing.T, dir string) {
+			rename(t, dir, dir+".migrating")
+			rename(t, filepath.Join(dir+".migrating", "ancient"), filepath.Join(dir+".leveldb", "ancient"))
+		}},
+		{"after moving the new database", func(t *testing.T, dir string) {
+			rename(t, filepath.Join(dir, "ancient"), filepath.Join(dir+".leveldb", "ancient"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "chaindata")
+			newMigrateTestDatabase(t, dir)
+			if err := rawdb.MigrateDatabase(dir, "leveldb", "pebble", 16, 16, log.Global, migrateTestLocation); err != nil {
+				t.Fatalf("failed to migrate to pebble: %v", err)
+			}
+			tt.undo(t, dir)
+			if err := os.WriteFile(dir+".swapping", []byte("leveldb"), 0644); err != nil {
+				t.Fatalf("failed to write swap marker: %v", err)
+			}
+			// A read-only open refuses the half swapped database
+			if _, err := rawdb.Open(rawdb.OpenOptions{Directory: dir, ReadOnly: true}, common.ZONE_CTX, log.Global, migrateTestLocation); err == nil {
+				t.Fatalf("read-only open of an interrupted migration accepted")
+			}
+			// while the next start completes the swap
+			checkMigrateTestDatabase(t, dir, "pebble")
+			if _, err := os.Stat(dir + ".swapping"); err == nil {
+				t.Errorf("swap marker left behind")
+			}
+			if _, err := os.Stat(dir + ".migrating"); err == nil {
+				t.Errorf("staging database left behind")
+			}
+			if _, err := os.Stat(dir + ".leveldb"); err != nil {
+				t.Errorf("old database not kept: %v", err)
+			}
+		})
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"math/big"
 
 	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
 	"github.com/dominant-strategies/go-quai/core/types"
 	"github.com/dominant-strategies/go-quai/crypto"
 	"github.com/dominant-strategies/go-quai/ethdb"
@@ -243,6 +244,26 @@ func WriteTxIndexTail(db ethdb.KeyValueWriter, number uint64) {
 	}
 }
 
+// ReadHistoryTail retrieves the number of the oldest block whose bodies and
+// receipts are still stored. If the corresponding entry is non-existent in
+// database it means no history has been pruned.
+func ReadHistoryTail(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(historyTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteHistoryTail stores the number of the oldest block whose bodies and
+// receipts are still stored into database.
+func WriteHistoryTail(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(historyTailKey, encodeBlockNumber(number)); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to store the history tail")
+	}
+}
+
 // ReadFastTxLookupLimit retrieves the tx lookup limit used in fast sync.
 func ReadFastTxLookupLimit(db ethdb.KeyValueReader) *uint64 {
 	data, _ := db.Get(fastTxLookupLimitKey)
@@ -516,10 +537,30 @@ func DeleteAllPbBodyKeys(db ethdb.KeyValueWriter) {
 	}
 }
 
+// readAncientByHash retrieves the data of a frozen canonical block from a table
+// of the dom chain data, which the key-value store keys by hash only.
+func readAncientByHash(db ethdb.Reader, kind string, hash common.Hash) []byte {
+	number := ReadHeaderNumber(db, hash)
+	if number == nil {
+		return nil
+	}
+	data, _ := db.Ancient(kind, *number)
+	if len(data) == 0 {
+		return nil
+	}
+	if h, _ := db.Ancient(freezerHashTable, *number); common.BytesToHash(h) != hash {
+		return nil
+	}
+	return data
+}
+
 // ReadHeadsHashes retreive's the heads hashes of the blockchain.
 func ReadTermini(db ethdb.Reader, hash common.Hash) *types.Termini {
 	key := terminiKey(hash)
 	data, _ := db.Get(key)
+	if len(data) == 0 {
+		data = readAncientByHash(db, freezerTerminiTable, hash)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -574,6 +615,9 @@ func ReadWorkObjectHeader(db ethdb.Reader, hash common.Hash, woType types.WorkOb
 		key = phWorkObjectHeaderKey(hash)
 	}
 	data, _ := db.Get(key)
+	if len(data) == 0 && woType == types.BlockObject {
+		data = readAncientByHash(db, freezerHeaderTable, hash)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -697,8 +741,7 @@ func DeleteBlockWithoutNumber(db ethdb.KeyValueWriter, hash common.Hash, number
 
 // ReadWorkObjectBody retreive's the work object body stored in hash.
 func ReadWorkObjectBody(db ethdb.Reader, hash common.Hash, woType types.WorkObjectView) *types.WorkObjectBody {
-	key := workObjectBodyKey(hash)
-	data, _ := db.Get(key)
+	data := readWorkObjectBodyProto(db, hash)
 	if len(data) == 0 {
 		return nil
 	}
@@ -721,8 +764,7 @@ func ReadWorkObjectBody(db ethdb.Reader, hash common.Hash, woType types.WorkObje
 }
 
 func ReadWorkObjectBodyHeaderOnly(db ethdb.Reader, hash common.Hash) *types.WorkObjectBody {
-	key := workObjectBodyKey(hash)
-	data, _ := db.Get(key)
+	data := readWorkObjectBodyProto(db, hash)
 	if len(data) == 0 {
 		return nil
 	}
@@ -744,6 +786,16 @@ func ReadWorkObjectBodyHeaderOnly(db ethdb.Reader, hash common.Hash) *types.Work
 	return workObjectBody
 }
 
+// readWorkObjectBodyProto retrieves the work object body in its raw proto
+// encoding, from the ancient store once the block is frozen.
+func readWorkObjectBodyProto(db ethdb.Reader, hash common.Hash) []byte {
+	data, _ := db.Get(workObjectBodyKey(hash))
+	if len(data) == 0 {
+		data = readAncientByHash(db, freezerBodiesTable, hash)
+	}
+	return data
+}
+
 // WriteWorkObjectBody writes the work object body of the terminus hash.
 func WriteWorkObjectBody(db ethdb.KeyValueWriter, hash common.Hash, workObject *types.WorkObject, woType types.WorkObjectView, nodeCtx int) {
 
@@ -771,6 +823,32 @@ func DeleteWorkObjectBody(db ethdb.KeyValueWriter, hash common.Hash) {
 	}
 }
 
+// PruneWorkObjectBody rewrites the work object body stored for the header hash
+// without its transactions and external transactions. The header, uncles,
+// manifest and interlink hashes are kept, as header reads and the dom/sub
+// coordination still need them. The body is read from db and the pruned one is
+// written to batch.
+func PruneWorkObjectBody(db ethdb.KeyValueReader, batch ethdb.KeyValueWriter, hash common.Hash) {
+	key := workObjectBodyKey(hash)
+	data, _ := db.Get(key)
+	if len(data) == 0 {
+		return
+	}
+	protoWorkObjectBody := new(types.ProtoWorkObjectBody)
+	if err := proto.Unmarshal(data, protoWorkObjectBody); err != nil {
+		batch.Logger().WithField("err", err).Fatal("Failed to proto Unmarshal work object body")
+	}
+	protoWorkObjectBody.Transactions = &types.ProtoTransactions{}
+	protoWorkObjectBody.ExtTransactions = &types.ProtoTransactions{}
+	data, err := proto.Marshal(protoWorkObjectBody)
+	if err != nil {
+		batch.Logger().WithField("err", err).Fatal("Failed to proto Marshal work object body")
+	}
+	if err := batch.Put(key, data); err != nil {
+		batch.Logger().WithField("err", err).Fatal("Failed to store work object body")
+	}
+}
+
 // ReadPendingHeader retreive's the pending header stored in hash.
 func ReadPendingHeader(db ethdb.Reader, hash common.Hash) *types.PendingHeader {
 	key := pendingHeaderKey(hash)
@@ -1125,6 +1203,118 @@ func ReadBadWorkObject(db ethdb.Reader, hash common.Hash) *types.WorkObject {
 	return nil
 }
 
+const reorgHistoryToKeep = 128
+
+// ReadReorgHistory retrieves the most recent reorgs, oldest first.
+func ReadReorgHistory(db ethdb.KeyValueReader) []*types.Reorg {
+	head := readReorgHistoryHead(db)
+	first := uint64(0)
+	if head > reorgHistoryToKeep {
+		first = head - reorgHistoryToKeep
+	}
+	reorgs := make([]*types.Reorg, 0, head-first)
+	for number := first; number < head; number++ {
+		if reorg := readReorg(db, number); reorg != nil {
+			reorgs = append(reorgs, reorg)
+		}
+	}
+	return reorgs
+}
+
+// WriteReorg appends a reorg to the reorg history, deleting the oldest entry
+// beyond the retention limit.
+func WriteReorg(db ethdb.KeyValueStore, reorg *types.Reorg) {
+	head := readReorgHistoryHead(db)
+	data, err := proto.Marshal(encodeReorg(reorg))
+	if err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to proto encode reorg")
+	}
+	protoHead, err := proto.Marshal(&ProtoNumber{Number: head + 1})
+	if err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to proto encode reorg history head")
+	}
+	batch := db.NewBatch()
+	if err := batch.Put(reorgKey(head), data); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to store reorg")
+	}
+	if head >= reorgHistoryToKeep {
+		if err := batch.Delete(reorgKey(head - reorgHistoryToKeep)); err != nil {
+			db.Logger().WithField("err", err).Fatal("Failed to delete reorg")
+		}
+	}
+	if err := batch.Put(reorgHistoryHeadKey, protoHead); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to store reorg history head")
+	}
+	if err := batch.Write(); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to store reorg history")
+	}
+}
+
+// readReorgHistoryHead retrieves the number of reorgs recorded so far.
+func readReorgHistoryHead(db ethdb.KeyValueReader) uint64 {
+	data, _ := db.Get(reorgHistoryHeadKey)
+	if len(data) == 0 {
+		return 0
+	}
+	protoHead := new(ProtoNumber)
+	if err := proto.Unmarshal(data, protoHead); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to proto Unmarshal reorg history head")
+	}
+	return protoHead.Number
+}
+
+// readReorg retrieves the reorg recorded under the given number.
+func readReorg(db ethdb.KeyValueReader, number uint64) *types.Reorg {
+	data, _ := db.Get(reorgKey(number))
+	if len(data) == 0 {
+		return nil
+	}
+	protoReorg := new(ProtoReorg)
+	if err := proto.Unmarshal(data, protoReorg); err != nil {
+		db.Logger().WithField("err", err).Error("Invalid reorg proto")
+		return nil
+	}
+	return decodeReorg(protoReorg)
+}
+
+func encodeReorg(reorg *types.Reorg) *ProtoReorg {
+	protoReorg := &ProtoReorg{
+		OldHead:        reorg.OldHead.ProtoEncode(),
+		NewHead:        reorg.NewHead.ProtoEncode(),
+		CommonAncestor: reorg.CommonAncestor.ProtoEncode(),
+		Number:         uint64(reorg.Number),
+		Depth:          uint64(reorg.Depth),
+		Removed:        common.Hashes(reorg.Removed).ProtoEncode(),
+		Added:          common.Hashes(reorg.Added).ProtoEncode(),
+		Time:           uint64(reorg.Time),
+	}
+	if reorg.OldEntropy != nil {
+		protoReorg.OldEntropy = reorg.OldEntropy.ToInt().Bytes()
+	}
+	if reorg.NewEntropy != nil {
+		protoReorg.NewEntropy = reorg.NewEntropy.ToInt().Bytes()
+	}
+	return protoReorg
+}
+
+func decodeReorg(protoReorg *ProtoReorg) *types.Reorg {
+	reorg := &types.Reorg{
+		Number:     hexutil.Uint64(protoReorg.GetNumber()),
+		Depth:      hexutil.Uint64(protoReorg.GetDepth()),
+		OldEntropy: (*hexutil.Big)(new(big.Int).SetBytes(protoReorg.GetOldEntropy())),
+		NewEntropy: (*hexutil.Big)(new(big.Int).SetBytes(protoReorg.GetNewEntropy())),
+		Time:       hexutil.Uint64(protoReorg.GetTime()),
+	}
+	reorg.OldHead.ProtoDecode(protoReorg.GetOldHead())
+	reorg.NewHead.ProtoDecode(protoReorg.GetNewHead())
+	reorg.CommonAncestor.ProtoDecode(protoReorg.GetCommonAncestor())
+	var removed, added common.Hashes
+	removed.ProtoDecode(protoReorg.GetRemoved())
+	added.ProtoDecode(protoReorg.GetAdded())
+	reorg.Removed, reorg.Added = removed, added
+	return reorg
+}
+
 // FindCommonAncestor returns the last common ancestor of two block headers
 func FindCommonAncestor(db ethdb.Reader, a, b *types.WorkObject, nodeCtx int) *types.WorkObject {
 	for bn := b.NumberU64(nodeCtx); a.NumberU64(nodeCtx) > bn; {
@@ -1362,6 +1552,9 @@ func DeletePendingEtxs(db ethdb.KeyValueWriter, hash common.Hash) {
 func ReadPendingEtxsRollup(db ethdb.Reader, hash common.Hash) *types.PendingEtxsRollup {
 	// Try to look up the data in leveldb.
 	data, _ := db.Get(pendingEtxsRollupKey(hash))
+	if len(data) == 0 {
+		data = readAncientByHash(db, freezerPendingEtxsRollupTable, hash)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -1408,6 +1601,9 @@ func DeletePendingEtxsRollup(db ethdb.KeyValueWriter, hash common.Hash) {
 func ReadManifest(db ethdb.Reader, hash common.Hash) types.BlockManifest {
 	// Try to look up the data in leveldb.
 	data, _ := db.Get(manifestKey(hash))
+	if len(data) == 0 {
+		data = readAncientByHash(db, freezerManifestTable, hash)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -1454,6 +1650,9 @@ func DeleteManifest(db ethdb.KeyValueWriter, hash common.Hash) {
 func ReadInterlinkHashes(db ethdb.Reader, hash common.Hash) common.Hashes {
 	// Try to look up the data in leveldb.
 	data, _ := db.Get(interlinkHashKey(hash))
+	if len(data) == 0 {
+		data = readAncientByHash(db, freezerInterlinkTable, hash)
+	}
 	if len(data) == 0 {
 		return nil
 	}
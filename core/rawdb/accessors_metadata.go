@@ -52,6 +52,20 @@ func WriteDatabaseVersion(db ethdb.KeyValueWriter, version uint64) {
 	}
 }
 
+// ReadGCMode retrieves the trie garbage collection mode ("full" or "archive")
+// the database was created with, or an empty string if none was recorded.
+func ReadGCMode(db ethdb.KeyValueReader) string {
+	data, _ := db.Get(gcModeKey)
+	return string(data)
+}
+
+// WriteGCMode stores the trie garbage collection mode of the database.
+func WriteGCMode(db ethdb.KeyValueWriter, mode string) {
+	if err := db.Put(gcModeKey, []byte(mode)); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to store the gc mode")
+	}
+}
+
 // ReadChainConfig retrieves the consensus settings based on the given genesis hash.
 func ReadChainConfig(db ethdb.KeyValueReader, hash common.Hash) *params.ChainConfig {
 	data, _ := db.Get(configKey(hash))
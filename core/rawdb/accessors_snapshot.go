@@ -215,3 +215,95 @@ func DeleteSnapshotSyncStatus(db ethdb.KeyValueWriter) {
 		db.Logger().WithField("err", err).Fatal("Failed to remove snapshot sync status")
 	}
 }
+
+// ReadSnapshotUtxoRoot retrieves the UTXO root of the block whose UTXO set is
+// contained in the persisted UTXO snapshot.
+func ReadSnapshotUtxoRoot(db ethdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(snapshotUtxoRootKey)
+	if len(data) != common.HashLength {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteSnapshotUtxoRoot stores the UTXO root of the block whose UTXO set is
+// contained in the persisted UTXO snapshot.
+func WriteSnapshotUtxoRoot(db ethdb.KeyValueWriter, root common.Hash) {
+	if err := db.Put(snapshotUtxoRootKey, root[:]); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to store utxo snapshot root")
+	}
+}
+
+// DeleteSnapshotUtxoRoot deletes the UTXO root of the persisted UTXO snapshot,
+// marking the entire UTXO snapshot invalid until it is written again.
+func DeleteSnapshotUtxoRoot(db ethdb.KeyValueWriter) {
+	if err := db.Delete(snapshotUtxoRootKey); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to remove utxo snapshot root")
+	}
+}
+
+// ReadUtxoSnapshot retrieves the snapshot entry of a UTXO trie leaf.
+func ReadUtxoSnapshot(db ethdb.KeyValueReader, hash common.Hash) []byte {
+	data, _ := db.Get(utxoSnapshotKey(hash))
+	return data
+}
+
+// WriteUtxoSnapshot stores the snapshot entry of a UTXO trie leaf.
+func WriteUtxoSnapshot(db ethdb.KeyValueWriter, hash common.Hash, entry []byte) {
+	if err := db.Put(utxoSnapshotKey(hash), entry); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to store utxo snapshot")
+	}
+}
+
+// DeleteUtxoSnapshot removes the snapshot entry of a UTXO trie leaf.
+func DeleteUtxoSnapshot(db ethdb.KeyValueWriter, hash common.Hash) {
+	if err := db.Delete(utxoSnapshotKey(hash)); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to delete utxo snapshot")
+	}
+}
+
+// ReadSnapshotUtxoJournal retrieves the serialized in-memory UTXO diff layers
+// saved at the last shutdown.
+func ReadSnapshotUtxoJournal(db ethdb.KeyValueReader) []byte {
+	data, _ := db.Get(snapshotUtxoJournalKey)
+	return data
+}
+
+// WriteSnapshotUtxoJournal stores the serialized in-memory UTXO diff layers to
+// save at shutdown.
+func WriteSnapshotUtxoJournal(db ethdb.KeyValueWriter, journal []byte) {
+	if err := db.Put(snapshotUtxoJournalKey, journal); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to store utxo snapshot journal")
+	}
+}
+
+// DeleteSnapshotUtxoJournal deletes the serialized in-memory UTXO diff layers
+// saved at the last shutdown
+func DeleteSnapshotUtxoJournal(db ethdb.KeyValueWriter) {
+	if err := db.Delete(snapshotUtxoJournalKey); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to remove utxo snapshot journal")
+	}
+}
+
+// ReadSnapshotUtxoGenerator retrieves the serialized UTXO snapshot generator
+// saved at the last shutdown.
+func ReadSnapshotUtxoGenerator(db ethdb.KeyValueReader) []byte {
+	data, _ := db.Get(snapshotUtxoGeneratorKey)
+	return data
+}
+
+// WriteSnapshotUtxoGenerator stores the serialized UTXO snapshot generator to
+// save at shutdown.
+func WriteSnapshotUtxoGenerator(db ethdb.KeyValueWriter, generator []byte) {
+	if err := db.Put(snapshotUtxoGeneratorKey, generator); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to store utxo snapshot generator")
+	}
+}
+
+// DeleteSnapshotUtxoGenerator deletes the serialized UTXO snapshot generator
+// saved at the last shutdown
+func DeleteSnapshotUtxoGenerator(db ethdb.KeyValueWriter) {
+	if err := db.Delete(snapshotUtxoGeneratorKey); err != nil {
+		db.Logger().WithField("err", err).Fatal("Failed to remove utxo snapshot generator")
+	}
+}
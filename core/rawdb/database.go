@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"sync/atomic"
 	"time"
 
@@ -101,7 +102,7 @@ func (db *nofreezedb) AncientSize(kind string) (uint64, error) {
 }
 
 // AppendAncient returns an error as we don't have a backing chain freezer.
-func (db *nofreezedb) AppendAncient(number uint64, hash, header, body, receipts, etxSet []byte) error {
+func (db *nofreezedb) AppendAncient(number uint64, hash, header, body, receipts, etxSet, manifest, termini, pendingEtxsRollup, interlinkHashes []byte) error {
 	return errNotSupported
 }
 
@@ -132,6 +133,11 @@ func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace st
 	if err != nil {
 		return nil, err
 	}
+	// Migrate the freezers created before the dom chain data tables
+	if err := frdb.backfill(db); err != nil {
+		frdb.Close()
+		return nil, err
+	}
 	// Since the freezer can be stored separately from the user's key-value database,
 	// there's a fairly high probability that the user requests invalid combinations
 	// of the freezer and database. Ensure that we don't shoot ourselves in the foot
@@ -196,6 +202,22 @@ func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace st
 			// feezer.
 		}
 	}
+	// Freezer is consistent with the key-value database, permit combining the two
+	if !frdb.readonly {
+		frdb.wg.Add(1)
+		go func() {
+			defer frdb.wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					logger.WithFields(log.Fields{
+						"error":      r,
+						"stacktrace": string(debug.Stack()),
+					}).Error("Go-Quai Panicked")
+				}
+			}()
+			frdb.freeze(db, nodeCtx, location)
+		}()
+	}
 	return &freezerdb{
 		KeyValueStore: db,
 		AncientStore:  frdb,
@@ -292,6 +314,15 @@ func openKeyValueDatabase(o OpenOptions, logger *log.Logger, location common.Loc
 // The passed o.AncientDir indicates the path of root ancient directory where
 // the chain freezer can be opened.
 func Open(o OpenOptions, nodeCtx int, logger *log.Logger, location common.Location) (ethdb.Database, error) {
+	// Complete a database migration interrupted while swapping the databases,
+	// as the directory may not hold the database yet
+	if o.ReadOnly {
+		if _, err := os.Stat(o.Directory + migrationSwapSuffix); err == nil {
+			return nil, fmt.Errorf("interrupted database migration in %s, open it read-write to complete it", o.Directory)
+		}
+	} else if _, err := RecoverDatabaseSwap(o.Directory, logger); err != nil {
+		return nil, err
+	}
 	kvdb, err := openKeyValueDatabase(o, logger, location)
 	if err != nil {
 		return nil, err
@@ -360,15 +391,21 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte, logger *log.
 		txLookups       stat
 		accountSnaps    stat
 		storageSnaps    stat
+		utxoSnaps       stat
 		preimages       stat
 		bloomBits       stat
 
 		// Ancient store statistics
-		ancientHeadersSize  common.StorageSize
-		ancientBodiesSize   common.StorageSize
-		ancientReceiptsSize common.StorageSize
-		ancientTdsSize      common.StorageSize
-		ancientHashesSize   common.StorageSize
+		ancientHeadersSize   common.StorageSize
+		ancientBodiesSize    common.StorageSize
+		ancientReceiptsSize  common.StorageSize
+		ancientTdsSize       common.StorageSize
+		ancientHashesSize    common.StorageSize
+		ancientEtxSetsSize   common.StorageSize
+		ancientManifestSize  common.StorageSize
+		ancientTerminiSize   common.StorageSize
+		ancientRollupsSize   common.StorageSize
+		ancientInterlinkSize common.StorageSize
 
 		// Les statistic
 		chtTrieNodes   stat
@@ -411,10 +448,14 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte, logger *log.
 			accountSnaps.Add(size)
 		case bytes.HasPrefix(key, SnapshotStoragePrefix) && len(key) == (len(SnapshotStoragePrefix)+2*common.HashLength):
 			storageSnaps.Add(size)
+		case bytes.HasPrefix(key, SnapshotUtxoPrefix) && len(key) == (len(SnapshotUtxoPrefix)+common.HashLength):
+			utxoSnaps.Add(size)
 		case bytes.HasPrefix(key, preimagePrefix) && len(key) == (len(preimagePrefix)+common.HashLength):
 			preimages.Add(size)
 		case bytes.HasPrefix(key, configPrefix) && len(key) == (len(configPrefix)+common.HashLength):
 			metadata.Add(size)
+		case bytes.HasPrefix(key, reorgPrefix) && len(key) == (len(reorgPrefix)+8):
+			metadata.Add(size)
 		case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == (len(bloomBitsPrefix)+10+common.HashLength):
 			bloomBits.Add(size)
 		case bytes.HasPrefix(key, BloomBitsIndexPrefix):
@@ -432,8 +473,9 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte, logger *log.
 			for _, meta := range [][]byte{
 				databaseVersionKey, headHeaderKey, headWorkObjectKey, lastPivotKey,
 				fastTrieProgressKey, snapshotDisabledKey, snapshotRootKey, snapshotJournalKey,
-				snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey,
-				uncleanShutdownKey, badWorkObjectKey,
+				snapshotGeneratorKey, snapshotRecoveryKey, snapshotUtxoRootKey, snapshotUtxoJournalKey,
+				snapshotUtxoGeneratorKey, txIndexTailKey, historyTailKey, fastTxLookupLimitKey, uncleanShutdownKey,
+				badWorkObjectKey, gcModeKey, reorgHistoryHeadKey,
 			} {
 				if bytes.Equal(key, meta) {
 					metadata.Add(size)
@@ -455,8 +497,8 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte, logger *log.
 		}
 	}
 	// Inspect append-only file store then.
-	ancientSizes := []*common.StorageSize{&ancientHeadersSize, &ancientBodiesSize, &ancientReceiptsSize, &ancientHashesSize, &ancientTdsSize}
-	for i, category := range []string{freezerHeaderTable, freezerBodiesTable, freezerReceiptTable, freezerHashTable, freezerDifficultyTable, freezerEtxSetsTable} {
+	ancientSizes := []*common.StorageSize{&ancientHeadersSize, &ancientBodiesSize, &ancientReceiptsSize, &ancientHashesSize, &ancientTdsSize, &ancientEtxSetsSize, &ancientManifestSize, &ancientTerminiSize, &ancientRollupsSize, &ancientInterlinkSize}
+	for i, category := range []string{freezerHeaderTable, freezerBodiesTable, freezerReceiptTable, freezerHashTable, freezerDifficultyTable, freezerEtxSetsTable, freezerManifestTable, freezerTerminiTable, freezerPendingEtxsRollupTable, freezerInterlinkTable} {
 		if size, err := db.AncientSize(category); err == nil {
 			*ancientSizes[i] += common.StorageSize(size)
 			total += common.StorageSize(size)
@@ -482,12 +524,18 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte, logger *log.
 		{"Key-Value store", "Trie preimages", preimages.Size(), preimages.Count()},
 		{"Key-Value store", "Account snapshot", accountSnaps.Size(), accountSnaps.Count()},
 		{"Key-Value store", "Storage snapshot", storageSnaps.Size(), storageSnaps.Count()},
+		{"Key-Value store", "UTXO snapshot", utxoSnaps.Size(), utxoSnaps.Count()},
 		{"Key-Value store", "Singleton metadata", metadata.Size(), metadata.Count()},
 		{"Ancient store", "Headers", ancientHeadersSize.String(), ancients.String()},
 		{"Ancient store", "Bodies", ancientBodiesSize.String(), ancients.String()},
 		{"Ancient store", "Receipt lists", ancientReceiptsSize.String(), ancients.String()},
 		{"Ancient store", "Difficulties", ancientTdsSize.String(), ancients.String()},
 		{"Ancient store", "Block number->hash", ancientHashesSize.String(), ancients.String()},
+		{"Ancient store", "ETX sets", ancientEtxSetsSize.String(), ancients.String()},
+		{"Ancient store", "Manifests", ancientManifestSize.String(), ancients.String()},
+		{"Ancient store", "Termini", ancientTerminiSize.String(), ancients.String()},
+		{"Ancient store", "Pending ETX rollups", ancientRollupsSize.String(), ancients.String()},
+		{"Ancient store", "Interlink hashes", ancientInterlinkSize.String(), ancients.String()},
 		{"Light client", "CHT trie nodes", chtTrieNodes.Size(), chtTrieNodes.Count()},
 		{"Light client", "Bloom trie nodes", bloomTrieNodes.Size(), bloomTrieNodes.Count()},
 	}
@@ -242,6 +242,125 @@ func (x *ProtoLegacyTxLookupEntry) GetIndex() uint64 {
 	return 0
 }
 
+type ProtoReorg struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	OldHead        *common.ProtoHash   `protobuf:"bytes,1,opt,name=old_head,json=oldHead,proto3" json:"old_head,omitempty"`
+	NewHead        *common.ProtoHash   `protobuf:"bytes,2,opt,name=new_head,json=newHead,proto3" json:"new_head,omitempty"`
+	CommonAncestor *common.ProtoHash   `protobuf:"bytes,3,opt,name=common_ancestor,json=commonAncestor,proto3" json:"common_ancestor,omitempty"`
+	Number         uint64              `protobuf:"varint,4,opt,name=number,proto3" json:"number,omitempty"`
+	Depth          uint64              `protobuf:"varint,5,opt,name=depth,proto3" json:"depth,omitempty"`
+	Removed        *common.ProtoHashes `protobuf:"bytes,6,opt,name=removed,proto3" json:"removed,omitempty"`
+	Added          *common.ProtoHashes `protobuf:"bytes,7,opt,name=added,proto3" json:"added,omitempty"`
+	OldEntropy     []byte              `protobuf:"bytes,8,opt,name=old_entropy,json=oldEntropy,proto3" json:"old_entropy,omitempty"`
+	NewEntropy     []byte              `protobuf:"bytes,9,opt,name=new_entropy,json=newEntropy,proto3" json:"new_entropy,omitempty"`
+	Time           uint64              `protobuf:"varint,10,opt,name=time,proto3" json:"time,omitempty"`
+}
+
+func (x *ProtoReorg) Reset() {
+	*x = ProtoReorg{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_core_rawdb_db_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProtoReorg) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProtoReorg) ProtoMessage() {}
+
+func (x *ProtoReorg) ProtoReflect() protoreflect.Message {
+	mi := &file_core_rawdb_db_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProtoReorg.ProtoReflect.Descriptor instead.
+func (*ProtoReorg) Descriptor() ([]byte, []int) {
+	return file_core_rawdb_db_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ProtoReorg) GetOldHead() *common.ProtoHash {
+	if x != nil {
+		return x.OldHead
+	}
+	return nil
+}
+
+func (x *ProtoReorg) GetNewHead() *common.ProtoHash {
+	if x != nil {
+		return x.NewHead
+	}
+	return nil
+}
+
+func (x *ProtoReorg) GetCommonAncestor() *common.ProtoHash {
+	if x != nil {
+		return x.CommonAncestor
+	}
+	return nil
+}
+
+func (x *ProtoReorg) GetNumber() uint64 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *ProtoReorg) GetDepth() uint64 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *ProtoReorg) GetRemoved() *common.ProtoHashes {
+	if x != nil {
+		return x.Removed
+	}
+	return nil
+}
+
+func (x *ProtoReorg) GetAdded() *common.ProtoHashes {
+	if x != nil {
+		return x.Added
+	}
+	return nil
+}
+
+func (x *ProtoReorg) GetOldEntropy() []byte {
+	if x != nil {
+		return x.OldEntropy
+	}
+	return nil
+}
+
+func (x *ProtoReorg) GetNewEntropy() []byte {
+	if x != nil {
+		return x.NewEntropy
+	}
+	return nil
+}
+
+func (x *ProtoReorg) GetTime() uint64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
 var File_core_rawdb_db_proto protoreflect.FileDescriptor
 
 var file_core_rawdb_db_proto_rawDesc = []byte{
@@ -276,11 +395,35 @@ var file_core_rawdb_db_proto_rawDesc = []byte{
 	0x04, 0x68, 0x61, 0x73, 0x68, 0x12, 0x1f, 0x0a, 0x0b, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x5f, 0x69,
 	0x6e, 0x64, 0x65, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x62, 0x6c, 0x6f, 0x63,
 	0x6b, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x18,
-	0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x42, 0x33, 0x5a, 0x31,
-	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x64, 0x6f, 0x6d, 0x69, 0x6e,
-	0x61, 0x6e, 0x74, 0x2d, 0x73, 0x74, 0x72, 0x61, 0x74, 0x65, 0x67, 0x69, 0x65, 0x73, 0x2f, 0x67,
-	0x6f, 0x2d, 0x71, 0x75, 0x61, 0x69, 0x2f, 0x63, 0x6f, 0x72, 0x65, 0x2f, 0x72, 0x61, 0x77, 0x64,
-	0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x22, 0x82, 0x03, 0x0a,
+	0x0a, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x52, 0x65, 0x6f, 0x72, 0x67, 0x12, 0x2c, 0x0a, 0x08, 0x6f,
+	0x6c, 0x64, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e,
+	0x63, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x48, 0x61, 0x73, 0x68,
+	0x52, 0x07, 0x6f, 0x6c, 0x64, 0x48, 0x65, 0x61, 0x64, 0x12, 0x2c, 0x0a, 0x08, 0x6e, 0x65, 0x77,
+	0x5f, 0x68, 0x65, 0x61, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x63, 0x6f,
+	0x6d, 0x6d, 0x6f, 0x6e, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x48, 0x61, 0x73, 0x68, 0x52, 0x07,
+	0x6e, 0x65, 0x77, 0x48, 0x65, 0x61, 0x64, 0x12, 0x3a, 0x0a, 0x0f, 0x63, 0x6f, 0x6d, 0x6d, 0x6f,
+	0x6e, 0x5f, 0x61, 0x6e, 0x63, 0x65, 0x73, 0x74, 0x6f, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x11, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x48,
+	0x61, 0x73, 0x68, 0x52, 0x0e, 0x63, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x41, 0x6e, 0x63, 0x65, 0x73,
+	0x74, 0x6f, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x64,
+	0x65, 0x70, 0x74, 0x68, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x64, 0x65, 0x70, 0x74,
+	0x68, 0x12, 0x2d, 0x0a, 0x07, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x64, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x13, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x2e, 0x50, 0x72, 0x6f, 0x74,
+	0x6f, 0x48, 0x61, 0x73, 0x68, 0x65, 0x73, 0x52, 0x07, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x64,
+	0x12, 0x29, 0x0a, 0x05, 0x61, 0x64, 0x64, 0x65, 0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x13, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x48, 0x61,
+	0x73, 0x68, 0x65, 0x73, 0x52, 0x05, 0x61, 0x64, 0x64, 0x65, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x6f,
+	0x6c, 0x64, 0x5f, 0x65, 0x6e, 0x74, 0x72, 0x6f, 0x70, 0x79, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x0a, 0x6f, 0x6c, 0x64, 0x45, 0x6e, 0x74, 0x72, 0x6f, 0x70, 0x79, 0x12, 0x1f, 0x0a, 0x0b,
+	0x6e, 0x65, 0x77, 0x5f, 0x65, 0x6e, 0x74, 0x72, 0x6f, 0x70, 0x79, 0x18, 0x09, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x0a, 0x6e, 0x65, 0x77, 0x45, 0x6e, 0x74, 0x72, 0x6f, 0x70, 0x79, 0x12, 0x12, 0x0a,
+	0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x74, 0x69, 0x6d,
+	0x65, 0x42, 0x33, 0x5a, 0x31, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f,
+	0x64, 0x6f, 0x6d, 0x69, 0x6e, 0x61, 0x6e, 0x74, 0x2d, 0x73, 0x74, 0x72, 0x61, 0x74, 0x65, 0x67,
+	0x69, 0x65, 0x73, 0x2f, 0x67, 0x6f, 0x2d, 0x71, 0x75, 0x61, 0x69, 0x2f, 0x63, 0x6f, 0x72, 0x65,
+	0x2f, 0x72, 0x61, 0x77, 0x64, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -295,28 +438,35 @@ func file_core_rawdb_db_proto_rawDescGZIP() []byte {
 	return file_core_rawdb_db_proto_rawDescData
 }
 
-var file_core_rawdb_db_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_core_rawdb_db_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
 var file_core_rawdb_db_proto_goTypes = []interface{}{
 	(*ProtoNumber)(nil),                 // 0: db.ProtoNumber
 	(*ProtoBadWorkObject)(nil),          // 1: db.ProtoBadWorkObject
 	(*ProtoBadWorkObjects)(nil),         // 2: db.ProtoBadWorkObjects
 	(*ProtoLegacyTxLookupEntry)(nil),    // 3: db.ProtoLegacyTxLookupEntry
-	(*types.ProtoWorkObjectHeader)(nil), // 4: block.ProtoWorkObjectHeader
-	(*types.ProtoWorkObjectBody)(nil),   // 5: block.ProtoWorkObjectBody
-	(*types.ProtoTransaction)(nil),      // 6: block.ProtoTransaction
-	(*common.ProtoHash)(nil),            // 7: common.ProtoHash
+	(*ProtoReorg)(nil),                  // 4: db.ProtoReorg
+	(*types.ProtoWorkObjectHeader)(nil), // 5: block.ProtoWorkObjectHeader
+	(*types.ProtoWorkObjectBody)(nil),   // 6: block.ProtoWorkObjectBody
+	(*types.ProtoTransaction)(nil),      // 7: block.ProtoTransaction
+	(*common.ProtoHash)(nil),            // 8: common.ProtoHash
+	(*common.ProtoHashes)(nil),          // 9: common.ProtoHashes
 }
 var file_core_rawdb_db_proto_depIdxs = []int32{
-	4, // 0: db.ProtoBadWorkObject.wo_header:type_name -> block.ProtoWorkObjectHeader
-	5, // 1: db.ProtoBadWorkObject.wo_body:type_name -> block.ProtoWorkObjectBody
-	6, // 2: db.ProtoBadWorkObject.tx:type_name -> block.ProtoTransaction
-	1, // 3: db.ProtoBadWorkObjects.bad_work_objects:type_name -> db.ProtoBadWorkObject
-	7, // 4: db.ProtoLegacyTxLookupEntry.hash:type_name -> common.ProtoHash
-	5, // [5:5] is the sub-list for method output_type
-	5, // [5:5] is the sub-list for method input_type
-	5, // [5:5] is the sub-list for extension type_name
-	5, // [5:5] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+	5,  // 0: db.ProtoBadWorkObject.wo_header:type_name -> block.ProtoWorkObjectHeader
+	6,  // 1: db.ProtoBadWorkObject.wo_body:type_name -> block.ProtoWorkObjectBody
+	7,  // 2: db.ProtoBadWorkObject.tx:type_name -> block.ProtoTransaction
+	1,  // 3: db.ProtoBadWorkObjects.bad_work_objects:type_name -> db.ProtoBadWorkObject
+	8,  // 4: db.ProtoLegacyTxLookupEntry.hash:type_name -> common.ProtoHash
+	8,  // 5: db.ProtoReorg.old_head:type_name -> common.ProtoHash
+	8,  // 6: db.ProtoReorg.new_head:type_name -> common.ProtoHash
+	8,  // 7: db.ProtoReorg.common_ancestor:type_name -> common.ProtoHash
+	9,  // 8: db.ProtoReorg.removed:type_name -> common.ProtoHashes
+	9,  // 9: db.ProtoReorg.added:type_name -> common.ProtoHashes
+	10, // [10:10] is the sub-list for method output_type
+	10, // [10:10] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
 }
 
 func init() { file_core_rawdb_db_proto_init() }
@@ -373,6 +523,18 @@ func file_core_rawdb_db_proto_init() {
 				return nil
 			}
 		}
+		file_core_rawdb_db_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProtoReorg); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -380,7 +542,7 @@ func file_core_rawdb_db_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_core_rawdb_db_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   5,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -200,7 +200,7 @@ func (f *freezer) AncientSize(kind string) (uint64, error) {
 // Notably, this function is lock free but kind of thread-safe. All out-of-order
 // injection will be rejected. But if two injections with same number happen at
 // the same time, we can get into the trouble.
-func (f *freezer) AppendAncient(number uint64, hash, header, body, receipts, etxSet []byte) (err error) {
+func (f *freezer) AppendAncient(number uint64, hash, header, body, receipts, etxSet, manifest, termini, pendingEtxsRollup, interlinkHashes []byte) (err error) {
 	if f.readonly {
 		return errReadOnly
 	}
@@ -263,6 +263,38 @@ func (f *freezer) AppendAncient(number uint64, hash, header, body, receipts, etx
 		}).Error("Failed to append ancient etx set")
 		return err
 	}
+	if err := f.tables[freezerManifestTable].Append(f.frozen, manifest); err != nil {
+		f.logger.WithFields(log.Fields{
+			"number": f.frozen,
+			"hash":   hash,
+			"err":    err,
+		}).Error("Failed to append ancient manifest")
+		return err
+	}
+	if err := f.tables[freezerTerminiTable].Append(f.frozen, termini); err != nil {
+		f.logger.WithFields(log.Fields{
+			"number": f.frozen,
+			"hash":   hash,
+			"err":    err,
+		}).Error("Failed to append ancient termini")
+		return err
+	}
+	if err := f.tables[freezerPendingEtxsRollupTable].Append(f.frozen, pendingEtxsRollup); err != nil {
+		f.logger.WithFields(log.Fields{
+			"number": f.frozen,
+			"hash":   hash,
+			"err":    err,
+		}).Error("Failed to append ancient pending etxs rollup")
+		return err
+	}
+	if err := f.tables[freezerInterlinkTable].Append(f.frozen, interlinkHashes); err != nil {
+		f.logger.WithFields(log.Fields{
+			"number": f.frozen,
+			"hash":   hash,
+			"err":    err,
+		}).Error("Failed to append ancient interlink hashes")
+		return err
+	}
 	atomic.AddUint64(&f.frozen, 1) // Only modify atomically
 	return nil
 }
@@ -392,7 +424,9 @@ func (f *freezer) freeze(db ethdb.KeyValueStore, nodeCtx int, location common.Lo
 				f.logger.WithField("number", f.frozen).Error("Canonical hash missing, can't freeze")
 				break
 			}
-			header := ReadHeaderProto(nfdb, hash, f.frozen)
+			// Blocks are stored as work objects, the header and body
+			// tables hold their proto encodings
+			header, _ := nfdb.Get(blockWorkObjectHeaderKey(hash))
 			if len(header) == 0 {
 				f.logger.WithFields(log.Fields{
 					"number": f.frozen,
@@ -400,7 +434,7 @@ func (f *freezer) freeze(db ethdb.KeyValueStore, nodeCtx int, location common.Lo
 				}).Error("Block header missing, can't freeze")
 				break
 			}
-			body := ReadBodyProto(nfdb, hash, f.frozen)
+			body, _ := nfdb.Get(workObjectBodyKey(hash))
 			if len(body) == 0 {
 				f.logger.WithFields(log.Fields{
 					"number": f.frozen,
@@ -408,28 +442,31 @@ func (f *freezer) freeze(db ethdb.KeyValueStore, nodeCtx int, location common.Lo
 				}).Error("Block body missing, can't freeze")
 				break
 			}
+			// Only zone blocks are processed and have receipts, which encode
+			// empty for a block without transactions
 			receipts := ReadReceiptsProto(nfdb, hash, f.frozen)
-			if len(receipts) == 0 {
-				f.logger.WithFields(log.Fields{
-					"number": f.frozen,
-					"hash":   hash,
-				}).Error("Block receipts missing, can't freeze")
-				break
-			}
-			etxSet, err := ReadEtxSetProto(nfdb, hash, f.frozen)
-			if err != nil {
-				f.logger.WithFields(log.Fields{
-					"number": f.frozen,
-					"hash":   hash,
-				}).Error("Total etxset missing, can't freeze")
-				break
+			if len(receipts) == 0 && nodeCtx == common.ZONE_CTX {
+				if has, _ := nfdb.Has(blockReceiptsKey(f.frozen, hash)); !has {
+					f.logger.WithFields(log.Fields{
+						"number": f.frozen,
+						"hash":   hash,
+					}).Error("Block receipts missing, can't freeze")
+					break
+				}
 			}
+			// Etx sets are only stored by the databases of older releases
+			etxSet, _ := ReadEtxSetProto(nfdb, hash, f.frozen)
+			// The dom chain data is missing for the blocks that don't carry it
+			manifest, _ := nfdb.Get(manifestKey(hash))
+			termini, _ := nfdb.Get(terminiKey(hash))
+			pendingEtxsRollup, _ := nfdb.Get(pendingEtxsRollupKey(hash))
+			interlinkHashes, _ := nfdb.Get(interlinkHashKey(hash))
 			f.logger.WithFields(log.Fields{
 				"number": f.frozen,
 				"hash":   hash,
 			}).Trace("Deep froze ancient block")
 			// Inject all the components into the relevant data tables
-			if err := f.AppendAncient(f.frozen, hash[:], header, body, receipts, etxSet); err != nil {
+			if err := f.AppendAncient(f.frozen, hash[:], header, body, receipts, etxSet, manifest, termini, pendingEtxsRollup, interlinkHashes); err != nil {
 				break
 			}
 			ancients = append(ancients, hash)
@@ -445,6 +482,11 @@ func (f *freezer) freeze(db ethdb.KeyValueStore, nodeCtx int, location common.Lo
 			if first+uint64(i) != 0 {
 				DeleteBlockWithoutNumber(batch, ancients[i], first+uint64(i), types.BlockObject)
 				DeleteCanonicalHash(batch, first+uint64(i))
+				for _, key := range freezerHashKeyedTables {
+					if err := batch.Delete(key(ancients[i])); err != nil {
+						f.logger.WithField("err", err).Fatal("Failed to delete frozen dom chain data")
+					}
+				}
 			}
 		}
 		if err := batch.Write(); err != nil {
@@ -531,10 +573,15 @@ func (f *freezer) freeze(db ethdb.KeyValueStore, nodeCtx int, location common.Lo
 	}
 }
 
-// repair truncates all data tables to the same length.
+// repair truncates all data tables to the same length. The tables keyed by
+// hash in the key-value store don't bound the length, as a freezer created
+// before them or interrupted while appending to them backfills them instead.
 func (f *freezer) repair() error {
 	min := uint64(math.MaxUint64)
-	for _, table := range f.tables {
+	for name, table := range f.tables {
+		if _, ok := freezerHashKeyedTables[name]; ok {
+			continue
+		}
 		items := atomic.LoadUint64(&table.items)
 		if min > items {
 			min = items
@@ -548,3 +595,40 @@ func (f *freezer) repair() error {
 	atomic.StoreUint64(&f.frozen, min)
 	return nil
 }
+
+// backfill appends to the tables keyed by hash in the key-value store the
+// items they miss up to the frozen blocks, reading them from the key-value
+// store, which keeps them until they are frozen. Items missing from the
+// key-value store as well are appended empty.
+func (f *freezer) backfill(db ethdb.KeyValueReader) error {
+	if f.readonly {
+		return nil
+	}
+	frozen := atomic.LoadUint64(&f.frozen)
+	for name, key := range freezerHashKeyedTables {
+		table := f.tables[name]
+		first := atomic.LoadUint64(&table.items)
+		if first >= frozen {
+			continue
+		}
+		for number := first; number < frozen; number++ {
+			hash, err := f.tables[freezerHashTable].Retrieve(number)
+			if err != nil {
+				return err
+			}
+			data, _ := db.Get(key(common.BytesToHash(hash)))
+			if err := table.Append(number, data); err != nil {
+				return err
+			}
+		}
+		if err := table.Sync(); err != nil {
+			return err
+		}
+		f.logger.WithFields(log.Fields{
+			"table": name,
+			"from":  first,
+			"to":    frozen,
+		}).Info("Backfilled freezer table")
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package rawdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/crypto"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/log"
+)
+
+// migrationProgressKey tracks the last key copied into the database being
+// migrated to, so that an interrupted migration resumes where it stopped.
+var migrationProgressKey = []byte("DatabaseMigrationProgress")
+
+const (
+	// migrationStagingSuffix names the directory the migrated database is built
+	// in, next to the database directory.
+	migrationStagingSuffix = ".migrating"
+
+	// migrationSwapSuffix names the file marking a verified migration being
+	// swapped in, next to the database directory. It holds the engine migrated
+	// from, which names the directory the old database is kept in.
+	migrationSwapSuffix = ".swapping"
+)
+
+// MigrateDatabase copies all the key-value data of the database in dir from
+// the from engine into a new database of the to engine, verifies that both hold
+// the same keys and values, and swaps the new database in place. The new
+// database is built next to dir and an interrupted migration resumes from the
+// last key copied. The old database is kept next to dir, while the freezer,
+// when stored in dir, is moved to the new database as is.
+func MigrateDatabase(dir string, from, to string, cache, handles int, logger *log.Logger, location common.Location) error {
+	if from == to {
+		return fmt.Errorf("database is already on %s", to)
+	}
+	for _, engine := range []string{from, to} {
+		if engine != dbLeveldb && engine != dbPebble {
+			return fmt.Errorf("unknown db.engine %v", engine)
+		}
+	}
+	// A migration interrupted while swapping the databases only needs to be
+	// completed
+	if swapped, err := RecoverDatabaseSwap(dir, logger); err != nil || swapped {
+		return err
+	}
+	if existing := hasPreexistingDb(dir); existing != from {
+		if existing == "" {
+			return fmt.Errorf("no database found in %s", dir)
+		}
+		return fmt.Errorf("found %s database in %s, not %s", existing, dir, from)
+	}
+	staging := dir + migrationStagingSuffix
+	if existing := hasPreexistingDb(staging); existing != "" && existing != to {
+		return fmt.Errorf("found %s database in %s, remove it to migrate to %s", existing, staging, to)
+	}
+	src, err := openKeyValueDatabase(OpenOptions{Type: from, Directory: dir, Cache: cache, Handles: handles, ReadOnly: true}, logger, location)
+	if err != nil {
+		return err
+	}
+	dst, err := openKeyValueDatabase(OpenOptions{Type: to, Directory: staging, Cache: cache, Handles: handles}, logger, location)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	err = copyDatabase(src, dst, logger)
+	if err == nil {
+		err = verifyDatabaseCopy(src, dst, logger)
+	}
+	src.Close()
+	dst.Close()
+	if err != nil {
+		return err
+	}
+	return swapDatabase(dir, staging, from, logger)
+}
+
+// copyDatabase copies all the key-value pairs of src into dst, starting after
+// the last key recorded by a previous run.
+func copyDatabase(src, dst ethdb.Database, logger *log.Logger) error {
+	var start []byte
+	if progress, _ := dst.Get(migrationProgressKey); len(progress) > 0 {
+		start = progress
+		logger.WithField("key", common.Bytes2Hex(progress)).Info("Resuming database migration")
+	}
+	it := src.NewIterator(nil, start)
+	defer it.Release()
+
+	var (
+		batch  = dst.NewBatch()
+		count  int64
+		size   common.StorageSize
+		begin  = time.Now()
+		logged = time.Now()
+	)
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+		if err := batch.Put(key, value); err != nil {
+			return err
+		}
+		count++
+		size += common.StorageSize(len(key) + len(value))
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			// Record the progress along with the data it covers
+			if err := batch.Put(migrationProgressKey, common.CopyBytes(key)); err != nil {
+				return err
+			}
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			logger.WithFields(log.Fields{
+				"count":   count,
+				"size":    size,
+				"key":     common.Bytes2Hex(key),
+				"elapsed": common.PrettyDuration(time.Since(begin)),
+			}).Info("Migrating database")
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if err := batch.Delete(migrationProgressKey); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	logger.WithFields(log.Fields{
+		"count":   count,
+		"size":    size,
+		"elapsed": common.PrettyDuration(time.Since(begin)),
+	}).Info("Migrated database")
+	return nil
+}
+
+// verifyDatabaseCopy checks that src and dst hold the same number of keys with
+// the same values, by hashing all the key-value pairs of each of them.
+func verifyDatabaseCopy(src, dst ethdb.Database, logger *log.Logger) error {
+	srcCount, srcHash, err := hashDatabase(src)
+	if err != nil {
+		return err
+	}
+	dstCount, dstHash, err := hashDatabase(dst)
+	if err != nil {
+		return err
+	}
+	if srcCount != dstCount {
+		return fmt.Errorf("key count mismatch after migration: have %d, want %d", dstCount, srcCount)
+	}
+	if srcHash != dstHash {
+		return fmt.Errorf("content hash mismatch after migration: have %x, want %x", dstHash, srcHash)
+	}
+	logger.WithFields(log.Fields{
+		"count": srcCount,
+		"hash":  srcHash,
+	}).Info("Verified migrated database")
+	return nil
+}
+
+// hashDatabase returns the number of keys of db and the hash of all its
+// key-value pairs in key order.
+func hashDatabase(db ethdb.Database) (int64, common.Hash, error) {
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	var (
+		count  int64
+		hasher = crypto.NewKeccakState()
+	)
+	for it.Next() {
+		if bytes.Equal(it.Key(), migrationProgressKey) {
+			continue
+		}
+		// Length prefix the keys and values so that no two databases hash alike
+		for _, item := range [][]byte{it.Key(), it.Value()} {
+			hasher.Write(encodeBlockNumber(uint64(len(item))))
+			hasher.Write(item)
+		}
+		count++
+	}
+	if err := it.Error(); err != nil {
+		return 0, common.Hash{}, err
+	}
+	var hash common.Hash
+	hasher.Read(hash[:])
+	return count, hash, nil
+}
+
+// swapDatabase moves the migrated database in staging to dir, keeping the old
+// database next to it and moving the freezer stored in it to the new one. The
+// swap is recorded before any rename, so that a crash in between the renames
+// is rolled forward by RecoverDatabaseSwap instead of leaving dir missing.
+func swapDatabase(dir, staging, from string, logger *log.Logger) error {
+	backup := dir + "." + from
+	if _, err := os.Stat(backup); err == nil {
+		return fmt.Errorf("can't keep the old database, %s already exists", backup)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := writeFileSync(dir+migrationSwapSuffix, []byte(from)); err != nil {
+		return err
+	}
+	return completeDatabaseSwap(dir, from, logger)
+}
+
+// RecoverDatabaseSwap completes the swap of a migrated database in place of the
+// one in dir if a migration was interrupted while swapping them, reporting
+// whether it did. It must run before the database in dir is opened.
+func RecoverDatabaseSwap(dir string, logger *log.Logger) (bool, error) {
+	from, err := os.ReadFile(dir + migrationSwapSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if engine := string(from); engine != dbLeveldb && engine != dbPebble {
+		return false, fmt.Errorf("corrupt database migration marker %s: unknown db.engine %q", dir+migrationSwapSuffix, engine)
+	}
+	logger.WithField("database", dir).Warn("Completing interrupted database migration")
+	if err := completeDatabaseSwap(dir, string(from), logger); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// completeDatabaseSwap applies the renames of a swap that are not done yet, in
+// order, and removes the swap marker once all of them are done.
+func completeDatabaseSwap(dir, from string, logger *log.Logger) error {
+	var (
+		staging = dir + migrationStagingSuffix
+		backup  = dir + "." + from
+		parent  = filepath.Dir(dir)
+	)
+	// The staging database is only left once it took the place of dir
+	if _, err := os.Stat(staging); err == nil {
+		if _, err := os.Stat(dir); err == nil {
+			if err := os.Rename(dir, backup); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := os.Rename(staging, dir); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	ancient := filepath.Join(backup, "ancient")
+	if _, err := os.Stat(ancient); err == nil {
+		if err := os.Rename(ancient, filepath.Join(dir, "ancient")); err != nil {
+			return err
+		}
+	}
+	if err := syncDir(parent); err != nil {
+		return err
+	}
+	if err := os.Remove(dir + migrationSwapSuffix); err != nil {
+		return err
+	}
+	if err := syncDir(parent); err != nil {
+		return err
+	}
+	logger.WithFields(log.Fields{
+		"database": dir,
+		"old":      backup,
+	}).Info("Swapped in migrated database, remove the old one once the node runs fine")
+	return nil
+}
+
+// writeFileSync writes a file and flushes it and its directory entry to disk.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes the entries of a directory to disk, making the renames and
+// removals in it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -68,9 +68,22 @@ var (
 	// snapshotSyncStatusKey tracks the snapshot sync status across restarts.
 	snapshotSyncStatusKey = []byte("SnapshotSyncStatus")
 
+	// snapshotUtxoRootKey tracks the UTXO root of the last UTXO snapshot.
+	snapshotUtxoRootKey = []byte("SnapshotUtxoRoot")
+
+	// snapshotUtxoJournalKey tracks the in-memory UTXO diff layers across restarts.
+	snapshotUtxoJournalKey = []byte("SnapshotUtxoJournal")
+
+	// snapshotUtxoGeneratorKey tracks the UTXO snapshot generation marker across restarts.
+	snapshotUtxoGeneratorKey = []byte("SnapshotUtxoGenerator")
+
 	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
 	txIndexTailKey = []byte("TransactionIndexTail")
 
+	// historyTailKey tracks the oldest block whose bodies and receipts have not
+	// been pruned.
+	historyTailKey = []byte("HistoryTail")
+
 	// fastTxLookupLimitKey tracks the transaction lookup limit during fast sync.
 	fastTxLookupLimitKey = []byte("FastTransactionLookupLimit")
 
@@ -80,6 +93,12 @@ var (
 	// uncleanShutdownKey tracks the list of local crashes
 	uncleanShutdownKey = []byte("unclean-shutdown") // config prefix for the db
 
+	// gcModeKey tracks the trie garbage collection mode the database was created with
+	gcModeKey = []byte("GCMode")
+
+	// reorgHistoryHeadKey tracks the number of reorgs recorded so far
+	reorgHistoryHeadKey = []byte("ReorgHistoryHead")
+
 	// genesisHashesKey tracks the list of genesis hashes
 	genesisHashesKey = []byte("GenesisHashes")
 
@@ -124,6 +143,7 @@ var (
 	bloomBitsPrefix       = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
 	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
+	SnapshotUtxoPrefix    = []byte("U") // SnapshotUtxoPrefix + utxo key hash -> utxo trie value
 	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
 
 	expansionStatusPrefix = []byte("exp") // ExpansionStatusPrefix + block hash -> ExpansionStatus
@@ -131,6 +151,7 @@ var (
 
 	preimagePrefix = []byte("secure-key-")  // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("quai-config-") // config prefix for the db
+	reorgPrefix    = []byte("reorg-")       // reorgPrefix + num (uint64 big endian) -> reorg
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
@@ -154,17 +175,46 @@ const (
 
 	// freezerEtxSetsTable indicates the name of the etx set table.
 	freezerEtxSetsTable = "etxSets"
+
+	// freezerManifestTable indicates the name of the freezer manifest table.
+	freezerManifestTable = "manifests"
+
+	// freezerTerminiTable indicates the name of the freezer termini table.
+	freezerTerminiTable = "termini"
+
+	// freezerPendingEtxsRollupTable indicates the name of the freezer pending etxs rollup table.
+	freezerPendingEtxsRollupTable = "pendingEtxsRollups"
+
+	// freezerInterlinkTable indicates the name of the freezer interlink hashes table.
+	freezerInterlinkTable = "interlinkHashes"
 )
 
 // FreezerNoSnappy configures whether compression is disabled for the ancient-tables.
-// Hashes and difficulties don't compress well.
+// Hashes and the hash lists of the dom chains don't compress well. The total
+// difficulty table is not opened: the entropy of a block is not frozen, so no
+// block appends to it and it would truncate every other table to its empty
+// length on repair. A diffs table left by an older release stays on disk
+// untouched.
 var FreezerNoSnappy = map[string]bool{
-	freezerHeaderTable:     false,
-	freezerHashTable:       true,
-	freezerBodiesTable:     false,
-	freezerReceiptTable:    false,
-	freezerDifficultyTable: true,
-	freezerEtxSetsTable:    false,
+	freezerHeaderTable:  false,
+	freezerHashTable:    true,
+	freezerBodiesTable:  false,
+	freezerReceiptTable: false,
+	freezerEtxSetsTable: false,
+
+	freezerManifestTable:          true,
+	freezerTerminiTable:           true,
+	freezerPendingEtxsRollupTable: false,
+	freezerInterlinkTable:         true,
+}
+
+// freezerHashKeyedTables are the tables of the dom chain data that the
+// key-value store keys by block hash only, with the key of each entry.
+var freezerHashKeyedTables = map[string]func(common.Hash) []byte{
+	freezerManifestTable:          manifestKey,
+	freezerTerminiTable:           terminiKey,
+	freezerPendingEtxsRollupTable: pendingEtxsRollupKey,
+	freezerInterlinkTable:         interlinkHashKey,
 }
 
 // LegacyTxLookupEntry is the legacy TxLookupEntry definition with some unnecessary
@@ -298,6 +348,11 @@ func storageSnapshotKey(accountHash, storageHash common.Hash) []byte {
 	return append(append(SnapshotStoragePrefix, accountHash.Bytes()...), storageHash.Bytes()...)
 }
 
+// utxoSnapshotKey = SnapshotUtxoPrefix + utxo key hash
+func utxoSnapshotKey(hash common.Hash) []byte {
+	return append(SnapshotUtxoPrefix, hash.Bytes()...)
+}
+
 // storageSnapshotsKey = SnapshotStoragePrefix + account hash + storage hash
 func storageSnapshotsKey(accountHash common.Hash) []byte {
 	return append(SnapshotStoragePrefix, accountHash.Bytes()...)
@@ -380,6 +435,11 @@ func bloomKey(hash common.Hash) []byte {
 	return append(bloomPrefix, hash.Bytes()...)
 }
 
+// reorgKey = reorgPrefix + num (uint64 big endian)
+func reorgKey(number uint64) []byte {
+	return append(reorgPrefix, encodeBlockNumber(number)...)
+}
+
 func inboundEtxsKey(hash common.Hash) []byte {
 	return append(inboundEtxsPrefix, hash.Bytes()...)
 }
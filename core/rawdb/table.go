@@ -90,8 +90,8 @@ func (t *table) AncientSize(kind string) (uint64, error) {
 
 // AppendAncient is a noop passthrough that just forwards the request to the underlying
 // database.
-func (t *table) AppendAncient(number uint64, hash, header, body, receipts, etxSet []byte) error {
-	return t.db.AppendAncient(number, hash, header, body, receipts, etxSet)
+func (t *table) AppendAncient(number uint64, hash, header, body, receipts, etxSet, manifest, termini, pendingEtxsRollup, interlinkHashes []byte) error {
+	return t.db.AppendAncient(number, hash, header, body, receipts, etxSet, manifest, termini, pendingEtxsRollup, interlinkHashes)
 }
 
 // TruncateAncients is a noop passthrough that just forwards the request to the underlying
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/log"
+)
+
+func newReorgTestReorg(number uint64) *types.Reorg {
+	hash := func(n uint64) common.Hash { return common.BigToHash(new(big.Int).SetUint64(n)) }
+	return &types.Reorg{
+		OldHead:        hash(number + 2),
+		NewHead:        hash(number + 3),
+		CommonAncestor: hash(number),
+		Number:         hexutil.Uint64(number),
+		Depth:          2,
+		Removed:        []common.Hash{hash(number + 1), hash(number + 2)},
+		Added:          []common.Hash{hash(number + 1), hash(number + 2), hash(number + 3)},
+		OldEntropy:     (*hexutil.Big)(big.NewInt(100)),
+		NewEntropy:     (*hexutil.Big)(big.NewInt(150)),
+		Time:           hexutil.Uint64(1700000000 + number),
+	}
+}
+
+func TestReorgHistory(t *testing.T) {
+	db := rawdb.NewMemoryDatabase(log.Global)
+	if have := rawdb.ReadReorgHistory(db); len(have) != 0 {
+		t.Fatalf("empty history: have %d reorgs", len(have))
+	}
+	// Record more reorgs than are kept, the oldest ones must be pruned
+	const keep, total = 128, 130
+	for i := uint64(0); i < total; i++ {
+		rawdb.WriteReorg(db, newReorgTestReorg(i))
+	}
+	history := rawdb.ReadReorgHistory(db)
+	if len(history) != keep {
+		t.Fatalf("history length mismatch: have %d, want %d", len(history), keep)
+	}
+	for i, reorg := range history {
+		if want := newReorgTestReorg(uint64(total - keep + i)); !reflect.DeepEqual(reorg, want) {
+			t.Fatalf("reorg %d mismatch: have %+v, want %+v", i, reorg, want)
+		}
+	}
+	it := db.NewIterator([]byte("reorg-"), nil)
+	defer it.Release()
+	stored := 0
+	for it.Next() {
+		stored++
+	}
+	if stored != keep {
+		t.Errorf("stored reorg count mismatch: have %d, want %d", stored, keep)
+	}
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math/big"
@@ -21,6 +22,7 @@ import (
 	"github.com/dominant-strategies/go-quai/ethdb"
 	"github.com/dominant-strategies/go-quai/event"
 	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/metrics_config"
 	"github.com/dominant-strategies/go-quai/params"
 	"github.com/dominant-strategies/go-quai/trie"
 )
@@ -50,8 +52,8 @@ type CoreBackend interface {
 	AddPendingEtxsRollup(pEtxRollup types.PendingEtxsRollup) error
 	UpdateDom(oldTerminus common.Hash, pendingHeader types.PendingHeader, location common.Location)
 	RequestDomToAppendOrFetch(hash common.Hash, entropy *big.Int, order int)
-	SubRelayPendingHeader(pendingHeader types.PendingHeader, newEntropy *big.Int, location common.Location, subReorg bool, order int)
-	Append(header *types.WorkObject, manifest types.BlockManifest, domPendingHeader *types.WorkObject, domTerminus common.Hash, domOrigin bool, newInboundEtxs types.Transactions) (types.Transactions, bool, bool, error)
+	SubRelayPendingHeader(ctx context.Context, pendingHeader types.PendingHeader, newEntropy *big.Int, location common.Location, subReorg bool, order int)
+	Append(ctx context.Context, header *types.WorkObject, manifest types.BlockManifest, domPendingHeader *types.WorkObject, domTerminus common.Hash, domOrigin bool, newInboundEtxs types.Transactions) (types.Transactions, bool, bool, error)
 	DownloadBlocksInManifest(hash common.Hash, manifest types.BlockManifest, entropy *big.Int)
 	GenerateRecoveryPendingHeader(pendingHeader *types.WorkObject, checkpointHashes types.Termini) error
 	GetPendingEtxsRollupFromSub(hash common.Hash, location common.Location) (types.PendingEtxsRollup, error)
@@ -71,6 +73,7 @@ type Slice struct {
 	txPool        *TxPool
 	miner         *Miner
 	expansionFeed event.Feed
+	appendFeed    event.Feed
 
 	sliceDb ethdb.Database
 	config  *params.ChainConfig
@@ -78,8 +81,9 @@ type Slice struct {
 
 	quit chan struct{} // slice quit channel
 
-	domInterface CoreBackend
-	subInterface []CoreBackend
+	domInterface   CoreBackend
+	subInterface   []CoreBackend
+	subInterfaceMu sync.RWMutex // guards the slots of subInterface, swapped when a sub stops or restarts
 
 	wg               sync.WaitGroup
 	scope            event.SubscriptionScope
@@ -164,7 +168,7 @@ func (sl *Slice) SetDomInterface(domInterface CoreBackend) {
 // Append takes a proposed header and constructs a local block and attempts to hierarchically append it to the block graph.
 // If this is called from a dominant context a domTerminus must be provided else a common.Hash{} should be used and domOrigin should be set to true.
 // Return of this function is the Etxs generated in the Zone Block, subReorg bool that tells dom if should be mined on, setHead bool that determines if we should set the block as the current head and the error
-func (sl *Slice) Append(header *types.WorkObject, domPendingHeader *types.WorkObject, domTerminus common.Hash, domOrigin bool, newInboundEtxs types.Transactions) (types.Transactions, bool, bool, error) {
+func (sl *Slice) Append(ctx context.Context, header *types.WorkObject, domPendingHeader *types.WorkObject, domTerminus common.Hash, domOrigin bool, newInboundEtxs types.Transactions) (_ types.Transactions, _ bool, _ bool, err error) {
 	start := time.Now()
 	nodeCtx := sl.NodeCtx()
 
@@ -172,6 +176,9 @@ func (sl *Slice) Append(header *types.WorkObject, domPendingHeader *types.WorkOb
 		return nil, false, false, nil
 	}
 
+	ctx, span := metrics_config.StartBlockSpan(ctx, "Slice.Append", header.Hash(), sl.NodeLocation().Name())
+	defer func() { span.End(err) }()
+
 	// Only print in Info level if block is c_startingPrintLimit behind or less
 	if sl.CurrentInfo(header) {
 		sl.logger.WithFields(log.Fields{
@@ -212,7 +219,9 @@ func (sl *Slice) Append(header *types.WorkObject, domPendingHeader *types.WorkOb
 	batch := sl.sliceDb.NewBatch()
 
 	// Run Previous Coincident Reference Check (PCRC)
+	_, pcrcSpan := metrics_config.StartBlockSpan(ctx, "Slice.pcrc", header.Hash(), sl.NodeLocation().Name())
 	domTerminus, newTermini, err := sl.pcrc(batch, header, domTerminus, domOrigin)
+	pcrcSpan.End(err)
 	if err != nil {
 		return nil, false, false, err
 	}
@@ -224,7 +233,9 @@ func (sl *Slice) Append(header *types.WorkObject, domPendingHeader *types.WorkOb
 
 	time2 := common.PrettyDuration(time.Since(start))
 	// Append the new block
+	_, headerSpan := metrics_config.StartBlockSpan(ctx, "HeaderChain.AppendHeader", header.Hash(), sl.NodeLocation().Name())
 	err = sl.hc.AppendHeader(header)
+	headerSpan.End(err)
 	if err != nil {
 		return nil, false, false, err
 	}
@@ -280,6 +291,7 @@ func (sl *Slice) Append(header *types.WorkObject, domPendingHeader *types.WorkOb
 				}
 				pEtxNew := pEtxRetry{hash: block.Hash(), retries: retry}
 				sl.pEtxRetryCache.Add(block.Hash(), pEtxNew)
+				pEtxRetryMetrics.WithLabelValues(sl.NodeLocation().Name(), "collect").Inc()
 				return nil, false, false, ErrSubNotSyncedToDom
 			}
 			sl.inboundEtxsCache.Add(block.Hash(), newInboundEtxs)
@@ -297,8 +309,8 @@ func (sl *Slice) Append(header *types.WorkObject, domPendingHeader *types.WorkOb
 	// Call my sub to append the block, and collect the rolled up ETXs from that sub
 	if nodeCtx != common.ZONE_CTX {
 		// How to get the sub pending etxs if not running the full node?.
-		if sl.subInterface[location.SubIndex(sl.NodeCtx())] != nil {
-			subPendingEtxs, subReorg, setHead, err = sl.subInterface[location.SubIndex(sl.NodeCtx())].Append(header, block.Manifest(), pendingHeaderWithTermini.WorkObject(), domTerminus, true, newInboundEtxs)
+		if sub := sl.getSubInterface(location.SubIndex(sl.NodeCtx())); sub != nil {
+			subPendingEtxs, subReorg, setHead, err = sub.Append(ctx, header, block.Manifest(), pendingHeaderWithTermini.WorkObject(), domTerminus, true, newInboundEtxs)
 			if err != nil {
 				return nil, false, false, err
 			}
@@ -361,7 +373,7 @@ func (sl *Slice) Append(header *types.WorkObject, domPendingHeader *types.WorkOb
 		setHead = sl.poem(sl.engine.TotalLogS(sl.hc, block), sl.engine.TotalLogS(sl.hc, sl.hc.CurrentHeader()))
 
 		if subReorg || (sl.hc.CurrentHeader().NumberU64(nodeCtx) < block.NumberU64(nodeCtx)+c_currentStateComputeWindow) {
-			err := sl.hc.SetCurrentState(block)
+			err := sl.hc.SetCurrentState(ctx, block)
 			if err != nil {
 				sl.logger.WithFields(log.Fields{
 					"err":  err,
@@ -416,6 +428,8 @@ func (sl *Slice) Append(header *types.WorkObject, domPendingHeader *types.WorkOb
 		sl.hc.chainSideFeed.Send(ChainSideEvent{Blocks: []*types.WorkObject{block}})
 	}
 
+	sl.appendFeed.Send(BlockAppendEvent{Block: block})
+
 	// Chain head feed is only used by the Zone chains
 	if subReorg && nodeCtx == common.ZONE_CTX {
 		sl.hc.chainHeadFeed.Send(ChainHeadEvent{Block: block})
@@ -431,11 +445,12 @@ func (sl *Slice) Append(header *types.WorkObject, domPendingHeader *types.WorkOb
 	}
 
 	// Relay the new pendingHeader
-	sl.relayPh(block, pendingHeaderWithTermini, domOrigin, block.Location(), subReorg)
+	sl.relayPh(ctx, block, pendingHeaderWithTermini, domOrigin, block.Location(), subReorg)
 
 	inputs, outputs := block.InputsAndOutputsWithoutCoinbase()
 	net := int(outputs) - int(inputs)
 	time10 := common.PrettyDuration(time.Since(start))
+	appendTimeMetrics.WithLabelValues(sl.NodeLocation().Name()).Observe(time.Since(start).Seconds())
 	sl.logger.WithFields(log.Fields{
 		"t0_1": time0_1,
 		"t0_2": time0_2,
@@ -517,8 +532,10 @@ func (sl *Slice) ProcessingState() bool {
 }
 
 // relayPh sends pendingHeaderWithTermini to subordinates
-func (sl *Slice) relayPh(block *types.WorkObject, pendingHeaderWithTermini types.PendingHeader, domOrigin bool, location common.Location, subReorg bool) {
+func (sl *Slice) relayPh(ctx context.Context, block *types.WorkObject, pendingHeaderWithTermini types.PendingHeader, domOrigin bool, location common.Location, subReorg bool) {
 	nodeCtx := sl.NodeCtx()
+	ctx, span := metrics_config.StartBlockSpan(ctx, "Slice.relayPh", block.Hash(), sl.NodeLocation().Name())
+	defer span.End(nil)
 
 	if nodeCtx == common.ZONE_CTX && sl.ProcessingState() {
 		// Send an empty header to miner
@@ -532,8 +549,8 @@ func (sl *Slice) relayPh(block *types.WorkObject, pendingHeaderWithTermini types
 		}
 	} else if !domOrigin && subReorg {
 		for _, i := range sl.randomRelayArray() {
-			if sl.subInterface[i] != nil {
-				sl.subInterface[i].SubRelayPendingHeader(pendingHeaderWithTermini, pendingHeaderWithTermini.WorkObject().ParentEntropy(nodeCtx), location, subReorg, nodeCtx)
+			if sub := sl.getSubInterface(i); sub != nil {
+				sub.SubRelayPendingHeader(ctx, pendingHeaderWithTermini, pendingHeaderWithTermini.WorkObject().ParentEntropy(nodeCtx), location, subReorg, nodeCtx)
 			}
 		}
 	}
@@ -576,13 +593,13 @@ func (sl *Slice) UpdateDom(oldTerminus common.Hash, pendingHeader types.PendingH
 		newPh, exists := sl.readPhCache(newDomTerminus)
 		if exists {
 			for _, i := range sl.randomRelayArray() {
-				if sl.subInterface[i] != nil {
+				if sub := sl.getSubInterface(i); sub != nil {
 					sl.logger.WithFields(log.Fields{
 						"parentHash": newPh.WorkObject().ParentHash(nodeCtx),
 						"number":     newPh.WorkObject().NumberArray(),
 						"newTermini": newPh.Termini().SubTerminiAtIndex(i),
 					}).Info("SubRelay in UpdateDom")
-					sl.subInterface[i].SubRelayPendingHeader(newPh, pendingHeader.WorkObject().ParentEntropy(common.ZONE_CTX), common.Location{}, true, nodeCtx)
+					sub.SubRelayPendingHeader(context.Background(), newPh, pendingHeader.WorkObject().ParentEntropy(common.ZONE_CTX), common.Location{}, true, nodeCtx)
 				}
 			}
 		} else {
@@ -604,13 +621,13 @@ func (sl *Slice) UpdateDom(oldTerminus common.Hash, pendingHeader types.PendingH
 			newPh, exists := sl.readPhCache(newDomTerminus)
 			if exists {
 				for _, i := range sl.randomRelayArray() {
-					if sl.subInterface[i] != nil {
+					if sub := sl.getSubInterface(i); sub != nil {
 						sl.logger.WithFields(log.Fields{
 							"parentHash": newPh.WorkObject().ParentHash(nodeCtx),
 							"number":     newPh.WorkObject().NumberArray(),
 							"newTermini": newPh.Termini().SubTerminiAtIndex(i),
 						}).Info("SubRelay in UpdateDom")
-						sl.subInterface[i].SubRelayPendingHeader(newPh, pendingHeader.WorkObject().ParentEntropy(common.ZONE_CTX), common.Location{}, true, nodeCtx)
+						sub.SubRelayPendingHeader(context.Background(), newPh, pendingHeader.WorkObject().ParentEntropy(common.ZONE_CTX), common.Location{}, true, nodeCtx)
 					}
 				}
 			} else {
@@ -919,11 +936,11 @@ func (sl *Slice) GetManifest(blockHash common.Hash) (types.BlockManifest, error)
 // GetSubManifest gets the block manifest from the subordinate node which
 // produced this block
 func (sl *Slice) GetSubManifest(slice common.Location, blockHash common.Hash) (types.BlockManifest, error) {
-	subIdx := slice.SubIndex(sl.NodeCtx())
-	if sl.subInterface[subIdx] == nil {
+	sub := sl.getSubInterface(slice.SubIndex(sl.NodeCtx()))
+	if sub == nil {
 		return nil, errors.New("missing requested subordinate node")
 	}
-	return sl.subInterface[subIdx].GetManifest(blockHash)
+	return sub.GetManifest(blockHash)
 }
 
 // SendPendingEtxsToDom shares a set of pending ETXs with your dom, so he can reference them when a coincident block is found
@@ -936,6 +953,7 @@ func (sl *Slice) GetPEtxRollupAfterRetryThreshold(blockHash common.Hash, hash co
 	if !exists || pEtx.retries < c_pEtxRetryThreshold {
 		return types.PendingEtxsRollup{}, ErrPendingEtxNotFound
 	}
+	pEtxRetryMetrics.WithLabelValues(sl.NodeLocation().Name(), "rollup").Inc()
 	return sl.GetPendingEtxsRollupFromSub(hash, location)
 }
 
@@ -943,8 +961,8 @@ func (sl *Slice) GetPEtxRollupAfterRetryThreshold(blockHash common.Hash, hash co
 func (sl *Slice) GetPendingEtxsRollupFromSub(hash common.Hash, location common.Location) (types.PendingEtxsRollup, error) {
 	nodeCtx := sl.NodeLocation().Context()
 	if nodeCtx == common.PRIME_CTX {
-		if sl.subInterface[location.SubIndex(sl.NodeCtx())] != nil {
-			pEtxRollup, err := sl.subInterface[location.SubIndex(sl.NodeCtx())].GetPendingEtxsRollupFromSub(hash, location)
+		if sub := sl.getSubInterface(location.SubIndex(sl.NodeCtx())); sub != nil {
+			pEtxRollup, err := sub.GetPendingEtxsRollupFromSub(hash, location)
 			if err != nil {
 				return types.PendingEtxsRollup{}, err
 			} else {
@@ -970,6 +988,7 @@ func (sl *Slice) GetPEtxAfterRetryThreshold(blockHash common.Hash, hash common.H
 	if !exists || pEtx.retries < c_pEtxRetryThreshold {
 		return types.PendingEtxs{}, ErrPendingEtxNotFound
 	}
+	pEtxRetryMetrics.WithLabelValues(sl.NodeLocation().Name(), "etxs").Inc()
 	return sl.GetPendingEtxsFromSub(hash, location)
 }
 
@@ -977,8 +996,8 @@ func (sl *Slice) GetPEtxAfterRetryThreshold(blockHash common.Hash, hash common.H
 func (sl *Slice) GetPendingEtxsFromSub(hash common.Hash, location common.Location) (types.PendingEtxs, error) {
 	nodeCtx := sl.NodeLocation().Context()
 	if nodeCtx != common.ZONE_CTX {
-		if sl.subInterface[location.SubIndex(sl.NodeCtx())] != nil {
-			pEtx, err := sl.subInterface[location.SubIndex(sl.NodeCtx())].GetPendingEtxsFromSub(hash, location)
+		if sub := sl.getSubInterface(location.SubIndex(sl.NodeCtx())); sub != nil {
+			pEtx, err := sub.GetPendingEtxsFromSub(hash, location)
 			if err != nil {
 				return types.PendingEtxs{}, err
 			} else {
@@ -995,8 +1014,11 @@ func (sl *Slice) GetPendingEtxsFromSub(hash common.Hash, location common.Locatio
 }
 
 // SubRelayPendingHeader takes a pending header from the sender (ie dominant), updates the phCache with a composited header and relays result to subordinates
-func (sl *Slice) SubRelayPendingHeader(pendingHeader types.PendingHeader, newEntropy *big.Int, location common.Location, subReorg bool, order int) {
+func (sl *Slice) SubRelayPendingHeader(ctx context.Context, pendingHeader types.PendingHeader, newEntropy *big.Int, location common.Location, subReorg bool, order int) {
 	nodeCtx := sl.NodeLocation().Context()
+	// The pending header is built on the block whose append is relaying it
+	ctx, span := metrics_config.StartBlockSpan(ctx, "Slice.SubRelayPendingHeader", pendingHeader.WorkObject().ParentHash(nodeCtx), sl.NodeLocation().Name())
+	defer span.End(nil)
 	var err error
 
 	if nodeCtx == common.REGION_CTX {
@@ -1009,9 +1031,9 @@ func (sl *Slice) SubRelayPendingHeader(pendingHeader types.PendingHeader, newEnt
 		}
 
 		for _, i := range sl.randomRelayArray() {
-			if sl.subInterface[i] != nil {
+			if sub := sl.getSubInterface(i); sub != nil {
 				if ph, exists := sl.readPhCache(pendingHeader.Termini().SubTerminiAtIndex(sl.NodeLocation().Region())); exists {
-					sl.subInterface[i].SubRelayPendingHeader(ph, newEntropy, location, subReorg, order)
+					sub.SubRelayPendingHeader(ctx, ph, newEntropy, location, subReorg, order)
 				}
 			}
 		}
@@ -1128,7 +1150,7 @@ func (sl *Slice) updatePhCacheFromDom(pendingHeader types.PendingHeader, termini
 				if block != nil {
 					// setting the current state will help speed the process of append
 					// after mining this block since the state will already be computed
-					err := sl.hc.SetCurrentState(block)
+					err := sl.hc.SetCurrentState(context.Background(), block)
 					if err != nil {
 						sl.logger.WithFields(log.Fields{
 							"Hash": block.Hash(),
@@ -1446,13 +1468,13 @@ func (sl *Slice) IsSubClientsEmpty() bool {
 	switch sl.NodeCtx() {
 	case common.PRIME_CTX:
 		for i := 0; i < int(activeRegions); i++ {
-			if sl.subInterface[i] == nil {
+			if sl.getSubInterface(i) == nil {
 				return true
 			}
 		}
 	case common.REGION_CTX:
 		for _, slice := range sl.ActiveSlices() {
-			if sl.subInterface[slice.Zone()] == nil {
+			if sl.getSubInterface(slice.Zone()) == nil {
 				return true
 			}
 		}
@@ -1560,8 +1582,8 @@ func (sl *Slice) NewGenesisPendingHeader(domPendingHeader *types.WorkObject, dom
 	}
 
 	if nodeCtx != common.ZONE_CTX {
-		for i, client := range sl.subInterface {
-			if client != nil {
+		for i := range sl.subInterface {
+			if client := sl.getSubInterface(i); client != nil {
 				err = client.NewGenesisPendingHeader(domPendingHeader, termini.SubTerminiAtIndex(i), genesisHash)
 				if err != nil {
 					return err
@@ -1589,6 +1611,8 @@ func (sl *Slice) SubscribeMissingBlockEvent(ch chan<- types.BlockRequest) event.
 
 // SetSubClient sets the subClient for the given location
 func (sl *Slice) SetSubInterface(subInterface CoreBackend, location common.Location) {
+	sl.subInterfaceMu.Lock()
+	defer sl.subInterfaceMu.Unlock()
 	switch sl.NodeCtx() {
 	case common.PRIME_CTX:
 		sl.subInterface[location.Region()] = subInterface
@@ -1599,6 +1623,15 @@ func (sl *Slice) SetSubInterface(subInterface CoreBackend, location common.Locat
 	}
 }
 
+// getSubInterface returns the interface of the sub at the index, or nil if
+// the sub is not connected. Callers hold on to the returned interface as the
+// slot can be swapped at any time.
+func (sl *Slice) getSubInterface(index int) CoreBackend {
+	sl.subInterfaceMu.RLock()
+	defer sl.subInterfaceMu.RUnlock()
+	return sl.subInterface[index]
+}
+
 // loadLastState loads the phCache and the slice pending header hash from the db.
 func (sl *Slice) loadLastState() error {
 	sl.bestPhKey = rawdb.ReadBestPhKey(sl.sliceDb)
@@ -1785,6 +1818,10 @@ func (sl *Slice) cleanCacheAndDatabaseTillBlock(hash common.Hash) {
 	// Recover the snaps
 	if nodeCtx == common.ZONE_CTX && sl.ProcessingState() {
 		sl.hc.bc.processor.snaps, _ = snapshot.New(sl.sliceDb, sl.hc.bc.processor.stateCache.TrieDB(), sl.hc.bc.processor.cacheConfig.SnapshotLimit, currentHeader.EVMRoot(), true, true, sl.logger)
+		if sl.hc.bc.processor.utxoSnaps != nil {
+			sl.hc.bc.processor.utxoSnaps.Release()
+		}
+		sl.hc.bc.processor.utxoSnaps, _ = snapshot.NewUtxoTree(sl.sliceDb, sl.hc.bc.processor.utxoCache.TrieDB(), sl.hc.bc.processor.cacheConfig.SnapshotLimit, TriesInMemory, currentHeader.UTXORoot(), true, sl.logger)
 	}
 }
 
@@ -1793,15 +1830,15 @@ func (sl *Slice) GenerateRecoveryPendingHeader(pendingHeader *types.WorkObject,
 	regions, zones := common.GetHierarchySizeForExpansionNumber(sl.hc.currentExpansionNumber)
 	if nodeCtx == common.PRIME_CTX {
 		for i := 0; i < int(regions); i++ {
-			if sl.subInterface[i] != nil {
-				sl.subInterface[i].GenerateRecoveryPendingHeader(pendingHeader, checkPointHashes)
+			if sub := sl.getSubInterface(i); sub != nil {
+				sub.GenerateRecoveryPendingHeader(pendingHeader, checkPointHashes)
 			}
 		}
 	} else if nodeCtx == common.REGION_CTX {
 		newPendingHeader := sl.SetHeadBackToRecoveryState(pendingHeader, checkPointHashes.SubTerminiAtIndex(sl.NodeLocation().Region()))
 		for i := 0; i < int(zones); i++ {
-			if sl.subInterface[i] != nil {
-				sl.subInterface[i].GenerateRecoveryPendingHeader(newPendingHeader.WorkObject(), newPendingHeader.Termini())
+			if sub := sl.getSubInterface(i); sub != nil {
+				sub.GenerateRecoveryPendingHeader(newPendingHeader.WorkObject(), newPendingHeader.Termini())
 			}
 		}
 	} else {
@@ -1909,3 +1946,8 @@ func (sl *Slice) AddGenesisPendingEtxs(block *types.WorkObject) {
 func (sl *Slice) SubscribeExpansionEvent(ch chan<- ExpansionEvent) event.Subscription {
 	return sl.scope.Track(sl.expansionFeed.Subscribe(ch))
 }
+
+// SubscribeBlockAppendEvent subscribes to the blocks appended to the slice
+func (sl *Slice) SubscribeBlockAppendEvent(ch chan<- BlockAppendEvent) event.Subscription {
+	return sl.scope.Track(sl.appendFeed.Subscribe(ch))
+}
@@ -0,0 +1,101 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/rlp"
+	"github.com/dominant-strategies/go-quai/trie"
+)
+
+// ForEachTrieNode calls onNode with the hash and encoding of every node of the
+// trie of the given root stored in db. It fails if any of the nodes is missing,
+// so it also checks that the trie is complete.
+func ForEachTrieNode(db Database, root common.Hash, onNode func(hash common.Hash, blob []byte) error) error {
+	if root == emptyRoot {
+		return nil
+	}
+	tr, err := db.OpenTrie(root)
+	if err != nil {
+		return err
+	}
+	return forEachNode(db, tr.NodeIterator(nil), onNode, nil)
+}
+
+// ForEachStateNode calls onNode with the hash and encoding of every node of the
+// account trie of the given root and of the storage tries of its accounts, and
+// onCode with the hash and code of its contracts. The storage tries and the
+// code shared by several accounts are only visited once. It fails if any of the
+// nodes or code is missing.
+func ForEachStateNode(db Database, root common.Hash, onNode func(hash common.Hash, blob []byte) error, onCode func(hash common.Hash, code []byte) error) error {
+	if root == emptyRoot {
+		return nil
+	}
+	tr, err := db.OpenTrie(root)
+	if err != nil {
+		return err
+	}
+	var (
+		storageRoots = make(map[common.Hash]struct{})
+		codeHashes   = make(map[common.Hash]struct{})
+	)
+	onAccount := func(key []byte, blob []byte) error {
+		var account Account
+		if err := rlp.Decode(bytes.NewReader(blob), &account); err != nil {
+			return err
+		}
+		addrHash := common.BytesToHash(key)
+		if _, seen := storageRoots[account.Root]; !seen && account.Root != emptyRoot {
+			storageRoots[account.Root] = struct{}{}
+			storageTrie, err := db.OpenStorageTrie(addrHash, account.Root)
+			if err != nil {
+				return err
+			}
+			if err := forEachNode(db, storageTrie.NodeIterator(nil), onNode, nil); err != nil {
+				return fmt.Errorf("storage trie %x: %w", account.Root, err)
+			}
+		}
+		codeHash := common.BytesToHash(account.CodeHash)
+		if _, seen := codeHashes[codeHash]; !seen && !bytes.Equal(account.CodeHash, emptyCodeHash) {
+			codeHashes[codeHash] = struct{}{}
+			code, err := db.ContractCode(addrHash, codeHash)
+			if err != nil {
+				return fmt.Errorf("code %x: %w", codeHash, err)
+			}
+			if onCode != nil {
+				return onCode(codeHash, code)
+			}
+		}
+		return nil
+	}
+	return forEachNode(db, tr.NodeIterator(nil), onNode, onAccount)
+}
+
+// forEachNode walks the nodes of a trie, calling onNode with the ones stored
+// on their own and onLeaf with the leaves.
+func forEachNode(db Database, it trie.NodeIterator, onNode func(hash common.Hash, blob []byte) error, onLeaf func(key []byte, blob []byte) error) error {
+	for it.Next(true) {
+		if it.Leaf() {
+			if onLeaf != nil {
+				if err := onLeaf(it.LeafKey(), it.LeafBlob()); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		// Nodes small enough to be embedded in their parent have no hash
+		hash := it.Hash()
+		if hash == (common.Hash{}) || onNode == nil {
+			continue
+		}
+		blob, err := db.TrieDB().Node(hash)
+		if err != nil {
+			return err
+		}
+		if err := onNode(hash, blob); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
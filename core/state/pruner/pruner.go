@@ -87,6 +87,9 @@ type Pruner struct {
 
 // NewPruner creates the pruner instance.
 func NewPruner(db ethdb.Database, datadir, trieCachePath string, bloomSize uint64, logger *log.Logger, location common.Location) (*Pruner, error) {
+	if rawdb.ReadGCMode(db) == "archive" {
+		return nil, errors.New("state pruning is not allowed on an archive database")
+	}
 	headBlock := rawdb.ReadHeadBlock(db)
 	if headBlock == nil {
 		return nil, errors.New("failed to load head block")
@@ -0,0 +1,448 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/metrics_config"
+	"github.com/dominant-strategies/go-quai/rlp"
+	"github.com/dominant-strategies/go-quai/trie"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// utxoSnapshotReads counts the reads of the UTXO snapshot by the layer serving
+// them: a diff layer, the clean cache of the disk layer (hit) or its database
+// (miss). A fallback is a read the snapshot cannot serve yet, which is done on
+// the UTXO trie.
+var utxoSnapshotReads *prometheus.CounterVec
+
+func init() {
+	utxoSnapshotReads = metrics_config.NewCounterVec("UtxoSnapshotReads", "Reads of the UTXO snapshot by the layer serving them")
+	for _, source := range []string{"diff", "hit", "miss", "fallback"} {
+		utxoSnapshotReads.WithLabelValues(source)
+	}
+}
+
+// markUtxoRead counts a read of the UTXO snapshot served by the source
+func markUtxoRead(source string) {
+	if metrics_config.MetricsEnabled() {
+		utxoSnapshotReads.WithLabelValues(source).Inc()
+	}
+}
+
+// UtxoSnapshot represents the functionality supported by a UTXO snapshot layer.
+type UtxoSnapshot interface {
+	// Root returns the UTXO root for which this snapshot was made.
+	Root() common.Hash
+
+	// Utxo directly retrieves the UTXO trie value associated with the hash of
+	// an outpoint key, or nil if the outpoint is not in the UTXO set.
+	Utxo(hash common.Hash) ([]byte, error)
+}
+
+// utxoSnapshot is the internal version of the UTXO snapshot layer that supports
+// some additional methods compared to the public API.
+type utxoSnapshot interface {
+	UtxoSnapshot
+
+	// Parent returns the subsequent layer of a snapshot, or nil if the base was
+	// reached.
+	Parent() utxoSnapshot
+
+	// Update creates a new layer on top of the existing snapshot diff tree with
+	// the UTXOs created (non-nil value) and spent (nil value) by a block.
+	//
+	// Note, the map is retained by the method to avoid copying everything.
+	Update(utxoRoot common.Hash, utxos map[common.Hash][]byte) *utxoDiffLayer
+
+	// Journal commits an entire diff hierarchy to disk into a single journal entry.
+	Journal(buffer *bytes.Buffer, logger *log.Logger) (common.Hash, error)
+
+	// Stale return whether this layer has become stale (was flattened across) or
+	// if it's still live.
+	Stale() bool
+}
+
+// UtxoTree is the snapshot tree of the UTXO set. It mirrors the state snapshot
+// Tree, but its layers are keyed by the UTXO root of the blocks since the state
+// root does not change with the UTXO set. It consists of one persistent flat
+// layer of the UTXO trie leaves, on top of which the UTXOs created and spent by
+// the recent blocks are kept in memory diff layers.
+type UtxoTree struct {
+	diskdb ethdb.KeyValueStore          // Persistent database to store the snapshot
+	triedb *trie.Database               // In-memory cache to access the UTXO trie through
+	cache  int                          // Megabytes permitted to use for read caches
+	depth  int                          // Number of diff layers kept in memory above the disk layer
+	layers map[common.Hash]utxoSnapshot // Collection of all known layers
+	lock   sync.RWMutex
+	logger *log.Logger
+}
+
+// NewUtxoTree attempts to load an already existing UTXO snapshot from a
+// persistent key-value store (with a number of memory layers from a journal),
+// ensuring that the head of the snapshot matches the expected UTXO root.
+//
+// If the snapshot is missing, broken or does not match the head, it is wiped
+// and regenerated from the UTXO trie on a background thread if rebuild is set.
+// The tree keeps up to depth diff layers in memory, see Depth.
+func NewUtxoTree(diskdb ethdb.KeyValueStore, triedb *trie.Database, cache int, depth int, utxoRoot common.Hash, rebuild bool, logger *log.Logger) (*UtxoTree, error) {
+	snap := &UtxoTree{
+		diskdb: diskdb,
+		triedb: triedb,
+		cache:  cache,
+		depth:  depth,
+		layers: make(map[common.Hash]utxoSnapshot),
+		logger: logger,
+	}
+	head, err := loadUtxoSnapshot(diskdb, triedb, cache, utxoRoot)
+	if err != nil {
+		if rebuild {
+			logger.WithField("err", err).Warn("Failed to load utxo snapshot, regenerating")
+			snap.Rebuild(utxoRoot)
+			return snap, nil
+		}
+		return nil, err
+	}
+	// Existing snapshot loaded, seed all the layers
+	for head != nil {
+		snap.layers[head.Root()] = head
+		head = head.Parent()
+	}
+	return snap, nil
+}
+
+// Depth returns the number of diff layers the tree keeps in memory above the
+// disk layer, to be passed to Cap.
+func (t *UtxoTree) Depth() int {
+	return t.depth
+}
+
+// Snapshot retrieves the UTXO snapshot belonging to the given UTXO root, or nil
+// if no snapshot is maintained for that root.
+func (t *UtxoTree) Snapshot(utxoRoot common.Hash) UtxoSnapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if layer, ok := t.layers[utxoRoot]; ok {
+		return layer
+	}
+	return nil
+}
+
+// Update adds a new UTXO snapshot into the tree, if that can be linked to an
+// existing old parent. The layer is not replaced if the UTXO root is already
+// known, e.g. a sibling block producing the same UTXO set.
+func (t *UtxoTree) Update(utxoRoot common.Hash, parentRoot common.Hash, utxos map[common.Hash][]byte) error {
+	if utxoRoot == parentRoot {
+		return errSnapshotCycle
+	}
+	if t.Snapshot(utxoRoot) != nil {
+		return nil
+	}
+	parent := t.Snapshot(parentRoot)
+	if parent == nil {
+		return fmt.Errorf("parent [%#x] utxo snapshot missing", parentRoot)
+	}
+	snap := parent.(utxoSnapshot).Update(utxoRoot, utxos)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.layers[snap.root] = snap
+	return nil
+}
+
+// Cap traverses downwards the UTXO snapshot tree from a head UTXO root until
+// the number of allowed layers are crossed. All layers beyond the permitted
+// number are flattened downwards, and persisted once the bottom-most diff
+// grows beyond the memory limit.
+func (t *UtxoTree) Cap(utxoRoot common.Hash, layers int) error {
+	snap := t.Snapshot(utxoRoot)
+	if snap == nil {
+		return fmt.Errorf("utxo snapshot [%#x] missing", utxoRoot)
+	}
+	diff, ok := snap.(*utxoDiffLayer)
+	if !ok {
+		return fmt.Errorf("utxo snapshot [%#x] is disk layer", utxoRoot)
+	}
+	// If the generator is still running, use a more aggressive cap
+	diff.origin.lock.RLock()
+	if diff.origin.genMarker != nil && layers > 8 {
+		layers = 8
+	}
+	diff.origin.lock.RUnlock()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	persisted := t.cap(diff, layers)
+
+	// Remove any layer that is stale or links into a stale layer
+	children := make(map[common.Hash][]common.Hash)
+	for root, snap := range t.layers {
+		if diff, ok := snap.(*utxoDiffLayer); ok {
+			parent := diff.parent.Root()
+			children[parent] = append(children[parent], root)
+		}
+	}
+	var remove func(root common.Hash)
+	remove = func(root common.Hash) {
+		delete(t.layers, root)
+		for _, child := range children[root] {
+			remove(child)
+		}
+		delete(children, root)
+	}
+	for root, snap := range t.layers {
+		if snap.Stale() {
+			remove(root)
+		}
+	}
+	// If the disk layer was modified, regenerate all the cumulative blooms
+	if persisted != nil {
+		var rebloom func(root common.Hash)
+		rebloom = func(root common.Hash) {
+			if diff, ok := t.layers[root].(*utxoDiffLayer); ok {
+				diff.rebloom(persisted)
+			}
+			for _, child := range children[root] {
+				rebloom(child)
+			}
+		}
+		rebloom(persisted.root)
+	}
+	return nil
+}
+
+// cap traverses downwards the diff tree until the number of allowed layers are
+// crossed. All diffs beyond the permitted number are flattened downwards. The
+// method returns the new disk layer if diffs were persisted into it.
+func (t *UtxoTree) cap(diff *utxoDiffLayer, layers int) *utxoDiskLayer {
+	// Dive until we run out of layers or reach the persistent database
+	for i := 0; i < layers-1; i++ {
+		if parent, ok := diff.parent.(*utxoDiffLayer); ok {
+			diff = parent
+		} else {
+			return nil
+		}
+	}
+	// We're out of layers, flatten anything below, stopping if it's the disk or if
+	// the memory limit is not yet exceeded.
+	switch parent := diff.parent.(type) {
+	case *utxoDiskLayer:
+		return nil
+
+	case *utxoDiffLayer:
+		flattened := parent.flatten().(*utxoDiffLayer)
+		t.layers[flattened.root] = flattened
+
+		diff.lock.Lock()
+		defer diff.lock.Unlock()
+
+		diff.parent = flattened
+		if flattened.memory < aggregatorMemoryLimit {
+			// The generator must move along with the disk layer, so push the
+			// covered part of the diffs down while it is running
+			if flattened.parent.(*utxoDiskLayer).genAbort == nil {
+				return nil
+			}
+		}
+	default:
+		panic(fmt.Sprintf("unknown utxo data layer: %T", parent))
+	}
+	bottom := diff.parent.(*utxoDiffLayer)
+
+	bottom.lock.RLock()
+	base := utxoDiffToDisk(bottom, t.logger)
+	bottom.lock.RUnlock()
+
+	t.layers[base.root] = base
+	diff.parent = base
+	return base
+}
+
+// utxoDiffToDisk merges a bottom-most diff into the persistent disk layer
+// underneath it. The method will panic if called onto a non-bottom-most diff
+// layer.
+func utxoDiffToDisk(bottom *utxoDiffLayer, logger *log.Logger) *utxoDiskLayer {
+	var (
+		base  = bottom.parent.(*utxoDiskLayer)
+		batch = base.diskdb.NewBatch()
+		stats *utxoGeneratorStats
+	)
+	// If the disk layer is running a snapshot generator, abort it
+	if base.genAbort != nil {
+		abort := make(chan *utxoGeneratorStats)
+		base.genAbort <- abort
+		stats = <-abort
+	}
+	// Put the deletion in the batch writer, flush all updates in the final step.
+	rawdb.DeleteSnapshotUtxoRoot(batch)
+
+	// Mark the original base as stale as we're going to create a new wrapper
+	base.lock.Lock()
+	if base.stale {
+		panic("parent utxo disk layer is stale") // we've committed into the same base from two children, boo
+	}
+	base.stale = true
+	base.lock.Unlock()
+
+	for hash, data := range bottom.utxoData {
+		// Skip any UTXO not covered yet by the snapshot
+		if base.genMarker != nil && bytes.Compare(hash[:], base.genMarker) > 0 {
+			continue
+		}
+		if len(data) > 0 {
+			rawdb.WriteUtxoSnapshot(batch, hash, data)
+		} else {
+			rawdb.DeleteUtxoSnapshot(batch, hash)
+		}
+		base.cache.Set(hash[:], data)
+
+		// It's ok to flush, the root will go missing in case of a crash and
+		// we'll detect and regenerate the snapshot.
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				logger.WithField("err", err).Fatal("Failed to write utxo snapshot")
+			}
+			batch.Reset()
+		}
+	}
+	rawdb.WriteSnapshotUtxoRoot(batch, bottom.root)
+	journalUtxoProgress(batch, base.genMarker, stats)
+
+	if err := batch.Write(); err != nil {
+		logger.WithField("err", err).Fatal("Failed to write leftover utxo snapshot")
+	}
+	logger.WithFields(log.Fields{
+		"root":     bottom.root,
+		"complete": base.genMarker == nil,
+	}).Debug("Journalled utxo disk layer")
+	res := &utxoDiskLayer{
+		root:       bottom.root,
+		cache:      base.cache,
+		diskdb:     base.diskdb,
+		triedb:     base.triedb,
+		genMarker:  base.genMarker,
+		genPending: base.genPending,
+	}
+	// If snapshot generation hasn't finished yet, continue where the previous
+	// round left off on the new root
+	if base.genMarker != nil && base.genAbort != nil {
+		res.genAbort = make(chan chan *utxoGeneratorStats)
+		go res.generate(stats)
+	}
+	return res
+}
+
+// Journal commits the entire UTXO diff hierarchy to disk into a single journal
+// entry. This is meant to be used during shutdown to persist the snapshot
+// without flattening everything down (bad for reorgs).
+func (t *UtxoTree) Journal(utxoRoot common.Hash) (common.Hash, error) {
+	snap := t.Snapshot(utxoRoot)
+	if snap == nil {
+		return common.Hash{}, fmt.Errorf("utxo snapshot [%#x] missing", utxoRoot)
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	journal := new(bytes.Buffer)
+	if err := rlp.Encode(journal, journalVersion); err != nil {
+		return common.Hash{}, err
+	}
+	diskroot := t.diskRoot()
+	if diskroot == (common.Hash{}) {
+		return common.Hash{}, errors.New("invalid utxo disk root")
+	}
+	if err := rlp.Encode(journal, diskroot); err != nil {
+		return common.Hash{}, err
+	}
+	base, err := snap.(utxoSnapshot).Journal(journal, t.logger)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	rawdb.WriteSnapshotUtxoJournal(t.diskdb, journal.Bytes())
+	return base, nil
+}
+
+// Rebuild wipes all available UTXO snapshot data from the persistent database
+// and discard all caches and diff layers. Afterwards, it starts a new snapshot
+// generator with the given UTXO root.
+func (t *UtxoTree) Rebuild(utxoRoot common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.invalidate()
+
+	// The generator wipes the stale entries ahead of its marker as it goes
+	t.logger.Info("Rebuilding utxo snapshot")
+	t.layers = map[common.Hash]utxoSnapshot{
+		utxoRoot: generateUtxoSnapshot(t.diskdb, t.triedb, t.cache, utxoRoot),
+	}
+}
+
+// Release stops any pending generator and marks all the layers stale, so that
+// the tree can be replaced by a new one over the same database.
+func (t *UtxoTree) Release() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.invalidate()
+	t.layers = map[common.Hash]utxoSnapshot{}
+}
+
+// invalidate aborts the generator and marks all the layers stale. The lock of
+// the tree is assumed to be held already.
+func (t *UtxoTree) invalidate() {
+	for _, layer := range t.layers {
+		switch layer := layer.(type) {
+		case *utxoDiskLayer:
+			// If the base layer is generating, abort it and save
+			if layer.genAbort != nil {
+				abort := make(chan *utxoGeneratorStats)
+				layer.genAbort <- abort
+				<-abort
+			}
+			layer.lock.Lock()
+			layer.stale = true
+			layer.lock.Unlock()
+
+		case *utxoDiffLayer:
+			layer.lock.Lock()
+			atomic.StoreUint32(&layer.stale, 1)
+			layer.lock.Unlock()
+
+		default:
+			panic(fmt.Sprintf("unknown utxo layer type: %T", layer))
+		}
+	}
+}
+
+// diskRoot returns the UTXO root of the disk layer. The lock of the tree is
+// assumed to be held already.
+func (t *UtxoTree) diskRoot() common.Hash {
+	for _, layer := range t.layers {
+		switch layer := layer.(type) {
+		case *utxoDiskLayer:
+			return layer.root
+		case *utxoDiffLayer:
+			return layer.origin.root
+		}
+	}
+	return common.Hash{}
+}
+
+// DiskRoot returns the UTXO root of the persisted UTXO snapshot.
+func (t *UtxoTree) DiskRoot() common.Hash {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.diskRoot()
+}
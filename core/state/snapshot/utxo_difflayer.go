@@ -0,0 +1,182 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dominant-strategies/go-quai/common"
+	bloomfilter "github.com/holiman/bloomfilter/v2"
+)
+
+// bloomUtxoHasherOffset is the runtime constant which determines which part of
+// the UTXO key hash the bloom hasher looks at, randomized like the other
+// offsets
+var bloomUtxoHasherOffset = rand.Intn(25)
+
+// utxoDiffLayer represents the UTXOs created and spent by running a block on
+// top of a UTXO snapshot.
+type utxoDiffLayer struct {
+	origin *utxoDiskLayer // Base disk layer to directly use on bloom misses
+	parent utxoSnapshot   // Parent snapshot modified by this one, never nil
+	memory uint64         // Approximate guess as to how much memory we use
+
+	root  common.Hash // UTXO root to which this snapshot diff belongs to
+	stale uint32      // Signals that the layer became stale (UTXO set progressed)
+
+	utxoData map[common.Hash][]byte // Keyed UTXOs for direct retrieval (nil means spent)
+
+	diffed *bloomfilter.Filter // Bloom filter tracking all the diffed items up to the disk layer
+
+	lock sync.RWMutex
+}
+
+// utxoBloomHasher is a wrapper around a common.Hash to satisfy the interface
+// API requirements of the bloom library used. It's used to convert a UTXO key
+// hash into a 64 bit mini hash.
+type utxoBloomHasher common.Hash
+
+func (h utxoBloomHasher) Write(p []byte) (n int, err error) { panic("not implemented") }
+func (h utxoBloomHasher) Sum(b []byte) []byte               { panic("not implemented") }
+func (h utxoBloomHasher) Reset()                            { panic("not implemented") }
+func (h utxoBloomHasher) BlockSize() int                    { panic("not implemented") }
+func (h utxoBloomHasher) Size() int                         { return 8 }
+func (h utxoBloomHasher) Sum64() uint64 {
+	return binary.BigEndian.Uint64(h[bloomUtxoHasherOffset : bloomUtxoHasherOffset+8])
+}
+
+// newUtxoDiffLayer creates a new diff on top of an existing UTXO snapshot,
+// whether that's the persistent layer or a diff already.
+func newUtxoDiffLayer(parent utxoSnapshot, root common.Hash, utxos map[common.Hash][]byte) *utxoDiffLayer {
+	if utxos == nil {
+		utxos = make(map[common.Hash][]byte)
+	}
+	dl := &utxoDiffLayer{
+		parent:   parent,
+		root:     root,
+		utxoData: utxos,
+	}
+	switch parent := parent.(type) {
+	case *utxoDiskLayer:
+		dl.rebloom(parent)
+	case *utxoDiffLayer:
+		dl.rebloom(parent.origin)
+	default:
+		panic("unknown parent type")
+	}
+	for _, data := range utxos {
+		dl.memory += uint64(common.HashLength + len(data))
+	}
+	return dl
+}
+
+// rebloom discards the layer's current bloom and rebuilds it from scratch based
+// on the parent's and the local diffs.
+func (dl *utxoDiffLayer) rebloom(origin *utxoDiskLayer) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.origin = origin
+
+	if parent, ok := dl.parent.(*utxoDiffLayer); ok {
+		parent.lock.RLock()
+		dl.diffed, _ = parent.diffed.Copy()
+		parent.lock.RUnlock()
+	} else {
+		dl.diffed, _ = bloomfilter.New(uint64(bloomSize), uint64(bloomFuncs))
+	}
+	for hash := range dl.utxoData {
+		dl.diffed.Add(utxoBloomHasher(hash))
+	}
+}
+
+// Root returns the UTXO root for which this snapshot was made.
+func (dl *utxoDiffLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent returns the subsequent layer of a diff layer.
+func (dl *utxoDiffLayer) Parent() utxoSnapshot {
+	return dl.parent
+}
+
+// Stale return whether this layer has become stale (was flattened across) or if
+// it's still live.
+func (dl *utxoDiffLayer) Stale() bool {
+	return atomic.LoadUint32(&dl.stale) != 0
+}
+
+// Utxo directly retrieves the UTXO trie value associated with the hash of an
+// outpoint key, checking the bloom filter first to skip the diff layers that
+// did not touch it.
+//
+// Note the returned value is not a copy, please don't modify it.
+func (dl *utxoDiffLayer) Utxo(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	var origin *utxoDiskLayer
+	if !dl.diffed.Contains(utxoBloomHasher(hash)) {
+		origin = dl.origin // extract origin while holding the lock
+	}
+	dl.lock.RUnlock()
+
+	if origin != nil {
+		return origin.Utxo(hash)
+	}
+	return dl.utxo(hash)
+}
+
+// utxo is an internal version of Utxo that skips the bloom filter checks and
+// uses the internal maps to try and retrieve the data.
+func (dl *utxoDiffLayer) utxo(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.Stale() {
+		markUtxoRead("fallback")
+		return nil, ErrSnapshotStale
+	}
+	if data, ok := dl.utxoData[hash]; ok {
+		markUtxoRead("diff")
+		return data, nil
+	}
+	if diff, ok := dl.parent.(*utxoDiffLayer); ok {
+		return diff.utxo(hash)
+	}
+	return dl.parent.Utxo(hash)
+}
+
+// Update creates a new layer on top of the existing snapshot diff tree with
+// the UTXOs created and spent by a block.
+func (dl *utxoDiffLayer) Update(utxoRoot common.Hash, utxos map[common.Hash][]byte) *utxoDiffLayer {
+	return newUtxoDiffLayer(dl, utxoRoot, utxos)
+}
+
+// flatten pushes all data from this point downwards, flattening everything into
+// a single diff at the bottom.
+func (dl *utxoDiffLayer) flatten() utxoSnapshot {
+	parent, ok := dl.parent.(*utxoDiffLayer)
+	if !ok {
+		return dl
+	}
+	parent = parent.flatten().(*utxoDiffLayer)
+
+	parent.lock.Lock()
+	defer parent.lock.Unlock()
+
+	if atomic.SwapUint32(&parent.stale, 1) != 0 {
+		panic(fmt.Sprintf("parent utxo diff layer %#x is stale", parent.root)) // we've flattened into the same parent from two children, boo
+	}
+	for hash, data := range dl.utxoData {
+		parent.utxoData[hash] = data
+	}
+	return &utxoDiffLayer{
+		parent:   parent.parent,
+		origin:   parent.origin,
+		root:     dl.root,
+		utxoData: parent.utxoData,
+		diffed:   dl.diffed,
+		memory:   parent.memory + dl.memory,
+	}
+}
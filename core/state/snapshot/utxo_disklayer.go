@@ -0,0 +1,81 @@
+package snapshot
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/trie"
+)
+
+// utxoDiskLayer is the persistent flat layer of the UTXO set built on top of a
+// key-value store.
+type utxoDiskLayer struct {
+	diskdb ethdb.KeyValueStore // Key-value store containing the base snapshot
+	triedb *trie.Database      // UTXO trie node cache for reconstruction purposes
+	cache  *fastcache.Cache    // Cache to avoid hitting the disk for direct access
+
+	root  common.Hash // UTXO root of the base snapshot
+	stale bool        // Signals that the layer became stale (UTXO set progressed)
+
+	genMarker  []byte                        // Marker for the UTXOs that are indexed during initial layer generation
+	genPending chan struct{}                 // Notification channel when generation is done
+	genAbort   chan chan *utxoGeneratorStats // Notification channel to abort generating the snapshot in this layer
+
+	lock sync.RWMutex
+}
+
+// Root returns the UTXO root for which this snapshot was made.
+func (dl *utxoDiskLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent always returns nil as there's no layer below the disk.
+func (dl *utxoDiskLayer) Parent() utxoSnapshot {
+	return nil
+}
+
+// Stale return whether this layer has become stale (was flattened across) or if
+// it's still live.
+func (dl *utxoDiskLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// Utxo directly retrieves the UTXO trie value associated with the hash of an
+// outpoint key.
+func (dl *utxoDiskLayer) Utxo(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		markUtxoRead("fallback")
+		return nil, ErrSnapshotStale
+	}
+	// If the layer is being generated, ensure the requested hash has already been
+	// covered by the generator.
+	if dl.genMarker != nil && bytes.Compare(hash[:], dl.genMarker) > 0 {
+		markUtxoRead("fallback")
+		return nil, ErrNotCoveredYet
+	}
+	if blob, found := dl.cache.HasGet(nil, hash[:]); found {
+		markUtxoRead("hit")
+		return blob, nil
+	}
+	markUtxoRead("miss")
+	blob := rawdb.ReadUtxoSnapshot(dl.diskdb, hash)
+	dl.cache.Set(hash[:], blob)
+
+	return blob, nil
+}
+
+// Update creates a new layer on top of the existing snapshot diff tree with
+// the UTXOs created and spent by a block.
+func (dl *utxoDiskLayer) Update(utxoRoot common.Hash, utxos map[common.Hash][]byte) *utxoDiffLayer {
+	return newUtxoDiffLayer(dl, utxoRoot, utxos)
+}
@@ -0,0 +1,197 @@
+package snapshot
+
+import (
+	"errors"
+	"runtime/debug"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/rlp"
+	"github.com/dominant-strategies/go-quai/trie"
+)
+
+// utxoGeneratorStats is a collection of statistics gathered by the UTXO
+// snapshot generator for logging purposes.
+type utxoGeneratorStats struct {
+	start   time.Time          // Timestamp when generation started
+	utxos   uint64             // Number of UTXOs indexed
+	storage common.StorageSize // Total size of the indexed UTXOs
+	logger  *log.Logger
+}
+
+// Log creates an contextual log with the given message and the context pulled
+// from the internally maintained statistics.
+func (gs *utxoGeneratorStats) Log(msg string, root common.Hash, marker []byte) {
+	fields := log.Fields{
+		"root":    root,
+		"utxos":   gs.utxos,
+		"storage": gs.storage,
+		"elapsed": common.PrettyDuration(time.Since(gs.start)),
+	}
+	if len(marker) == common.HashLength {
+		fields["at"] = common.BytesToHash(marker)
+	}
+	gs.logger.WithFields(fields).Info(msg)
+}
+
+// generateUtxoSnapshot regenerates a brand new UTXO snapshot based on the UTXO
+// trie of the given root. The snapshot is returned immediately and generation
+// is continued in the background until done.
+func generateUtxoSnapshot(diskdb ethdb.KeyValueStore, triedb *trie.Database, cache int, utxoRoot common.Hash) *utxoDiskLayer {
+	var (
+		stats     = &utxoGeneratorStats{start: time.Now(), logger: diskdb.Logger()}
+		batch     = diskdb.NewBatch()
+		genMarker = []byte{} // Initialized but empty!
+	)
+	rawdb.WriteSnapshotUtxoRoot(batch, utxoRoot)
+	rawdb.DeleteSnapshotUtxoJournal(batch)
+	journalUtxoProgress(batch, genMarker, stats)
+	if err := batch.Write(); err != nil {
+		diskdb.Logger().WithField("err", err).Fatal("Failed to write initialized utxo snapshot marker")
+	}
+	base := &utxoDiskLayer{
+		diskdb:     diskdb,
+		triedb:     triedb,
+		root:       utxoRoot,
+		cache:      fastcache.New(cache * 1024 * 1024),
+		genMarker:  genMarker,
+		genPending: make(chan struct{}),
+		genAbort:   make(chan chan *utxoGeneratorStats),
+	}
+	go base.generate(stats)
+	diskdb.Logger().WithField("root", utxoRoot).Debug("Started utxo snapshot generation")
+	return base
+}
+
+// journalUtxoProgress persists the UTXO generator stats into the database to
+// resume later.
+func journalUtxoProgress(db ethdb.KeyValueWriter, marker []byte, stats *utxoGeneratorStats) {
+	entry := journalUtxoGenerator{
+		Done:   marker == nil,
+		Marker: marker,
+	}
+	if stats != nil {
+		entry.Utxos = stats.utxos
+		entry.Storage = uint64(stats.storage)
+	}
+	blob, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		panic(err) // Cannot happen, here to catch dev errors
+	}
+	rawdb.WriteSnapshotUtxoGenerator(db, blob)
+}
+
+// generate is a background thread that iterates over the UTXO trie, writing
+// its leaves into the flat UTXO snapshot. The entries ahead of the marker are
+// left over by an earlier generation on another UTXO set, so they are wiped
+// before the trie is iterated from the marker on.
+func (dl *utxoDiskLayer) generate(stats *utxoGeneratorStats) {
+	defer func() {
+		if r := recover(); r != nil {
+			stats.logger.WithFields(log.Fields{
+				"error":      r,
+				"stacktrace": string(debug.Stack()),
+			}).Error("Go-Quai Panicked")
+		}
+	}()
+	var (
+		origin []byte
+		batch  = dl.diskdb.NewBatch()
+		logged = time.Now()
+		abort  chan *utxoGeneratorStats
+	)
+	stats.Log("Resuming utxo snapshot generation", dl.root, dl.genMarker)
+
+	checkAndFlush := func(currentLocation []byte) error {
+		select {
+		case abort = <-dl.genAbort:
+		default:
+		}
+		if batch.ValueSize() > ethdb.IdealBatchSize || abort != nil {
+			journalUtxoProgress(batch, currentLocation, stats)
+
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+
+			dl.lock.Lock()
+			dl.genMarker = currentLocation
+			dl.lock.Unlock()
+
+			if abort != nil {
+				stats.Log("Aborting utxo snapshot generation", dl.root, currentLocation)
+				return errors.New("aborted")
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			stats.Log("Generating utxo snapshot", dl.root, currentLocation)
+			logged = time.Now()
+		}
+		return nil
+	}
+	generateUtxos := func() error {
+		if len(dl.genMarker) > 0 { // []byte{} is the start, use nil for that
+			if origin = increaseKey(common.CopyBytes(dl.genMarker)); origin == nil {
+				return nil // special case, the last is 0xffffffff...fff
+			}
+		}
+		keylen := len(rawdb.SnapshotUtxoPrefix) + common.HashLength
+		if err := wipeKeyRange(dl.diskdb, "utxos", rawdb.SnapshotUtxoPrefix, origin, nil, keylen, origin == nil); err != nil {
+			return err
+		}
+		tr, err := trie.New(dl.root, dl.triedb)
+		if err != nil {
+			return errMissingTrie
+		}
+		it := trie.NewIterator(tr.NodeIterator(origin))
+		for it.Next() {
+			key := common.CopyBytes(it.Key)
+			rawdb.WriteUtxoSnapshot(batch, common.BytesToHash(key), it.Value)
+			stats.utxos++
+			stats.storage += common.StorageSize(1 + common.HashLength + len(it.Value))
+
+			if err := checkAndFlush(key); err != nil {
+				return err
+			}
+		}
+		return it.Err
+	}
+	if err := generateUtxos(); err != nil {
+		if abort == nil { // aborted by internal error, wait the signal
+			stats.logger.WithField("err", err).Error("Utxo snapshot generation failed")
+			abort = <-dl.genAbort
+		}
+		abort <- stats
+		return
+	}
+	// Snapshot fully generated, set the marker to nil
+	journalUtxoProgress(batch, nil, stats)
+	if err := batch.Write(); err != nil {
+		stats.logger.WithField("err", err).Error("Failed to flush batch")
+
+		abort = <-dl.genAbort
+		abort <- stats
+		return
+	}
+	batch.Reset()
+
+	stats.logger.WithFields(log.Fields{
+		"utxos":   stats.utxos,
+		"storage": stats.storage,
+		"elapsed": common.PrettyDuration(time.Since(stats.start)),
+	}).Info("Generated utxo snapshot")
+
+	dl.lock.Lock()
+	dl.genMarker = nil
+	close(dl.genPending)
+	dl.lock.Unlock()
+
+	// Someone will be looking for us, wait it out
+	abort = <-dl.genAbort
+	abort <- nil
+}
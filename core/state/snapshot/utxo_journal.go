@@ -0,0 +1,209 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/rlp"
+	"github.com/dominant-strategies/go-quai/trie"
+)
+
+// journalUtxoGenerator is a UTXO disk layer entry containing the generator
+// progress marker.
+type journalUtxoGenerator struct {
+	Done    bool // Whether the generator finished creating the snapshot
+	Marker  []byte
+	Utxos   uint64
+	Storage uint64
+}
+
+// journalUtxo is a UTXO entry in a utxoDiffLayer's disk journal, an empty blob
+// marks a spent UTXO.
+type journalUtxo struct {
+	Hash common.Hash
+	Blob []byte
+}
+
+// loadUtxoSnapshot loads a pre-existing UTXO snapshot backed by a key-value
+// store, along with the diff layers journalled at the last shutdown.
+func loadUtxoSnapshot(diskdb ethdb.KeyValueStore, triedb *trie.Database, cache int, utxoRoot common.Hash) (utxoSnapshot, error) {
+	baseRoot := rawdb.ReadSnapshotUtxoRoot(diskdb)
+	if baseRoot == (common.Hash{}) {
+		return nil, errors.New("missing or corrupted utxo snapshot")
+	}
+	generatorBlob := rawdb.ReadSnapshotUtxoGenerator(diskdb)
+	if len(generatorBlob) == 0 {
+		return nil, errors.New("missing utxo snapshot generator")
+	}
+	var generator journalUtxoGenerator
+	if err := rlp.DecodeBytes(generatorBlob, &generator); err != nil {
+		return nil, fmt.Errorf("failed to decode utxo snapshot generator: %v", err)
+	}
+	base := &utxoDiskLayer{
+		diskdb: diskdb,
+		triedb: triedb,
+		cache:  fastcache.New(cache * 1024 * 1024),
+		root:   baseRoot,
+	}
+	snapshot, err := loadUtxoJournal(diskdb, base)
+	if err != nil {
+		return nil, err
+	}
+	// The diffs are lost if the node crashed, and the snapshot can't follow a
+	// head that was rewound below it either, so it must be rebuilt
+	if head := snapshot.Root(); head != utxoRoot {
+		return nil, fmt.Errorf("head doesn't match utxo snapshot: have %#x, want %#x", head, utxoRoot)
+	}
+	// Everything loaded correctly, resume any suspended generation
+	if !generator.Done {
+		base.genMarker = generator.Marker
+		if base.genMarker == nil {
+			base.genMarker = []byte{}
+		}
+		base.genPending = make(chan struct{})
+		base.genAbort = make(chan chan *utxoGeneratorStats)
+
+		go base.generate(&utxoGeneratorStats{
+			start:   time.Now(),
+			utxos:   generator.Utxos,
+			storage: common.StorageSize(generator.Storage),
+			logger:  diskdb.Logger(),
+		})
+	}
+	return snapshot, nil
+}
+
+// loadUtxoJournal reads the UTXO diff layers journalled on top of the disk
+// layer. A missing or mismatched journal only discards the diffs.
+func loadUtxoJournal(db ethdb.KeyValueStore, base *utxoDiskLayer) (utxoSnapshot, error) {
+	journal := rawdb.ReadSnapshotUtxoJournal(db)
+	if len(journal) == 0 {
+		db.Logger().WithFields(log.Fields{
+			"diskroot": base.root,
+			"diffs":    "missing",
+		}).Warn("Loaded utxo snapshot journal")
+		return base, nil
+	}
+	r := rlp.NewStream(bytes.NewReader(journal), 0)
+
+	version, err := r.Uint()
+	if err != nil {
+		db.Logger().WithField("err", err).Warn("Failed to resolve the utxo journal version")
+		return base, nil
+	}
+	if version != journalVersion {
+		db.Logger().WithFields(log.Fields{
+			"required": journalVersion,
+			"got":      version,
+		}).Warn("Discarded the utxo snapshot journal with wrong version")
+		return base, nil
+	}
+	var root common.Hash
+	if err := r.Decode(&root); err != nil {
+		return nil, errors.New("missing utxo disk layer root")
+	}
+	if root != base.root {
+		db.Logger().WithFields(log.Fields{
+			"diskroot": base.root,
+			"diffs":    "unmatched",
+		}).Warn("Loaded utxo snapshot journal")
+		return base, nil
+	}
+	snapshot, err := loadUtxoDiffLayer(base, r)
+	if err != nil {
+		return nil, err
+	}
+	db.Logger().WithFields(log.Fields{
+		"diskroot": base.root,
+		"diffhead": snapshot.Root(),
+	}).Debug("Loaded utxo snapshot journal")
+	return snapshot, nil
+}
+
+// loadUtxoDiffLayer reads the next sections of a UTXO snapshot journal,
+// reconstructing a new diff and linking it to the parent.
+func loadUtxoDiffLayer(parent utxoSnapshot, r *rlp.Stream) (utxoSnapshot, error) {
+	var root common.Hash
+	if err := r.Decode(&root); err != nil {
+		// The first read may fail with EOF, marking the end of the journal
+		if err == io.EOF {
+			return parent, nil
+		}
+		return nil, fmt.Errorf("load utxo diff root: %v", err)
+	}
+	var utxos []journalUtxo
+	if err := r.Decode(&utxos); err != nil {
+		return nil, fmt.Errorf("load utxo diff entries: %v", err)
+	}
+	utxoData := make(map[common.Hash][]byte, len(utxos))
+	for _, entry := range utxos {
+		if len(entry.Blob) > 0 { // RLP loses nil-ness, but `[]byte{}` is not a valid item, so reinterpret that
+			utxoData[entry.Hash] = entry.Blob
+		} else {
+			utxoData[entry.Hash] = nil
+		}
+	}
+	return loadUtxoDiffLayer(newUtxoDiffLayer(parent, root, utxoData), r)
+}
+
+// Journal terminates any in-progress snapshot generation, also implicitly
+// pushing the progress into the database.
+func (dl *utxoDiskLayer) Journal(buffer *bytes.Buffer, logger *log.Logger) (common.Hash, error) {
+	var stats *utxoGeneratorStats
+	if dl.genAbort != nil {
+		abort := make(chan *utxoGeneratorStats)
+		dl.genAbort <- abort
+
+		if stats = <-abort; stats != nil {
+			stats.Log("Journalling in-progress utxo snapshot", dl.root, dl.genMarker)
+		}
+	}
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return common.Hash{}, ErrSnapshotStale
+	}
+	journalUtxoProgress(dl.diskdb, dl.genMarker, stats)
+
+	logger.WithField("root", dl.root).Debug("Journalled utxo disk layer")
+	return dl.root, nil
+}
+
+// Journal writes the memory layer contents into a buffer to be stored in the
+// database as the UTXO snapshot journal.
+func (dl *utxoDiffLayer) Journal(buffer *bytes.Buffer, logger *log.Logger) (common.Hash, error) {
+	base, err := dl.parent.Journal(buffer, logger)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.Stale() {
+		return common.Hash{}, ErrSnapshotStale
+	}
+	if err := rlp.Encode(buffer, dl.root); err != nil {
+		return common.Hash{}, err
+	}
+	utxos := make([]journalUtxo, 0, len(dl.utxoData))
+	for hash, blob := range dl.utxoData {
+		utxos = append(utxos, journalUtxo{Hash: hash, Blob: blob})
+	}
+	if err := rlp.Encode(buffer, utxos); err != nil {
+		return common.Hash{}, err
+	}
+	logger.WithFields(log.Fields{
+		"root":   dl.root,
+		"parent": dl.parent.Root(),
+	}).Debug("Journalled utxo diff layer")
+	return base, nil
+}
@@ -0,0 +1,266 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/crypto"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/trie"
+)
+
+// utxoTestDepth is the number of diff layers the test trees keep in memory.
+const utxoTestDepth = 2
+
+// utxoTestHash returns a deterministic hashed outpoint key for the tests.
+func utxoTestHash(i int) common.Hash {
+	return crypto.Keccak256Hash([]byte(fmt.Sprintf("utxo-%d", i)))
+}
+
+// utxoTestRoot returns a deterministic UTXO root for the tests.
+func utxoTestRoot(i int) common.Hash {
+	return common.BytesToHash([]byte{0xff, byte(i)})
+}
+
+// newUtxoTestTree creates a UTXO snapshot tree with a complete disk layer
+// holding the given entries.
+func newUtxoTestTree(db ethdb.KeyValueStore, root common.Hash, utxos map[common.Hash][]byte) *UtxoTree {
+	for hash, data := range utxos {
+		rawdb.WriteUtxoSnapshot(db, hash, data)
+	}
+	rawdb.WriteSnapshotUtxoRoot(db, root)
+	journalUtxoProgress(db, nil, nil)
+
+	base := &utxoDiskLayer{
+		diskdb: db,
+		triedb: trie.NewDatabase(db),
+		cache:  fastcache.New(1024 * 500),
+		root:   root,
+	}
+	return &UtxoTree{
+		diskdb: db,
+		triedb: base.triedb,
+		cache:  1,
+		depth:  utxoTestDepth,
+		layers: map[common.Hash]utxoSnapshot{root: base},
+		logger: log.Global,
+	}
+}
+
+// checkUtxo verifies that a snapshot layer returns the expected value of an
+// outpoint key.
+func checkUtxo(t *testing.T, snap UtxoSnapshot, hash common.Hash, want []byte) {
+	t.Helper()
+	have, err := snap.Utxo(hash)
+	if err != nil {
+		t.Fatalf("failed to retrieve utxo %x: %v", hash, err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Fatalf("utxo %x mismatch: have %x, want %x", hash, have, want)
+	}
+}
+
+// Tests that diff layers beyond the permitted depth are merged into a single
+// bottom diff and that spent entries keep shadowing the disk layer.
+func TestUtxoDiffLayerFlatten(t *testing.T) {
+	var (
+		db   = rawdb.NewMemoryDatabase(log.Global)
+		a, b = utxoTestHash(1), utxoTestHash(2)
+		c, d = utxoTestHash(3), utxoTestHash(4)
+	)
+	tree := newUtxoTestTree(db, utxoTestRoot(0), map[common.Hash][]byte{a: {0x0a}, b: {0x0b}})
+
+	// Spend a, create c, spend c again and create d in successive blocks
+	if err := tree.Update(utxoTestRoot(1), utxoTestRoot(0), map[common.Hash][]byte{a: nil, c: {0x0c}}); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	if err := tree.Update(utxoTestRoot(2), utxoTestRoot(1), map[common.Hash][]byte{c: nil, d: {0x0d}}); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	if err := tree.Update(utxoTestRoot(3), utxoTestRoot(2), map[common.Hash][]byte{a: {0x1a}}); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	if n := len(tree.layers); n != 4 {
+		t.Fatalf("pre-cap layer count mismatch: have %d, want %d", n, 4)
+	}
+	// Flatten everything below the head into one diff over the disk layer
+	if err := tree.Cap(utxoTestRoot(3), 1); err != nil {
+		t.Fatalf("failed to cap utxo tree: %v", err)
+	}
+	if n := len(tree.layers); n != 3 {
+		t.Fatalf("post-cap layer count mismatch: have %d, want %d", n, 3)
+	}
+	if tree.Snapshot(utxoTestRoot(1)) != nil {
+		t.Fatalf("flattened layer still accessible")
+	}
+	bottom, ok := tree.Snapshot(utxoTestRoot(2)).(*utxoDiffLayer)
+	if !ok {
+		t.Fatalf("bottom layer is not a diff layer")
+	}
+	if _, ok := bottom.parent.(*utxoDiskLayer); !ok {
+		t.Fatalf("bottom diff layer is not on the disk layer")
+	}
+	checkUtxo(t, bottom, a, nil)
+	checkUtxo(t, bottom, b, []byte{0x0b})
+	checkUtxo(t, bottom, c, nil)
+	checkUtxo(t, bottom, d, []byte{0x0d})
+
+	head := tree.Snapshot(utxoTestRoot(3))
+	checkUtxo(t, head, a, []byte{0x1a})
+	checkUtxo(t, head, b, []byte{0x0b})
+	checkUtxo(t, head, c, nil)
+	checkUtxo(t, head, d, []byte{0x0d})
+
+	// Persist the bottom diff and check the disk reflects the spent entries
+	origin := bottom.parent.(*utxoDiskLayer)
+	base := utxoDiffToDisk(bottom, log.Global)
+	if base.Root() != utxoTestRoot(2) {
+		t.Fatalf("disk layer root mismatch: have %x, want %x", base.Root(), utxoTestRoot(2))
+	}
+	if root := rawdb.ReadSnapshotUtxoRoot(db); root != utxoTestRoot(2) {
+		t.Fatalf("persisted root mismatch: have %x, want %x", root, utxoTestRoot(2))
+	}
+	if blob := rawdb.ReadUtxoSnapshot(db, a); len(blob) != 0 {
+		t.Fatalf("spent utxo still on disk: %x", blob)
+	}
+	if blob := rawdb.ReadUtxoSnapshot(db, d); !bytes.Equal(blob, []byte{0x0d}) {
+		t.Fatalf("created utxo mismatch on disk: have %x, want %x", blob, []byte{0x0d})
+	}
+	if _, err := origin.Utxo(b); err != ErrSnapshotStale {
+		t.Fatalf("replaced disk layer not stale: %v", err)
+	}
+	checkUtxo(t, base, a, nil)
+	checkUtxo(t, base, b, []byte{0x0b})
+}
+
+// Tests that the diff layers journalled at shutdown are reloaded on top of the
+// disk layer, and that a journal for another head is rejected.
+func TestUtxoJournal(t *testing.T) {
+	var (
+		db   = rawdb.NewMemoryDatabase(log.Global)
+		a, b = utxoTestHash(1), utxoTestHash(2)
+		c    = utxoTestHash(3)
+	)
+	tree := newUtxoTestTree(db, utxoTestRoot(0), map[common.Hash][]byte{a: {0x0a}, b: {0x0b}})
+	if err := tree.Update(utxoTestRoot(1), utxoTestRoot(0), map[common.Hash][]byte{a: nil, c: {0x0c}}); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	if err := tree.Update(utxoTestRoot(2), utxoTestRoot(1), map[common.Hash][]byte{b: {0x1b}}); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	base, err := tree.Journal(utxoTestRoot(2))
+	if err != nil {
+		t.Fatalf("failed to journal utxo tree: %v", err)
+	}
+	if base != utxoTestRoot(0) {
+		t.Fatalf("journalled disk root mismatch: have %x, want %x", base, utxoTestRoot(0))
+	}
+	// Reload the tree and check every layer came back with its data
+	loaded, err := NewUtxoTree(db, trie.NewDatabase(db), 1, utxoTestDepth, utxoTestRoot(2), false, log.Global)
+	if err != nil {
+		t.Fatalf("failed to load utxo tree: %v", err)
+	}
+	if n := len(loaded.layers); n != 3 {
+		t.Fatalf("loaded layer count mismatch: have %d, want %d", n, 3)
+	}
+	if loaded.DiskRoot() != utxoTestRoot(0) {
+		t.Fatalf("loaded disk root mismatch: have %x, want %x", loaded.DiskRoot(), utxoTestRoot(0))
+	}
+	head := loaded.Snapshot(utxoTestRoot(2))
+	checkUtxo(t, head, a, nil)
+	checkUtxo(t, head, b, []byte{0x1b})
+	checkUtxo(t, head, c, []byte{0x0c})
+
+	middle := loaded.Snapshot(utxoTestRoot(1))
+	checkUtxo(t, middle, b, []byte{0x0b})
+
+	// A journal not ending at the expected head must not be used
+	if _, err := NewUtxoTree(db, trie.NewDatabase(db), 1, utxoTestDepth, utxoTestRoot(1), false, log.Global); err == nil {
+		t.Fatalf("loaded utxo tree with mismatched head")
+	}
+}
+
+// Tests that an interrupted generation resumes from its marker, wiping the
+// stale entries ahead of it and keeping the ones it already wrote.
+func TestUtxoGenerationResume(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase(log.Global)
+		triedb = trie.NewDatabase(db)
+		utxos  = make(map[common.Hash][]byte)
+		hashes []common.Hash
+	)
+	tr, err := trie.New(common.Hash{}, triedb)
+	if err != nil {
+		t.Fatalf("failed to create trie: %v", err)
+	}
+	for i := 0; i < 64; i++ {
+		hash, data := utxoTestHash(i), []byte{byte(i), 0x01}
+		if err := tr.TryUpdate(hash[:], data); err != nil {
+			t.Fatalf("failed to insert utxo: %v", err)
+		}
+		utxos[hash] = data
+		hashes = append(hashes, hash)
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	if err := triedb.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to flush trie: %v", err)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+
+	// Simulate a generation interrupted half way, leaving a stale entry from
+	// an older UTXO set ahead of the marker
+	marker := hashes[len(hashes)/2]
+	for _, hash := range hashes[:len(hashes)/2+1] {
+		rawdb.WriteUtxoSnapshot(db, hash, utxos[hash])
+	}
+	stale := common.BytesToHash(bytes.Repeat([]byte{0xff}, common.HashLength))
+	rawdb.WriteUtxoSnapshot(db, stale, []byte{0xde, 0xad})
+	rawdb.WriteSnapshotUtxoRoot(db, root)
+	journalUtxoProgress(db, marker[:], nil)
+
+	tree, err := NewUtxoTree(db, triedb, 1, utxoTestDepth, root, false, log.Global)
+	if err != nil {
+		t.Fatalf("failed to load utxo tree: %v", err)
+	}
+	base := tree.Snapshot(root).(*utxoDiskLayer)
+	select {
+	case <-base.genPending:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("utxo snapshot generation timed out")
+	}
+	for hash, want := range utxos {
+		checkUtxo(t, base, hash, want)
+		if blob := rawdb.ReadUtxoSnapshot(db, hash); !bytes.Equal(blob, want) {
+			t.Fatalf("generated utxo %x mismatch: have %x, want %x", hash, blob, want)
+		}
+	}
+	if blob := rawdb.ReadUtxoSnapshot(db, stale); len(blob) != 0 {
+		t.Fatalf("stale utxo ahead of the marker not wiped: %x", blob)
+	}
+	// The generator is marked done on disk so the next start won't resume it
+	tree.Release()
+	if _, err := loadUtxoSnapshot(db, triedb, 1, root); err != nil {
+		t.Fatalf("failed to reload generated utxo snapshot: %v", err)
+	}
+	var count int
+	it := db.NewIterator(rawdb.SnapshotUtxoPrefix, nil)
+	for it.Next() {
+		if len(it.Key()) == len(rawdb.SnapshotUtxoPrefix)+common.HashLength {
+			count++
+		}
+	}
+	it.Release()
+	if count != len(utxos) {
+		t.Fatalf("snapshot entry count mismatch: have %d, want %d", count, len(utxos))
+	}
+}
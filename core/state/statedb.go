@@ -18,7 +18,6 @@
 package state
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"math/big"
@@ -87,6 +86,8 @@ func registerMetrics() {
 	stateMetrics.WithLabelValues("SnapshotAccountReads")
 	stateMetrics.WithLabelValues("SnapshotStorageReads")
 	stateMetrics.WithLabelValues("SnapshotCommits")
+	stateMetrics.WithLabelValues("SnapshotUtxoReads")
+	stateMetrics.WithLabelValues("SnapshotUtxoCommits")
 }
 
 // StateDB structs within the Quai protocol are used to store anything
@@ -115,6 +116,10 @@ type StateDB struct {
 	snapAccounts  map[common.Hash][]byte
 	snapStorage   map[common.Hash]map[common.Hash][]byte
 
+	utxoSnaps *snapshot.UtxoTree
+	utxoSnap  snapshot.UtxoSnapshot
+	snapUtxos map[common.Hash][]byte // UTXOs created (non-nil) and spent (nil) keyed by the hash of their trie key
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects        map[common.InternalAddress]*stateObject
 	stateObjectsPending map[common.InternalAddress]struct{} // State objects finalized but not yet written to the trie
@@ -161,7 +166,7 @@ type StateDB struct {
 }
 
 // New creates a new state from a given trie.
-func New(root common.Hash, utxoRoot common.Hash, etxRoot common.Hash, db Database, utxoDb Database, etxDb Database, snaps *snapshot.Tree, nodeLocation common.Location, logger *log.Logger) (*StateDB, error) {
+func New(root common.Hash, utxoRoot common.Hash, etxRoot common.Hash, db Database, utxoDb Database, etxDb Database, snaps *snapshot.Tree, utxoSnaps *snapshot.UtxoTree, nodeLocation common.Location, logger *log.Logger) (*StateDB, error) {
 	tr, err := db.OpenTrie(root)
 	if err != nil {
 		return nil, err
@@ -183,6 +188,7 @@ func New(root common.Hash, utxoRoot common.Hash, etxRoot common.Hash, db Databas
 		etxTrie:             etxTr,
 		originalRoot:        root,
 		snaps:               snaps,
+		utxoSnaps:           utxoSnaps,
 		logger:              logger,
 		stateObjects:        make(map[common.InternalAddress]*stateObject),
 		stateObjectsPending: make(map[common.InternalAddress]struct{}),
@@ -201,6 +207,11 @@ func New(root common.Hash, utxoRoot common.Hash, etxRoot common.Hash, db Databas
 			sdb.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
 		}
 	}
+	if sdb.utxoSnaps != nil {
+		if sdb.utxoSnap = sdb.utxoSnaps.Snapshot(utxoRoot); sdb.utxoSnap != nil {
+			sdb.snapUtxos = make(map[common.Hash][]byte)
+		}
+	}
 	return sdb, nil
 }
 
@@ -564,10 +575,32 @@ func (s *StateDB) GetUTXO(txHash common.Hash, outputIndex uint16) *types.UtxoEnt
 	if metrics_config.MetricsEnabled() {
 		defer func(start time.Time) { stateMetrics.WithLabelValues("GetUTXO").Add(float64(time.Since(start))) }(time.Now())
 	}
-	enc, err := s.utxoTrie.TryGet(utxoKey(txHash, outputIndex))
-	if err != nil {
-		s.setError(fmt.Errorf("getUTXO (%x) error: %v", txHash, err))
-		return nil
+	var (
+		key = types.UtxoKey(txHash, outputIndex)
+		enc []byte
+		err error
+	)
+	// If a UTXO snapshot is available, read the UTXOs touched by this block
+	// first and the flat UTXO set below them
+	if s.utxoSnap != nil {
+		hash := crypto.HashData(s.hasher, key)
+		if data, ok := s.snapUtxos[hash]; ok {
+			enc = data
+		} else {
+			start := time.Now()
+			enc, err = s.utxoSnap.Utxo(hash)
+			if metrics_config.MetricsEnabled() {
+				stateMetrics.WithLabelValues("SnapshotUtxoReads").Add(float64(time.Since(start)))
+			}
+		}
+	}
+	// If the snapshot is unavailable or not generated yet, fall back to the trie
+	if s.utxoSnap == nil || err != nil {
+		enc, err = s.utxoTrie.TryGet(key)
+		if err != nil {
+			s.setError(fmt.Errorf("getUTXO (%x) error: %v", txHash, err))
+			return nil
+		}
 	}
 	if len(enc) == 0 {
 		return nil
@@ -590,8 +623,13 @@ func (s *StateDB) DeleteUTXO(txHash common.Hash, outputIndex uint16) {
 		defer func(start time.Time) { stateMetrics.WithLabelValues("DeleteUTXO").Add(float64(time.Since(start))) }(time.Now())
 	}
 	// Delete the utxo from the trie
-	if err := s.utxoTrie.TryDelete(utxoKey(txHash, outputIndex)); err != nil {
+	key := types.UtxoKey(txHash, outputIndex)
+	if err := s.utxoTrie.TryDelete(key); err != nil {
 		s.setError(fmt.Errorf("deleteUTXO (%x) error: %v", txHash, err))
+		return
+	}
+	if s.utxoSnap != nil {
+		s.snapUtxos[crypto.HashData(s.hasher, key)] = nil
 	}
 }
 
@@ -611,8 +649,13 @@ func (s *StateDB) CreateUTXO(txHash common.Hash, outputIndex uint16, utxo *types
 	if err != nil {
 		panic(fmt.Errorf("can't encode UTXO entry at %x: %v", txHash, err))
 	}
-	if err := s.utxoTrie.TryUpdate(utxoKey(txHash, outputIndex), data); err != nil {
+	key := types.UtxoKey(txHash, outputIndex)
+	if err := s.utxoTrie.TryUpdate(key, data); err != nil {
 		s.setError(fmt.Errorf("createUTXO (%x) error: %v", txHash, err))
+		return nil
+	}
+	if s.utxoSnap != nil {
+		s.snapUtxos[crypto.HashData(s.hasher, key)] = data
 	}
 	return nil
 }
@@ -628,6 +671,33 @@ func (s *StateDB) CommitUTXOs() (common.Hash, error) {
 	root, err := s.utxoTrie.Commit(nil)
 	if err != nil {
 		s.setError(fmt.Errorf("commitUTXOs error: %v", err))
+		return root, err
+	}
+	// If the UTXO snapshot is enabled, update it with the UTXOs of this block
+	if s.utxoSnap != nil {
+		if metrics_config.MetricsEnabled() {
+			defer func(start time.Time) {
+				stateMetrics.WithLabelValues("SnapshotUtxoCommits").Add(float64(time.Since(start)))
+			}(time.Now())
+		}
+		// Only update if the UTXO set changed
+		if parent := s.utxoSnap.Root(); parent != root {
+			if err := s.utxoSnaps.Update(root, parent, s.snapUtxos); err != nil {
+				s.logger.WithFields(log.Fields{
+					"root":   root,
+					"parent": parent,
+					"err":    err,
+				}).Error("Failed to update utxo snapshot tree")
+			}
+			if err := s.utxoSnaps.Cap(root, s.utxoSnaps.Depth()); err != nil {
+				s.logger.WithFields(log.Fields{
+					"root":   root,
+					"layers": s.utxoSnaps.Depth(),
+					"err":    err,
+				}).Warn("Failed to cap utxo snapshot tree")
+			}
+		}
+		s.utxoSnap, s.snapUtxos = nil, nil
 	}
 	return root, err
 }
@@ -636,9 +706,10 @@ func (s *StateDB) UTXORoot() common.Hash {
 	return s.utxoTrie.Hash()
 }
 
+// GetUTXOProof returns the Merkle proof for the given outpoint in the UTXO trie.
 func (s *StateDB) GetUTXOProof(hash common.Hash, index uint16) ([][]byte, error) {
 	var proof proofList
-	err := s.utxoTrie.Prove(utxoKey(hash, index), 0, &proof)
+	err := s.utxoTrie.Prove(crypto.Keccak256(types.UtxoKey(hash, index)), 0, &proof)
 	return proof, err
 }
 
@@ -943,6 +1014,7 @@ func (s *StateDB) Copy() *StateDB {
 		preimages:           make(map[common.Hash][]byte, len(s.preimages)),
 		journal:             newJournal(),
 		hasher:              crypto.NewKeccakState(),
+		logger:              s.logger,
 	}
 	// Copy the dirty states, logs, and preimages
 	for addr := range s.journal.dirties {
@@ -1023,6 +1095,14 @@ func (s *StateDB) Copy() *StateDB {
 			state.snapStorage[k] = temp
 		}
 	}
+	if s.utxoSnaps != nil {
+		state.utxoSnaps = s.utxoSnaps
+		state.utxoSnap = s.utxoSnap
+		state.snapUtxos = make(map[common.Hash][]byte, len(s.snapUtxos))
+		for k, v := range s.snapUtxos {
+			state.snapUtxos[k] = v
+		}
+	}
 	return state
 }
 
@@ -1316,10 +1396,3 @@ func (s *StateDB) AddressInAccessList(addr common.Address) bool {
 func (s *StateDB) SlotInAccessList(addr common.Address, slot common.Hash) (addressPresent bool, slotPresent bool) {
 	return s.accessList.Contains(addr.Bytes20(), slot)
 }
-
-// This can be optimized via VLQ encoding as btcd has done
-func utxoKey(hash common.Hash, index uint16) []byte {
-	indexBytes := make([]byte, 2)
-	binary.BigEndian.PutUint16(indexBytes, index)
-	return append(indexBytes, hash.Bytes()...)
-}
@@ -17,6 +17,7 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/big"
@@ -40,6 +41,7 @@ import (
 	"github.com/dominant-strategies/go-quai/ethdb"
 	"github.com/dominant-strategies/go-quai/event"
 	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/metrics_config"
 	"github.com/dominant-strategies/go-quai/params"
 	"github.com/dominant-strategies/go-quai/trie"
 )
@@ -88,6 +90,7 @@ type CacheConfig struct {
 	TrieTimeLimit        time.Duration // Time limit after which to flush the current in-memory trie to disk
 	SnapshotLimit        int           // Memory allowance (MB) to use for caching snapshot entries in memory
 	Preimages            bool          // Whether to store preimage of trie key to the disk
+	HistoryLimit         uint64        // Number of recent blocks to keep the bodies and receipts of (0 = entire chain)
 }
 
 // defaultCacheConfig are the default caching values if none are specified by the
@@ -124,10 +127,11 @@ type StateProcessor struct {
 	quit          chan struct{}  // state processor quit channel
 	txLookupLimit uint64
 
-	snaps  *snapshot.Tree
-	triegc *prque.Prque  // Priority queue mapping block numbers to tries to gc
-	gcproc time.Duration // Accumulates canonical block processing for trie dumping
-	logger *log.Logger
+	snaps     *snapshot.Tree
+	utxoSnaps *snapshot.UtxoTree
+	triegc    *prque.Prque  // Priority queue mapping block numbers to tries to gc
+	gcproc    time.Duration // Accumulates canonical block processing for trie dumping
+	logger    *log.Logger
 }
 
 // NewStateProcessor initialises a new StateProcessor.
@@ -173,6 +177,7 @@ func NewStateProcessor(config *params.ChainConfig, hc *HeaderChain, engine conse
 		// TODO: If the state is not available, enable snapshot recovery
 		head := hc.CurrentHeader()
 		sp.snaps, _ = snapshot.New(hc.headerDb, sp.stateCache.TrieDB(), sp.cacheConfig.SnapshotLimit, head.EVMRoot(), true, false, sp.logger)
+		sp.utxoSnaps, _ = snapshot.NewUtxoTree(hc.headerDb, sp.utxoCache.TrieDB(), sp.cacheConfig.SnapshotLimit, TriesInMemory, head.UTXORoot(), true, sp.logger)
 	}
 	if txLookupLimit != nil {
 		sp.txLookupLimit = *txLookupLimit
@@ -235,7 +240,7 @@ func (p *StateProcessor) Process(block *types.WorkObject) (types.Receipts, []*ty
 		parentEtxSetRoot = types.EmptyRootHash
 	}
 	// Initialize a statedb
-	statedb, err := state.New(parentEvmRoot, parentUtxoRoot, parentEtxSetRoot, p.stateCache, p.utxoCache, p.etxCache, p.snaps, nodeLocation, p.logger)
+	statedb, err := state.New(parentEvmRoot, parentUtxoRoot, parentEtxSetRoot, p.stateCache, p.utxoCache, p.etxCache, p.snaps, p.utxoSnaps, nodeLocation, p.logger)
 	if err != nil {
 		return types.Receipts{}, []*types.Transaction{}, []*types.Log{}, nil, 0, err
 	}
@@ -1097,7 +1102,7 @@ func CheckDenominations(inputs, outputs map[uint]uint64) error {
 }
 
 // Apply State
-func (p *StateProcessor) Apply(batch ethdb.Batch, block *types.WorkObject) ([]*types.Log, error) {
+func (p *StateProcessor) Apply(ctx context.Context, batch ethdb.Batch, block *types.WorkObject) ([]*types.Log, error) {
 	nodeCtx := p.hc.NodeCtx()
 	start := time.Now()
 	blockHash := block.Hash()
@@ -1112,7 +1117,11 @@ func (p *StateProcessor) Apply(batch ethdb.Batch, block *types.WorkObject) ([]*t
 	time1 := common.PrettyDuration(time.Since(start))
 	time2 := common.PrettyDuration(time.Since(start))
 	// Process our block
+	_, span := metrics_config.StartBlockSpan(ctx, "StateProcessor.Process", block.Hash(), p.hc.NodeLocation().Name())
 	receipts, etxs, logs, statedb, usedGas, err := p.Process(block)
+	span.SetInt("txs", int64(len(block.Transactions())))
+	span.SetInt("gas", int64(usedGas))
+	span.End(err)
 	if err != nil {
 		return nil, err
 	}
@@ -1226,7 +1235,7 @@ func (p *StateProcessor) State() (*state.StateDB, error) {
 
 // StateAt returns a new mutable state based on a particular point in time.
 func (p *StateProcessor) StateAt(root, utxoRoot, etxRoot common.Hash) (*state.StateDB, error) {
-	return state.New(root, utxoRoot, etxRoot, p.stateCache, p.utxoCache, p.etxCache, p.snaps, p.hc.NodeLocation(), p.logger)
+	return state.New(root, utxoRoot, etxRoot, p.stateCache, p.utxoCache, p.etxCache, p.snaps, p.utxoSnaps, p.hc.NodeLocation(), p.logger)
 }
 
 // StateCache returns the caching database underpinning the blockchain instance.
@@ -1253,14 +1262,16 @@ func (p *StateProcessor) HasBlockAndState(hash common.Hash, number uint64) bool
 
 // GetReceiptsByHash retrieves the receipts for all transactions in a given block.
 func (p *StateProcessor) GetReceiptsByHash(hash common.Hash) types.Receipts {
-	if receipts, ok := p.receiptsCache.Get(hash); ok {
+	receipts, ok := p.receiptsCache.Get(hash)
+	recordCacheAccess(p.hc.NodeLocation().Name(), "receipts", ok)
+	if ok {
 		return receipts
 	}
 	number := rawdb.ReadHeaderNumber(p.hc.headerDb, hash)
 	if number == nil {
 		return nil
 	}
-	receipts := rawdb.ReadReceipts(p.hc.headerDb, hash, *number, p.hc.config)
+	receipts = rawdb.ReadReceipts(p.hc.headerDb, hash, *number, p.hc.config)
 	if receipts == nil {
 		return nil
 	}
@@ -1272,16 +1283,18 @@ func (p *StateProcessor) GetReceiptsByHash(hash common.Hash) types.Receipts {
 // hash from the cache or database.
 func (p *StateProcessor) GetTransactionLookup(hash common.Hash) *rawdb.LegacyTxLookupEntry {
 	// Short circuit if the txlookup already in the cache, retrieve otherwise
-	if lookup, exist := p.txLookupCache.Get(hash); exist {
+	lookup, exist := p.txLookupCache.Get(hash)
+	recordCacheAccess(p.hc.NodeLocation().Name(), "txLookup", exist)
+	if exist {
 		return &lookup
 	}
 	tx, blockHash, blockNumber, txIndex := rawdb.ReadTransaction(p.hc.headerDb, hash)
 	if tx == nil {
 		return nil
 	}
-	lookup := &rawdb.LegacyTxLookupEntry{BlockHash: blockHash, BlockIndex: blockNumber, Index: txIndex}
-	p.txLookupCache.Add(hash, *lookup)
-	return lookup
+	lookup = rawdb.LegacyTxLookupEntry{BlockHash: blockHash, BlockIndex: blockNumber, Index: txIndex}
+	p.txLookupCache.Add(hash, lookup)
+	return &lookup
 }
 
 // ContractCode retrieves a blob of data associated with a contract hash
@@ -1362,7 +1375,7 @@ func (p *StateProcessor) StateAtBlock(block *types.WorkObject, reexec uint64, ba
 		// we would rewind past a persisted block (specific corner case is chain
 		// tracing from the genesis).
 		if !checkLive {
-			statedb, err = state.New(current.EVMRoot(), current.UTXORoot(), current.EtxSetRoot(), database, utxoDatabase, etxDatabase, nil, nodeLocation, p.logger)
+			statedb, err = state.New(current.EVMRoot(), current.UTXORoot(), current.EtxSetRoot(), database, utxoDatabase, etxDatabase, nil, nil, nodeLocation, p.logger)
 			if err == nil {
 				return statedb, nil
 			}
@@ -1379,7 +1392,7 @@ func (p *StateProcessor) StateAtBlock(block *types.WorkObject, reexec uint64, ba
 			}
 			current = types.CopyWorkObject(parent)
 
-			statedb, err = state.New(current.EVMRoot(), current.UTXORoot(), current.EtxSetRoot(), database, utxoDatabase, etxDatabase, nil, nodeLocation, p.logger)
+			statedb, err = state.New(current.EVMRoot(), current.UTXORoot(), current.EtxSetRoot(), database, utxoDatabase, etxDatabase, nil, nil, nodeLocation, p.logger)
 			if err == nil {
 				break
 			}
@@ -1436,7 +1449,7 @@ func (p *StateProcessor) StateAtBlock(block *types.WorkObject, reexec uint64, ba
 			return nil, fmt.Errorf("stateAtBlock commit failed, number %d root %v: %w",
 				current.NumberU64(nodeCtx), current.EVMRoot().Hex(), err)
 		}
-		statedb, err = state.New(root, utxoRoot, etxRoot, database, utxoDatabase, etxDatabase, nil, nodeLocation, p.logger)
+		statedb, err = state.New(root, utxoRoot, etxRoot, database, utxoDatabase, etxDatabase, nil, nil, nodeLocation, p.logger)
 		if err != nil {
 			return nil, fmt.Errorf("state reset after block %d failed: %v", current.NumberU64(nodeCtx), err)
 		}
@@ -1519,6 +1532,13 @@ func (p *StateProcessor) Stop() {
 		etxTrieDB := p.etxCache.TrieDB()
 		etxTrieDB.SaveCache(p.cacheConfig.ETXTrieCleanJournal)
 	}
+	// Persist the UTXO diff layers so the UTXO snapshot is not regenerated on
+	// the next start
+	if p.utxoSnaps != nil {
+		if _, err := p.utxoSnaps.Journal(p.hc.CurrentHeader().UTXORoot()); err != nil {
+			p.logger.WithField("err", err).Warn("Failed to journal utxo snapshot")
+		}
+	}
 	close(p.quit)
 	p.logger.Info("State Processor stopped")
 }
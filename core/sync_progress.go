@@ -0,0 +1,157 @@
+package core
+
+import (
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/event"
+	"github.com/dominant-strategies/go-quai/log"
+)
+
+const (
+	c_syncProgressPeriod = 5 * time.Second // Time between two updates of the sync progress
+	c_syncLagThreshold   = 2               // Number of blocks behind the highest known block before the slice reports syncing
+	c_syncRateSmoothing  = 0.3             // Weight of the last period in the moving average of the append rate
+)
+
+// Stages of the sync reported in the sync progress
+const (
+	SyncStageDownload = "download" // the blocks ahead of the head are requested from the peers
+	SyncStageAppend   = "append"   // blocks received from the peers are waiting in the append queue
+	SyncStageState    = "state"    // the head is appended but its state is not processed yet
+)
+
+// SyncProgress is the sync status of a slice
+type SyncProgress struct {
+	Location        string         `json:"location"`
+	Syncing         bool           `json:"syncing"`
+	Stage           string         `json:"stage,omitempty"`
+	CurrentBlock    hexutil.Uint64 `json:"currentBlock"`
+	HighestBlock    hexutil.Uint64 `json:"highestBlock"`
+	AppendQueue     hexutil.Uint64 `json:"appendQueue"`
+	BlocksPerSecond float64        `json:"blocksPerSecond"`
+	EstimatedTime   hexutil.Uint64 `json:"estimatedTime"` // seconds until the highest block is reached at the current rate
+}
+
+// SyncEvent is posted each time the sync progress of a syncing slice is
+// updated, and once more when the slice is synced.
+type SyncEvent struct {
+	Progress SyncProgress
+}
+
+// syncTracker follows the head of the slice against the highest block
+// announced by the peers to estimate the progress of the sync.
+type syncTracker struct {
+	highestKnown atomic.Uint64
+	progress     atomic.Pointer[SyncProgress]
+	lastNumber   uint64
+	rate         float64
+	feed         event.Feed
+}
+
+// RecordKnownBlock raises the highest block known from the peers, e.g. the
+// number of a block or workshare they announced
+func (c *Core) RecordKnownBlock(number uint64) {
+	for {
+		highest := c.sync.highestKnown.Load()
+		if number <= highest || c.sync.highestKnown.CompareAndSwap(highest, number) {
+			return
+		}
+	}
+}
+
+// SyncProgress returns the last computed sync progress of the slice
+func (c *Core) SyncProgress() SyncProgress {
+	if progress := c.sync.progress.Load(); progress != nil {
+		return *progress
+	}
+	return c.computeSyncProgress(0)
+}
+
+// SubscribeSyncEvent registers a subscription of SyncEvent.
+func (c *Core) SubscribeSyncEvent(ch chan<- SyncEvent) event.Subscription {
+	return c.sync.feed.Subscribe(ch)
+}
+
+// computeSyncProgress builds the sync progress of the slice given the
+// blocks appended per second
+func (c *Core) computeSyncProgress(rate float64) SyncProgress {
+	nodeCtx := c.NodeCtx()
+	head := c.CurrentHeader()
+	current := head.NumberU64(nodeCtx)
+	highest := c.sync.highestKnown.Load()
+	if highest < current {
+		highest = current
+	}
+	progress := SyncProgress{
+		Location:        c.NodeLocation().Name(),
+		Syncing:         highest > current+c_syncLagThreshold,
+		CurrentBlock:    hexutil.Uint64(current),
+		HighestBlock:    hexutil.Uint64(highest),
+		AppendQueue:     hexutil.Uint64(c.appendQueue.Len()),
+		BlocksPerSecond: rate,
+	}
+	if !progress.Syncing {
+		return progress
+	}
+	if rate > 0 {
+		progress.EstimatedTime = hexutil.Uint64(float64(highest-current) / rate)
+	}
+	switch {
+	case nodeCtx == common.ZONE_CTX && c.ProcessingState() && !rawdb.ReadProcessedState(c.sl.sliceDb, head.Hash()):
+		// The head moved onto a branch appended without its state, which
+		// is processed before the slice appends further
+		progress.Stage = SyncStageState
+	case progress.AppendQueue > 0:
+		progress.Stage = SyncStageAppend
+	default:
+		progress.Stage = SyncStageDownload
+	}
+	return progress
+}
+
+// updateSyncProgress measures the append rate since the last update and
+// posts the new progress while the slice is syncing.
+func (c *Core) updateSyncProgress() {
+	current := c.CurrentHeader().NumberU64(c.NodeCtx())
+	var appended uint64
+	if current > c.sync.lastNumber {
+		appended = current - c.sync.lastNumber
+	}
+	c.sync.lastNumber = current
+	rate := float64(appended) / c_syncProgressPeriod.Seconds()
+	c.sync.rate = c_syncRateSmoothing*rate + (1-c_syncRateSmoothing)*c.sync.rate
+
+	progress := c.computeSyncProgress(c.sync.rate)
+	previous := c.sync.progress.Swap(&progress)
+	if progress.Syncing || (previous != nil && previous.Syncing) {
+		c.sync.feed.Send(SyncEvent{Progress: progress})
+	}
+}
+
+// startSyncTracker updates the sync progress every c_syncProgressPeriod
+func (c *Core) startSyncTracker() {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.WithFields(log.Fields{
+				"error":      r,
+				"stacktrace": string(debug.Stack()),
+			}).Fatal("Go-Quai Panicked")
+		}
+	}()
+	c.sync.lastNumber = c.CurrentHeader().NumberU64(c.NodeCtx())
+	ticker := time.NewTicker(c_syncProgressPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.updateSyncProgress()
+		case <-c.quit:
+			return
+		}
+	}
+}
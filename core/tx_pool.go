@@ -1119,6 +1119,7 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 		errs = append(errs, qiErrs...)
 	}
 	if len(news) == 0 {
+		recordTxpoolRejections(pool.chainconfig.Location.Name(), errs)
 		return errs
 	}
 
@@ -1135,6 +1136,7 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 		errs[nilSlot] = err
 		nilSlot++
 	}
+	recordTxpoolRejections(pool.chainconfig.Location.Name(), errs)
 	// Reorg the pool internals if needed and return
 	pool.requestPromoteExecutables(dirtyAddrs)
 	return errs
@@ -1552,7 +1554,15 @@ func (pool *TxPool) runReorg(done chan struct{}, cancel chan struct{}, reset *tx
 				highestPending := list.LastElement()
 				pool.pendingNonces.set(addr, highestPending.Nonce()+1)
 			}
+			pending, queued := pool.stats()
 			pool.mu.Unlock()
+			pool.qiMu.RLock()
+			qi := len(pool.qiPool)
+			pool.qiMu.RUnlock()
+			location := pool.chainconfig.Location.Name()
+			txpoolSizeMetrics.WithLabelValues(location, "pending").Set(float64(pending))
+			txpoolSizeMetrics.WithLabelValues(location, "queued").Set(float64(queued))
+			txpoolSizeMetrics.WithLabelValues(location, "qi").Set(float64(qi))
 
 			// Notify subsystems for newly added transactions
 			for _, tx := range promoted {
@@ -0,0 +1,23 @@
+package types
+
+import (
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+)
+
+// Reorg describes a switch of the canonical head onto a competing branch that
+// POEM chose for carrying more entropy.
+type Reorg struct {
+	OldHead        common.Hash    `json:"oldHead"`
+	NewHead        common.Hash    `json:"newHead"`
+	CommonAncestor common.Hash    `json:"commonAncestor"`
+	Number         hexutil.Uint64 `json:"number"` // number of the common ancestor
+	Depth          hexutil.Uint64 `json:"depth"`  // number of blocks removed from the canonical chain
+	Removed        []common.Hash  `json:"removed"`
+	Added          []common.Hash  `json:"added"`
+	// OldEntropy and NewEntropy are the log-entropy accumulated by the old and
+	// new branches on top of the common ancestor
+	OldEntropy *hexutil.Big   `json:"oldEntropy"`
+	NewEntropy *hexutil.Big   `json:"newEntropy"`
+	Time       hexutil.Uint64 `json:"time"`
+}
@@ -568,6 +568,9 @@ func (tx *Transaction) TxOut() TxOuts { return tx.inner.txOut() }
 
 func (tx *Transaction) TxIn() TxIns { return tx.inner.txIn() }
 
+// Time returns the time the transaction was first seen locally.
+func (tx *Transaction) Time() time.Time { return tx.time }
+
 func (tx *Transaction) GetSchnorrSignature() *schnorr.Signature {
 	return tx.inner.getSchnorrSignature()
 }
@@ -918,6 +921,13 @@ func NewTxWithMinerFee(tx *Transaction, baseFee *big.Int, qiTxFee *big.Int) (*Tx
 	}, nil
 }
 
+// Tx returns the wrapped transaction.
+func (t *TxWithMinerFee) Tx() *Transaction { return t.tx }
+
+// MinerFee returns the effective miner gasTipCap of a Quai transaction, or the
+// total fee left to the miner by a Qi transaction.
+func (t *TxWithMinerFee) MinerFee() *big.Int { return t.minerFee }
+
 // TxByPriceAndTime implements both the sort and the heap interface, making it useful
 // for all at once sorting as well as individually adding and removing elements.
 type TxByPriceAndTime []*TxWithMinerFee
@@ -155,6 +155,14 @@ func (outPoint *OutpointAndDenomination) ProtoDecode(protoOutPoint *ProtoOutPoin
 	return nil
 }
 
+// UtxoKey returns the key of the outpoint in the UTXO trie
+// This can be optimized via VLQ encoding as btcd has done
+func UtxoKey(hash common.Hash, index uint16) []byte {
+	indexBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(indexBytes, index)
+	return append(indexBytes, hash.Bytes()...)
+}
+
 // NewOutPoint returns a new Qi transaction outpoint point with the
 // provided hash and index.
 func NewOutPoint(txHash *common.Hash, index uint16) *OutPoint {
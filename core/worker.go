@@ -176,6 +176,8 @@ type Config struct {
 	GasPrice   *big.Int       // Minimum gas price for mining a transaction
 	Recommit   time.Duration  // The time interval for miner to re-create mining work.
 	Noverify   bool           // Disable remote mining solution verification(only useful in ethash).
+
+	BlockBuilder string // Strategy choosing and ordering the transactions of pending blocks
 }
 
 // worker is the main object which takes care of submitting new work to consensus engine
@@ -187,6 +189,7 @@ type worker struct {
 	hc           *HeaderChain
 	txPool       *TxPool
 	ephemeralKey *secp256k1.PrivateKey
+	builder      BlockBuilder
 	// Feeds
 	pendingLogsFeed   event.Feed
 	pendingHeaderFeed event.Feed
@@ -292,6 +295,15 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, db ethdb.Databas
 		fillTransactionsRollingAverage: &RollingAverage{windowSize: 100},
 		logger:                         logger,
 	}
+	builder, err := NewBlockBuilder(config.BlockBuilder, headerchain.NodeLocation())
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"err":      err,
+			"fallback": DefaultBlockBuilder,
+		}).Warn("Invalid block builder")
+		builder, _ = NewBlockBuilder(DefaultBlockBuilder, headerchain.NodeLocation())
+	}
+	worker.builder = builder
 	// initialize a uncle cache
 	worker.Uncles, _ = lru.New[common.Hash, types.WorkObjectHeader](c_uncleCacheSize)
 	// Set the GasFloor of the worker to the minGasLimit
@@ -596,6 +608,7 @@ func (w *worker) GeneratePendingHeader(block *types.WorkObject, fill bool) (*typ
 
 	work.wo = newWo
 
+	pendingHeaderTimeMetrics.WithLabelValues(w.hc.NodeLocation().Name()).Observe(time.Since(start).Seconds())
 	w.printPendingHeaderInfo(work, newWo, start)
 
 	return newWo, nil
@@ -811,19 +824,14 @@ func (w *worker) commitTransaction(env *environment, parent *types.WorkObject, t
 	return nil, errors.New("error finding transaction")
 }
 
-func (w *worker) commitTransactions(env *environment, parent *types.WorkObject, txs *types.TransactionsByPriceAndNonce, interrupt *int32) bool {
+func (w *worker) commitTransactions(env *environment, parent *types.WorkObject, etxs EtxSet, txs TransactionSet, interrupt *int32) bool {
 	qiTxsToRemove := make([]*common.Hash, 0)
 	gasLimit := env.wo.GasLimit
 	if env.gasPool == nil {
 		env.gasPool = new(types.GasPool).AddGas(gasLimit())
 	}
 	var coalescedLogs []*types.Log
-	minEtxGas := gasLimit() / params.MinimumEtxGasDivisor
-	oldestIndex, err := env.state.GetOldestIndex()
-	if err != nil {
-		w.logger.WithField("err", err).Error("Failed to get oldest index")
-		return true
-	}
+	_, maxEtxGas := etxGasRange(gasLimit())
 	for {
 		if interrupt != nil && atomic.LoadInt32(interrupt) != commitInterruptNone {
 			return atomic.LoadInt32(interrupt) == commitInterruptNewHead
@@ -835,15 +843,12 @@ func (w *worker) commitTransactions(env *environment, parent *types.WorkObject,
 			}).Trace("Not enough gas for further transactions")
 			break
 		}
-		// Add ETXs until minimum gas is used
-		if env.wo.GasUsed() >= minEtxGas {
-			break
-		}
-		if env.wo.GasUsed() > minEtxGas*params.MaximumEtxGasMultiplier { // sanity check, this should never happen
+		if env.wo.GasUsed() > maxEtxGas { // sanity check, this should never happen
 			w.logger.WithField("Gas Used", env.wo.GasUsed()).Error("Block uses more gas than maximum ETX gas")
 			return true
 		}
-		etx, err := env.state.PopETX()
+		// Add ETXs until the block builder includes no more
+		etx, err := etxs.Next(env.wo.GasUsed())
 		if err != nil {
 			w.logger.WithField("err", err).Error("Failed to read ETX")
 			return true
@@ -857,7 +862,6 @@ func (w *worker) commitTransactions(env *environment, parent *types.WorkObject,
 			coalescedLogs = append(coalescedLogs, logs...)
 			env.tcount++
 		}
-		oldestIndex.Add(oldestIndex, big.NewInt(1))
 	}
 	for {
 		// In the following three cases, we will interrupt the execution of the transaction.
@@ -1259,8 +1263,7 @@ func (w *worker) prepareWork(genParams *generateParams, wo *types.WorkObject) (*
 }
 
 // fillTransactions retrieves the pending transactions from the txpool and fills them
-// into the given sealing block. The transaction selection and ordering strategy can
-// be customized with the plugin in the future.
+// into the given sealing block, in the order chosen by the configured block builder.
 func (w *worker) fillTransactions(interrupt *int32, env *environment, block *types.WorkObject, fill bool) bool {
 	// Split the pending transactions into locals and remotes
 	// Fill the block with all available pending transactions.
@@ -1293,7 +1296,7 @@ func (w *worker) fillTransactions(interrupt *int32, env *environment, block *typ
 
 	if !fill {
 		if etxs {
-			return w.commitTransactions(env, block, &types.TransactionsByPriceAndNonce{}, interrupt)
+			return w.commitTransactions(env, block, w.builder.Etxs(env.state, env.wo.GasLimit(), 0), &types.TransactionsByPriceAndNonce{}, interrupt)
 		}
 		return false
 	}
@@ -1307,15 +1310,16 @@ func (w *worker) fillTransactions(interrupt *int32, env *environment, block *typ
 	pendingQiTxs := w.txPool.QiPoolPending()
 
 	if len(pending) > 0 || len(pendingQiTxs) > 0 || etxs {
-		txs := types.NewTransactionsByPriceAndNonce(env.signer, pendingQiTxs, pending, env.wo.BaseFee(), true)
-		return w.commitTransactions(env, block, txs, interrupt)
+		pendingGas := pendingTransactionsGas(pendingQiTxs, pending, w.hc.NodeLocation())
+		etxSet := w.builder.Etxs(env.state, env.wo.GasLimit(), pendingGas)
+		txs := w.builder.Transactions(env.signer, block, env.wo.BaseFee(), pendingQiTxs, pending)
+		return w.commitTransactions(env, block, etxSet, txs, interrupt)
 	}
 	return false
 }
 
-// fillTransactions retrieves the pending transactions from the txpool and fills them
-// into the given sealing block. The transaction selection and ordering strategy can
-// be customized with the plugin in the future.
+// adjustGasLimit sets the gas limit of the pending block from the parent and the
+// configured gas ceiling.
 func (w *worker) adjustGasLimit(env *environment, parent *types.WorkObject) {
 	env.wo.Header().SetGasLimit(CalcGasLimit(parent, w.config.GasCeil))
 }
@@ -100,7 +100,7 @@ type AncientReader interface {
 type AncientWriter interface {
 	// AppendAncient injects all binary blobs belong to block at the end of the
 	// append-only immutable table files.
-	AppendAncient(number uint64, hash, header, body, receipt, etxSet []byte) error
+	AppendAncient(number uint64, hash, header, body, receipt, etxSet, manifest, termini, pendingEtxsRollup, interlinkHashes []byte) error
 
 	// TruncateAncients discards all but the first n ancient data from the ancient store.
 	TruncateAncients(n uint64) error
@@ -1429,6 +1429,9 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 // GetTransactionReceipt returns the transaction receipt for the given transaction hash.
 func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
 	tx, blockHash, blockNumber, index, err := s.b.GetTransaction(ctx, hash)
+	if errors.Is(err, core.ErrHistoryPruned) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, nil
 	}
@@ -1445,16 +1448,127 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 			receipt = r
 		}
 	}
+	// Assign the effective gas price paid
+	header, err := s.b.HeaderByHash(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	signer := types.MakeSigner(s.b.ChainConfig(), new(big.Int).SetUint64(blockNumber))
+	return marshalReceipt(receipt, tx, blockHash, blockNumber, index, header.BaseFee(), signer), nil
+}
+
+// GetBlockReceipts returns the receipts of all the transactions of the given
+// block, in the order of the block. The Qi transactions and the Qi bound etxs
+// are not executed and have no stored receipt, so their entries only report
+// the inclusion, the gas they were charged and the etxs they emitted.
+func (s *PublicTransactionPoolAPI) GetBlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]map[string]interface{}, error) {
+	block, err := s.b.BlockByNumberOrHash(ctx, blockNrOrHash)
+	if block == nil || err != nil {
+		return nil, err
+	}
+	nodeCtx := s.b.NodeCtx()
+	blockHash, blockNumber := block.Hash(), block.NumberU64(nodeCtx)
+	receipts, err := s.b.GetReceipts(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	byHash := make(map[common.Hash]*types.Receipt, len(receipts))
+	for _, receipt := range receipts {
+		byHash[receipt.TxHash] = receipt
+	}
+	emitted := make(map[common.Hash]types.Transactions)
+	for _, etx := range block.ExtTransactions() {
+		emitted[etx.OriginatingTxHash()] = append(emitted[etx.OriginatingTxHash()], etx)
+	}
+	signer := types.MakeSigner(s.b.ChainConfig(), new(big.Int).SetUint64(blockNumber))
+	var (
+		txs               = block.Transactions()
+		result            = make([]map[string]interface{}, 0, len(txs))
+		cumulativeGasUsed uint64
+	)
+	for i, tx := range txs {
+		if receipt, ok := byHash[tx.Hash()]; ok {
+			cumulativeGasUsed = receipt.CumulativeGasUsed
+			result = append(result, marshalReceipt(receipt, tx, blockHash, blockNumber, uint64(i), block.BaseFee(), signer))
+			continue
+		}
+		fields := map[string]interface{}{
+			"blockHash":        blockHash,
+			"blockNumber":      hexutil.Uint64(blockNumber),
+			"transactionHash":  tx.Hash(),
+			"transactionIndex": hexutil.Uint64(i),
+			"to":               nil,
+			"logs":             []*types.Log{},
+			"etxs":             types.Transactions{},
+			"logsBloom":        types.Bloom{},
+			"status":           hexutil.Uint(types.ReceiptStatusSuccessful),
+			"type":             hexutil.Uint(tx.Type()),
+		}
+		var gasUsed uint64
+		switch tx.Type() {
+		case types.QiTxType:
+			gasUsed = types.CalculateBlockQiTxGas(tx, s.b.NodeLocation())
+			if etxs, ok := emitted[tx.Hash()]; ok {
+				fields["etxs"] = etxs
+			}
+		case types.ExternalTxType:
+			from, _ := types.Sender(signer, tx)
+			fields["from"] = from
+			fields["to"] = tx.To()
+			fields["originatingTxHash"] = tx.OriginatingTxHash()
+			gasUsed = params.CallValueTransferGas
+			if tx.ETXSender().Location().Equal(*tx.To().Location()) {
+				primeTerminus, err := s.b.HeaderByHash(ctx, block.PrimeTerminus())
+				if err != nil {
+					return nil, err
+				}
+				if primeTerminus == nil {
+					return nil, fmt.Errorf("prime terminus %x not found", block.PrimeTerminus())
+				}
+				gasUsed = conversionGas(primeTerminus, tx)
+			}
+		}
+		cumulativeGasUsed += gasUsed
+		fields["gasUsed"] = hexutil.Uint64(gasUsed)
+		fields["cumulativeGasUsed"] = hexutil.Uint64(cumulativeGasUsed)
+		result = append(result, fields)
+	}
+	return result, nil
+}
 
+// conversionGas returns the gas charged by the state processor for the
+// conversion of the etx to Qi, one value transfer for each output created at
+// the exchange rate of the prime terminus.
+func conversionGas(primeTerminus *types.WorkObject, etx *types.Transaction) uint64 {
+	var (
+		denominations = misc.FindMinDenominations(misc.QuaiToQi(primeTerminus, etx.Value()))
+		txGas         = etx.Gas()
+		gasUsed       uint64
+		outputs       int
+	)
+	for denomination := types.MaxDenomination; denomination >= 0; denomination-- {
+		for j := uint8(0); j < denominations[uint8(denomination)]; j++ {
+			if txGas < params.CallValueTransferGas || outputs >= types.MaxOutputIndex {
+				return gasUsed
+			}
+			txGas -= params.CallValueTransferGas
+			gasUsed += params.CallValueTransferGas
+			outputs++
+		}
+	}
+	return gasUsed
+}
+
+// marshalReceipt returns the RPC representation of the receipt of a Quai
+// transaction or etx included at the given index of a block.
+func marshalReceipt(receipt *types.Receipt, tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64, baseFee *big.Int, signer types.Signer) map[string]interface{} {
 	// Derive the sender.
-	bigblock := new(big.Int).SetUint64(blockNumber)
-	signer := types.MakeSigner(s.b.ChainConfig(), bigblock)
 	from, _ := types.Sender(signer, tx)
 
 	fields := map[string]interface{}{
 		"blockHash":         blockHash,
 		"blockNumber":       hexutil.Uint64(blockNumber),
-		"transactionHash":   hash,
+		"transactionHash":   tx.Hash(),
 		"transactionIndex":  hexutil.Uint64(index),
 		"from":              from,
 		"to":                tx.To(),
@@ -1467,11 +1581,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 		"type":              hexutil.Uint(tx.Type()),
 	}
 	// Assign the effective gas price paid
-	header, err := s.b.HeaderByHash(ctx, blockHash)
-	if err != nil {
-		return nil, err
-	}
-	gasPrice := new(big.Int).Add(header.BaseFee(), tx.EffectiveGasTipValue(header.BaseFee()))
+	gasPrice := new(big.Int).Add(baseFee, tx.EffectiveGasTipValue(baseFee))
 	fields["effectiveGasPrice"] = hexutil.Uint64(gasPrice.Uint64())
 
 	// Assign receipt status or post state.
@@ -1487,7 +1597,10 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	if !receipt.ContractAddress.Equal(common.Zero) && !receipt.ContractAddress.Equal(common.Address{}) {
 		fields["contractAddress"] = receipt.ContractAddress
 	}
-	return fields, nil
+	if tx.Type() == types.ExternalTxType {
+		fields["originatingTxHash"] = tx.OriginatingTxHash()
+	}
+	return fields
 }
 
 // SubmitTransaction is a helper function that submits tx to txPool and logs a message.
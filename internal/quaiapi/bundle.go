@@ -0,0 +1,231 @@
+package quaiapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/common/math"
+	"github.com/dominant-strategies/go-quai/core"
+	"github.com/dominant-strategies/go-quai/core/state"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/core/vm"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/rpc"
+)
+
+// BundleCall is a single entry of a simulated bundle, either a call described
+// by the transaction fields or a signed raw transaction.
+type BundleCall struct {
+	TransactionArgs
+	Raw *hexutil.Bytes `json:"raw"`
+}
+
+// BlockOverrides is the set of block context fields a bundle is simulated with
+// instead of the ones of the block it runs on top of.
+type BlockOverrides struct {
+	Number   *hexutil.Big    `json:"number"`
+	Time     *hexutil.Uint64 `json:"timestamp"`
+	BaseFee  *hexutil.Big    `json:"baseFee"`
+	Coinbase *common.Address `json:"coinbase"`
+}
+
+// Apply overrides the fields of the given block context.
+func (o *BlockOverrides) Apply(blockCtx *vm.BlockContext) {
+	if o == nil {
+		return
+	}
+	if o.Number != nil {
+		blockCtx.BlockNumber = new(big.Int).Set(o.Number.ToInt())
+	}
+	if o.Time != nil {
+		blockCtx.Time = new(big.Int).SetUint64(uint64(*o.Time))
+	}
+	if o.BaseFee != nil {
+		blockCtx.BaseFee = new(big.Int).Set(o.BaseFee.ToInt())
+	}
+	if o.Coinbase != nil {
+		blockCtx.Coinbase = *o.Coinbase
+	}
+}
+
+// BundleCallResult is the outcome of a single entry of a simulated bundle.
+type BundleCallResult struct {
+	TxHash     *common.Hash      `json:"txHash,omitempty"`
+	ReturnData hexutil.Bytes     `json:"returnData"`
+	Logs       []*types.Log      `json:"logs"`
+	GasUsed    hexutil.Uint64    `json:"gasUsed"`
+	Error      string            `json:"error,omitempty"`
+	Revert     hexutil.Bytes     `json:"revert,omitempty"`
+	Etxs       []*RPCTransaction `json:"etxs"`
+}
+
+// DoCallBundle applies the calls in order on top of the state of the given
+// block, each call seeing the changes of the ones before it. A call reverting
+// is reported in its result, while a call that can't be applied at all fails
+// the whole bundle.
+func DoCallBundle(ctx context.Context, b Backend, calls []BundleCall, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides, timeout time.Duration, globalGasCap uint64) ([]*BundleCallResult, error) {
+	defer func(start time.Time) {
+		b.Logger().WithFields(log.Fields{
+			"calls":   len(calls),
+			"runtime": time.Since(start),
+		}).Debug("Executing EVM call bundle finished")
+	}(time.Now())
+	nodeCtx := b.NodeCtx()
+	if nodeCtx != common.ZONE_CTX {
+		return nil, errors.New("doCallBundle can only be called in zone chain")
+	}
+	if !b.ProcessingState() {
+		return nil, errors.New("doCallBundle call can only be made on chain processing the state")
+	}
+	if len(calls) == 0 {
+		return nil, errors.New("bundle is empty")
+	}
+	nodeLocation := b.NodeLocation()
+	if blockOverrides != nil && blockOverrides.Coinbase != nil {
+		coinbase := common.BytesToAddress(blockOverrides.Coinbase.Bytes(), nodeLocation)
+		blockOverrides.Coinbase = &coinbase
+	}
+	state, header, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	if err := overrides.Apply(state, nodeLocation); err != nil {
+		return nil, err
+	}
+	baseFee := header.BaseFee()
+	if blockOverrides != nil && blockOverrides.BaseFee != nil {
+		baseFee = blockOverrides.BaseFee.ToInt()
+	}
+	// The whole bundle shares the timeout of a single call
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	gp := new(types.GasPool).AddGas(math.MaxUint64)
+	results := make([]*BundleCallResult, 0, len(calls))
+	for i, call := range calls {
+		msg, txHash, err := bundleCallMessage(b, state, call, header, baseFee, globalGasCap)
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %w", i, err)
+		}
+		state.Prepare(txHash, i)
+		logsBefore := len(state.GetLogs(txHash, common.Hash{}))
+
+		evm, vmError, err := b.GetEVM(ctx, msg, state, header, &vm.Config{NoBaseFee: true})
+		if err != nil {
+			return nil, err
+		}
+		blockOverrides.Apply(&evm.Context)
+		done := make(chan struct{})
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					b.Logger().WithFields(log.Fields{
+						"error":      r,
+						"stacktrace": string(debug.Stack()),
+					}).Error("Go-Quai Panicked")
+				}
+			}()
+			select {
+			case <-ctx.Done():
+				evm.Cancel()
+			case <-done:
+			}
+		}()
+		result, err := core.ApplyMessage(evm, msg, gp)
+		close(done)
+		if err := vmError(); err != nil {
+			return nil, err
+		}
+		if evm.Cancelled() {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %w (supplied gas %d)", i, err, msg.Gas())
+		}
+		// Finalise the call as block processing does, so that its refund and
+		// journal don't carry over to the next call
+		state.Finalise(true)
+
+		res := &BundleCallResult{
+			ReturnData: result.Return(),
+			Logs:       state.GetLogs(txHash, common.Hash{})[logsBefore:],
+			GasUsed:    hexutil.Uint64(result.UsedGas),
+			Etxs:       make([]*RPCTransaction, 0, len(result.Etxs)),
+		}
+		if txHash != (common.Hash{}) {
+			res.TxHash = &txHash
+		}
+		if result.Err != nil {
+			res.Error = result.Err.Error()
+			if len(result.Revert()) > 0 {
+				res.Error = newRevertError(result, nodeLocation).Error()
+				res.Revert = result.Revert()
+			}
+		}
+		for _, etx := range result.Etxs {
+			res.Etxs = append(res.Etxs, newRPCTransaction(etx, common.Hash{}, 0, 0, baseFee, nodeLocation))
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// bundleCallMessage turns an entry of a bundle into the message to apply,
+// returning the hash of the transaction for the raw entries.
+func bundleCallMessage(b Backend, state *state.StateDB, call BundleCall, header *types.WorkObject, baseFee *big.Int, globalGasCap uint64) (types.Message, common.Hash, error) {
+	nodeLocation := b.NodeLocation()
+	if call.Raw != nil {
+		protoTransaction := new(types.ProtoTransaction)
+		if err := proto.Unmarshal(*call.Raw, protoTransaction); err != nil {
+			return types.Message{}, common.Hash{}, err
+		}
+		tx := new(types.Transaction)
+		if err := tx.ProtoDecode(protoTransaction, nodeLocation); err != nil {
+			return types.Message{}, common.Hash{}, err
+		}
+		if tx.Type() != types.QuaiTxType {
+			return types.Message{}, common.Hash{}, fmt.Errorf("transaction %s is not a Quai transaction", tx.Hash().Hex())
+		}
+		msg, err := tx.AsMessage(types.MakeSigner(b.ChainConfig(), header.Number(b.NodeCtx())), baseFee)
+		if err != nil {
+			return types.Message{}, common.Hash{}, err
+		}
+		return msg, tx.Hash(), nil
+	}
+	args := call.TransactionArgs
+	// Reset to and from in case of type unmarshal error
+	if args.To != nil {
+		to := common.BytesToAddress(args.To.Bytes(), nodeLocation)
+		args.To = &to
+	}
+	if args.From != nil {
+		from := common.BytesToAddress(args.From.Bytes(), nodeLocation)
+		args.From = &from
+	}
+	if args.Nonce == nil {
+		internal, err := args.from(nodeLocation).InternalAndQuaiAddress()
+		if err != nil {
+			return types.Message{}, common.Hash{}, err
+		}
+		nonce := state.GetNonce(internal)
+		args.Nonce = (*hexutil.Uint64)(&nonce)
+	}
+	msg, err := args.ToMessage(globalGasCap, baseFee, nodeLocation)
+	if err != nil {
+		return types.Message{}, common.Hash{}, err
+	}
+	return msg, common.Hash{}, nil
+}
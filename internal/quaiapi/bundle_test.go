@@ -0,0 +1,141 @@
+package quaiapi
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/core"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/core/state"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/core/vm"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/params"
+	"github.com/dominant-strategies/go-quai/rpc"
+)
+
+var (
+	bundleTestLocation = common.Location{0, 0}
+	bundleTestSender   = common.HexToAddress("0x0000000000000000000000000000000000000011", bundleTestLocation)
+	bundleTestContract = common.HexToAddress("0x00000000000000000000000000000000000000aa", bundleTestLocation)
+
+	// bundleTestCode stores the first word of the calldata in slot 0, or
+	// returns slot 0 if called without data
+	bundleTestCode = common.Hex2Bytes("3615600c57600035600055005b60005460005260206000f3")
+)
+
+// bundleTestBackend serves every bundle on a fresh state holding the test
+// contract.
+type bundleTestBackend struct {
+	Backend
+	config *params.ChainConfig
+}
+
+func newBundleTestBackend() *bundleTestBackend {
+	config := *params.TestChainConfig
+	config.Location = bundleTestLocation
+	return &bundleTestBackend{config: &config}
+}
+
+func (b *bundleTestBackend) NodeCtx() int                     { return common.ZONE_CTX }
+func (b *bundleTestBackend) NodeLocation() common.Location    { return bundleTestLocation }
+func (b *bundleTestBackend) ProcessingState() bool            { return true }
+func (b *bundleTestBackend) ChainConfig() *params.ChainConfig { return b.config }
+func (b *bundleTestBackend) Logger() *log.Logger              { return log.Global }
+
+func (b *bundleTestBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.WorkObject, error) {
+	db := state.NewDatabase(rawdb.NewMemoryDatabase(log.Global))
+	statedb, err := state.New(common.Hash{}, common.Hash{}, common.Hash{}, db, db, db, nil, nil, bundleTestLocation, log.Global)
+	if err != nil {
+		return nil, nil, err
+	}
+	contract, err := bundleTestContract.InternalAndQuaiAddress()
+	if err != nil {
+		return nil, nil, err
+	}
+	statedb.SetCode(contract, bundleTestCode)
+	return statedb, types.EmptyHeader(common.ZONE_CTX), nil
+}
+
+func (b *bundleTestBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.WorkObject, vmConfig *vm.Config) (*vm.EVM, func() error, error) {
+	blockCtx := vm.BlockContext{
+		CanTransfer:        core.CanTransfer,
+		Transfer:           core.Transfer,
+		GetHash:            func(uint64) common.Hash { return common.Hash{} },
+		CheckIfEtxEligible: func(common.Hash, common.Location) bool { return false },
+		Coinbase:           common.ZeroAddress(bundleTestLocation),
+		GasLimit:           params.GenesisGasLimit,
+		BlockNumber:        big.NewInt(1),
+		Time:               new(big.Int),
+		Difficulty:         new(big.Int),
+		BaseFee:            new(big.Int),
+	}
+	return vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), state, b.config, *vmConfig), func() error { return nil }, nil
+}
+
+// bundleTestCall returns a call of the test contract, storing the value if
+// not nil.
+func bundleTestCall(value *big.Int) BundleCall {
+	from, to := bundleTestSender, bundleTestContract
+	gas := hexutil.Uint64(100000)
+	call := BundleCall{TransactionArgs: TransactionArgs{From: &from, To: &to, Gas: &gas}}
+	if value != nil {
+		data := hexutil.Bytes(common.BigToHash(value).Bytes())
+		call.Data = &data
+	}
+	return call
+}
+
+func callTestBundle(t *testing.T, calls ...BundleCall) []*BundleCallResult {
+	t.Helper()
+	results, err := DoCallBundle(context.Background(), newBundleTestBackend(), calls, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), nil, nil, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to call bundle: %v", err)
+	}
+	if len(results) != len(calls) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(calls))
+	}
+	for i, res := range results {
+		if res.Error != "" {
+			t.Fatalf("call %d failed: %s", i, res.Error)
+		}
+	}
+	return results
+}
+
+func TestDoCallBundleSequentialState(t *testing.T) {
+	results := callTestBundle(t, bundleTestCall(big.NewInt(5)), bundleTestCall(nil), bundleTestCall(big.NewInt(7)), bundleTestCall(nil))
+
+	// Every read sees the value stored by the call before it
+	if have, want := new(big.Int).SetBytes(results[1].ReturnData), big.NewInt(5); have.Cmp(want) != 0 {
+		t.Errorf("first read mismatch: have %v, want %v", have, want)
+	}
+	if have, want := new(big.Int).SetBytes(results[3].ReturnData), big.NewInt(7); have.Cmp(want) != 0 {
+		t.Errorf("second read mismatch: have %v, want %v", have, want)
+	}
+	// while a bundle on its own does not see the state of another
+	if have := new(big.Int).SetBytes(callTestBundle(t, bundleTestCall(nil))[0].ReturnData); have.Sign() != 0 {
+		t.Errorf("read of a fresh bundle mismatch: have %v, want 0", have)
+	}
+}
+
+func TestDoCallBundleGasPerCall(t *testing.T) {
+	// Set the slot, clear it earning a refund, then read it
+	results := callTestBundle(t, bundleTestCall(big.NewInt(1)), bundleTestCall(new(big.Int)), bundleTestCall(nil))
+
+	set := callTestBundle(t, bundleTestCall(big.NewInt(1)))[0]
+	if results[0].GasUsed != set.GasUsed {
+		t.Errorf("first call gas mismatch: have %d, want %d", results[0].GasUsed, set.GasUsed)
+	}
+	if results[1].GasUsed >= results[0].GasUsed {
+		t.Errorf("clearing call gas not refunded: have %d, setting call used %d", results[1].GasUsed, results[0].GasUsed)
+	}
+	// The refund of the clearing call must not lower the gas of the next one
+	read := callTestBundle(t, bundleTestCall(nil))[0]
+	if results[2].GasUsed != read.GasUsed {
+		t.Errorf("read gas mismatch: have %d, want %d", results[2].GasUsed, read.GasUsed)
+	}
+}
@@ -0,0 +1,146 @@
+package quaiapi
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/core/state"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/ethdb"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/rpc"
+)
+
+// etxStatusTestBackend serves a short zone chain with the etx set of its head.
+type etxStatusTestBackend struct {
+	Backend
+	db       ethdb.Database
+	statedb  *state.StateDB
+	blocks   map[common.Hash]*types.WorkObject
+	receipts map[common.Hash]types.Receipts
+	head     *types.WorkObject
+}
+
+func (b *etxStatusTestBackend) NodeCtx() int            { return common.ZONE_CTX }
+func (b *etxStatusTestBackend) ProcessingState() bool   { return true }
+func (b *etxStatusTestBackend) ChainDb() ethdb.Database { return b.db }
+
+func (b *etxStatusTestBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*state.StateDB, *types.WorkObject, error) {
+	return b.statedb, b.head, nil
+}
+
+func (b *etxStatusTestBackend) BlockOrCandidateByHash(hash common.Hash) *types.WorkObject {
+	return b.blocks[hash]
+}
+
+func (b *etxStatusTestBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.receipts[hash], nil
+}
+
+func (b *etxStatusTestBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.WorkObject, error) {
+	return nil, nil
+}
+
+func newEtxStatusTestEtx(index uint16) *types.Transaction {
+	to := common.ZeroAddress(bundleTestLocation)
+	return types.NewTx(&types.ExternalTx{OriginatingTxHash: common.Hash{0xe7}, ETXIndex: index, Gas: 21000, To: &to, Value: new(big.Int), Sender: to})
+}
+
+// newEtxStatusTestBackend creates a chain of three blocks: the first one
+// processes etx 1, the head processes etx 2 which fails and the etxs 3 and 4
+// are rolled up with the first block and the head.
+func newEtxStatusTestBackend(t *testing.T) *etxStatusTestBackend {
+	db := rawdb.NewMemoryDatabase(log.Global)
+	sdb := state.NewDatabase(db)
+	statedb, err := state.New(common.Hash{}, common.Hash{}, common.Hash{}, sdb, sdb, sdb, nil, nil, bundleTestLocation, log.Global)
+	if err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	b := &etxStatusTestBackend{
+		db:       db,
+		statedb:  statedb,
+		blocks:   make(map[common.Hash]*types.WorkObject),
+		receipts: make(map[common.Hash]types.Receipts),
+	}
+	var parent common.Hash
+	for number, etx := range []*types.Transaction{nil, newEtxStatusTestEtx(1), newEtxStatusTestEtx(2)} {
+		block := types.EmptyHeader(common.ZONE_CTX)
+		block.SetNumber(big.NewInt(int64(number)), common.ZONE_CTX)
+		block.SetParentHash(parent, common.ZONE_CTX)
+		if etx != nil {
+			block.Body().SetTransactions(types.Transactions{etx})
+			status := types.ReceiptStatusSuccessful
+			if number == 2 {
+				status = types.ReceiptStatusFailed
+			}
+			b.receipts[block.Hash()] = types.Receipts{{Status: status, TxHash: etx.Hash()}}
+		}
+		b.blocks[block.Hash()] = block
+		parent, b.head = block.Hash(), block
+	}
+	first := b.head.ParentHash(common.ZONE_CTX)
+	rawdb.WriteInboundEtxs(db, first, types.Transactions{newEtxStatusTestEtx(3)})
+	rawdb.WriteInboundEtxs(db, b.head.Hash(), types.Transactions{newEtxStatusTestEtx(4)})
+	return b
+}
+
+func checkEtxStatus(t *testing.T, b *etxStatusTestBackend, index uint64, status string, position int64) map[string]interface{} {
+	t.Helper()
+	fields, err := NewPublicBlockChainQuaiAPI(b).GetEtxStatus(context.Background(), common.Hash{0xe7}, hexutil.Uint64(index))
+	if err != nil {
+		t.Fatalf("etx %d: failed to get status: %v", index, err)
+	}
+	if fields["status"] != status {
+		t.Fatalf("etx %d: status mismatch: have %v, want %s", index, fields["status"], status)
+	}
+	have, ok := fields["queuePosition"].(*hexutil.Big)
+	if (position >= 0) != ok || (ok && have.ToInt().Int64() != position) {
+		t.Errorf("etx %d: queue position mismatch: have %v, want %d", index, fields["queuePosition"], position)
+	}
+	return fields
+}
+
+func TestGetEtxStatus(t *testing.T) {
+	b := newEtxStatusTestBackend(t)
+
+	// Processed in a recent block, successfully or not
+	fields := checkEtxStatus(t, b, 1, EtxStatusProcessed, -1)
+	if fields["blockHash"] != b.head.ParentHash(common.ZONE_CTX) || fields["receipt"] == nil {
+		t.Errorf("processed etx: block or receipt mismatch: %v", fields)
+	}
+	checkEtxStatus(t, b, 2, EtxStatusFailed, -1)
+
+	// Rolled up with the head, entering the etx set with the next block
+	checkEtxStatus(t, b, 4, EtxStatusInRollup, -1)
+
+	// Waiting in the etx set, the one rolled up with an older block included
+	if err := b.statedb.PushETXs(types.Transactions{newEtxStatusTestEtx(5), newEtxStatusTestEtx(3)}); err != nil {
+		t.Fatalf("failed to push etxs: %v", err)
+	}
+	checkEtxStatus(t, b, 5, EtxStatusQueued, 0)
+	checkEtxStatus(t, b, 3, EtxStatusQueued, 1)
+
+	// Not known to the zone
+	checkEtxStatus(t, b, 6, EtxStatusUnknown, -1)
+}
+
+func TestGetEtxStatusQueueScanLimit(t *testing.T) {
+	b := newEtxStatusTestBackend(t)
+	etxs := make(types.Transactions, 0, etxStatusQueueScanLimit+2)
+	for i := 0; i < etxStatusQueueScanLimit; i++ {
+		etxs = append(etxs, newEtxStatusTestEtx(uint16(100+i)))
+	}
+	etxs = append(etxs, newEtxStatusTestEtx(3), newEtxStatusTestEtx(5))
+	if err := b.statedb.PushETXs(etxs); err != nil {
+		t.Fatalf("failed to push etxs: %v", err)
+	}
+	// Etxs beyond the scanned front of the set are only known to be queued if
+	// they were rolled up with a recent block
+	checkEtxStatus(t, b, 100+etxStatusQueueScanLimit-1, EtxStatusQueued, etxStatusQueueScanLimit-1)
+	checkEtxStatus(t, b, 3, EtxStatusQueued, -1)
+	checkEtxStatus(t, b, 5, EtxStatusUnknown, -1)
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"time"
 
@@ -27,6 +28,7 @@ import (
 	"github.com/dominant-strategies/go-quai/common/hexutil"
 	"github.com/dominant-strategies/go-quai/consensus/misc"
 	"github.com/dominant-strategies/go-quai/core"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
 	"github.com/dominant-strategies/go-quai/core/types"
 	"github.com/dominant-strategies/go-quai/crypto"
 	"github.com/dominant-strategies/go-quai/log"
@@ -66,6 +68,29 @@ func (s *PublicQuaiAPI) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big,
 	return (*hexutil.Big)(tipcap), err
 }
 
+// ArchiveMode returns true if the node keeps the full historical state
+// (--node.gcmode=archive) and can serve state queries at any block.
+func (s *PublicQuaiAPI) ArchiveMode() bool {
+	return s.b.ArchiveMode()
+}
+
+// Syncing returns false if the slice is synced with its peers, and otherwise
+// the progress of the sync:
+// - location: name of the slice
+// - currentBlock: number of the current head
+// - highestBlock: highest block number known from the peers
+// - appendQueue: blocks waiting for their parent to be appended
+// - blocksPerSecond: average number of blocks appended per second
+// - estimatedTime: seconds until the highest block is reached
+// - stage: headers, bodies or state
+func (s *PublicQuaiAPI) Syncing() (interface{}, error) {
+	progress := s.b.SyncProgress()
+	if !progress.Syncing {
+		return false, nil
+	}
+	return progress, nil
+}
+
 func (s *PublicQuaiAPI) FeeHistory(ctx context.Context, blockCount rpc.DecimalOrHex, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*feeHistoryResult, error) {
 	oldest, reward, baseFee, gasUsed, err := s.b.FeeHistory(ctx, int(blockCount), lastBlock, rewardPercentiles)
 	if err != nil {
@@ -246,6 +271,65 @@ func (s *PublicBlockChainQuaiAPI) GetProof(ctx context.Context, address common.A
 	}, state.Error()
 }
 
+// UtxoEntryResult is an entry of the UTXO set
+type UtxoEntryResult struct {
+	Denomination hexutil.Uint64 `json:"denomination"`
+	Address      hexutil.Bytes  `json:"address"`
+	Lock         *hexutil.Big   `json:"lock"`
+}
+
+// UtxoProofResult is the Merkle-proof of an outpoint against the UTXO root
+// of a block
+type UtxoProofResult struct {
+	TxHash      common.Hash      `json:"txHash"`
+	Index       hexutil.Uint64   `json:"index"`
+	Entry       *UtxoEntryResult `json:"entry"` // nil if the outpoint is not in the UTXO set
+	Proof       []string         `json:"proof"`
+	UtxoRoot    common.Hash      `json:"utxoRoot"`
+	BlockHash   common.Hash      `json:"blockHash"`
+	BlockNumber hexutil.Uint64   `json:"blockNumber"`
+}
+
+// GetUtxoProof returns the Merkle-proof of the outpoint against the UTXO root
+// of the block. The proof shows the entry of the outpoint if it is unspent at
+// that block, and that it is absent from the UTXO set otherwise.
+func (s *PublicBlockChainQuaiAPI) GetUtxoProof(ctx context.Context, txHash common.Hash, index hexutil.Uint64, blockNrOrHash rpc.BlockNumberOrHash) (*UtxoProofResult, error) {
+	nodeCtx := s.b.NodeCtx()
+	if nodeCtx != common.ZONE_CTX {
+		return nil, errors.New("getUtxoProof call can only be made in zone chain")
+	}
+	if !s.b.ProcessingState() {
+		return nil, errors.New("getUtxoProof call can only be made on chain processing the state")
+	}
+	if index > types.MaxOutputIndex {
+		return nil, fmt.Errorf("output index %d is greater than the max output index %d", index, types.MaxOutputIndex)
+	}
+	state, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	proof, err := state.GetUTXOProof(txHash, uint16(index))
+	if err != nil {
+		return nil, err
+	}
+	result := &UtxoProofResult{
+		TxHash:      txHash,
+		Index:       index,
+		Proof:       toHexSlice(proof),
+		UtxoRoot:    header.UTXORoot(),
+		BlockHash:   header.Hash(),
+		BlockNumber: hexutil.Uint64(header.NumberU64(nodeCtx)),
+	}
+	if entry := state.GetUTXO(txHash, uint16(index)); entry != nil {
+		result.Entry = &UtxoEntryResult{
+			Denomination: hexutil.Uint64(entry.Denomination),
+			Address:      entry.Address,
+			Lock:         (*hexutil.Big)(entry.Lock),
+		}
+	}
+	return result, state.Error()
+}
+
 // GetHeaderByNumber returns the requested canonical block header.
 // * When blockNr is -1 the chain head is returned.
 // * When blockNr is -2 the pending chain head is returned.
@@ -449,6 +533,18 @@ func (s *PublicBlockChainQuaiAPI) Call(ctx context.Context, args TransactionArgs
 	return result.Return(), result.Err
 }
 
+// CallBundle executes the given calls and signed raw transactions in order on a
+// shared state for the given block number, returning the outcome of each one.
+//
+// Additionally, the caller can override accounts and the fields of the block
+// context the bundle runs with.
+//
+// Note, this function doesn't make and changes in the state/blockchain and is
+// useful to simulate a sequence of dependent transactions.
+func (s *PublicBlockChainQuaiAPI) CallBundle(ctx context.Context, calls []BundleCall, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides) ([]*BundleCallResult, error) {
+	return DoCallBundle(ctx, s.b, calls, blockNrOrHash, overrides, blockOverrides, 5*time.Second, s.b.RPCGasCap())
+}
+
 // EstimateGas returns an estimate of the amount of gas needed to execute the
 // given transaction against the current pending block.
 func (s *PublicBlockChainQuaiAPI) EstimateGas(ctx context.Context, args TransactionArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Uint64, error) {
@@ -783,6 +879,136 @@ func (s *PublicBlockChainQuaiAPI) GetPendingHeader(ctx context.Context) (map[str
 	return marshaledPh, nil
 }
 
+const (
+	// etxStatusSearchDepth is the number of canonical blocks searched back from
+	// the head for an already processed or rolled up etx.
+	etxStatusSearchDepth = 256
+
+	// etxStatusQueueScanLimit is the number of etxs read from the front of the
+	// etx set to find the queue position of an etx.
+	etxStatusQueueScanLimit = 1024
+
+	EtxStatusUnknown   = "unknown"   // the etx is not known to this zone
+	EtxStatusInRollup  = "inRollup"  // the etx is part of a dom rollup and enters the etx set in the next block
+	EtxStatusQueued    = "queued"    // the etx is waiting in the etx set
+	EtxStatusProcessed = "processed" // the etx has been included in a block
+	EtxStatusFailed    = "failed"    // the etx has been included in a block but its execution failed
+)
+
+// GetEtxStatus reports the progress of the external transaction emitted at
+// etxIndex by originatingTxHash towards inclusion in this zone. The etx is
+// looked up in the recent blocks and the inbound etxs rolled up with them,
+// and its queue position in the front of the etx set.
+func (s *PublicBlockChainQuaiAPI) GetEtxStatus(ctx context.Context, originatingTxHash common.Hash, etxIndex hexutil.Uint64) (map[string]interface{}, error) {
+	nodeCtx := s.b.NodeCtx()
+	if nodeCtx != common.ZONE_CTX {
+		return nil, errors.New("getEtxStatus can only be called in zone chain")
+	}
+	if !s.b.ProcessingState() {
+		return nil, errors.New("getEtxStatus call can only be made on chain processing the state")
+	}
+	isEtx := func(tx *types.Transaction) bool {
+		return tx != nil && tx.Type() == types.ExternalTxType && tx.OriginatingTxHash() == originatingTxHash && uint64(tx.ETXIndex()) == uint64(etxIndex)
+	}
+	fields := map[string]interface{}{
+		"originatingTxHash": originatingTxHash,
+		"etxIndex":          etxIndex,
+		"status":            EtxStatusUnknown,
+	}
+
+	statedb, head, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	// Check whether the etx has been processed in a recent block, or rolled
+	// up with one. The inbound etxs of a block are pushed into the etx set by
+	// its child, so an etx rolled up before the head is queued unless a later
+	// block processed it.
+	var (
+		etx           *types.Transaction
+		rolledUpBlock *types.WorkObject
+	)
+	block := s.b.BlockOrCandidateByHash(head.Hash())
+	for i := 0; block != nil && i < etxStatusSearchDepth; i++ {
+		for _, tx := range block.Transactions() {
+			if !isEtx(tx) {
+				continue
+			}
+			fields["status"] = EtxStatusProcessed
+			fields["etxHash"] = tx.Hash()
+			fields["blockHash"] = block.Hash()
+			fields["blockNumber"] = hexutil.Uint64(block.NumberU64(nodeCtx))
+			receipts, err := s.b.GetReceipts(ctx, block.Hash())
+			if err != nil {
+				return nil, err
+			}
+			// Qi etxs are added to the utxo set without a receipt
+			for _, receipt := range receipts {
+				if receipt.TxHash == tx.Hash() {
+					fields["receipt"] = receipt
+					if receipt.Status == types.ReceiptStatusFailed {
+						fields["status"] = EtxStatusFailed
+					}
+				}
+			}
+			return fields, nil
+		}
+		for _, inbound := range rawdb.ReadInboundEtxs(s.b.ChainDb(), block.Hash()) {
+			if isEtx(inbound) {
+				etx, rolledUpBlock = inbound, block
+				break
+			}
+		}
+		if etx != nil || block.NumberU64(nodeCtx) == 0 {
+			break
+		}
+		block = s.b.BlockOrCandidateByHash(block.ParentHash(nodeCtx))
+	}
+
+	if rolledUpBlock != nil && rolledUpBlock.Hash() == head.Hash() {
+		fields["status"] = EtxStatusInRollup
+	} else {
+		// Look for the queue position of the etx in the front of the etx set.
+		// An etx rolled up with an older block is queued even if it is
+		// further back.
+		if rolledUpBlock != nil {
+			fields["status"] = EtxStatusQueued
+		}
+		oldest, err := statedb.GetOldestIndex()
+		if err != nil {
+			return nil, err
+		}
+		newest, err := statedb.GetNewestIndex()
+		if err != nil {
+			return nil, err
+		}
+		end := new(big.Int).Add(oldest, big.NewInt(etxStatusQueueScanLimit))
+		if end.Cmp(newest) > 0 {
+			end = newest
+		}
+		for index := new(big.Int).Set(oldest); index.Cmp(end) < 0; index.Add(index, common.Big1) {
+			queued, err := statedb.ReadETX(index)
+			if err != nil {
+				return nil, err
+			}
+			if isEtx(queued) {
+				etx = queued
+				fields["status"] = EtxStatusQueued
+				fields["queuePosition"] = (*hexutil.Big)(new(big.Int).Sub(index, oldest))
+				break
+			}
+		}
+	}
+	if etx == nil {
+		return fields, nil
+	}
+	fields["etxHash"] = etx.Hash()
+	if primeTerminus, err := s.b.HeaderByHash(ctx, head.PrimeTerminus()); err == nil && primeTerminus != nil && etx.To() != nil {
+		fields["eligible"] = s.b.CheckIfEtxIsEligible(primeTerminus.EtxEligibleSlices(), *etx.To().Location())
+	}
+	return fields, nil
+}
+
 // ListRunningChains returns the running locations where the node is serving data.
 func (s *PublicBlockChainQuaiAPI) ListRunningChains() []common.Location {
 	return s.b.GetSlicesRunning()
@@ -0,0 +1,182 @@
+package quaiapi
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/crypto"
+	"github.com/dominant-strategies/go-quai/params"
+	"github.com/dominant-strategies/go-quai/rpc"
+)
+
+// receiptTestBackend serves a single block and its receipts.
+type receiptTestBackend struct {
+	Backend
+	config   *params.ChainConfig
+	block    *types.WorkObject
+	receipts types.Receipts
+}
+
+func (b *receiptTestBackend) NodeCtx() int                     { return common.ZONE_CTX }
+func (b *receiptTestBackend) NodeLocation() common.Location    { return bundleTestLocation }
+func (b *receiptTestBackend) ChainConfig() *params.ChainConfig { return b.config }
+
+func (b *receiptTestBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.WorkObject, error) {
+	return b.block, nil
+}
+
+func (b *receiptTestBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.WorkObject, error) {
+	return b.block, nil
+}
+
+func (b *receiptTestBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.receipts, nil
+}
+
+func (b *receiptTestBackend) GetTransaction(ctx context.Context, hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
+	for i, tx := range b.block.Transactions() {
+		if tx.Hash() == hash {
+			return tx, b.block.Hash(), b.block.NumberU64(common.ZONE_CTX), uint64(i), nil
+		}
+	}
+	return nil, common.Hash{}, 0, 0, errors.New("transaction not found")
+}
+
+// newReceiptTestBackend creates a block holding a Quai transaction, a Qi
+// transaction emitting an etx, an etx executed on the Quai ledger, an etx to
+// the Qi ledger and a conversion to Qi, with the receipts of the executed ones.
+func newReceiptTestBackend(t *testing.T) *receiptTestBackend {
+	config := *params.TestChainConfig
+	config.Location = bundleTestLocation
+	signer := types.LatestSigner(&config)
+
+	key, _ := crypto.GenerateKey()
+	to := bundleTestContract
+	quaiTx, err := types.SignTx(types.NewTx(&types.QuaiTx{
+		ChainID:   config.ChainID,
+		GasTipCap: new(big.Int),
+		GasFeeCap: new(big.Int),
+		Gas:       21000,
+		To:        &to,
+		Value:     new(big.Int),
+	}), signer, key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	qiAddress := make([]byte, common.AddressLength)
+	qiAddress[1] = 0x80 // Qi ledger
+	qiTx := types.NewTx(&types.QiTx{
+		ChainID: config.ChainID,
+		TxIn:    types.TxIns{{PreviousOutPoint: *types.NewOutPoint(&common.Hash{1}, 0)}},
+		TxOut:   types.TxOuts{{Denomination: 1, Address: qiAddress}},
+	})
+	emittedTo := common.HexToAddress("0x1000000000000000000000000000000000000001", bundleTestLocation)
+	emitted := types.NewTx(&types.ExternalTx{OriginatingTxHash: qiTx.Hash(), To: &emittedTo, Value: big.NewInt(1), Sender: common.ZeroAddress(bundleTestLocation)})
+
+	sender := common.HexToAddress("0x1000000000000000000000000000000000000022", bundleTestLocation)
+	quaiEtx := types.NewTx(&types.ExternalTx{OriginatingTxHash: common.Hash{2}, ETXIndex: 3, Gas: 50000, To: &to, Value: big.NewInt(1), Sender: sender})
+	qiTo := common.BytesToAddress(qiAddress, bundleTestLocation)
+	qiEtx := types.NewTx(&types.ExternalTx{OriginatingTxHash: common.Hash{3}, ETXIndex: 1, Gas: 50000, To: &qiTo, Value: big.NewInt(1), Sender: sender})
+	conversion := types.NewTx(&types.ExternalTx{OriginatingTxHash: common.Hash{4}, ETXIndex: 2, Gas: 50000, To: &qiTo, Value: big.NewInt(1), Sender: bundleTestContract})
+
+	block := types.EmptyHeader(common.ZONE_CTX)
+	block.SetNumber(big.NewInt(7), common.ZONE_CTX)
+	block.Body().SetTransactions(types.Transactions{quaiTx, qiTx, quaiEtx, qiEtx, conversion})
+	block.Body().SetExtTransactions(types.Transactions{emitted})
+
+	// The gas of the Qi transaction is accounted before the etx
+	cumulativeGasUsed := 21000 + types.CalculateBlockQiTxGas(qiTx, bundleTestLocation) + 30000
+	return &receiptTestBackend{
+		config: &config,
+		block:  block,
+		receipts: types.Receipts{
+			{Status: types.ReceiptStatusSuccessful, TxHash: quaiTx.Hash(), GasUsed: 21000, CumulativeGasUsed: 21000, Logs: []*types.Log{}, Etxs: types.Transactions{}},
+			{Status: types.ReceiptStatusSuccessful, TxHash: quaiEtx.Hash(), GasUsed: 30000, CumulativeGasUsed: cumulativeGasUsed, Logs: []*types.Log{}, Etxs: types.Transactions{}},
+		},
+	}
+}
+
+func TestGetBlockReceipts(t *testing.T) {
+	b := newReceiptTestBackend(t)
+	api := NewPublicTransactionPoolAPI(b, nil)
+	txs := b.block.Transactions()
+
+	receipts, err := api.GetBlockReceipts(context.Background(), rpc.BlockNumberOrHashWithHash(b.block.Hash(), false))
+	if err != nil {
+		t.Fatalf("failed to get block receipts: %v", err)
+	}
+	if len(receipts) != len(txs) {
+		t.Fatalf("receipt count mismatch: have %d, want %d", len(receipts), len(txs))
+	}
+	for i, receipt := range receipts {
+		if receipt["transactionHash"] != txs[i].Hash() {
+			t.Errorf("receipt %d: transaction hash mismatch: have %v, want %x", i, receipt["transactionHash"], txs[i].Hash())
+		}
+		if receipt["transactionIndex"] != hexutil.Uint64(i) {
+			t.Errorf("receipt %d: transaction index mismatch: have %v, want %d", i, receipt["transactionIndex"], i)
+		}
+		if receipt["blockHash"] != b.block.Hash() || receipt["blockNumber"] != hexutil.Uint64(7) {
+			t.Errorf("receipt %d: block mismatch: have %v #%v", i, receipt["blockHash"], receipt["blockNumber"])
+		}
+	}
+	// The executed transactions and etxs report the same receipt as when
+	// looked up one by one
+	for _, i := range []int{0, 2} {
+		want, err := api.GetTransactionReceipt(context.Background(), txs[i].Hash())
+		if err != nil {
+			t.Fatalf("failed to get receipt %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(receipts[i], want) {
+			t.Errorf("receipt %d mismatch:\nhave %v\nwant %v", i, receipts[i], want)
+		}
+	}
+	if have, want := receipts[2]["from"], txs[2].ETXSender(); have != want {
+		t.Errorf("etx sender mismatch: have %v, want %v", have, want)
+	}
+	// The Qi transaction reports its gas and the etxs it emitted
+	if have, want := receipts[1]["gasUsed"], hexutil.Uint64(types.CalculateBlockQiTxGas(txs[1], bundleTestLocation)); have != want {
+		t.Errorf("qi transaction gas mismatch: have %v, want %v", have, want)
+	}
+	if etxs := receipts[1]["etxs"].(types.Transactions); len(etxs) != 1 || etxs[0].Hash() != b.block.ExtTransactions()[0].Hash() {
+		t.Errorf("qi transaction etxs mismatch: have %v", etxs)
+	}
+	if to := receipts[1]["to"]; to != nil {
+		t.Errorf("qi transaction recipient mismatch: have %v, want nil", to)
+	}
+	if have, want := receipts[1]["cumulativeGasUsed"], hexutil.Uint64(21000+types.CalculateBlockQiTxGas(txs[1], bundleTestLocation)); have != want {
+		t.Errorf("qi transaction cumulative gas mismatch: have %v, want %v", have, want)
+	}
+	// The etx to the Qi ledger reports its inclusion and sender
+	qiEtx := receipts[3]
+	if qiEtx["from"] != txs[3].ETXSender() {
+		t.Errorf("qi etx sender mismatch: have %v, want %v", qiEtx["from"], txs[3].ETXSender())
+	}
+	cumulativeGasUsed := b.receipts[1].CumulativeGasUsed + params.CallValueTransferGas
+	if qiEtx["gasUsed"] != hexutil.Uint64(params.CallValueTransferGas) || qiEtx["cumulativeGasUsed"] != hexutil.Uint64(cumulativeGasUsed) {
+		t.Errorf("qi etx gas mismatch: have %v of %v", qiEtx["gasUsed"], qiEtx["cumulativeGasUsed"])
+	}
+	if qiEtx["status"] != hexutil.Uint(types.ReceiptStatusSuccessful) {
+		t.Errorf("qi etx status mismatch: have %v", qiEtx["status"])
+	}
+	// The conversion is charged for the outputs it creates at the rate of the
+	// prime terminus
+	conversionGasUsed := conversionGas(b.block, txs[4])
+	if receipts[4]["gasUsed"] != hexutil.Uint64(conversionGasUsed) || receipts[4]["cumulativeGasUsed"] != hexutil.Uint64(cumulativeGasUsed+conversionGasUsed) {
+		t.Errorf("conversion gas mismatch: have %v of %v", receipts[4]["gasUsed"], receipts[4]["cumulativeGasUsed"])
+	}
+	// The etxs report the transaction they originate from
+	for _, i := range []int{2, 3, 4} {
+		if have, want := receipts[i]["originatingTxHash"], txs[i].OriginatingTxHash(); have != want {
+			t.Errorf("receipt %d: originating transaction mismatch: have %v, want %x", i, have, want)
+		}
+	}
+	if _, ok := receipts[0]["originatingTxHash"]; ok {
+		t.Errorf("transaction receipt has unexpected field originatingTxHash")
+	}
+}
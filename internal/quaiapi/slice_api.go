@@ -0,0 +1,237 @@
+package quaiapi
+
+import (
+	"context"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/metrics_config"
+	"google.golang.org/protobuf/proto"
+)
+
+// SliceAPI exposes the dom/sub coordination methods of a slice to its dom
+// and subordinate slices when they run in a separate process. All objects are
+// passed in their protobuf encoding.
+type SliceAPI struct {
+	b Backend
+}
+
+// NewSliceAPI creates a new dom/sub coordination API.
+func NewSliceAPI(b Backend) *SliceAPI {
+	return &SliceAPI{b}
+}
+
+// AppendResult is the response of slice_append.
+type AppendResult struct {
+	PendingEtxs hexutil.Bytes `json:"pendingEtxs"`
+	SubReorg    bool          `json:"subReorg"`
+	SetHead     bool          `json:"setHead"`
+}
+
+func (s *SliceAPI) decodeWorkObject(data hexutil.Bytes) (*types.WorkObject, error) {
+	protoWo := new(types.ProtoWorkObject)
+	if err := proto.Unmarshal(data, protoWo); err != nil {
+		return nil, err
+	}
+	wo := new(types.WorkObject)
+	if err := wo.ProtoDecode(protoWo, s.b.NodeLocation(), types.BlockObject); err != nil {
+		return nil, err
+	}
+	return wo, nil
+}
+
+func (s *SliceAPI) decodePendingHeader(data hexutil.Bytes) (types.PendingHeader, error) {
+	protoPh := new(types.ProtoPendingHeader)
+	if err := proto.Unmarshal(data, protoPh); err != nil {
+		return types.PendingHeader{}, err
+	}
+	var ph types.PendingHeader
+	if err := ph.ProtoDecode(protoPh, s.b.NodeLocation()); err != nil {
+		return types.PendingHeader{}, err
+	}
+	return ph, nil
+}
+
+func (s *SliceAPI) decodeManifest(data hexutil.Bytes) (types.BlockManifest, error) {
+	protoManifest := new(types.ProtoManifest)
+	if err := proto.Unmarshal(data, protoManifest); err != nil {
+		return nil, err
+	}
+	var manifest types.BlockManifest
+	if err := manifest.ProtoDecode(protoManifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// AddPendingEtxs adds the pending etxs emitted by a subordinate block.
+func (s *SliceAPI) AddPendingEtxs(ctx context.Context, data hexutil.Bytes) error {
+	protoPEtxs := new(types.ProtoPendingEtxs)
+	if err := proto.Unmarshal(data, protoPEtxs); err != nil {
+		return err
+	}
+	var pEtxs types.PendingEtxs
+	if err := pEtxs.ProtoDecode(protoPEtxs, s.b.NodeLocation()); err != nil {
+		return err
+	}
+	return s.b.AddPendingEtxs(pEtxs)
+}
+
+// AddPendingEtxsRollup adds the pending etxs rollup of a subordinate block.
+func (s *SliceAPI) AddPendingEtxsRollup(ctx context.Context, data hexutil.Bytes) error {
+	protoRollup := new(types.ProtoPendingEtxsRollup)
+	if err := proto.Unmarshal(data, protoRollup); err != nil {
+		return err
+	}
+	var rollup types.PendingEtxsRollup
+	if err := rollup.ProtoDecode(protoRollup, s.b.NodeLocation()); err != nil {
+		return err
+	}
+	return s.b.AddPendingEtxsRollup(rollup)
+}
+
+// UpdateDom updates the dom with the pending header of a subordinate.
+func (s *SliceAPI) UpdateDom(ctx context.Context, oldTerminus common.Hash, pendingHeader hexutil.Bytes, location hexutil.Bytes) error {
+	ph, err := s.decodePendingHeader(pendingHeader)
+	if err != nil {
+		return err
+	}
+	s.b.UpdateDom(oldTerminus, ph, common.Location(location))
+	return nil
+}
+
+// RequestDomToAppendOrFetch asks the dom to append or fetch the given block.
+func (s *SliceAPI) RequestDomToAppendOrFetch(ctx context.Context, hash common.Hash, entropy *hexutil.Big, order int) {
+	s.b.RequestDomToAppendOrFetch(hash, entropy.ToInt(), order)
+}
+
+// SubRelayPendingHeader relays the pending header of the dom to the slice.
+func (s *SliceAPI) SubRelayPendingHeader(ctx context.Context, pendingHeader hexutil.Bytes, newEntropy *hexutil.Big, location hexutil.Bytes, subReorg bool, order int) error {
+	ph, err := s.decodePendingHeader(pendingHeader)
+	if err != nil {
+		return err
+	}
+	// The relay continues the trace of the dom but not its deadline
+	ctx, span := metrics_config.StartBlockSpan(context.WithoutCancel(ctx), "SliceAPI.SubRelayPendingHeader", ph.WorkObject().ParentHash(s.b.NodeCtx()), s.b.NodeLocation().Name())
+	defer span.End(nil)
+	s.b.SubRelayPendingHeader(ctx, ph, newEntropy.ToInt(), common.Location(location), subReorg, order)
+	return nil
+}
+
+// Append appends a dom block to the slice.
+func (s *SliceAPI) Append(ctx context.Context, header hexutil.Bytes, manifest hexutil.Bytes, domPendingHeader hexutil.Bytes, domTerminus common.Hash, domOrigin bool, newInboundEtxs hexutil.Bytes) (_ *AppendResult, err error) {
+	wo, err := s.decodeWorkObject(header)
+	if err != nil {
+		return nil, err
+	}
+	// Nest the append under the span of the calling dom. The append is not
+	// aborted if the dom gives up waiting for it.
+	ctx, span := metrics_config.StartBlockSpan(context.WithoutCancel(ctx), "SliceAPI.Append", wo.Hash(), s.b.NodeLocation().Name())
+	defer func() { span.End(err) }()
+	blockManifest, err := s.decodeManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	domPh, err := s.decodeWorkObject(domPendingHeader)
+	if err != nil {
+		return nil, err
+	}
+	protoEtxs := new(types.ProtoTransactions)
+	if err := proto.Unmarshal(newInboundEtxs, protoEtxs); err != nil {
+		return nil, err
+	}
+	var etxs types.Transactions
+	if err := etxs.ProtoDecode(protoEtxs, s.b.NodeLocation()); err != nil {
+		return nil, err
+	}
+	pendingEtxs, subReorg, setHead, err := s.b.Append(ctx, wo, blockManifest, domPh, domTerminus, domOrigin, etxs)
+	if err != nil {
+		return nil, err
+	}
+	protoPendingEtxs, err := pendingEtxs.ProtoEncode()
+	if err != nil {
+		return nil, err
+	}
+	data, err := proto.Marshal(protoPendingEtxs)
+	if err != nil {
+		return nil, err
+	}
+	return &AppendResult{PendingEtxs: data, SubReorg: subReorg, SetHead: setHead}, nil
+}
+
+// DownloadBlocksInManifest requests the blocks in the manifest of a dom block.
+func (s *SliceAPI) DownloadBlocksInManifest(ctx context.Context, hash common.Hash, manifest hexutil.Bytes, entropy *hexutil.Big) error {
+	blockManifest, err := s.decodeManifest(manifest)
+	if err != nil {
+		return err
+	}
+	s.b.DownloadBlocksInManifest(hash, blockManifest, entropy.ToInt())
+	return nil
+}
+
+// GenerateRecoveryPendingHeader regenerates the pending header from the
+// given checkpoint hashes.
+func (s *SliceAPI) GenerateRecoveryPendingHeader(ctx context.Context, pendingHeader hexutil.Bytes, checkpointHashes hexutil.Bytes) error {
+	wo, err := s.decodeWorkObject(pendingHeader)
+	if err != nil {
+		return err
+	}
+	protoTermini := new(types.ProtoTermini)
+	if err := proto.Unmarshal(checkpointHashes, protoTermini); err != nil {
+		return err
+	}
+	var termini types.Termini
+	if err := termini.ProtoDecode(protoTermini); err != nil {
+		return err
+	}
+	return s.b.GenerateRecoveryPendingHeader(wo, termini)
+}
+
+// GetPendingEtxsRollupFromSub returns the pending etxs rollup of the block.
+func (s *SliceAPI) GetPendingEtxsRollupFromSub(ctx context.Context, hash common.Hash, location hexutil.Bytes) (hexutil.Bytes, error) {
+	rollup, err := s.b.GetPendingEtxsRollupFromSub(hash, common.Location(location))
+	if err != nil {
+		return nil, err
+	}
+	protoRollup, err := rollup.ProtoEncode()
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(protoRollup)
+}
+
+// GetPendingEtxsFromSub returns the pending etxs of the block.
+func (s *SliceAPI) GetPendingEtxsFromSub(ctx context.Context, hash common.Hash, location hexutil.Bytes) (hexutil.Bytes, error) {
+	pEtxs, err := s.b.GetPendingEtxsFromSub(hash, common.Location(location))
+	if err != nil {
+		return nil, err
+	}
+	protoPEtxs, err := pEtxs.ProtoEncode()
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(protoPEtxs)
+}
+
+// NewGenesisPendingHeader initializes the genesis pending header of the slice.
+func (s *SliceAPI) NewGenesisPendingHeader(ctx context.Context, pendingHeader hexutil.Bytes, domTerminus common.Hash, hash common.Hash) error {
+	wo, err := s.decodeWorkObject(pendingHeader)
+	if err != nil {
+		return err
+	}
+	return s.b.NewGenesisPendingHeader(wo, domTerminus, hash)
+}
+
+// GetManifest returns the manifest of the block.
+func (s *SliceAPI) GetManifest(ctx context.Context, blockHash common.Hash) (hexutil.Bytes, error) {
+	manifest, err := s.b.GetManifest(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	protoManifest, err := manifest.ProtoEncode()
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(protoManifest)
+}
@@ -0,0 +1,332 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultModule is the module name addressing the level of a whole logger
+	DefaultModule = "*"
+
+	// modulePrefix is stripped from the package path of the caller to obtain
+	// its module, e.g. core/state
+	modulePrefix = "github.com/dominant-strategies/go-quai/"
+)
+
+var (
+	// loggers are the loggers created by the node, keyed by the name of their
+	// log file without extension, e.g. global, peers or zone-0-1
+	loggers   = make(map[string]*registeredLogger)
+	loggersMu sync.Mutex
+
+	// logFormat is the output format of new loggers
+	logFormat = TextFormat
+
+	// defaultFields are attached to the entries of every logger
+	defaultFields = make(Fields)
+)
+
+// registeredLogger keeps the state needed to reconfigure a logger at runtime
+type registeredLogger struct {
+	logger *Logger
+	fields *fieldsHook
+	output *moduleHook
+}
+
+// fieldsHook attaches a set of fields to every entry of a logger, unless the
+// entry already carries a field of the same name.
+type fieldsHook struct {
+	mu     sync.RWMutex
+	fields Fields
+}
+
+func (hook *fieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *fieldsHook) Fire(entry *logrus.Entry) error {
+	hook.mu.RLock()
+	defer hook.mu.RUnlock()
+	for key, value := range hook.fields {
+		if _, ok := entry.Data[key]; !ok {
+			entry.Data[key] = value
+		}
+	}
+	return nil
+}
+
+func (hook *fieldsHook) set(key string, value interface{}) {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	hook.fields[key] = value
+}
+
+// moduleHook writes the entries of a logger, dropping the ones above the
+// level configured for the module they were logged from. The logger itself
+// is set to the most verbose of these levels and discards its own output.
+type moduleHook struct {
+	mu        sync.RWMutex
+	writer    io.Writer
+	formatter logrus.Formatter
+	level     logrus.Level
+	modules   map[string]logrus.Level
+	// quietest is the least verbose of the levels, entries at or below it
+	// are written without looking up their module
+	quietest logrus.Level
+}
+
+func (hook *moduleHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *moduleHook) Fire(entry *logrus.Entry) error {
+	hook.mu.RLock()
+	defer hook.mu.RUnlock()
+	if entry.Level > hook.quietest && entry.Level > hook.moduleLevel(callerModule()) {
+		return nil
+	}
+	line, err := hook.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	_, err = hook.writer.Write(line)
+	return err
+}
+
+// moduleLevel returns the level of the most specific module configured for
+// the given module, or the level of the logger
+func (hook *moduleHook) moduleLevel(module string) logrus.Level {
+	level, matched := hook.level, ""
+	for name, moduleLevel := range hook.modules {
+		if (module == name || strings.HasPrefix(module, name+"/")) && len(name) > len(matched) {
+			level, matched = moduleLevel, name
+		}
+	}
+	return level
+}
+
+// setLevels updates the levels of the hook and returns the most verbose
+// level the logger has to let through
+func (hook *moduleHook) setLevels() logrus.Level {
+	loudest, quietest := hook.level, hook.level
+	for _, moduleLevel := range hook.modules {
+		if moduleLevel > loudest {
+			loudest = moduleLevel
+		}
+		if moduleLevel < quietest {
+			quietest = moduleLevel
+		}
+	}
+	hook.quietest = quietest
+	return loudest
+}
+
+// discardFormatter is the formatter of the registered loggers, whose entries
+// are formatted and written by their moduleHook instead
+type discardFormatter struct{}
+
+func (discardFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+// callerModules caches the module of the program counters seen by
+// callerModule. Program counters of the logging packages map to loggingFrame.
+var callerModules sync.Map
+
+const loggingFrame = "\x00"
+
+// callerModule returns the module of the first caller outside of the logging
+// packages, e.g. core/state
+func callerModule() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	for _, pc := range pcs[:n] {
+		module, ok := callerModules.Load(pc)
+		if !ok {
+			module = pcModule(pc)
+			callerModules.Store(pc, module)
+		}
+		if module != loggingFrame {
+			return module.(string)
+		}
+	}
+	return ""
+}
+
+// pcModule returns the module of the innermost function outside of the
+// logging packages at the program counter, including the functions inlined
+// there
+func pcModule(pc uintptr) string {
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		frame, more := frames.Next()
+		function := strings.TrimPrefix(frame.Function, modulePrefix)
+		if !strings.Contains(frame.Function, "sirupsen/logrus") && !strings.HasPrefix(function, "log.") {
+			// The package ends at the first dot after the last slash
+			pkg := function
+			if slash := strings.LastIndex(pkg, "/"); slash >= 0 {
+				if dot := strings.Index(pkg[slash:], "."); dot >= 0 {
+					pkg = pkg[:slash+dot]
+				}
+			} else if dot := strings.Index(pkg, "."); dot >= 0 {
+				pkg = pkg[:dot]
+			}
+			return pkg
+		}
+		if !more {
+			return loggingFrame
+		}
+	}
+}
+
+// newFormatter returns the formatter for the configured log format
+func newFormatter() logrus.Formatter {
+	if logFormat == JSONFormat {
+		return &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	}
+	return &logrus.TextFormatter{
+		ForceColors:     true,
+		PadLevelText:    true,
+		FullTimestamp:   true,
+		TimestampFormat: "01-02|15:04:05.000",
+	}
+}
+
+// register sets up the output and fields of the logger and makes it
+// reachable by name. The module levels of a logger previously registered
+// under the same name, e.g. before its slice restarted, are carried over and
+// its writer is replaced.
+func register(name string, logger *Logger, writer io.Writer, level logrus.Level, fields Fields) {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+
+	hook := &fieldsHook{fields: make(Fields)}
+	for key, value := range defaultFields {
+		hook.fields[key] = value
+	}
+	for key, value := range fields {
+		hook.fields[key] = value
+	}
+	output := &moduleHook{
+		writer:    writer,
+		formatter: newFormatter(),
+		level:     level,
+		modules:   make(map[string]logrus.Level),
+	}
+	if previous, ok := loggers[name]; ok {
+		// The previous logger may still be used by the goroutines of a
+		// stopping slice, so its entries go to the new writer from now on and
+		// its own writer, e.g. an open log file, is closed
+		previous.output.mu.Lock()
+		for module, moduleLevel := range previous.output.modules {
+			output.modules[module] = moduleLevel
+		}
+		if closer, ok := previous.output.writer.(io.Closer); ok {
+			closer.Close()
+		}
+		previous.output.writer = writer
+		previous.output.mu.Unlock()
+	}
+	// The fields hook is added first, so the entries carry their fields by
+	// the time the output hook writes them
+	logger.AddHook(hook)
+	logger.AddHook(output)
+	logger.SetOutput(io.Discard)
+	logger.SetFormatter(discardFormatter{})
+	logger.SetLevel(output.setLevels())
+	loggers[name] = &registeredLogger{logger: logger, fields: hook, output: output}
+}
+
+// SetLogFormat sets the output format, text or json, of all the loggers.
+func SetLogFormat(format string) error {
+	switch LogFormat(format) {
+	case TextFormat, JSONFormat:
+	default:
+		return fmt.Errorf("invalid log format %q, expected %s or %s", format, TextFormat, JSONFormat)
+	}
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	logFormat = LogFormat(format)
+	for _, registered := range loggers {
+		registered.output.mu.Lock()
+		registered.output.formatter = newFormatter()
+		registered.output.mu.Unlock()
+	}
+	return nil
+}
+
+// setOutput changes the destination of the entries of the named logger
+func setOutput(name string, writer io.Writer) {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	if registered, ok := loggers[name]; ok {
+		registered.output.mu.Lock()
+		registered.output.writer = writer
+		registered.output.mu.Unlock()
+	}
+}
+
+// SetDefaultField attaches the field to the entries of all the loggers,
+// including the ones created later.
+func SetDefaultField(key string, value interface{}) {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	defaultFields[key] = value
+	for _, registered := range loggers {
+		registered.fields.set(key, value)
+	}
+}
+
+// SetLogLevel changes the level of the named logger, e.g. zone-0-1. If a
+// module other than DefaultModule is given, e.g. core or p2p/node, only the
+// entries logged from that module and its submodules are affected.
+func SetLogLevel(name string, module string, level string) error {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	registered, ok := loggers[name]
+	if !ok {
+		return fmt.Errorf("unknown logger %q", name)
+	}
+	module = strings.TrimPrefix(strings.Trim(module, "/"), modulePrefix)
+	output := registered.output
+	output.mu.Lock()
+	defer output.mu.Unlock()
+	if module == "" || module == DefaultModule {
+		output.level = parsed
+	} else {
+		output.modules[module] = parsed
+	}
+	registered.logger.SetLevel(output.setLevels())
+	return nil
+}
+
+// LogLevels returns the levels of all the loggers, keyed by logger and
+// module name. The level of the whole logger is listed under DefaultModule.
+func LogLevels() map[string]map[string]string {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	levels := make(map[string]map[string]string, len(loggers))
+	for name, registered := range loggers {
+		output := registered.output
+		output.mu.RLock()
+		modules := make(map[string]string, len(output.modules)+1)
+		modules[DefaultModule] = output.level.String()
+		for module, level := range output.modules {
+			modules[module] = level.String()
+		}
+		output.mu.RUnlock()
+		levels[name] = modules
+	}
+	return levels
+}
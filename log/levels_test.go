@@ -0,0 +1,201 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// closeBuffer is a log writer recording whether it was closed
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+// newTestLogger registers a logger writing to a buffer, removing it again
+// when the test ends.
+func newTestLogger(t *testing.T, name string, level logrus.Level, fields Fields) (*Logger, *closeBuffer) {
+	t.Helper()
+	logger, output := logrus.New(), new(closeBuffer)
+	register(name, logger, output, level, fields)
+	t.Cleanup(func() {
+		loggersMu.Lock()
+		delete(loggers, name)
+		loggersMu.Unlock()
+	})
+	return logger, output
+}
+
+func TestModuleLevel(t *testing.T) {
+	hook := &moduleHook{
+		level:   logrus.WarnLevel,
+		modules: map[string]logrus.Level{"core": logrus.InfoLevel, "core/state": logrus.TraceLevel},
+	}
+	tests := []struct {
+		module string
+		level  logrus.Level
+	}{
+		{"p2p/node", logrus.WarnLevel},
+		{"core", logrus.InfoLevel},
+		{"core/vm", logrus.InfoLevel},
+		{"core/state", logrus.TraceLevel},
+		{"core/state/snapshot", logrus.TraceLevel},
+		{"corex", logrus.WarnLevel},
+	}
+	for _, tt := range tests {
+		if have := hook.moduleLevel(tt.module); have != tt.level {
+			t.Errorf("module %s: level mismatch: have %v, want %v", tt.module, have, tt.level)
+		}
+	}
+}
+
+func TestModuleFiltering(t *testing.T) {
+	logger, output := newTestLogger(t, "test-modules", logrus.InfoLevel, nil)
+
+	// The frames of the log package are skipped when looking up the caller,
+	// so the entries of this test are attributed to the testing package
+	logger.Debug("hidden debug")
+	if err := SetLogLevel("test-modules", "core", "debug"); err != nil {
+		t.Fatalf("failed to set level: %v", err)
+	}
+	logger.Debug("hidden core debug")
+	if err := SetLogLevel("test-modules", modulePrefix+"testing/", "debug"); err != nil {
+		t.Fatalf("failed to set level: %v", err)
+	}
+	logger.Debug("shown debug")
+	logger.Trace("hidden trace")
+	if err := SetLogLevel("test-modules", "testing", "error"); err != nil {
+		t.Fatalf("failed to set level: %v", err)
+	}
+	logger.Info("hidden info")
+	logger.Error("shown error")
+
+	lines := output.String()
+	for _, hidden := range []string{"hidden debug", "hidden core debug", "hidden trace", "hidden info"} {
+		if strings.Contains(lines, hidden) {
+			t.Errorf("entry %q written", hidden)
+		}
+	}
+	for _, shown := range []string{"shown debug", "shown error"} {
+		if !strings.Contains(lines, shown) {
+			t.Errorf("entry %q missing", shown)
+		}
+	}
+	levels := LogLevels()["test-modules"]
+	if levels[DefaultModule] != "info" || levels["core"] != "debug" || levels["testing"] != "error" {
+		t.Errorf("levels mismatch: %v", levels)
+	}
+}
+
+func TestRegisterCarriesLevels(t *testing.T) {
+	previous, previousOutput := newTestLogger(t, "test-restart", logrus.InfoLevel, nil)
+	if err := SetLogLevel("test-restart", "testing", "trace"); err != nil {
+		t.Fatalf("failed to set level: %v", err)
+	}
+	// Registering the logger again, as a restarting slice does, keeps the
+	// module levels and closes the previous writer
+	logger, output := newTestLogger(t, "test-restart", logrus.InfoLevel, nil)
+	if !previousOutput.closed {
+		t.Errorf("previous writer not closed")
+	}
+	if have := LogLevels()["test-restart"]["testing"]; have != "trace" {
+		t.Errorf("module level mismatch: have %s, want trace", have)
+	}
+	logger.Trace("new trace")
+	previous.Info("stale info")
+	if previousOutput.Len() != 0 {
+		t.Errorf("previous writer written after restart: %q", previousOutput.String())
+	}
+	for _, entry := range []string{"new trace", "stale info"} {
+		if !strings.Contains(output.String(), entry) {
+			t.Errorf("entry %q missing", entry)
+		}
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	if err := SetLogFormat("xml"); err == nil {
+		t.Fatalf("invalid format accepted")
+	}
+	if err := SetLogFormat(string(JSONFormat)); err != nil {
+		t.Fatalf("failed to set format: %v", err)
+	}
+	t.Cleanup(func() { SetLogFormat(string(TextFormat)) })
+
+	logger, output := newTestLogger(t, "test-json", logrus.InfoLevel, Fields{"location": "zone-0-1"})
+	logger.WithField("hash", "0x01").Warn("json entry")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid json entry %q: %v", output.String(), err)
+	}
+	want := map[string]interface{}{"msg": "json entry", "level": "warning", "hash": "0x01", "location": "zone-0-1"}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("field %s mismatch: have %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["time"]; !ok {
+		t.Errorf("time missing")
+	}
+}
+
+func TestSetDefaultField(t *testing.T) {
+	if err := SetLogFormat(string(JSONFormat)); err != nil {
+		t.Fatalf("failed to set format: %v", err)
+	}
+	t.Cleanup(func() { SetLogFormat(string(TextFormat)) })
+
+	existing, existingOutput := newTestLogger(t, "test-default-existing", logrus.InfoLevel, nil)
+	SetDefaultField("test-node", "node-1")
+	t.Cleanup(func() {
+		loggersMu.Lock()
+		delete(defaultFields, "test-node")
+		loggersMu.Unlock()
+	})
+	later, laterOutput := newTestLogger(t, "test-default-later", logrus.InfoLevel, nil)
+
+	existing.Info("existing entry")
+	later.Info("later entry")
+	later.WithField("test-node", "node-2").Info("own entry")
+
+	check := func(output *closeBuffer, want ...string) {
+		t.Helper()
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		if len(lines) != len(want) {
+			t.Fatalf("entry count mismatch: have %d, want %d", len(lines), len(want))
+		}
+		for i, line := range lines {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("invalid json entry %q: %v", line, err)
+			}
+			if entry["test-node"] != want[i] {
+				t.Errorf("entry %d: default field mismatch: have %v, want %s", i, entry["test-node"], want[i])
+			}
+		}
+	}
+	check(existingOutput, "node-1")
+	check(laterOutput, "node-1", "node-2")
+}
+
+func TestSetLogLevelErrors(t *testing.T) {
+	newTestLogger(t, "test-errors", logrus.InfoLevel, nil)
+	if err := SetLogLevel("test-unknown", DefaultModule, "debug"); err == nil || !strings.Contains(err.Error(), "unknown logger") {
+		t.Errorf("unknown logger: error mismatch: %v", err)
+	}
+	if err := SetLogLevel("test-errors", DefaultModule, "loud"); err == nil {
+		t.Errorf("invalid level accepted")
+	}
+	if have := LogLevels()["test-errors"][DefaultModule]; have != "info" {
+		t.Errorf("level changed by failed calls: have %s", have)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/natefinch/lumberjack"
 	"github.com/sirupsen/logrus"
@@ -38,7 +39,7 @@ var (
 )
 
 func init() {
-	Global = createStandardLogger(defaultLogFilePath, defaultLogLevel.String(), true)
+	Global = createStandardLogger("global", defaultLogFilePath, defaultLogLevel.String(), true, nil)
 }
 
 func SetGlobalLogger(logFilename string, logLevel string) {
@@ -46,7 +47,7 @@ func SetGlobalLogger(logFilename string, logLevel string) {
 	if err != nil {
 		level = defaultLogLevel
 	}
-	Global.SetLevel(level)
+	SetLogLevel("global", DefaultModule, level.String())
 
 	if logFilename == "" {
 		Global.WithFields(Fields{
@@ -62,7 +63,7 @@ func SetGlobalLogger(logFilename string, logLevel string) {
 		MaxBackups: 3,
 		MaxAge:     28, //days
 	}
-	Global.SetOutput(io.MultiWriter(output, os.Stdout))
+	setOutput("global", io.MultiWriter(output, os.Stdout))
 
 	Global.WithFields(Fields{
 		"path":  logFilename,
@@ -70,11 +71,22 @@ func SetGlobalLogger(logFilename string, logLevel string) {
 	}).Info("Global logger started")
 }
 
-func NewLogger(logFilename string, logLevel string) *logrus.Logger {
+// NewLogger creates a logger writing to the given file of the log directory.
+// The fields, e.g. the location of a slice, are attached to every entry. The
+// logger is reachable by its file name without extension to change its
+// levels at runtime.
+func NewLogger(logFilename string, logLevel string, fields ...Fields) *logrus.Logger {
 	if logFilename == "" {
 		logFilename = defaultLogFilePath
 	}
-	shardLogger := createStandardLogger(filepath.Join(logDir, logFilename), logLevel, false)
+	loggerFields := make(Fields)
+	for _, f := range fields {
+		for key, value := range f {
+			loggerFields[key] = value
+		}
+	}
+	name := strings.TrimSuffix(filepath.Base(logFilename), filepath.Ext(logFilename))
+	shardLogger := createStandardLogger(name, filepath.Join(logDir, logFilename), logLevel, false, loggerFields)
 	shardLogger.WithFields(Fields{
 		"path":  logFilename,
 		"level": logLevel,
@@ -82,7 +94,7 @@ func NewLogger(logFilename string, logLevel string) *logrus.Logger {
 	return shardLogger
 }
 
-func createStandardLogger(logFilename string, logLevel string, stdOut bool) *logrus.Logger {
+func createStandardLogger(name string, logFilename string, logLevel string, stdOut bool, fields Fields) *logrus.Logger {
 	logger := logrus.New()
 	output := &lumberjack.Logger{
 		Filename:   logFilename,
@@ -91,22 +103,15 @@ func createStandardLogger(logFilename string, logLevel string, stdOut bool) *log
 		MaxAge:     28, //days
 	}
 
+	var writer io.Writer = output
 	if stdOut {
-		logger.SetOutput(io.MultiWriter(output, os.Stdout))
-	} else {
-		logger.SetOutput(output)
+		writer = io.MultiWriter(output, os.Stdout)
 	}
 
-	logger.SetFormatter(&logrus.TextFormatter{
-		ForceColors:     true,
-		PadLevelText:    true,
-		FullTimestamp:   true,
-		TimestampFormat: "01-02|15:04:05.000",
-	})
 	level, err := logrus.ParseLevel(logLevel)
 	if err != nil {
 		level = defaultLogLevel
 	}
-	logger.SetLevel(level)
+	register(name, logger, writer, level, fields)
 	return logger
 }
@@ -27,6 +27,7 @@ var enabled bool
 
 var registeredGauges = make(map[string]*prometheus.GaugeVec)
 var registeredCounters = make(map[string]*prometheus.CounterVec)
+var registeredHistograms = make(map[string]*prometheus.HistogramVec)
 
 // Init enables or disables the metrics system. Since we need this to run before
 // any other code gets to create meters and timers, we'll actually do an ugly hack
@@ -112,6 +113,53 @@ func NewCounterVec(name string, help string) *prometheus.CounterVec {
 	return counterVec
 }
 
+// NewLabeledGaugeVec returns a gauge vector partitioned by the given labels,
+// e.g. location, for the metrics that are tracked per slice.
+func NewLabeledGaugeVec(name string, help string, labels ...string) *prometheus.GaugeVec {
+	if gaugeVec, exists := registeredGauges[name]; exists {
+		return gaugeVec
+	}
+	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: name,
+		Help: help,
+	}, labels)
+	prometheus.Register(gaugeVec)
+	registeredGauges[name] = gaugeVec
+	return gaugeVec
+}
+
+// NewLabeledCounterVec returns a counter vector partitioned by the given
+// labels.
+func NewLabeledCounterVec(name string, help string, labels ...string) *prometheus.CounterVec {
+	if counterVec, exists := registeredCounters[name]; exists {
+		return counterVec
+	}
+	counterVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: name,
+		Help: help,
+	}, labels)
+	prometheus.Register(counterVec)
+	registeredCounters[name] = counterVec
+	return counterVec
+}
+
+// NewHistogramVec returns a histogram vector with the given buckets,
+// partitioned by the given labels. The default buckets are used if none are
+// given.
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	if histogramVec, exists := registeredHistograms[name]; exists {
+		return histogramVec
+	}
+	histogramVec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help,
+		Buckets: buckets,
+	}, labels)
+	prometheus.Register(histogramVec)
+	registeredHistograms[name] = histogramVec
+	return histogramVec
+}
+
 func NewTimer(name string, help string) *prometheus.Timer {
 	timeHistogram := prometheus.NewHistogram(prometheus.HistogramOpts{
 		Name: name,
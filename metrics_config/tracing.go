@@ -0,0 +1,153 @@
+package metrics_config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/dominant-strategies/go-quai"
+
+var (
+	// tracer creates the spans of go-quai. It does not record anything until
+	// tracing is enabled. The provider is not installed globally so that the
+	// spans of the libraries, e.g. the libp2p dht, are not exported.
+	tracer = trace.NewNoopTracerProvider().Tracer(tracerName)
+
+	tracingEnabled bool
+)
+
+// TracingConfig configures the export of the spans
+type TracingConfig struct {
+	Endpoint    string  // OTLP gRPC collector address, e.g. localhost:4317
+	Insecure    bool    // connect to the collector without TLS
+	File        string  // file the spans are written to as JSON
+	SampleRatio float64 // fraction of the traces that are recorded
+	ServiceName string  // name of the process reported to the collector
+}
+
+// StartTracing installs a tracer provider exporting the spans to the OTLP
+// collector and/or the file of the config. The returned function flushes and
+// stops the export.
+func StartTracing(config TracingConfig) (func(context.Context) error, error) {
+	var exporters []sdktrace.SpanExporter
+	var file *os.File
+	if config.Endpoint != "" {
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Endpoint)}
+		if config.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(context.Background(), options...)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the otlp exporter: %w", err)
+		}
+		exporters = append(exporters, exporter)
+	}
+	if config.File != "" {
+		var err error
+		file, err = os.OpenFile(config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+	if len(exporters) == 0 {
+		return nil, errors.New("no tracing endpoint or file configured")
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	}
+	for _, exporter := range exporters {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+	tracer = provider.Tracer(tracerName)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tracingEnabled = true
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
+
+// TracingEnabled returns true if the spans are exported
+func TracingEnabled() bool {
+	return tracingEnabled
+}
+
+// StartSpan starts a span as a child of the span carried by the context.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records the error, if any, and ends the span.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// BlockSpan is a span around a step of processing a block.
+type BlockSpan struct {
+	span trace.Span
+}
+
+// StartBlockSpan starts a span for the block with the given hash at the
+// location, nested under the span carried by the context, e.g. the append of
+// the block in its dom. The returned context carries the new span to the
+// later steps on the block.
+func StartBlockSpan(ctx context.Context, name string, hash fmt.Stringer, location string) (context.Context, *BlockSpan) {
+	if !tracingEnabled {
+		return ctx, nil
+	}
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("block.hash", hash.String()),
+		attribute.String("location", location),
+	))
+	return ctx, &BlockSpan{span: span}
+}
+
+// SetInt adds an integer attribute to the span.
+func (s *BlockSpan) SetInt(key string, value int64) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attribute.Int64(key, value))
+}
+
+// End records the error, if any, and ends the span.
+func (s *BlockSpan) End(err error) {
+	if s == nil {
+		return
+	}
+	EndSpan(s.span, err)
+}
@@ -110,6 +110,10 @@ type Config struct {
 	// exposed.
 	HTTPModules []string
 
+	// HTTPAuthModules is a list of API modules served via the HTTP RPC interface
+	// only to the requests carrying a JWT signed with the JWTSecret.
+	HTTPAuthModules []string `toml:",omitempty"`
+
 	// HTTPTimeouts allows for customization of the timeout values used by the HTTP RPC
 	// interface.
 	HTTPTimeouts rpc.HTTPTimeouts
@@ -129,6 +133,15 @@ type Config struct {
 	// WSPathPrefix specifies a path prefix on which ws-rpc is to be served.
 	WSPathPrefix string `toml:",omitempty"`
 
+	// AuthHost is the host interface on which to start the authenticated HTTP
+	// RPC server serving the dom/sub coordination APIs. If this field is empty,
+	// no authenticated endpoint will be started.
+	AuthHost string `toml:",omitempty"`
+
+	// AuthPort is the TCP port number on which to start the authenticated HTTP
+	// RPC server.
+	AuthPort int `toml:",omitempty"`
+
 	// WSOrigins is the list of domain to accept websocket requests from. Please be
 	// aware that the server can only act upon the HTTP request the client sends and
 	// cannot verify the validity of the request header.
@@ -139,6 +152,11 @@ type Config struct {
 	// exposed.
 	WSModules []string
 
+	// WSAuthModules is a list of API modules served via the websocket RPC
+	// interface only to the connections opened with a JWT signed with the
+	// JWTSecret.
+	WSAuthModules []string `toml:",omitempty"`
+
 	// WSExposeAll exposes all API modules via the WebSocket RPC interface rather
 	// than just the public ones.
 	//
@@ -200,6 +218,15 @@ func (c *Config) WSEndpoint() string {
 	return fmt.Sprintf("%s:%d", c.WSHost, c.WSPort)
 }
 
+// AuthEndpoint resolves the authenticated endpoint based on the configured
+// host interface and port parameters.
+func (c *Config) AuthEndpoint() string {
+	if c.AuthHost == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.AuthHost, c.AuthPort)
+}
+
 // DefaultWSEndpoint returns the websocket endpoint used by default.
 func DefaultWSEndpoint() string {
 	config := &Config{WSHost: DefaultWSHost, WSPort: DefaultWSPort}
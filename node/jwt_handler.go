@@ -0,0 +1,134 @@
+package node
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+)
+
+const (
+	// jwtSecretLength is the length in bytes of the shared jwt secret
+	jwtSecretLength = 32
+	// jwtExpiryTimeout is the allowed drift between the issued-at claim of a
+	// token and the local time
+	jwtExpiryTimeout = 60 * time.Second
+)
+
+// jwtHandler is a handler which validates the HS256 signed token carried in
+// the Authorization header of incoming requests.
+type jwtHandler struct {
+	keyFunc func(token *jwt.Token) (interface{}, error)
+	next    http.Handler
+}
+
+// newJWTHandler creates a http.Handler with jwt authentication support.
+func newJWTHandler(secret []byte, next http.Handler) http.Handler {
+	return &jwtHandler{
+		keyFunc: func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return secret, nil
+		},
+		next: next,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (handler *jwtHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	strToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if strToken == "" || strToken == r.Header.Get("Authorization") {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+	claims := jwt.StandardClaims{}
+	token, err := jwt.ParseWithClaims(strToken, &claims, handler.keyFunc)
+	if err != nil || !token.Valid {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	if claims.IssuedAt == 0 {
+		http.Error(w, "missing issued-at", http.StatusUnauthorized)
+		return
+	}
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	if time.Since(issuedAt) > jwtExpiryTimeout || time.Until(issuedAt) > jwtExpiryTimeout {
+		http.Error(w, "stale token", http.StatusUnauthorized)
+		return
+	}
+	handler.next.ServeHTTP(w, r)
+}
+
+// jwtNamespaceHandler is a handler serving the requests without an
+// Authorization header with the public modules of an endpoint, and the
+// requests carrying a valid token with all of its modules.
+type jwtNamespaceHandler struct {
+	authenticated http.Handler
+	public        http.Handler
+}
+
+// newJWTNamespaceHandler creates a http.Handler requiring authentication
+// only for the modules served by the authenticated handler.
+func newJWTNamespaceHandler(secret []byte, authenticated http.Handler, public http.Handler) http.Handler {
+	return &jwtNamespaceHandler{
+		authenticated: newJWTHandler(secret, authenticated),
+		public:        public,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (handler *jwtNamespaceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// A request with an invalid token is rejected rather than served with the
+	// public modules, so that clients do not mistake a bad token for a
+	// missing method
+	if r.Header.Get("Authorization") == "" {
+		handler.public.ServeHTTP(w, r)
+		return
+	}
+	handler.authenticated.ServeHTTP(w, r)
+}
+
+// NewJWTToken returns a HS256 token for the given secret issued at the
+// current time.
+func NewJWTToken(secret []byte) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{IssuedAt: time.Now().Unix()})
+	return token.SignedString(secret)
+}
+
+// ObtainJWTSecret loads the hex encoded jwt secret from the given file,
+// generating and persisting a new one if the file does not exist.
+func ObtainJWTSecret(fileName string) ([]byte, error) {
+	if fileName == "" {
+		return nil, errors.New("no jwt secret file configured")
+	}
+	if data, err := os.ReadFile(fileName); err == nil {
+		secret := common.FromHex(strings.TrimSpace(string(data)))
+		if len(secret) != jwtSecretLength {
+			return nil, fmt.Errorf("invalid jwt secret in %s, expected %d bytes", fileName, jwtSecretLength)
+		}
+		return secret, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	secret := make([]byte, jwtSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(fileName, []byte(hexutil.Encode(secret)), 0600); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
@@ -0,0 +1,57 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestJWTHandler makes sure only requests carrying a fresh token signed with
+// the shared secret are served.
+func TestJWTHandler(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	handler := newJWTHandler(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	sign := func(key []byte, issuedAt time.Time) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{IssuedAt: issuedAt.Unix()}).SignedString(key)
+		require.NoError(t, err)
+		return token
+	}
+
+	valid, err := NewJWTToken(secret)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve(valid))
+	assert.Equal(t, http.StatusUnauthorized, serve(""))
+	assert.Equal(t, http.StatusUnauthorized, serve(sign([]byte("wrong secret"), time.Now())))
+	assert.Equal(t, http.StatusUnauthorized, serve(sign(secret, time.Now().Add(-2*jwtExpiryTimeout))))
+	assert.Equal(t, http.StatusUnauthorized, serve(sign(secret, time.Now().Add(2*jwtExpiryTimeout))))
+}
+
+// TestObtainJWTSecret makes sure the secret is generated once and reloaded
+// afterwards.
+func TestObtainJWTSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwtsecret")
+	secret, err := ObtainJWTSecret(path)
+	require.NoError(t, err)
+	assert.Len(t, secret, jwtSecretLength)
+
+	reloaded, err := ObtainJWTSecret(path)
+	require.NoError(t, err)
+	assert.Equal(t, secret, reloaded)
+}
@@ -51,6 +51,7 @@ type Node struct {
 	rpcAPIs       []rpc.API   // List of APIs currently provided by the node
 	http          *httpServer //
 	ws            *httpServer //
+	httpAuth      *httpServer // authenticated endpoint serving the dom/sub coordination apis
 	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
 	location      []byte
 
@@ -111,6 +112,7 @@ func New(conf *Config, logger *log.Logger) (*Node, error) {
 	// Configure RPC servers.
 	node.http = newHTTPServer(node.logger, conf.HTTPTimeouts)
 	node.ws = newHTTPServer(node.logger, rpc.DefaultHTTPTimeouts)
+	node.httpAuth = newHTTPServer(node.logger, conf.HTTPTimeouts)
 
 	return node, nil
 }
@@ -287,14 +289,29 @@ func (n *Node) startRPC() error {
 		return err
 	}
 
+	// Load the secret authenticating the privileged modules and endpoint,
+	// generating it on the first start.
+	var jwtSecret []byte
+	if (n.config.HTTPHost != "" && len(n.config.HTTPAuthModules) != 0) || (n.config.WSHost != "" && len(n.config.WSAuthModules) != 0) || n.config.AuthHost != "" {
+		secret, err := ObtainJWTSecret(n.config.JWTSecret)
+		if err != nil {
+			return err
+		}
+		jwtSecret = secret
+	}
+
 	// Configure HTTP.
 	if n.config.HTTPHost != "" {
 		config := httpConfig{
 			CorsAllowedOrigins: n.config.HTTPCors,
 			Vhosts:             n.config.HTTPVirtualHosts,
 			Modules:            n.config.HTTPModules,
+			AuthModules:        n.config.HTTPAuthModules,
 			prefix:             n.config.HTTPPathPrefix,
 		}
+		if len(config.AuthModules) != 0 {
+			config.jwtSecret = jwtSecret
+		}
 		if err := n.http.setListenAddr(n.config.HTTPHost, n.config.HTTPPort); err != nil {
 			return err
 		}
@@ -307,9 +324,13 @@ func (n *Node) startRPC() error {
 	if n.config.WSHost != "" {
 		server := n.wsServerForPort(n.config.WSPort)
 		config := wsConfig{
-			Modules: n.config.WSModules,
-			Origins: n.config.WSOrigins,
-			prefix:  n.config.WSPathPrefix,
+			Modules:     n.config.WSModules,
+			AuthModules: n.config.WSAuthModules,
+			Origins:     n.config.WSOrigins,
+			prefix:      n.config.WSPathPrefix,
+		}
+		if len(config.AuthModules) != 0 {
+			config.jwtSecret = jwtSecret
 		}
 		if err := server.setListenAddr(n.config.WSHost, n.config.WSPort); err != nil {
 			return err
@@ -319,6 +340,23 @@ func (n *Node) startRPC() error {
 		}
 	}
 
+	// Configure the authenticated endpoint.
+	if n.config.AuthHost != "" {
+		config := httpConfig{
+			Vhosts:    []string{"*"},
+			jwtSecret: jwtSecret,
+		}
+		if err := n.httpAuth.setListenAddr(n.config.AuthHost, n.config.AuthPort); err != nil {
+			return err
+		}
+		if err := n.httpAuth.enableRPC(n.rpcAPIs, config); err != nil {
+			return err
+		}
+		if err := n.httpAuth.start(); err != nil {
+			return err
+		}
+	}
+
 	if err := n.http.start(); err != nil {
 		return err
 	}
@@ -335,6 +373,7 @@ func (n *Node) wsServerForPort(port int) *httpServer {
 func (n *Node) stopRPC() {
 	n.http.stop()
 	n.ws.stop()
+	n.httpAuth.stop()
 	n.stopInProc()
 }
 
@@ -445,6 +484,11 @@ func (n *Node) WSEndpoint() string {
 	return "ws://" + n.ws.listenAddr() + n.ws.wsConfig.prefix
 }
 
+// AuthEndpoint returns the URL of the authenticated HTTP server.
+func (n *Node) AuthEndpoint() string {
+	return "http://" + n.httpAuth.listenAddr()
+}
+
 // EventMux retrieves the event multiplexer used by all the network services in
 // the current protocol stack.
 func (n *Node) EventMux() *event.TypeMux {
@@ -39,19 +39,50 @@ type httpConfig struct {
 	Modules            []string
 	CorsAllowedOrigins []string
 	Vhosts             []string
-	prefix             string // path prefix on which to mount http handler
+	AuthModules        []string // modules only served to the requests carrying a valid JWT
+	prefix             string   // path prefix on which to mount http handler
+	jwtSecret          []byte   // optional JWT secret, see newRPCServers
 }
 
 // wsConfig is the JSON-RPC/Websocket configuration
 type wsConfig struct {
-	Origins []string
-	Modules []string
-	prefix  string // path prefix on which to mount ws handler
+	Origins     []string
+	Modules     []string
+	AuthModules []string // modules only served to the connections opened with a valid JWT
+	prefix      string   // path prefix on which to mount ws handler
+	jwtSecret   []byte   // optional JWT secret, see newRPCServers
 }
 
 type rpcHandler struct {
 	http.Handler
-	server *rpc.Server
+	server     *rpc.Server // serves the public modules, if any
+	authServer *rpc.Server // serves the authenticated modules, if any
+}
+
+// newRPCHandler creates the handler of the servers of an endpoint, serve
+// returning the handler of a single server. The requests to the
+// authenticated server have to carry a JWT signed with the secret.
+func newRPCHandler(srv *rpc.Server, authSrv *rpc.Server, secret []byte, serve func(*rpc.Server) http.Handler) *rpcHandler {
+	handler := &rpcHandler{server: srv, authServer: authSrv}
+	switch {
+	case authSrv == nil:
+		handler.Handler = serve(srv)
+	case srv == nil:
+		handler.Handler = newJWTHandler(secret, serve(authSrv))
+	default:
+		handler.Handler = newJWTNamespaceHandler(secret, serve(authSrv), serve(srv))
+	}
+	return handler
+}
+
+// stop stops the rpc servers of the handler.
+func (h *rpcHandler) stop() {
+	if h.server != nil {
+		h.server.Stop()
+	}
+	if h.authServer != nil {
+		h.authServer.Stop()
+	}
 }
 
 type httpServer struct {
@@ -161,6 +192,7 @@ func (h *httpServer) start() error {
 		"prefix":   h.httpConfig.prefix,
 		"cors":     strings.Join(h.httpConfig.CorsAllowedOrigins, ","),
 		"vhosts":   strings.Join(h.httpConfig.Vhosts, ","),
+		"auth":     strings.Join(h.httpConfig.AuthModules, ","),
 	}).Info("HTTP endpoint started")
 
 	// Log all handlers mounted on server.
@@ -257,11 +289,11 @@ func (h *httpServer) doStop() {
 	wsHandler := h.wsHandler.Load().(*rpcHandler)
 	if httpHandler != nil {
 		h.httpHandler.Store((*rpcHandler)(nil))
-		httpHandler.server.Stop()
+		httpHandler.stop()
 	}
 	if wsHandler != nil {
 		h.wsHandler.Store((*rpcHandler)(nil))
-		wsHandler.server.Stop()
+		wsHandler.stop()
 	}
 	h.server.Shutdown(context.Background())
 	h.listener.Close()
@@ -282,15 +314,14 @@ func (h *httpServer) enableRPC(apis []rpc.API, config httpConfig) error {
 	}
 
 	// Create RPC server and handler.
-	srv := rpc.NewServer(h.logger)
-	if err := RegisterApis(apis, config.Modules, srv, false, h.logger); err != nil {
+	srv, authSrv, err := newRPCServers(apis, config.Modules, config.AuthModules, config.jwtSecret, h.logger)
+	if err != nil {
 		return err
 	}
 	h.httpConfig = config
-	h.httpHandler.Store(&rpcHandler{
-		Handler: NewHTTPHandlerStack(srv, config.CorsAllowedOrigins, config.Vhosts),
-		server:  srv,
-	})
+	handler := newRPCHandler(srv, authSrv, config.jwtSecret, func(srv *rpc.Server) http.Handler { return srv })
+	handler.Handler = NewHTTPHandlerStack(handler.Handler, config.CorsAllowedOrigins, config.Vhosts)
+	h.httpHandler.Store(handler)
 	return nil
 }
 
@@ -299,7 +330,7 @@ func (h *httpServer) disableRPC() bool {
 	handler := h.httpHandler.Load().(*rpcHandler)
 	if handler != nil {
 		h.httpHandler.Store((*rpcHandler)(nil))
-		handler.server.Stop()
+		handler.stop()
 	}
 	return handler != nil
 }
@@ -314,15 +345,14 @@ func (h *httpServer) enableWS(apis []rpc.API, config wsConfig) error {
 	}
 
 	// Create RPC server and handler.
-	srv := rpc.NewServer(h.logger)
-	if err := RegisterApis(apis, config.Modules, srv, false, h.logger); err != nil {
+	srv, authSrv, err := newRPCServers(apis, config.Modules, config.AuthModules, config.jwtSecret, h.logger)
+	if err != nil {
 		return err
 	}
 	h.wsConfig = config
-	h.wsHandler.Store(&rpcHandler{
-		Handler: srv.WebsocketHandler(config.Origins),
-		server:  srv,
-	})
+	h.wsHandler.Store(newRPCHandler(srv, authSrv, config.jwtSecret, func(srv *rpc.Server) http.Handler {
+		return srv.WebsocketHandler(config.Origins)
+	}))
 	return nil
 }
 
@@ -343,7 +373,7 @@ func (h *httpServer) disableWS() bool {
 	ws := h.wsHandler.Load().(*rpcHandler)
 	if ws != nil {
 		h.wsHandler.Store((*rpcHandler)(nil))
-		ws.server.Stop()
+		ws.stop()
 	}
 	return ws != nil
 }
@@ -489,6 +519,9 @@ func RegisterApis(apis []rpc.API, modules []string, srv *rpc.Server, exposeAll b
 	}
 	// Register all the APIs exposed by the services
 	for _, api := range apis {
+		if api.Authenticated {
+			continue
+		}
 		if exposeAll || allowList[api.Namespace] || (len(allowList) == 0 && api.Public) {
 			if err := srv.RegisterName(api.Namespace, api.Service); err != nil {
 				return err
@@ -497,3 +530,71 @@ func RegisterApis(apis []rpc.API, modules []string, srv *rpc.Server, exposeAll b
 	}
 	return nil
 }
+
+// newRPCServers creates the public and authenticated servers of an endpoint.
+// Without a JWT secret, only the public server is created and serves the
+// modules. With a secret and no authModules, the whole endpoint requires a
+// JWT and only the authenticated server is created, serving the apis
+// restricted to authenticated endpoints. Otherwise the public server serves
+// the modules of the endpoint, or the public apis if none are configured,
+// except the authModules, and the authenticated server also serves the
+// authModules.
+func newRPCServers(apis []rpc.API, modules []string, authModules []string, secret []byte, logger *log.Logger) (*rpc.Server, *rpc.Server, error) {
+	if len(secret) == 0 {
+		srv := rpc.NewServer(logger)
+		if err := RegisterApis(apis, modules, srv, false, logger); err != nil {
+			return nil, nil, err
+		}
+		return srv, nil, nil
+	}
+	if len(authModules) == 0 {
+		authSrv := rpc.NewServer(logger)
+		if err := registerAuthenticatedApis(apis, authSrv); err != nil {
+			return nil, nil, err
+		}
+		return nil, authSrv, nil
+	}
+	if len(modules) == 0 {
+		for _, api := range apis {
+			if api.Public && !api.Authenticated {
+				modules = append(modules, api.Namespace)
+			}
+		}
+	}
+	requireAuth := make(map[string]bool)
+	for _, module := range authModules {
+		requireAuth[module] = true
+	}
+	var publicModules []string
+	for _, module := range modules {
+		if !requireAuth[module] {
+			publicModules = append(publicModules, module)
+		}
+	}
+	srv := rpc.NewServer(logger)
+	// An empty list would expose all the public apis
+	if len(publicModules) != 0 {
+		if err := RegisterApis(apis, publicModules, srv, false, logger); err != nil {
+			return nil, nil, err
+		}
+	}
+	authSrv := rpc.NewServer(logger)
+	if err := RegisterApis(apis, append(publicModules, authModules...), authSrv, false, logger); err != nil {
+		return nil, nil, err
+	}
+	return srv, authSrv, nil
+}
+
+// registerAuthenticatedApis registers the APIs which are only served on the
+// authenticated endpoint.
+func registerAuthenticatedApis(apis []rpc.API, srv *rpc.Server) error {
+	for _, api := range apis {
+		if !api.Authenticated {
+			continue
+		}
+		if err := srv.RegisterName(api.Namespace, api.Service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ package node
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -57,6 +58,64 @@ func TestVhosts(t *testing.T) {
 	assert.Equal(t, resp2.StatusCode, http.StatusForbidden)
 }
 
+// pingService is an api used to check which modules an endpoint serves.
+type pingService struct{}
+
+func (pingService) Ping() string { return "pong" }
+
+// TestAuthModules makes sure the modules requiring authentication are only
+// served to the requests carrying a valid token, while the other modules stay
+// public.
+func TestAuthModules(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	apis := []rpc.API{
+		{Namespace: "quai", Service: pingService{}, Public: true},
+		{Namespace: "admin", Service: pingService{}},
+	}
+	srv := newHTTPServer(log.Global, rpc.DefaultHTTPTimeouts)
+	assert.NoError(t, srv.enableRPC(apis, httpConfig{Modules: []string{"quai"}, AuthModules: []string{"admin"}, jwtSecret: secret}))
+	assert.NoError(t, srv.setListenAddr("localhost", 0))
+	assert.NoError(t, srv.start())
+	defer srv.stop()
+	url := "http://" + srv.listenAddr()
+
+	call := func(method string, headers ...string) (int, string) {
+		body := bytes.NewReader([]byte(`{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":[]}`))
+		req, err := http.NewRequest("POST", url, body)
+		assert.NoError(t, err)
+		req.Header.Set("content-type", "application/json")
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+
+	// Without a token only the public modules are served
+	status, body := call("quai_ping")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "pong")
+	status, body = call("admin_ping")
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotContains(t, body, "pong")
+
+	// With a valid token all the modules are served
+	token, err := NewJWTToken(secret)
+	assert.NoError(t, err)
+	_, body = call("quai_ping", "Authorization", "Bearer "+token)
+	assert.Contains(t, body, "pong")
+	_, body = call("admin_ping", "Authorization", "Bearer "+token)
+	assert.Contains(t, body, "pong")
+
+	// An invalid token is rejected
+	status, _ = call("quai_ping", "Authorization", "Bearer invalid")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
 type originTest struct {
 	spec    string
 	expOk   []string
@@ -1,6 +1,7 @@
 package node
 
 import (
+	"context"
 	"math/big"
 	"reflect"
 	"runtime/debug"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/dominant-strategies/go-quai/core/types"
 	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/metrics_config"
 	"github.com/dominant-strategies/go-quai/p2p"
 	"github.com/dominant-strategies/go-quai/p2p/node/pubsubManager"
 	"github.com/dominant-strategies/go-quai/p2p/node/streamManager"
@@ -20,6 +22,7 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/dominant-strategies/go-quai/common"
 )
@@ -304,6 +307,10 @@ func (p *P2PNode) UnprotectPeer(peer p2p.PeerID) {
 	p.peerManager.UnprotectPeer(peer)
 }
 
+func (p *P2PNode) PeerCount() int {
+	return p.connectionStats()
+}
+
 func (p *P2PNode) BanPeer(peer p2p.PeerID) {
 	log.Global.WithFields(log.Fields{
 		"peer": peer,
@@ -347,6 +354,16 @@ func (p *P2PNode) handleBroadcast(sourcePeer peer.ID, topic string, data interfa
 		return
 	}
 
+	// The attributes are only built if the span is exported
+	if metrics_config.TracingEnabled() {
+		_, span := metrics_config.StartSpan(context.Background(), "p2p.handleBroadcast",
+			attribute.String("topic", topic),
+			attribute.String("location", nodeLocation.Name()),
+			attribute.String("peer", sourcePeer.String()),
+		)
+		defer span.End()
+	}
+
 	switch v := data.(type) {
 	case types.WorkObjectHeader:
 		p.cacheAdd(v.Hash(), &v, nodeLocation)
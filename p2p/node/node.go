@@ -172,6 +172,8 @@ func NewNode(ctx context.Context, quitCh chan struct{}) (*P2PNode, error) {
 	// log the p2p node's ID
 	nodeID := host.ID()
 	log.Global.Infof("node created: %s", nodeID)
+	// Tag the entries of every logger with the ID of this node
+	log.SetDefaultField("node", nodeID.String())
 
 	// Set peer manager's self ID
 	peerMgr.SetSelfID(nodeID)
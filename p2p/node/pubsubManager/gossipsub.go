@@ -171,6 +171,10 @@ func (g *PubsubManager) Subscribe(location common.Location, datatype interface{}
 				if g.ctx.Err() != nil {
 					return
 				}
+				// the subscription was cancelled by an unsubscribe
+				if errors.Is(err, pubsub.ErrSubscriptionCancelled) {
+					return
+				}
 				log.Global.Errorf("error getting next message from subscription: %s", err)
 				continue
 			}
@@ -193,19 +197,23 @@ func (g *PubsubManager) Subscribe(location common.Location, datatype interface{}
 
 // unsubscribe from broadcasts of the given type of data
 func (g *PubsubManager) Unsubscribe(location common.Location, datatype interface{}) error {
-	if topic, err := NewTopic(g.genesis, location, datatype); err != nil {
-		if value, ok := g.subscriptions.Load(topic); ok {
-			value.(*pubsub.Subscription).Cancel()
-			g.subscriptions.Delete(topic)
-		}
-		if value, ok := g.topics.Load(topic); ok {
-			value.(*pubsub.Topic).Close()
-			g.topics.Delete(topic)
-		}
-		return nil
-	} else {
+	topicSub, err := NewTopic(g.genesis, location, datatype)
+	if err != nil {
 		return err
 	}
+	value, ok := g.topics.Load(topicSub.String())
+	if !ok {
+		return nil
+	}
+	topic := value.(*pubsub.Topic)
+	if value, ok := g.subscriptions.Load(topic); ok {
+		value.(*pubsub.Subscription).Cancel()
+		g.subscriptions.Delete(topic)
+	}
+	g.PubSub.UnregisterTopicValidator(topic.String())
+	topic.Close()
+	g.topics.Delete(topicSub.String())
+	return nil
 }
 
 // broadcasts data to subscribing peers
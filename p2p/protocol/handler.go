@@ -3,16 +3,19 @@ package protocol
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"math/big"
 	"runtime/debug"
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/dominant-strategies/go-quai/common"
 	"github.com/dominant-strategies/go-quai/core/types"
 	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/metrics_config"
 	"github.com/dominant-strategies/go-quai/p2p/pb"
 )
 
@@ -126,6 +129,15 @@ func handleRequest(quaiMsg *pb.QuaiRequestMessage, stream network.Stream, node Q
 		// TODO: handle error
 		return
 	}
+	// The attributes are only built if the span is exported
+	if metrics_config.TracingEnabled() {
+		_, span := metrics_config.StartSpan(context.Background(), "p2p.handleRequest",
+			attribute.String("request.type", fmt.Sprintf("%T", decodedType)),
+			attribute.String("location", loc.Name()),
+			attribute.String("peer", stream.Conn().RemotePeer().String()),
+		)
+		defer span.End()
+	}
 	switch query.(type) {
 	case *common.Hash:
 		log.Global.WithFields(log.Fields{
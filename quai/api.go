@@ -287,6 +287,12 @@ func (api *PrivateDebugAPI) Preimage(ctx context.Context, hash common.Hash) (hex
 	return nil, errors.New("unknown preimage")
 }
 
+// GetReorgHistory returns the most recent reorgs of the canonical chain, oldest
+// first, together with the entropy of the competing branches.
+func (api *PublicDebugAPI) GetReorgHistory() []*types.Reorg {
+	return rawdb.ReadReorgHistory(api.quai.ChainDb())
+}
+
 // AccountRangeMaxResults is the maximum number of results to be returned per call
 const AccountRangeMaxResults = 256
 
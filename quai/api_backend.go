@@ -128,6 +128,9 @@ func (b *QuaiAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumb
 	if number == rpc.LatestBlockNumber {
 		number = rpc.BlockNumber(b.quai.core.CurrentHeader().NumberU64(b.NodeCtx()))
 	}
+	if b.quai.core.HistoryPruned(b.quai.core.GetCanonicalHash(uint64(number)), uint64(number)) {
+		return nil, core.ErrHistoryPruned
+	}
 	block := b.quai.core.GetBlockByNumber(uint64(number))
 	if block != nil {
 		return block, nil
@@ -136,13 +139,29 @@ func (b *QuaiAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumb
 }
 
 func (b *QuaiAPIBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.WorkObject, error) {
+	if err := b.checkHistory(hash); err != nil {
+		return nil, err
+	}
 	return b.quai.core.GetBlockByHash(hash), nil
 }
 
 func (b *QuaiAPIBackend) BlockOrCandidateByHash(hash common.Hash) *types.WorkObject {
+	// Pruned blocks are not served, their bodies lack the transactions
+	if err := b.checkHistory(hash); err != nil {
+		return nil
+	}
 	return b.quai.core.GetBlockOrCandidateByHash(hash)
 }
 
+// checkHistory returns ErrHistoryPruned if the bodies and receipts of the block
+// with the given hash have been pruned.
+func (b *QuaiAPIBackend) checkHistory(hash common.Hash) error {
+	if number := rawdb.ReadHeaderNumber(b.quai.ChainDb(), hash); number != nil && b.quai.core.HistoryPruned(hash, *number) {
+		return core.ErrHistoryPruned
+	}
+	return nil
+}
+
 func (b *QuaiAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.WorkObject, error) {
 	if blockNr, ok := blockNrOrHash.Number(); ok {
 		return b.BlockByNumber(ctx, blockNr)
@@ -155,6 +174,9 @@ func (b *QuaiAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash
 		if blockNrOrHash.RequireCanonical && b.quai.core.GetCanonicalHash(header.NumberU64(b.NodeCtx())) != hash {
 			return nil, errors.New("hash is not currently canonical")
 		}
+		if b.quai.core.HistoryPruned(hash, header.NumberU64(b.NodeCtx())) {
+			return nil, core.ErrHistoryPruned
+		}
 		block := b.quai.core.GetBlock(hash, header.NumberU64(b.NodeCtx()))
 		if block == nil {
 			return nil, errors.New("header found, but block body is missing")
@@ -228,6 +250,9 @@ func (b *QuaiAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (typ
 	if nodeCtx != common.ZONE_CTX {
 		return nil, errors.New("getReceipts can only be called in zone chain")
 	}
+	if err := b.checkHistory(hash); err != nil {
+		return nil, err
+	}
 	return b.quai.core.GetReceiptsByHash(hash), nil
 }
 
@@ -245,6 +270,9 @@ func (b *QuaiAPIBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*ty
 	if nodeCtx != common.ZONE_CTX {
 		return nil, errors.New("getLogs can only be called in zone chain")
 	}
+	if err := b.checkHistory(hash); err != nil {
+		return nil, err
+	}
 	receipts := b.quai.core.GetReceiptsByHash(hash)
 	if receipts == nil {
 		return nil, nil
@@ -301,6 +329,14 @@ func (b *QuaiAPIBackend) SubscribeChainSideEvent(ch chan<- core.ChainSideEvent)
 	return b.quai.Core().SubscribeChainSideEvent(ch)
 }
 
+func (b *QuaiAPIBackend) SubscribeReorgEvent(ch chan<- core.ReorgEvent) event.Subscription {
+	return b.quai.Core().SubscribeReorgEvent(ch)
+}
+
+func (b *QuaiAPIBackend) SubscribeSyncEvent(ch chan<- core.SyncEvent) event.Subscription {
+	return b.quai.Core().SubscribeSyncEvent(ch)
+}
+
 func (b *QuaiAPIBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	nodeCtx := b.quai.core.NodeCtx()
 	if nodeCtx != common.ZONE_CTX {
@@ -364,6 +400,11 @@ func (b *QuaiAPIBackend) GetTransaction(ctx context.Context, txHash common.Hash)
 	if nodeCtx != common.ZONE_CTX {
 		return nil, common.Hash{}, 0, 0, errors.New("getTransaction can only be called in zone chain")
 	}
+	// The lookup entries outlive the history, telling pruned transactions apart.
+	// They always point to canonical blocks.
+	if number := rawdb.ReadTxLookupEntry(b.quai.ChainDb(), txHash); number != nil && b.quai.core.HistoryPruned(b.quai.core.GetCanonicalHash(*number), *number) {
+		return nil, common.Hash{}, 0, 0, core.ErrHistoryPruned
+	}
 	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(b.quai.ChainDb(), txHash)
 	if tx == nil {
 		return nil, common.Hash{}, 0, 0, errors.New("transaction not found")
@@ -482,8 +523,8 @@ func (b *QuaiAPIBackend) StateAtTransaction(ctx context.Context, block *types.Wo
 	return b.quai.core.StateAtTransaction(block, txIndex, reexec)
 }
 
-func (b *QuaiAPIBackend) Append(header *types.WorkObject, manifest types.BlockManifest, domPendingHeader *types.WorkObject, domTerminus common.Hash, domOrigin bool, newInboundEtxs types.Transactions) (types.Transactions, bool, bool, error) {
-	return b.quai.core.Append(header, manifest, domPendingHeader, domTerminus, domOrigin, newInboundEtxs)
+func (b *QuaiAPIBackend) Append(ctx context.Context, header *types.WorkObject, manifest types.BlockManifest, domPendingHeader *types.WorkObject, domTerminus common.Hash, domOrigin bool, newInboundEtxs types.Transactions) (types.Transactions, bool, bool, error) {
+	return b.quai.core.Append(ctx, header, manifest, domPendingHeader, domTerminus, domOrigin, newInboundEtxs)
 }
 
 func (b *QuaiAPIBackend) DownloadBlocksInManifest(hash common.Hash, manifest types.BlockManifest, entropy *big.Int) {
@@ -506,8 +547,8 @@ func (b *QuaiAPIBackend) PendingBlock() *types.WorkObject {
 	return b.quai.core.PendingBlock()
 }
 
-func (b *QuaiAPIBackend) SubRelayPendingHeader(pendingHeader types.PendingHeader, newEntropy *big.Int, location common.Location, subReorg bool, order int) {
-	b.quai.core.SubRelayPendingHeader(pendingHeader, newEntropy, location, subReorg, order)
+func (b *QuaiAPIBackend) SubRelayPendingHeader(ctx context.Context, pendingHeader types.PendingHeader, newEntropy *big.Int, location common.Location, subReorg bool, order int) {
+	b.quai.core.SubRelayPendingHeader(ctx, pendingHeader, newEntropy, location, subReorg, order)
 }
 
 func (b *QuaiAPIBackend) UpdateDom(oldTerminus common.Hash, pendingHeader types.PendingHeader, location common.Location) {
@@ -522,6 +563,26 @@ func (b *QuaiAPIBackend) ProcessingState() bool {
 	return b.quai.core.ProcessingState()
 }
 
+func (b *QuaiAPIBackend) BadHashExistsInChain() bool {
+	return b.quai.core.BadHashExistsInChain()
+}
+
+func (b *QuaiAPIBackend) AppendQueueLen() int {
+	return b.quai.core.AppendQueueLen()
+}
+
+func (b *QuaiAPIBackend) SyncProgress() core.SyncProgress {
+	return b.quai.core.SyncProgress()
+}
+
+func (b *QuaiAPIBackend) RecordKnownBlock(number uint64) {
+	b.quai.core.RecordKnownBlock(number)
+}
+
+func (b *QuaiAPIBackend) ArchiveMode() bool {
+	return b.quai.ArchiveMode()
+}
+
 func (b *QuaiAPIBackend) NewGenesisPendingHeader(pendingHeader *types.WorkObject, domTerminus common.Hash, genesisHash common.Hash) error {
 	return b.quai.core.NewGenesisPendigHeader(pendingHeader, domTerminus, genesisHash)
 }
@@ -574,6 +635,10 @@ func (b *QuaiAPIBackend) Logger() *log.Logger {
 	return b.quai.logger
 }
 
+func (b *QuaiAPIBackend) CheckIfEtxIsEligible(etxEligibleSlices common.Hash, location common.Location) bool {
+	return b.quai.core.CheckIfEtxIsEligible(etxEligibleSlices, location)
+}
+
 func (b *QuaiAPIBackend) GetSlicesRunning() []common.Location {
 	return b.quai.core.GetSlicesRunning()
 }
@@ -590,6 +655,10 @@ func (b *QuaiAPIBackend) SubscribeExpansionEvent(ch chan<- core.ExpansionEvent)
 	return b.quai.core.SubscribeExpansionEvent(ch)
 }
 
+func (b *QuaiAPIBackend) SubscribeBlockAppendEvent(ch chan<- core.BlockAppendEvent) event.Subscription {
+	return b.quai.core.SubscribeBlockAppendEvent(ch)
+}
+
 func (b *QuaiAPIBackend) SendWorkShare(workShare *types.WorkObjectHeader) error {
 	return b.quai.core.SendWorkShare(workShare)
 }
@@ -109,6 +109,23 @@ func New(stack *node.Node, p2p NetworkingAPI, config *quaiconfig.Config, nodeCtx
 	if err != nil {
 		return nil, err
 	}
+	// The tries of every block are committed to disk, so the historical state
+	// is only lost to the offline state pruner, which an archive database
+	// refuses. Refuse to silently switch an existing database between the
+	// modes, as a pruned database can't serve the state of every block.
+	gcMode := "full"
+	if config.NoPruning {
+		gcMode = "archive"
+	}
+	if storedMode := rawdb.ReadGCMode(chainDb); storedMode != "" {
+		if storedMode != gcMode {
+			return nil, fmt.Errorf("database was created with gcmode=%s, cannot start with gcmode=%s", storedMode, gcMode)
+		}
+	} else if config.NoPruning && rawdb.ReadHeadBlockHash(chainDb) != (common.Hash{}) {
+		return nil, fmt.Errorf("database was created with gcmode=full, resync from genesis to run with gcmode=archive")
+	} else {
+		rawdb.WriteGCMode(chainDb, gcMode)
+	}
 	// Only run the genesis block setup for Prime and region-0 and zone-0-0, for everything else it is setup through the expansion trigger
 	chainConfig := config.Genesis.Config
 	// This is not the normal protocol start, starting the protocol at a
@@ -236,6 +253,7 @@ func New(stack *node.Node, p2p NetworkingAPI, config *quaiconfig.Config, nodeCtx
 			TrieTimeLimit:        config.TrieTimeout,
 			SnapshotLimit:        config.SnapshotCache,
 			Preimages:            config.Preimages,
+			HistoryLimit:         config.HistoryLimit,
 		}
 	)
 
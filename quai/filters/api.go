@@ -29,6 +29,7 @@ import (
 	quai "github.com/dominant-strategies/go-quai"
 	"github.com/dominant-strategies/go-quai/common"
 	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/core"
 	"github.com/dominant-strategies/go-quai/core/types"
 	"github.com/dominant-strategies/go-quai/ethdb"
 	"github.com/dominant-strategies/go-quai/event"
@@ -288,6 +289,86 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 	return rpcSub, nil
 }
 
+// Reorgs send a notification each time the canonical head switches to a
+// competing branch, with the removed and added blocks and the entropy of both
+// branches.
+func (api *PublicFilterAPI) Reorgs(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				api.backend.Logger().WithFields(log.Fields{
+					"error":      r,
+					"stacktrace": string(debug.Stack()),
+				}).Fatal("Go-Quai Panicked")
+			}
+		}()
+		reorgs := make(chan *types.Reorg)
+		reorgsSub := api.events.SubscribeReorgs(reorgs)
+
+		for {
+			select {
+			case r := <-reorgs:
+				notifier.Notify(rpcSub.ID, r)
+			case <-rpcSub.Err():
+				reorgsSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				reorgsSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// Syncing sends the sync progress of the slice every few seconds while it is
+// syncing, and a last notification with syncing set to false once it has
+// caught up with its peers.
+func (api *PublicFilterAPI) Syncing(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				api.backend.Logger().WithFields(log.Fields{
+					"error":      r,
+					"stacktrace": string(debug.Stack()),
+				}).Fatal("Go-Quai Panicked")
+			}
+		}()
+		syncing := make(chan *core.SyncProgress)
+		syncSub := api.events.SubscribeSyncing(syncing)
+
+		for {
+			select {
+			case progress := <-syncing:
+				notifier.Notify(rpcSub.ID, progress)
+			case <-rpcSub.Err():
+				syncSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				syncSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
 func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
@@ -335,6 +416,125 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 	return rpcSub, nil
 }
 
+// UtxoFilterCriteria represents a request to subscribe to the Qi outpoints of a
+// set of addresses.
+type UtxoFilterCriteria struct {
+	Addresses []common.AddressBytes `json:"addresses"`
+}
+
+// Utxos creates a subscription that fires for every Qi outpoint created or
+// spent by one of the given addresses. If a block is reorged out of the chain
+// its outpoints are sent again with the removed flag set.
+func (api *PublicFilterAPI) Utxos(ctx context.Context, crit UtxoFilterCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if api.backend.NodeCtx() != common.ZONE_CTX || !api.backend.ProcessingState() {
+		return &rpc.Subscription{}, errors.New("utxos subscription is only available in zones processing state")
+	}
+	if len(crit.Addresses) == 0 {
+		return &rpc.Subscription{}, errors.New("no addresses given to the utxos subscription")
+	}
+
+	var (
+		rpcSub       = notifier.CreateSubscription()
+		matchedUtxos = make(chan []*UtxoEvent)
+		utxosSub     = api.events.SubscribeUtxos(crit.Addresses, matchedUtxos)
+	)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				api.backend.Logger().WithFields(log.Fields{
+					"error":      r,
+					"stacktrace": string(debug.Stack()),
+				}).Fatal("Go-Quai Panicked")
+			}
+		}()
+		for {
+			select {
+			case utxos := <-matchedUtxos:
+				for _, utxo := range utxos {
+					notifier.Notify(rpcSub.ID, utxo)
+				}
+			case <-rpcSub.Err(): // client send an unsubscribe request
+				utxosSub.Unsubscribe()
+				return
+			case <-notifier.Closed(): // connection dropped
+				utxosSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// EtxFilterCriteria represents a request to subscribe to the external
+// transactions of a set of addresses.
+type EtxFilterCriteria struct {
+	Addresses []common.AddressBytes `json:"addresses"`
+}
+
+// OutboundEtxs creates a subscription that fires for every external
+// transaction emitted by one of the given addresses.
+func (api *PublicFilterAPI) OutboundEtxs(ctx context.Context, crit EtxFilterCriteria) (*rpc.Subscription, error) {
+	return api.etxs(ctx, crit, api.events.SubscribeOutboundEtxs)
+}
+
+// InboundEtxs creates a subscription that fires for every external transaction
+// arriving at one of the given addresses, together with its receipt.
+func (api *PublicFilterAPI) InboundEtxs(ctx context.Context, crit EtxFilterCriteria) (*rpc.Subscription, error) {
+	return api.etxs(ctx, crit, api.events.SubscribeInboundEtxs)
+}
+
+func (api *PublicFilterAPI) etxs(ctx context.Context, crit EtxFilterCriteria, subscribe func([]common.AddressBytes, chan []*EtxEvent) *Subscription) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if api.backend.NodeCtx() != common.ZONE_CTX || !api.backend.ProcessingState() {
+		return &rpc.Subscription{}, errors.New("etx subscriptions are only available in zones processing state")
+	}
+	if len(crit.Addresses) == 0 {
+		return &rpc.Subscription{}, errors.New("no addresses given to the etx subscription")
+	}
+
+	var (
+		rpcSub      = notifier.CreateSubscription()
+		matchedEtxs = make(chan []*EtxEvent)
+		etxsSub     = subscribe(crit.Addresses, matchedEtxs)
+	)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				api.backend.Logger().WithFields(log.Fields{
+					"error":      r,
+					"stacktrace": string(debug.Stack()),
+				}).Fatal("Go-Quai Panicked")
+			}
+		}()
+		for {
+			select {
+			case etxs := <-matchedEtxs:
+				for _, etx := range etxs {
+					notifier.Notify(rpcSub.ID, etx)
+				}
+			case <-rpcSub.Err(): // client send an unsubscribe request
+				etxsSub.Unsubscribe()
+				return
+			case <-notifier.Closed(): // connection dropped
+				etxsSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // FilterCriteria represents a request to create a new filter.
 // Same as quai.FilterQuery but with UnmarshalJSON() method.
 type FilterCriteria quai.FilterQuery
@@ -22,9 +22,12 @@ import (
 	"math/big"
 
 	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
 	"github.com/dominant-strategies/go-quai/core"
 	"github.com/dominant-strategies/go-quai/core/bloombits"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
 	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/crypto"
 	"github.com/dominant-strategies/go-quai/ethdb"
 	"github.com/dominant-strategies/go-quai/event"
 	"github.com/dominant-strategies/go-quai/log"
@@ -40,6 +43,9 @@ type Backend interface {
 	GetBloom(blockHash common.Hash) (*types.Bloom, error)
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
+	SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) event.Subscription
+	SubscribeReorgEvent(ch chan<- core.ReorgEvent) event.Subscription
+	SubscribeSyncEvent(ch chan<- core.SyncEvent) event.Subscription
 	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
 	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
 	SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Subscription
@@ -329,6 +335,178 @@ Logs:
 	return ret
 }
 
+// UtxoEvent describes a Qi outpoint that was created or spent by a block.
+type UtxoEvent struct {
+	Address      common.AddressBytes `json:"address"`
+	TxHash       common.Hash         `json:"txHash"`
+	Index        hexutil.Uint64      `json:"index"`
+	Denomination hexutil.Uint64      `json:"denomination"`
+	Lock         *hexutil.Big        `json:"lock"`
+	Spent        bool                `json:"spent"`
+	SpentBy      *common.Hash        `json:"spentBy,omitempty"`
+	BlockHash    common.Hash         `json:"blockHash"`
+	BlockNumber  hexutil.Uint64      `json:"blockNumber"`
+	// Removed is true if this event is reverted because of a chain reorganisation.
+	Removed bool `json:"removed"`
+}
+
+// utxoEventsFromBlock returns the outpoints spent and created by the Qi
+// transactions and inbound Qi ETXs of the given block.
+func utxoEventsFromBlock(db ethdb.Reader, block *types.WorkObject, location common.Location, removed bool) []*UtxoEvent {
+	var (
+		events      []*UtxoEvent
+		blockHash   = block.Hash()
+		blockNumber = hexutil.Uint64(block.NumberU64(common.ZONE_CTX))
+	)
+	for _, tx := range block.Transactions() {
+		switch tx.Type() {
+		case types.QiTxType:
+			if !types.IsCoinBaseTx(tx, block.ParentHash(common.ZONE_CTX), location) {
+				spentBy := tx.Hash()
+				for _, in := range tx.TxIn() {
+					event := &UtxoEvent{
+						Address:     crypto.PubkeyBytesToAddress(in.PubKey, location).Bytes20(),
+						TxHash:      in.PreviousOutPoint.TxHash,
+						Index:       hexutil.Uint64(in.PreviousOutPoint.Index),
+						Spent:       true,
+						SpentBy:     &spentBy,
+						BlockHash:   blockHash,
+						BlockNumber: blockNumber,
+						Removed:     removed,
+					}
+					// The denomination and lock of a spent outpoint are only
+					// known from the transaction that created it
+					if prevTx, _, _, _ := rawdb.ReadTransaction(db, in.PreviousOutPoint.TxHash); prevTx != nil && prevTx.Type() == types.QiTxType {
+						if outs := prevTx.TxOut(); int(in.PreviousOutPoint.Index) < len(outs) {
+							event.Denomination = hexutil.Uint64(outs[in.PreviousOutPoint.Index].Denomination)
+							event.Lock = (*hexutil.Big)(outs[in.PreviousOutPoint.Index].Lock)
+						}
+					}
+					events = append(events, event)
+				}
+			}
+			for i, out := range tx.TxOut() {
+				events = append(events, &UtxoEvent{
+					Address:      common.BytesToAddress(out.Address, location).Bytes20(),
+					TxHash:       tx.Hash(),
+					Index:        hexutil.Uint64(i),
+					Denomination: hexutil.Uint64(out.Denomination),
+					Lock:         (*hexutil.Big)(out.Lock),
+					BlockHash:    blockHash,
+					BlockNumber:  blockNumber,
+					Removed:      removed,
+				})
+			}
+		case types.ExternalTxType:
+			// Quai->Qi conversion outputs depend on the prime terminus exchange
+			// rate and are not reported here
+			if tx.To() == nil || !tx.To().IsInQiLedgerScope() || tx.ETXSender().Location().Equal(*tx.To().Location()) {
+				continue
+			}
+			events = append(events, &UtxoEvent{
+				Address:      tx.To().Bytes20(),
+				TxHash:       tx.OriginatingTxHash(),
+				Index:        hexutil.Uint64(tx.ETXIndex()),
+				Denomination: hexutil.Uint64(tx.Value().Uint64()),
+				Lock:         (*hexutil.Big)(new(big.Int)),
+				BlockHash:    blockHash,
+				BlockNumber:  blockNumber,
+				Removed:      removed,
+			})
+		}
+	}
+	return events
+}
+
+// filterUtxoEvents creates a slice of utxo events belonging to the given addresses.
+func filterUtxoEvents(events []*UtxoEvent, addresses map[common.AddressBytes]struct{}) []*UtxoEvent {
+	var ret []*UtxoEvent
+	for _, event := range events {
+		if _, ok := addresses[event.Address]; ok {
+			ret = append(ret, event)
+		}
+	}
+	return ret
+}
+
+// EtxEvent describes an external transaction emitted or received by a block.
+type EtxEvent struct {
+	Hash                common.Hash         `json:"hash"`
+	OriginatingTxHash   common.Hash         `json:"originatingTxHash"`
+	EtxIndex            hexutil.Uint64      `json:"etxIndex"`
+	From                common.AddressBytes `json:"from"`
+	To                  common.AddressBytes `json:"to"`
+	Value               *hexutil.Big        `json:"value"`
+	SourceLocation      common.Location     `json:"sourceLocation"`
+	DestinationLocation common.Location     `json:"destinationLocation"`
+	BlockHash           common.Hash         `json:"blockHash"`
+	BlockNumber         hexutil.Uint64      `json:"blockNumber"`
+	// Receipt is the receipt of an inbound etx in the destination zone. Qi
+	// etxs do not produce a receipt.
+	Receipt *types.Receipt `json:"receipt,omitempty"`
+	// Removed is true if this event is reverted because of a chain reorganisation.
+	Removed bool `json:"removed"`
+}
+
+func newEtxEvent(etx *types.Transaction, block *types.WorkObject, removed bool) *EtxEvent {
+	event := &EtxEvent{
+		Hash:              etx.Hash(),
+		OriginatingTxHash: etx.OriginatingTxHash(),
+		EtxIndex:          hexutil.Uint64(etx.ETXIndex()),
+		From:              etx.ETXSender().Bytes20(),
+		Value:             (*hexutil.Big)(etx.Value()),
+		SourceLocation:    *etx.ETXSender().Location(),
+		BlockHash:         block.Hash(),
+		BlockNumber:       hexutil.Uint64(block.NumberU64(common.ZONE_CTX)),
+		Removed:           removed,
+	}
+	if to := etx.To(); to != nil {
+		event.To = to.Bytes20()
+		event.DestinationLocation = *to.Location()
+	}
+	return event
+}
+
+// outboundEtxEventsFromBlock returns the external transactions emitted by the
+// given block.
+func outboundEtxEventsFromBlock(block *types.WorkObject, removed bool) []*EtxEvent {
+	etxs := block.ExtTransactions()
+	events := make([]*EtxEvent, 0, len(etxs))
+	for _, etx := range etxs {
+		events = append(events, newEtxEvent(etx, block, removed))
+	}
+	return events
+}
+
+// inboundEtxEventsFromBlock returns the external transactions processed by the
+// given block.
+func inboundEtxEventsFromBlock(block *types.WorkObject, removed bool) []*EtxEvent {
+	var events []*EtxEvent
+	for _, tx := range block.Transactions() {
+		if tx.Type() == types.ExternalTxType {
+			events = append(events, newEtxEvent(tx, block, removed))
+		}
+	}
+	return events
+}
+
+// filterEtxEvents creates a slice of copied etx events sent from or to the
+// given addresses.
+func filterEtxEvents(events []*EtxEvent, addresses map[common.AddressBytes]struct{}, inbound bool) []*EtxEvent {
+	var ret []*EtxEvent
+	for _, event := range events {
+		addr := event.From
+		if inbound {
+			addr = event.To
+		}
+		if _, ok := addresses[addr]; ok {
+			cpy := *event
+			ret = append(ret, &cpy)
+		}
+	}
+	return ret
+}
+
 func bloomFilter(bloom types.Bloom, addresses []common.Address, topics [][]common.Hash) bool {
 	if len(addresses) > 0 {
 		var included bool
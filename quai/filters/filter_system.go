@@ -19,6 +19,7 @@
 package filters
 
 import (
+	"context"
 	"fmt"
 	"runtime/debug"
 	"sync"
@@ -27,6 +28,7 @@ import (
 	quai "github.com/dominant-strategies/go-quai"
 	"github.com/dominant-strategies/go-quai/common"
 	"github.com/dominant-strategies/go-quai/core"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
 	"github.com/dominant-strategies/go-quai/core/types"
 	"github.com/dominant-strategies/go-quai/event"
 	"github.com/dominant-strategies/go-quai/log"
@@ -51,6 +53,20 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// UtxosSubscription queries for created and spent Qi outpoints (and their
+	// reversals on chain reorg) belonging to a set of addresses
+	UtxosSubscription
+	// OutboundEtxsSubscription queries for external transactions emitted by a
+	// set of addresses
+	OutboundEtxsSubscription
+	// InboundEtxsSubscription queries for external transactions arriving at a
+	// set of addresses
+	InboundEtxsSubscription
+	// ReorgsSubscription queries for switches of the canonical head onto a
+	// competing branch
+	ReorgsSubscription
+	// SyncingSubscription queries for the sync progress of the slice
+	SyncingSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -65,19 +81,30 @@ const (
 	logsChanSize = 10
 	// chainEvChanSize is the size of channel listening to ChainEvent.
 	chainEvChanSize = 10
+	// chainSideChanSize is the size of channel listening to ChainSideEvent.
+	chainSideChanSize = 10
+	// reorgChanSize is the size of channel listening to ReorgEvent.
+	reorgChanSize = 10
+	// syncChanSize is the size of channel listening to SyncEvent.
+	syncChanSize = 10
 )
 
 type subscription struct {
-	id        rpc.ID
-	typ       Type
-	created   time.Time
-	logsCrit  quai.FilterQuery
-	logs      chan []*types.Log
-	hashes    chan []common.Hash
-	headers   chan *types.WorkObject
-	header    chan *types.WorkObject
-	installed chan struct{} // closed when the filter is installed
-	err       chan error    // closed when the filter is uninstalled
+	id          rpc.ID
+	typ         Type
+	created     time.Time
+	logsCrit    quai.FilterQuery
+	addressCrit map[common.AddressBytes]struct{}
+	logs        chan []*types.Log
+	utxos       chan []*UtxoEvent
+	etxs        chan []*EtxEvent
+	reorgs      chan *types.Reorg
+	syncing     chan *core.SyncProgress
+	hashes      chan []common.Hash
+	headers     chan *types.WorkObject
+	header      chan *types.WorkObject
+	installed   chan struct{} // closed when the filter is installed
+	err         chan error    // closed when the filter is uninstalled
 }
 
 // EventSystem creates subscriptions, processes events and broadcasts them to the
@@ -93,6 +120,9 @@ type EventSystem struct {
 	rmLogsSub      event.Subscription // Subscription for removed log event
 	pendingLogsSub event.Subscription // Subscription for pending log event
 	chainSub       event.Subscription // Subscription for new chain event
+	chainSideSub   event.Subscription // Subscription for chain side event
+	reorgSub       event.Subscription // Subscription for reorg event
+	syncSub        event.Subscription // Subscription for sync progress event
 
 	// Channels
 	install       chan *subscription         // install filter for event notification
@@ -102,6 +132,15 @@ type EventSystem struct {
 	pendingLogsCh chan []*types.Log          // Channel to receive new log event
 	rmLogsCh      chan core.RemovedLogsEvent // Channel to receive removed log event
 	chainCh       chan core.ChainEvent       // Channel to receive new chain event
+	chainSideCh   chan core.ChainSideEvent   // Channel to receive chain side event
+	reorgCh       chan core.ReorgEvent       // Channel to receive reorg event
+	syncCh        chan core.SyncEvent        // Channel to receive sync progress event
+	inboundEtxCh  chan *inboundEtxs          // Channel to receive inbound etxs with their receipts
+	quit          chan struct{}              // Closed when the event loop exits
+
+	// Inbound etxs waiting for their receipts, the first one being looked up.
+	// Only accessed by the event loop.
+	inboundEtxQueue []*inboundEtxs
 }
 
 // NewEventSystem creates a new manager that listens for event on the given mux,
@@ -120,6 +159,11 @@ func NewEventSystem(backend Backend) *EventSystem {
 		rmLogsCh:      make(chan core.RemovedLogsEvent, rmLogsChanSize),
 		pendingLogsCh: make(chan []*types.Log, logsChanSize),
 		chainCh:       make(chan core.ChainEvent, chainEvChanSize),
+		chainSideCh:   make(chan core.ChainSideEvent, chainSideChanSize),
+		reorgCh:       make(chan core.ReorgEvent, reorgChanSize),
+		syncCh:        make(chan core.SyncEvent, syncChanSize),
+		inboundEtxCh:  make(chan *inboundEtxs, 1),
+		quit:          make(chan struct{}),
 	}
 
 	nodeCtx := backend.NodeCtx()
@@ -129,16 +173,19 @@ func NewEventSystem(backend Backend) *EventSystem {
 		m.logsSub = m.backend.SubscribeLogsEvent(m.logsCh)
 		m.rmLogsSub = m.backend.SubscribeRemovedLogsEvent(m.rmLogsCh)
 		m.pendingLogsSub = m.backend.SubscribePendingLogsEvent(m.pendingLogsCh)
+		m.chainSideSub = m.backend.SubscribeChainSideEvent(m.chainSideCh)
 	}
 	m.chainSub = m.backend.SubscribeChainEvent(m.chainCh)
+	m.reorgSub = m.backend.SubscribeReorgEvent(m.reorgCh)
+	m.syncSub = m.backend.SubscribeSyncEvent(m.syncCh)
 
 	// Make sure none of the subscriptions are empty
 	if nodeCtx == common.ZONE_CTX && backend.ProcessingState() {
-		if m.txsSub == nil || m.logsSub == nil || m.rmLogsSub == nil || m.chainSub == nil || m.pendingLogsSub == nil {
+		if m.txsSub == nil || m.logsSub == nil || m.rmLogsSub == nil || m.chainSub == nil || m.pendingLogsSub == nil || m.chainSideSub == nil || m.reorgSub == nil || m.syncSub == nil {
 			backend.Logger().Fatal("Subscribe for event system failed")
 		}
 	} else {
-		if m.chainSub == nil {
+		if m.chainSub == nil || m.reorgSub == nil || m.syncSub == nil {
 			backend.Logger().Fatal("Subscribe for event system failed")
 		}
 	}
@@ -175,6 +222,10 @@ func (sub *Subscription) Unsubscribe() {
 			case <-sub.f.logs:
 			case <-sub.f.hashes:
 			case <-sub.f.headers:
+			case <-sub.f.utxos:
+			case <-sub.f.etxs:
+			case <-sub.f.reorgs:
+			case <-sub.f.syncing:
 			}
 		}
 
@@ -242,6 +293,10 @@ func (es *EventSystem) subscribeMinedPendingLogs(crit quai.FilterQuery, logs cha
 		logs:      logs,
 		hashes:    make(chan []common.Hash),
 		headers:   make(chan *types.WorkObject),
+		utxos:     make(chan []*UtxoEvent),
+		etxs:      make(chan []*EtxEvent),
+		reorgs:    make(chan *types.Reorg),
+		syncing:   make(chan *core.SyncProgress),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -259,6 +314,10 @@ func (es *EventSystem) subscribeLogs(crit quai.FilterQuery, logs chan []*types.L
 		logs:      logs,
 		hashes:    make(chan []common.Hash),
 		headers:   make(chan *types.WorkObject),
+		utxos:     make(chan []*UtxoEvent),
+		etxs:      make(chan []*EtxEvent),
+		reorgs:    make(chan *types.Reorg),
+		syncing:   make(chan *core.SyncProgress),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -276,6 +335,10 @@ func (es *EventSystem) subscribePendingLogs(crit quai.FilterQuery, logs chan []*
 		logs:      logs,
 		hashes:    make(chan []common.Hash),
 		headers:   make(chan *types.WorkObject),
+		utxos:     make(chan []*UtxoEvent),
+		etxs:      make(chan []*EtxEvent),
+		reorgs:    make(chan *types.Reorg),
+		syncing:   make(chan *core.SyncProgress),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -292,6 +355,10 @@ func (es *EventSystem) SubscribeNewHeads(headers chan *types.WorkObject) *Subscr
 		logs:      make(chan []*types.Log),
 		hashes:    make(chan []common.Hash),
 		headers:   headers,
+		utxos:     make(chan []*UtxoEvent),
+		etxs:      make(chan []*EtxEvent),
+		reorgs:    make(chan *types.Reorg),
+		syncing:   make(chan *core.SyncProgress),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -308,6 +375,114 @@ func (es *EventSystem) SubscribePendingTxs(hashes chan []common.Hash) *Subscript
 		logs:      make(chan []*types.Log),
 		hashes:    hashes,
 		headers:   make(chan *types.WorkObject),
+		utxos:     make(chan []*UtxoEvent),
+		etxs:      make(chan []*EtxEvent),
+		reorgs:    make(chan *types.Reorg),
+		syncing:   make(chan *core.SyncProgress),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
+// SubscribeUtxos creates a subscription that writes the Qi outpoints created or
+// spent by the given addresses in every block appended to the chain. Outpoints
+// of blocks that are reorged out of the canonical chain are written again with
+// the removed flag set.
+func (es *EventSystem) SubscribeUtxos(addresses []common.AddressBytes, utxos chan []*UtxoEvent) *Subscription {
+	crit := make(map[common.AddressBytes]struct{}, len(addresses))
+	for _, addr := range addresses {
+		crit[addr] = struct{}{}
+	}
+	sub := &subscription{
+		id:          rpc.NewID(),
+		typ:         UtxosSubscription,
+		created:     time.Now(),
+		addressCrit: crit,
+		logs:        make(chan []*types.Log),
+		hashes:      make(chan []common.Hash),
+		headers:     make(chan *types.WorkObject),
+		utxos:       utxos,
+		etxs:        make(chan []*EtxEvent),
+		reorgs:      make(chan *types.Reorg),
+		syncing:     make(chan *core.SyncProgress),
+		installed:   make(chan struct{}),
+		err:         make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
+// SubscribeOutboundEtxs creates a subscription that writes the external
+// transactions emitted by the given addresses in every block appended to the
+// chain.
+func (es *EventSystem) SubscribeOutboundEtxs(addresses []common.AddressBytes, etxs chan []*EtxEvent) *Subscription {
+	return es.subscribeEtxs(OutboundEtxsSubscription, addresses, etxs)
+}
+
+// SubscribeInboundEtxs creates a subscription that writes the external
+// transactions arriving at the given addresses in every block appended to the
+// chain, together with their receipts.
+func (es *EventSystem) SubscribeInboundEtxs(addresses []common.AddressBytes, etxs chan []*EtxEvent) *Subscription {
+	return es.subscribeEtxs(InboundEtxsSubscription, addresses, etxs)
+}
+
+func (es *EventSystem) subscribeEtxs(typ Type, addresses []common.AddressBytes, etxs chan []*EtxEvent) *Subscription {
+	crit := make(map[common.AddressBytes]struct{}, len(addresses))
+	for _, addr := range addresses {
+		crit[addr] = struct{}{}
+	}
+	sub := &subscription{
+		id:          rpc.NewID(),
+		typ:         typ,
+		created:     time.Now(),
+		addressCrit: crit,
+		logs:        make(chan []*types.Log),
+		hashes:      make(chan []common.Hash),
+		headers:     make(chan *types.WorkObject),
+		utxos:       make(chan []*UtxoEvent),
+		etxs:        etxs,
+		reorgs:      make(chan *types.Reorg),
+		syncing:     make(chan *core.SyncProgress),
+		installed:   make(chan struct{}),
+		err:         make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
+// SubscribeReorgs creates a subscription that writes every switch of the
+// canonical head onto a competing branch.
+func (es *EventSystem) SubscribeReorgs(reorgs chan *types.Reorg) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       ReorgsSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    make(chan []common.Hash),
+		headers:   make(chan *types.WorkObject),
+		utxos:     make(chan []*UtxoEvent),
+		etxs:      make(chan []*EtxEvent),
+		reorgs:    reorgs,
+		syncing:   make(chan *core.SyncProgress),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
+// SubscribeSyncing creates a subscription that writes the sync progress of
+// the slice while it is syncing, and once more when it is synced.
+func (es *EventSystem) SubscribeSyncing(syncing chan *core.SyncProgress) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       SyncingSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    make(chan []common.Hash),
+		headers:   make(chan *types.WorkObject),
+		utxos:     make(chan []*UtxoEvent),
+		etxs:      make(chan []*EtxEvent),
+		reorgs:    make(chan *types.Reorg),
+		syncing:   syncing,
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -363,20 +538,149 @@ func (es *EventSystem) handleChainEvent(filters filterIndex, ev core.ChainEvent)
 	for _, f := range filters[BlocksSubscription] {
 		f.headers <- ev.Block
 	}
+	if len(filters[UtxosSubscription]) > 0 {
+		es.handleUtxoEvents(filters, utxoEventsFromBlock(es.backend.ChainDb(), ev.Block, es.backend.NodeLocation(), false))
+	}
+	es.handleEtxEvents(filters, ev.Block, false)
+}
+
+func (es *EventSystem) handleChainSideEvent(filters filterIndex, ev core.ChainSideEvent) {
+	if len(filters[UtxosSubscription]) == 0 && len(filters[OutboundEtxsSubscription]) == 0 && len(filters[InboundEtxsSubscription]) == 0 {
+		return
+	}
+	db := es.backend.ChainDb()
+	for _, block := range ev.Blocks {
+		// Only the blocks whose state was applied were announced by a chain
+		// event, both the ones reorged out and the uncles processed before
+		// losing to a sibling, so only they have changes to revert
+		if !rawdb.ReadProcessedState(db, block.Hash()) {
+			continue
+		}
+		if len(filters[UtxosSubscription]) > 0 {
+			es.handleUtxoEvents(filters, utxoEventsFromBlock(db, block, es.backend.NodeLocation(), true))
+		}
+		es.handleEtxEvents(filters, block, true)
+	}
+}
+
+func (es *EventSystem) handleReorgEvent(filters filterIndex, ev core.ReorgEvent) {
+	for _, f := range filters[ReorgsSubscription] {
+		f.reorgs <- ev.Reorg
+	}
+}
+
+func (es *EventSystem) handleSyncEvent(filters filterIndex, ev core.SyncEvent) {
+	for _, f := range filters[SyncingSubscription] {
+		progress := ev.Progress
+		f.syncing <- &progress
+	}
+}
+
+func (es *EventSystem) handleEtxEvents(filters filterIndex, block *types.WorkObject, removed bool) {
+	if len(filters[OutboundEtxsSubscription]) > 0 {
+		outbound := outboundEtxEventsFromBlock(block, removed)
+		for _, f := range filters[OutboundEtxsSubscription] {
+			matched := filterEtxEvents(outbound, f.addressCrit, false)
+			if len(matched) > 0 {
+				f.etxs <- matched
+			}
+		}
+	}
+	if len(filters[InboundEtxsSubscription]) > 0 {
+		inbound := inboundEtxEventsFromBlock(block, removed)
+		if len(inbound) == 0 {
+			return
+		}
+		matched := make(map[rpc.ID][]*EtxEvent)
+		for _, f := range filters[InboundEtxsSubscription] {
+			if etxs := filterEtxEvents(inbound, f.addressCrit, true); len(etxs) > 0 {
+				matched[f.id] = etxs
+			}
+		}
+		if len(matched) == 0 {
+			return
+		}
+		// The receipts are looked up outside of the event loop, one block at
+		// a time so that the subscribers get the blocks in order
+		es.inboundEtxQueue = append(es.inboundEtxQueue, &inboundEtxs{block: block, matched: matched})
+		if len(es.inboundEtxQueue) == 1 {
+			go es.lookupInboundEtxReceipts(es.inboundEtxQueue[0])
+		}
+	}
+}
+
+// inboundEtxs are the inbound etxs of a block matched by the subscriptions,
+// waiting for their receipts.
+type inboundEtxs struct {
+	block   *types.WorkObject
+	matched map[rpc.ID][]*EtxEvent
+}
+
+// lookupInboundEtxReceipts sets the receipts of the matched inbound etxs and
+// hands them back to the event loop.
+func (es *EventSystem) lookupInboundEtxReceipts(etxs *inboundEtxs) {
+	blockReceipts, err := es.backend.GetReceipts(context.Background(), etxs.block.Hash())
+	if err != nil {
+		es.backend.Logger().WithField("err", err).Debug("Failed to retrieve receipts for inbound etxs")
+	}
+	receipts := make(map[common.Hash]*types.Receipt, len(blockReceipts))
+	for _, receipt := range blockReceipts {
+		receipts[receipt.TxHash] = receipt
+	}
+	for _, matched := range etxs.matched {
+		for _, etx := range matched {
+			etx.Receipt = receipts[etx.Hash]
+		}
+	}
+	select {
+	case es.inboundEtxCh <- etxs:
+	case <-es.quit:
+	}
+}
+
+// handleInboundEtxs sends the inbound etxs whose receipts were looked up to
+// the subscriptions still installed, and starts the lookup of the next block.
+func (es *EventSystem) handleInboundEtxs(filters filterIndex, etxs *inboundEtxs) {
+	for id, matched := range etxs.matched {
+		if f, ok := filters[InboundEtxsSubscription][id]; ok {
+			f.etxs <- matched
+		}
+	}
+	es.inboundEtxQueue = es.inboundEtxQueue[1:]
+	if len(es.inboundEtxQueue) > 0 {
+		go es.lookupInboundEtxReceipts(es.inboundEtxQueue[0])
+	}
+}
+
+func (es *EventSystem) handleUtxoEvents(filters filterIndex, ev []*UtxoEvent) {
+	if len(ev) == 0 {
+		return
+	}
+	for _, f := range filters[UtxosSubscription] {
+		matched := filterUtxoEvents(ev, f.addressCrit)
+		if len(matched) > 0 {
+			f.utxos <- matched
+		}
+	}
 }
 
 // eventLoop (un)installs filters and processes mux events.
 func (es *EventSystem) eventLoop() {
 	nodeCtx := es.backend.NodeCtx()
+	zoneEvents := nodeCtx == common.ZONE_CTX && es.backend.ProcessingState()
 	// Ensure all subscriptions get cleaned up
 	defer func() {
-		if nodeCtx == common.ZONE_CTX && es.backend.ProcessingState() {
+		close(es.quit)
+		if zoneEvents {
 			es.txsSub.Unsubscribe()
 			es.logsSub.Unsubscribe()
 			es.rmLogsSub.Unsubscribe()
 			es.pendingLogsSub.Unsubscribe()
+			es.chainSideSub.Unsubscribe()
 		}
 		es.chainSub.Unsubscribe()
+		es.reorgSub.Unsubscribe()
+		es.syncSub.Unsubscribe()
 		if r := recover(); r != nil {
 			es.backend.Logger().WithFields(log.Fields{
 				"error":      r,
@@ -390,44 +694,29 @@ func (es *EventSystem) eventLoop() {
 		index[i] = make(map[rpc.ID]*subscription)
 	}
 
-	if nodeCtx == common.ZONE_CTX && es.backend.ProcessingState() {
-		go es.handleZoneEventLoop(index)
+	// The zone events are only subscribed to by the zones processing state,
+	// the nil channels of the other slices never fire
+	var txsErr, logsErr, rmLogsErr, chainSideErr <-chan error
+	if zoneEvents {
+		txsErr, logsErr, rmLogsErr, chainSideErr = es.txsSub.Err(), es.logsSub.Err(), es.rmLogsSub.Err(), es.chainSideSub.Err()
 	}
 
 	for {
 		select {
 		case ev := <-es.chainCh:
 			es.handleChainEvent(index, ev)
-
-		case f := <-es.install:
-			if f.typ != MinedAndPendingLogsSubscription {
-				index[f.typ][f.id] = f
-			}
-			close(f.installed)
-
-		case f := <-es.uninstall:
-			if f.typ != MinedAndPendingLogsSubscription {
-				delete(index[f.typ], f.id)
-			}
-			close(f.err)
-
-		case <-es.chainSub.Err():
-			return
-		}
-	}
-}
-
-func (es *EventSystem) handleZoneEventLoop(index filterIndex) {
-	defer func() {
-		if r := recover(); r != nil {
-			es.backend.Logger().WithFields(log.Fields{
-				"error":      r,
-				"stacktrace": string(debug.Stack()),
-			}).Error("Go-Quai Panicked")
-		}
-	}()
-	for {
-		select {
+		case ev := <-es.chainSideCh:
+			// The chain events of the blocks of a side event are sent before
+			// it, so handle the ones still queued first for the subscribers to
+			// see the changes of a block before their reversal
+			es.drainChainEvents(index)
+			es.handleChainSideEvent(index, ev)
+		case ev := <-es.reorgCh:
+			es.handleReorgEvent(index, ev)
+		case ev := <-es.syncCh:
+			es.handleSyncEvent(index, ev)
+		case etxs := <-es.inboundEtxCh:
+			es.handleInboundEtxs(index, etxs)
 		case ev := <-es.txsCh:
 			es.handleTxsEvent(index, ev)
 		case ev := <-es.logsCh:
@@ -436,6 +725,7 @@ func (es *EventSystem) handleZoneEventLoop(index filterIndex) {
 			es.handleRemovedLogs(index, ev)
 		case ev := <-es.pendingLogsCh:
 			es.handlePendingLogs(index, ev)
+
 		case f := <-es.install:
 			if f.typ == MinedAndPendingLogsSubscription {
 				// the type are logs and pending logs subscriptions
@@ -455,12 +745,33 @@ func (es *EventSystem) handleZoneEventLoop(index filterIndex) {
 				delete(index[f.typ], f.id)
 			}
 			close(f.err)
+
 		// System stopped
-		case <-es.txsSub.Err():
+		case <-es.chainSub.Err():
+			return
+		case <-es.reorgSub.Err():
+			return
+		case <-es.syncSub.Err():
+			return
+		case <-txsErr:
+			return
+		case <-logsErr:
 			return
-		case <-es.logsSub.Err():
+		case <-rmLogsErr:
 			return
-		case <-es.rmLogsSub.Err():
+		case <-chainSideErr:
+			return
+		}
+	}
+}
+
+// drainChainEvents handles the chain events waiting in the channel.
+func (es *EventSystem) drainChainEvents(filters filterIndex) {
+	for {
+		select {
+		case ev := <-es.chainCh:
+			es.handleChainEvent(filters, ev)
+		default:
 			return
 		}
 	}
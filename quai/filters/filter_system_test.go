@@ -27,10 +27,12 @@ import (
 
 	quai "github.com/dominant-strategies/go-quai"
 	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
 	"github.com/dominant-strategies/go-quai/core"
 	"github.com/dominant-strategies/go-quai/core/bloombits"
 	"github.com/dominant-strategies/go-quai/core/rawdb"
 	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/crypto"
 	"github.com/dominant-strategies/go-quai/ethdb"
 	"github.com/dominant-strategies/go-quai/event"
 	"github.com/dominant-strategies/go-quai/log"
@@ -51,7 +53,12 @@ type testBackend struct {
 	rmLogsFeed        event.Feed
 	pendingLogsFeed   event.Feed
 	chainFeed         event.Feed
+	chainSideFeed     event.Feed
+	reorgFeed         event.Feed
+	syncFeed          event.Feed
 	pendingHeaderFeed event.Feed
+
+	getReceipts func(hash common.Hash) types.Receipts // overrides the receipts of the database
 }
 
 func (b *testBackend) ChainDb() ethdb.Database {
@@ -82,6 +89,9 @@ func (b *testBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*type
 }
 
 func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	if b.getReceipts != nil {
+		return b.getReceipts(hash), nil
+	}
 	if number := rawdb.ReadHeaderNumber(b.db, hash); number != nil {
 		return rawdb.ReadReceipts(b.db, hash, *number, params.TestChainConfig), nil
 	}
@@ -122,6 +132,18 @@ func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subsc
 	return b.chainFeed.Subscribe(ch)
 }
 
+func (b *testBackend) SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) event.Subscription {
+	return b.chainSideFeed.Subscribe(ch)
+}
+
+func (b *testBackend) SubscribeReorgEvent(ch chan<- core.ReorgEvent) event.Subscription {
+	return b.reorgFeed.Subscribe(ch)
+}
+
+func (b *testBackend) SubscribeSyncEvent(ch chan<- core.SyncEvent) event.Subscription {
+	return b.syncFeed.Subscribe(ch)
+}
+
 func (b *testBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, b.sections
 }
@@ -641,3 +663,299 @@ func flattenLogs(pl [][]*types.Log) []*types.Log {
 	}
 	return logs
 }
+
+// TestReorgSubscription tests whether reorg subscriptions receive every switch
+// of the canonical head onto a competing branch.
+func TestReorgSubscription(t *testing.T) {
+	t.Parallel()
+	var (
+		db      = rawdb.NewMemoryDatabase(log.Global)
+		backend = &testBackend{db: db}
+		es      = NewEventSystem(backend)
+
+		reorg = &types.Reorg{
+			OldHead:        common.HexToHash("0x01"),
+			NewHead:        common.HexToHash("0x02"),
+			CommonAncestor: common.HexToHash("0x03"),
+			Depth:          1,
+			Removed:        []common.Hash{common.HexToHash("0x01")},
+			Added:          []common.Hash{common.HexToHash("0x02")},
+			OldEntropy:     (*hexutil.Big)(big.NewInt(10)),
+			NewEntropy:     (*hexutil.Big)(big.NewInt(20)),
+		}
+	)
+
+	reorgs := make(chan *types.Reorg)
+	sub := es.SubscribeReorgs(reorgs)
+	defer sub.Unsubscribe()
+
+	backend.reorgFeed.Send(core.ReorgEvent{Reorg: reorg})
+	select {
+	case got := <-reorgs:
+		if got != reorg {
+			t.Errorf("invalid reorg event, want %+v, got %+v", reorg, got)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting for reorg event")
+	}
+}
+
+// TestSyncingSubscription tests whether syncing subscriptions receive the sync
+// progress of the slice.
+func TestSyncingSubscription(t *testing.T) {
+	t.Parallel()
+	var (
+		db      = rawdb.NewMemoryDatabase(log.Global)
+		backend = &testBackend{db: db}
+		es      = NewEventSystem(backend)
+
+		progress = core.SyncProgress{
+			Location:     "cyprus1",
+			Syncing:      true,
+			Stage:        core.SyncStageAppend,
+			CurrentBlock: 10,
+			HighestBlock: 100,
+		}
+	)
+
+	syncing := make(chan *core.SyncProgress)
+	sub := es.SubscribeSyncing(syncing)
+	defer sub.Unsubscribe()
+
+	backend.syncFeed.Send(core.SyncEvent{Progress: progress})
+	select {
+	case got := <-syncing:
+		if *got != progress {
+			t.Errorf("invalid sync progress, want %+v, got %+v", progress, *got)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting for sync event")
+	}
+}
+
+// TestUtxoSubscription tests whether utxo subscriptions receive the outpoints
+// created and spent by the watched addresses, and their reversal on reorg.
+func TestUtxoSubscription(t *testing.T) {
+	t.Parallel()
+	var (
+		db       = rawdb.NewMemoryDatabase(log.Global)
+		backend  = &testBackend{db: db}
+		es       = NewEventSystem(backend)
+		location = common.Location{0, 0}
+
+		key, _   = crypto.GenerateKey()
+		pubKey   = crypto.FromECDSAPub(&key.PublicKey)
+		spender  = crypto.PubkeyBytesToAddress(pubKey, location).Bytes20()
+		receiver = common.HexToAddressBytes("0x0094f5ea0ba39494ce83a213fffba74279579268")
+		other    = common.HexToAddressBytes("0x0071562b71999873db5b286df957af199ec94617")
+
+		prevOut = types.OutPoint{TxHash: common.HexToHash("0x1111"), Index: 2}
+		tx      = types.NewTx(&types.QiTx{
+			ChainID: big.NewInt(1),
+			TxIn:    types.TxIns{{PreviousOutPoint: prevOut, PubKey: pubKey}},
+			TxOut: types.TxOuts{
+				{Denomination: 3, Address: receiver[:], Lock: big.NewInt(0)},
+				{Denomination: 1, Address: other[:], Lock: big.NewInt(0)},
+			},
+		})
+		genesis = types.EmptyHeader(common.ZONE_CTX)
+		block   = genesis.WithBody(genesis.Header(), []*types.Transaction{tx}, nil, nil, nil, nil)
+	)
+
+	utxos := make(chan []*UtxoEvent)
+	sub := es.SubscribeUtxos([]common.AddressBytes{spender, receiver}, utxos)
+	defer sub.Unsubscribe()
+
+	check := func(removed bool) {
+		var got []*UtxoEvent
+		timeout := time.After(1 * time.Second)
+		for len(got) < 2 {
+			select {
+			case ev := <-utxos:
+				got = append(got, ev...)
+			case <-timeout:
+				t.Fatalf("timeout waiting for utxo events, got %d", len(got))
+			}
+		}
+		if len(got) != 2 {
+			t.Fatalf("invalid number of utxo events, want 2, got %d", len(got))
+		}
+		spent, created := got[0], got[1]
+		if !spent.Spent || spent.Address != spender || spent.TxHash != prevOut.TxHash || uint16(spent.Index) != prevOut.Index || spent.Removed != removed {
+			t.Errorf("invalid spent utxo event: %+v", spent)
+		}
+		if created.Spent || created.Address != receiver || created.TxHash != tx.Hash() || created.Index != 0 || created.Denomination != 3 || created.Removed != removed {
+			t.Errorf("invalid created utxo event: %+v", created)
+		}
+	}
+
+	backend.chainFeed.Send(core.ChainEvent{Block: block, Hash: block.Hash()})
+	check(false)
+
+	rawdb.WriteProcessedState(db, block.Hash())
+	backend.chainSideFeed.Send(core.ChainSideEvent{Blocks: []*types.WorkObject{block}})
+	check(true)
+}
+
+// TestUtxoSubscriptionOrder tests whether the reversal of a block is always
+// delivered after its changes, even when both events are queued together.
+func TestUtxoSubscriptionOrder(t *testing.T) {
+	t.Parallel()
+	var (
+		db       = rawdb.NewMemoryDatabase(log.Global)
+		backend  = &testBackend{db: db}
+		es       = NewEventSystem(backend)
+		key, _   = crypto.GenerateKey()
+		pubKey   = crypto.FromECDSAPub(&key.PublicKey)
+		receiver = common.HexToAddressBytes("0x0094f5ea0ba39494ce83a213fffba74279579268")
+		genesis  = types.EmptyHeader(common.ZONE_CTX)
+	)
+
+	utxos := make(chan []*UtxoEvent)
+	sub := es.SubscribeUtxos([]common.AddressBytes{receiver}, utxos)
+	defer sub.Unsubscribe()
+
+	for i := 0; i < 50; i++ {
+		tx := types.NewTx(&types.QiTx{
+			ChainID: big.NewInt(1),
+			TxIn:    types.TxIns{{PreviousOutPoint: types.OutPoint{TxHash: common.HexToHash("0x1111"), Index: uint16(i)}, PubKey: pubKey}},
+			TxOut:   types.TxOuts{{Denomination: 3, Address: receiver[:], Lock: big.NewInt(0)}},
+		})
+		block := genesis.WithBody(genesis.Header(), []*types.Transaction{tx}, nil, nil, nil, nil)
+		rawdb.WriteProcessedState(db, block.Hash())
+
+		backend.chainFeed.Send(core.ChainEvent{Block: block, Hash: block.Hash()})
+		backend.chainSideFeed.Send(core.ChainSideEvent{Blocks: []*types.WorkObject{block}})
+		for _, removed := range []bool{false, true} {
+			select {
+			case ev := <-utxos:
+				if len(ev) != 1 || ev[0].TxHash != tx.Hash() || ev[0].Removed != removed {
+					t.Fatalf("block %d: invalid utxo event, want removed %v, got %+v", i, removed, ev[0])
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatalf("block %d: timeout waiting for utxo events", i)
+			}
+		}
+	}
+}
+
+// TestEtxSubscriptions tests whether etx subscriptions receive the external
+// transactions emitted by and arriving at the watched addresses.
+func TestEtxSubscriptions(t *testing.T) {
+	t.Parallel()
+	var (
+		db      = rawdb.NewMemoryDatabase(log.Global)
+		backend = &testBackend{db: db}
+		es      = NewEventSystem(backend)
+
+		local    = common.HexToAddress("0x0094f5ea0ba39494ce83a213fffba74279579268", common.Location{0, 0})
+		remote   = common.HexToAddress("0x0171562b71999873db5b286df957af199ec94617", common.Location{0, 1})
+		foreign  = common.HexToAddress("0x1071562b71999873db5b286df957af199ec94617", common.Location{1, 0})
+		outbound = types.NewTx(&types.ExternalTx{
+			OriginatingTxHash: common.HexToHash("0x1111"),
+			ETXIndex:          1,
+			To:                &remote,
+			Value:             big.NewInt(10),
+			Sender:            local,
+		})
+		inbound = types.NewTx(&types.ExternalTx{
+			OriginatingTxHash: common.HexToHash("0x2222"),
+			ETXIndex:          3,
+			To:                &local,
+			Value:             big.NewInt(20),
+			Sender:            foreign,
+		})
+		genesis = types.EmptyHeader(common.ZONE_CTX)
+		block   = genesis.WithBody(genesis.Header(), []*types.Transaction{inbound}, []*types.Transaction{outbound}, nil, nil, nil)
+	)
+
+	outboundEtxs := make(chan []*EtxEvent)
+	outboundSub := es.SubscribeOutboundEtxs([]common.AddressBytes{local.Bytes20()}, outboundEtxs)
+	defer outboundSub.Unsubscribe()
+	inboundEtxs := make(chan []*EtxEvent)
+	inboundSub := es.SubscribeInboundEtxs([]common.AddressBytes{local.Bytes20()}, inboundEtxs)
+	defer inboundSub.Unsubscribe()
+
+	backend.chainFeed.Send(core.ChainEvent{Block: block, Hash: block.Hash()})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case evs := <-outboundEtxs:
+			if len(evs) != 1 {
+				t.Fatalf("invalid number of outbound etxs, want 1, got %d", len(evs))
+			}
+			if evs[0].Hash != outbound.Hash() || evs[0].To != remote.Bytes20() || !evs[0].DestinationLocation.Equal(common.Location{0, 1}) {
+				t.Errorf("invalid outbound etx event: %+v", evs[0])
+			}
+		case evs := <-inboundEtxs:
+			if len(evs) != 1 {
+				t.Fatalf("invalid number of inbound etxs, want 1, got %d", len(evs))
+			}
+			if evs[0].OriginatingTxHash != common.HexToHash("0x2222") || evs[0].EtxIndex != 3 || !evs[0].SourceLocation.Equal(common.Location{1, 0}) {
+				t.Errorf("invalid inbound etx event: %+v", evs[0])
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatalf("timeout waiting for etx events")
+		}
+	}
+}
+
+// TestInboundEtxReceipts tests whether the receipts of inbound etxs are looked
+// up without holding back the other subscriptions.
+func TestInboundEtxReceipts(t *testing.T) {
+	t.Parallel()
+	var (
+		db      = rawdb.NewMemoryDatabase(log.Global)
+		release = make(chan struct{})
+		backend = &testBackend{db: db}
+		es      = NewEventSystem(backend)
+
+		local   = common.HexToAddress("0x0094f5ea0ba39494ce83a213fffba74279579268", common.Location{0, 0})
+		foreign = common.HexToAddress("0x1071562b71999873db5b286df957af199ec94617", common.Location{1, 0})
+		inbound = types.NewTx(&types.ExternalTx{
+			OriginatingTxHash: common.HexToHash("0x2222"),
+			ETXIndex:          3,
+			To:                &local,
+			Value:             big.NewInt(20),
+			Sender:            foreign,
+		})
+		genesis = types.EmptyHeader(common.ZONE_CTX)
+		block   = genesis.WithBody(genesis.Header(), []*types.Transaction{inbound}, nil, nil, nil, nil)
+		receipt = &types.Receipt{TxHash: inbound.Hash(), Status: types.ReceiptStatusSuccessful, GasUsed: 21000}
+	)
+	backend.getReceipts = func(hash common.Hash) types.Receipts {
+		<-release
+		return types.Receipts{receipt}
+	}
+
+	inboundEtxs := make(chan []*EtxEvent)
+	inboundSub := es.SubscribeInboundEtxs([]common.AddressBytes{local.Bytes20()}, inboundEtxs)
+	defer inboundSub.Unsubscribe()
+	headers := make(chan *types.WorkObject)
+	headersSub := es.SubscribeNewHeads(headers)
+	defer headersSub.Unsubscribe()
+
+	backend.chainFeed.Send(core.ChainEvent{Block: block, Hash: block.Hash()})
+
+	// The new head is delivered while the receipts are still being looked up
+	select {
+	case header := <-headers:
+		if header.Hash() != block.Hash() {
+			t.Fatalf("invalid header, want %x, got %x", block.Hash(), header.Hash())
+		}
+	case <-inboundEtxs:
+		t.Fatalf("inbound etx delivered before its receipt was looked up")
+	case <-time.After(1 * time.Second):
+		t.Fatalf("timeout waiting for the new head, blocked by the receipt lookup")
+	}
+
+	close(release)
+	select {
+	case evs := <-inboundEtxs:
+		if len(evs) != 1 || evs[0].Hash != inbound.Hash() || evs[0].Receipt != receipt {
+			t.Fatalf("invalid inbound etx events: %+v", evs)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("timeout waiting for inbound etx events")
+	}
+}
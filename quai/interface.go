@@ -98,4 +98,7 @@ type NetworkingAPI interface {
 	UnprotectPeer(core.PeerID)
 	// Ban will close the connection and prevent future connections with this peer
 	BanPeer(core.PeerID)
+
+	// Returns the number of peers currently connected
+	PeerCount() int
 }
@@ -100,12 +100,22 @@ func (qbe *QuaiBackend) GetBackend(location common.Location) *quaiapi.Backend {
 	return nil
 }
 
+// backend returns the api backend of the given location, or nil if the slice
+// is not running in this process
+func (qbe *QuaiBackend) backend(location common.Location) quaiapi.Backend {
+	backend := qbe.GetBackend(location)
+	if backend == nil {
+		return nil
+	}
+	return *backend
+}
+
 // Handle consensus data propagated to us from our peers
 func (qbe *QuaiBackend) OnNewBroadcast(sourcePeer p2p.PeerID, topic string, data interface{}, nodeLocation common.Location) bool {
 	defer types.ObjectPool.Put(data)
 	switch data := data.(type) {
 	case types.WorkObjectBlockView:
-		backend := *qbe.GetBackend(nodeLocation)
+		backend := qbe.backend(nodeLocation)
 		if backend == nil {
 			log.Global.Error("no backend found")
 			return false
@@ -119,11 +129,12 @@ func (qbe *QuaiBackend) OnNewBroadcast(sourcePeer p2p.PeerID, topic string, data
 		// If it was a good broadcast, mark the peer as lively
 		qbe.p2pBackend.MarkLivelyPeer(sourcePeer, topic)
 	case types.WorkObjectHeaderView:
-		backend := *qbe.GetBackend(nodeLocation)
+		backend := qbe.backend(nodeLocation)
 		if backend == nil {
 			log.Global.Error("no backend found")
 			return false
 		}
+		backend.RecordKnownBlock(data.WorkObject.NumberU64(backend.NodeCtx()))
 		// Only append this in the case of the slice
 		if !backend.ProcessingState() && backend.NodeCtx() == common.ZONE_CTX {
 			backend.WriteBlock(data.WorkObject)
@@ -133,7 +144,7 @@ func (qbe *QuaiBackend) OnNewBroadcast(sourcePeer p2p.PeerID, topic string, data
 		// If it was a good broadcast, mark the peer as lively
 		qbe.p2pBackend.MarkLivelyPeer(sourcePeer, topic)
 	case types.Transactions:
-		backend := *qbe.GetBackend(nodeLocation)
+		backend := qbe.backend(nodeLocation)
 		if backend == nil {
 			log.Global.Error("no backend found")
 			return false
@@ -144,11 +155,15 @@ func (qbe *QuaiBackend) OnNewBroadcast(sourcePeer p2p.PeerID, topic string, data
 
 		// TODO: Handle the error here and mark the peers accordingly
 	case types.WorkObjectHeader:
-		backend := *qbe.GetBackend(nodeLocation)
+		backend := qbe.backend(nodeLocation)
 		if backend == nil {
 			log.Global.Error("no backend found")
 			return false
 		}
+		// A workshare is mined on the head of the peer
+		if backend.NodeCtx() == common.ZONE_CTX && data.NumberU64() > 0 {
+			backend.RecordKnownBlock(data.NumberU64() - 1)
+		}
 		backend.SendWorkShare(&data)
 
 		workShareIngressCounter.Inc()
@@ -184,7 +199,7 @@ func (qbe *QuaiBackend) ValidatorFunc() func(ctx context.Context, id p2p.PeerID,
 		data = msg.Message.GetData()
 		switch data := data.(type) {
 		case types.WorkObject:
-			backend := *qbe.GetBackend(data.Location())
+			backend := qbe.backend(data.Location())
 			if backend == nil {
 				log.Global.WithFields(log.Fields{
 					"peer":     id,
@@ -231,7 +246,7 @@ func (qbe *QuaiBackend) SetCurrentExpansionNumber(expansionNumber uint8) {
 
 // WriteGenesisBlock adds the genesis block to the database and also writes the block to the disk
 func (qbe *QuaiBackend) WriteGenesisBlock(block *types.WorkObject, location common.Location) {
-	backend := *qbe.GetBackend(location)
+	backend := qbe.backend(location)
 	if backend == nil {
 		log.Global.Error("no backend found")
 		return
@@ -241,7 +256,7 @@ func (qbe *QuaiBackend) WriteGenesisBlock(block *types.WorkObject, location comm
 
 // SetSubInterface sets the sub interface for the given subLocation
 func (qbe *QuaiBackend) SetSubInterface(subInterface core.CoreBackend, nodeLocation common.Location, subLocation common.Location) {
-	backend := *qbe.GetBackend(nodeLocation)
+	backend := qbe.backend(nodeLocation)
 	if backend == nil {
 		log.Global.Error("no backend found")
 		return
@@ -251,7 +266,7 @@ func (qbe *QuaiBackend) SetSubInterface(subInterface core.CoreBackend, nodeLocat
 
 // SetDomInterface sets the dom interface for the given location
 func (qbe *QuaiBackend) SetDomInterface(domInterface core.CoreBackend, nodeLocation common.Location) {
-	backend := *qbe.GetBackend(nodeLocation)
+	backend := qbe.backend(nodeLocation)
 	if backend == nil {
 		log.Global.Error("no backend found")
 		return
@@ -261,7 +276,7 @@ func (qbe *QuaiBackend) SetDomInterface(domInterface core.CoreBackend, nodeLocat
 
 // AddGenesisPendingEtxs adds the genesis pending etxs for the given location
 func (qbe *QuaiBackend) AddGenesisPendingEtxs(block *types.WorkObject, location common.Location) {
-	backend := *qbe.GetBackend(location)
+	backend := qbe.backend(location)
 	if backend == nil {
 		log.Global.Error("no backend found")
 		return
@@ -273,7 +288,7 @@ func (qbe *QuaiBackend) LookupBlock(hash common.Hash, location common.Location)
 	if qbe == nil {
 		return nil
 	}
-	backend := *qbe.GetBackend(location)
+	backend := qbe.backend(location)
 	if backend == nil {
 		log.Global.Error("no backend found")
 		return nil
@@ -282,7 +297,7 @@ func (qbe *QuaiBackend) LookupBlock(hash common.Hash, location common.Location)
 }
 
 func (qbe *QuaiBackend) LookupBlockHashByNumber(number *big.Int, location common.Location) *common.Hash {
-	backend := *qbe.GetBackend(location)
+	backend := qbe.backend(location)
 	if backend == nil {
 		log.Global.Error("no backend found")
 		return nil
@@ -300,7 +315,7 @@ func (qbe *QuaiBackend) LookupBlockHashByNumber(number *big.Int, location common
 }
 
 func (qbe *QuaiBackend) ProcessingState(location common.Location) bool {
-	backend := *qbe.GetBackend(location)
+	backend := qbe.backend(location)
 	if backend == nil {
 		log.Global.Error("no backend found")
 		return false
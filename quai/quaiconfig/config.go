@@ -80,9 +80,10 @@ var Defaults = Config{
 	TrieTimeout:               60 * time.Minute,
 	SnapshotCache:             102,
 	Miner: core.Config{
-		GasCeil:  18000000,
-		GasPrice: big.NewInt(params.GWei),
-		Recommit: 3 * time.Second,
+		GasCeil:      18000000,
+		GasPrice:     big.NewInt(params.GWei),
+		Recommit:     3 * time.Second,
+		BlockBuilder: core.DefaultBlockBuilder,
 	},
 	TxPool:      core.DefaultTxPoolConfig,
 	RPCGasCap:   50000000,
@@ -110,6 +111,7 @@ type Config struct {
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	HistoryLimit  uint64 `toml:",omitempty"` // The maximum number of blocks from head whose bodies and receipts are kept.
 
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
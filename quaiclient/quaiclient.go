@@ -111,6 +111,16 @@ func (ec *Client) HeaderByNumber(ctx context.Context, number string) *types.Head
 	return header
 }
 
+// BlockReceipts returns the receipts of all the transactions of the given block.
+func (ec *Client) BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]*types.Receipt, error) {
+	var r []*types.Receipt
+	err := ec.c.CallContext(ctx, &r, "quai_getBlockReceipts", blockNrOrHash)
+	if err == nil && r == nil {
+		return nil, quai.NotFound
+	}
+	return r, err
+}
+
 //// Miner APIS
 
 // GetPendingHeader gets the latest pending header from the chain.
@@ -0,0 +1,103 @@
+package quaiclient
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	quai "github.com/dominant-strategies/go-quai"
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/crypto"
+	"github.com/dominant-strategies/go-quai/internal/quaiapi"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/params"
+	"github.com/dominant-strategies/go-quai/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+var receiptsTestLocation = common.Location{0, 0}
+
+// receiptsTestBackend serves a single block and its receipts.
+type receiptsTestBackend struct {
+	quaiapi.Backend
+	config   *params.ChainConfig
+	block    *types.WorkObject
+	receipts types.Receipts
+}
+
+func (b *receiptsTestBackend) NodeCtx() int                     { return common.ZONE_CTX }
+func (b *receiptsTestBackend) NodeLocation() common.Location    { return receiptsTestLocation }
+func (b *receiptsTestBackend) ChainConfig() *params.ChainConfig { return b.config }
+
+func (b *receiptsTestBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.WorkObject, error) {
+	if hash, ok := blockNrOrHash.Hash(); ok && hash != b.block.Hash() {
+		return nil, nil
+	}
+	return b.block, nil
+}
+
+func (b *receiptsTestBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.receipts, nil
+}
+
+func TestBlockReceipts(t *testing.T) {
+	config := *params.TestChainConfig
+	config.Location = receiptsTestLocation
+	key, _ := crypto.GenerateKey()
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa", receiptsTestLocation)
+	tx, err := types.SignTx(types.NewTx(&types.QuaiTx{
+		ChainID:   config.ChainID,
+		GasTipCap: new(big.Int),
+		GasFeeCap: new(big.Int),
+		Gas:       21000,
+		To:        &to,
+		Value:     new(big.Int),
+	}), types.LatestSigner(&config), key)
+	require.NoError(t, err)
+	qiTo := common.BytesToAddress(utxoProofAddress(1), receiptsTestLocation)
+	sender := common.HexToAddress("0x1000000000000000000000000000000000000022", receiptsTestLocation)
+	etx := types.NewTx(&types.ExternalTx{OriginatingTxHash: common.Hash{3}, ETXIndex: 1, Gas: 50000, To: &qiTo, Value: big.NewInt(1), Sender: sender})
+
+	block := types.EmptyHeader(common.ZONE_CTX)
+	block.SetNumber(big.NewInt(7), common.ZONE_CTX)
+	block.Body().SetTransactions(types.Transactions{tx, etx})
+	backend := &receiptsTestBackend{
+		config: &config,
+		block:  block,
+		receipts: types.Receipts{
+			{Status: types.ReceiptStatusSuccessful, TxHash: tx.Hash(), GasUsed: 21000, CumulativeGasUsed: 21000, Logs: []*types.Log{}, Etxs: types.Transactions{}},
+		},
+	}
+
+	server := rpc.NewServer(log.Global)
+	require.NoError(t, server.RegisterName("quai", quaiapi.NewPublicTransactionPoolAPI(backend, nil)))
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+	client, err := Dial(httpServer.URL, log.Global)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+
+	// The executed transaction and the Qi bound etx are both reported
+	receipts, err := client.BlockReceipts(context.Background(), rpc.BlockNumberOrHashWithHash(block.Hash(), false))
+	require.NoError(t, err)
+	require.Len(t, receipts, 2)
+	require.Equal(t, tx.Hash(), receipts[0].TxHash)
+	require.Equal(t, uint64(21000), receipts[0].GasUsed)
+	require.Equal(t, etx.Hash(), receipts[1].TxHash)
+	require.Equal(t, params.CallValueTransferGas, receipts[1].GasUsed)
+	require.Equal(t, 21000+params.CallValueTransferGas, receipts[1].CumulativeGasUsed)
+	for i, receipt := range receipts {
+		require.Equal(t, types.ReceiptStatusSuccessful, receipt.Status)
+		require.Equal(t, block.Hash(), receipt.BlockHash)
+		require.Equal(t, uint(i), receipt.TransactionIndex)
+	}
+
+	// An unknown block is not found
+	_, err = client.BlockReceipts(context.Background(), rpc.BlockNumberOrHashWithHash(common.Hash{0x01}, false))
+	require.ErrorIs(t, err, quai.NotFound)
+}
@@ -0,0 +1,301 @@
+package quaiclient
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/node"
+	"github.com/dominant-strategies/go-quai/rpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/protobuf/proto"
+)
+
+// sliceRequestTimeout is the maximum time a dom/sub coordination call is
+// allowed to take
+const sliceRequestTimeout = 60 * time.Second
+
+// SliceClient implements the dom/sub coordination interface of a slice
+// running in another process over its authenticated RPC endpoint.
+type SliceClient struct {
+	c        *rpc.Client
+	location common.Location // location of the local slice, used to decode responses
+	remote   common.Location
+	logger   *log.Logger
+}
+
+// jwtTransport signs every request with a freshly issued token.
+type jwtTransport struct {
+	secret []byte
+	next   http.RoundTripper
+}
+
+func (t *jwtTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := node.NewJWTToken(t.secret)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	// Carry the trace of the block being processed to the remote slice
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return t.next.RoundTrip(req)
+}
+
+// DialSlice connects to the authenticated endpoint of the slice at the
+// remote location.
+func DialSlice(rawurl string, secret []byte, location common.Location, remote common.Location, logger *log.Logger) (*SliceClient, error) {
+	client := &http.Client{Transport: &jwtTransport{secret: secret, next: http.DefaultTransport}}
+	c, err := rpc.DialHTTPWithClient(rawurl, client)
+	if err != nil {
+		return nil, err
+	}
+	return &SliceClient{c: c, location: location, remote: remote, logger: logger}, nil
+}
+
+func (sc *SliceClient) Close() {
+	sc.c.Close()
+}
+
+// call performs the rpc call, retrying while the remote slice is unreachable
+// so that the processes of a node can be started in any order.
+func (sc *SliceClient) call(result interface{}, method string, args ...interface{}) error {
+	return sc.callContext(context.Background(), result, method, args...)
+}
+
+// callContext performs the rpc call as part of the trace carried by the
+// context.
+func (sc *SliceClient) callContext(parent context.Context, result interface{}, method string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(parent, sliceRequestTimeout)
+	defer cancel()
+	for attempts := 1; ; attempts++ {
+		err := sc.c.CallContext(ctx, result, method, args...)
+		var opErr *net.OpError
+		if err == nil || !errors.As(err, &opErr) {
+			return err
+		}
+		sc.logger.WithFields(log.Fields{
+			"attempts": attempts,
+			"location": sc.remote.Name(),
+			"err":      err,
+		}).Warn("Remote slice unreachable. Waiting and retrying...")
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// notify performs a call whose result the interface does not return, logging
+// any failure.
+func (sc *SliceClient) notify(method string, args ...interface{}) {
+	if err := sc.call(nil, method, args...); err != nil {
+		sc.logger.WithFields(log.Fields{
+			"method":   method,
+			"location": sc.remote.Name(),
+			"err":      err,
+		}).Error("Slice rpc call failed")
+	}
+}
+
+func encodeWorkObject(wo *types.WorkObject) (hexutil.Bytes, error) {
+	protoWo, err := wo.ProtoEncode(types.BlockObject)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(protoWo)
+}
+
+func encodePendingHeader(ph types.PendingHeader) (hexutil.Bytes, error) {
+	protoPh, err := ph.ProtoEncode()
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(protoPh)
+}
+
+func encodeManifest(manifest types.BlockManifest) (hexutil.Bytes, error) {
+	protoManifest, err := manifest.ProtoEncode()
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(protoManifest)
+}
+
+func (sc *SliceClient) AddPendingEtxs(pEtxs types.PendingEtxs) error {
+	protoPEtxs, err := pEtxs.ProtoEncode()
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(protoPEtxs)
+	if err != nil {
+		return err
+	}
+	return sc.call(nil, "slice_addPendingEtxs", hexutil.Bytes(data))
+}
+
+func (sc *SliceClient) AddPendingEtxsRollup(pEtxRollup types.PendingEtxsRollup) error {
+	protoRollup, err := pEtxRollup.ProtoEncode()
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(protoRollup)
+	if err != nil {
+		return err
+	}
+	return sc.call(nil, "slice_addPendingEtxsRollup", hexutil.Bytes(data))
+}
+
+func (sc *SliceClient) UpdateDom(oldTerminus common.Hash, pendingHeader types.PendingHeader, location common.Location) {
+	data, err := encodePendingHeader(pendingHeader)
+	if err != nil {
+		sc.logger.WithField("err", err).Error("Failed to encode pending header")
+		return
+	}
+	sc.notify("slice_updateDom", oldTerminus, data, hexutil.Bytes(location))
+}
+
+func (sc *SliceClient) RequestDomToAppendOrFetch(hash common.Hash, entropy *big.Int, order int) {
+	sc.notify("slice_requestDomToAppendOrFetch", hash, (*hexutil.Big)(entropy), order)
+}
+
+func (sc *SliceClient) SubRelayPendingHeader(ctx context.Context, pendingHeader types.PendingHeader, newEntropy *big.Int, location common.Location, subReorg bool, order int) {
+	data, err := encodePendingHeader(pendingHeader)
+	if err != nil {
+		sc.logger.WithField("err", err).Error("Failed to encode pending header")
+		return
+	}
+	if err := sc.callContext(ctx, nil, "slice_subRelayPendingHeader", data, (*hexutil.Big)(newEntropy), hexutil.Bytes(location), subReorg, order); err != nil {
+		sc.logger.WithFields(log.Fields{
+			"method":   "slice_subRelayPendingHeader",
+			"location": sc.remote.Name(),
+			"err":      err,
+		}).Error("Slice rpc call failed")
+	}
+}
+
+func (sc *SliceClient) Append(ctx context.Context, header *types.WorkObject, manifest types.BlockManifest, domPendingHeader *types.WorkObject, domTerminus common.Hash, domOrigin bool, newInboundEtxs types.Transactions) (types.Transactions, bool, bool, error) {
+	headerData, err := encodeWorkObject(header)
+	if err != nil {
+		return nil, false, false, err
+	}
+	manifestData, err := encodeManifest(manifest)
+	if err != nil {
+		return nil, false, false, err
+	}
+	phData, err := encodeWorkObject(domPendingHeader)
+	if err != nil {
+		return nil, false, false, err
+	}
+	protoEtxs, err := newInboundEtxs.ProtoEncode()
+	if err != nil {
+		return nil, false, false, err
+	}
+	etxData, err := proto.Marshal(protoEtxs)
+	if err != nil {
+		return nil, false, false, err
+	}
+	var result struct {
+		PendingEtxs hexutil.Bytes `json:"pendingEtxs"`
+		SubReorg    bool          `json:"subReorg"`
+		SetHead     bool          `json:"setHead"`
+	}
+	if err := sc.callContext(ctx, &result, "slice_append", headerData, manifestData, phData, domTerminus, domOrigin, hexutil.Bytes(etxData)); err != nil {
+		return nil, false, false, err
+	}
+	protoPendingEtxs := new(types.ProtoTransactions)
+	if err := proto.Unmarshal(result.PendingEtxs, protoPendingEtxs); err != nil {
+		return nil, false, false, err
+	}
+	var pendingEtxs types.Transactions
+	if err := pendingEtxs.ProtoDecode(protoPendingEtxs, sc.location); err != nil {
+		return nil, false, false, err
+	}
+	return pendingEtxs, result.SubReorg, result.SetHead, nil
+}
+
+func (sc *SliceClient) DownloadBlocksInManifest(hash common.Hash, manifest types.BlockManifest, entropy *big.Int) {
+	data, err := encodeManifest(manifest)
+	if err != nil {
+		sc.logger.WithField("err", err).Error("Failed to encode manifest")
+		return
+	}
+	sc.notify("slice_downloadBlocksInManifest", hash, data, (*hexutil.Big)(entropy))
+}
+
+func (sc *SliceClient) GenerateRecoveryPendingHeader(pendingHeader *types.WorkObject, checkpointHashes types.Termini) error {
+	phData, err := encodeWorkObject(pendingHeader)
+	if err != nil {
+		return err
+	}
+	terminiData, err := proto.Marshal(checkpointHashes.ProtoEncode())
+	if err != nil {
+		return err
+	}
+	return sc.call(nil, "slice_generateRecoveryPendingHeader", phData, hexutil.Bytes(terminiData))
+}
+
+func (sc *SliceClient) GetPendingEtxsRollupFromSub(hash common.Hash, location common.Location) (types.PendingEtxsRollup, error) {
+	var data hexutil.Bytes
+	if err := sc.call(&data, "slice_getPendingEtxsRollupFromSub", hash, hexutil.Bytes(location)); err != nil {
+		return types.PendingEtxsRollup{}, err
+	}
+	protoRollup := new(types.ProtoPendingEtxsRollup)
+	if err := proto.Unmarshal(data, protoRollup); err != nil {
+		return types.PendingEtxsRollup{}, err
+	}
+	var rollup types.PendingEtxsRollup
+	if err := rollup.ProtoDecode(protoRollup, sc.location); err != nil {
+		return types.PendingEtxsRollup{}, err
+	}
+	return rollup, nil
+}
+
+func (sc *SliceClient) GetPendingEtxsFromSub(hash common.Hash, location common.Location) (types.PendingEtxs, error) {
+	var data hexutil.Bytes
+	if err := sc.call(&data, "slice_getPendingEtxsFromSub", hash, hexutil.Bytes(location)); err != nil {
+		return types.PendingEtxs{}, err
+	}
+	protoPEtxs := new(types.ProtoPendingEtxs)
+	if err := proto.Unmarshal(data, protoPEtxs); err != nil {
+		return types.PendingEtxs{}, err
+	}
+	var pEtxs types.PendingEtxs
+	if err := pEtxs.ProtoDecode(protoPEtxs, sc.location); err != nil {
+		return types.PendingEtxs{}, err
+	}
+	return pEtxs, nil
+}
+
+func (sc *SliceClient) NewGenesisPendingHeader(pendingHeader *types.WorkObject, domTerminus common.Hash, hash common.Hash) error {
+	data, err := encodeWorkObject(pendingHeader)
+	if err != nil {
+		return err
+	}
+	return sc.call(nil, "slice_newGenesisPendingHeader", data, domTerminus, hash)
+}
+
+func (sc *SliceClient) GetManifest(blockHash common.Hash) (types.BlockManifest, error) {
+	var data hexutil.Bytes
+	if err := sc.call(&data, "slice_getManifest", blockHash); err != nil {
+		return nil, err
+	}
+	protoManifest := new(types.ProtoManifest)
+	if err := proto.Unmarshal(data, protoManifest); err != nil {
+		return nil, err
+	}
+	var manifest types.BlockManifest
+	if err := manifest.ProtoDecode(protoManifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
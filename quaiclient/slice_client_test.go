@@ -0,0 +1,203 @@
+package quaiclient
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/internal/quaiapi"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+var sliceTestLocation = common.Location{0}
+
+// sliceTestBackend is a region backend recording the dom/sub calls it
+// receives and answering them with fixed objects.
+type sliceTestBackend struct {
+	quaiapi.Backend
+
+	// Arguments of the last calls
+	appended       *types.WorkObject
+	manifest       types.BlockManifest
+	domPh          *types.WorkObject
+	domTerminus    common.Hash
+	domOrigin      bool
+	inboundEtxs    types.Transactions
+	relayedPh      types.PendingHeader
+	relayEntropy   *big.Int
+	relayLocation  common.Location
+	relaySubReorg  bool
+	relayOrder     int
+	domPhUpdate    types.PendingHeader
+	domLocation    common.Location
+	oldTerminus    common.Hash
+	recoveryPh     *types.WorkObject
+	recoveryHashes types.Termini
+	subLocation    common.Location
+
+	// Responses
+	pendingEtxs types.PendingEtxs
+	rollup      types.PendingEtxsRollup
+}
+
+func (b *sliceTestBackend) NodeLocation() common.Location { return sliceTestLocation }
+func (b *sliceTestBackend) NodeCtx() int                  { return common.REGION_CTX }
+
+func (b *sliceTestBackend) Append(ctx context.Context, header *types.WorkObject, manifest types.BlockManifest, domPendingHeader *types.WorkObject, domTerminus common.Hash, domOrigin bool, newInboundEtxs types.Transactions) (types.Transactions, bool, bool, error) {
+	b.appended, b.manifest, b.domPh, b.domTerminus, b.domOrigin, b.inboundEtxs = header, manifest, domPendingHeader, domTerminus, domOrigin, newInboundEtxs
+	return b.pendingEtxs.Etxs, true, false, nil
+}
+
+func (b *sliceTestBackend) SubRelayPendingHeader(ctx context.Context, pendingHeader types.PendingHeader, newEntropy *big.Int, location common.Location, subReorg bool, order int) {
+	b.relayedPh, b.relayEntropy, b.relayLocation, b.relaySubReorg, b.relayOrder = pendingHeader, newEntropy, location, subReorg, order
+}
+
+func (b *sliceTestBackend) UpdateDom(oldTerminus common.Hash, pendingHeader types.PendingHeader, location common.Location) {
+	b.oldTerminus, b.domPhUpdate, b.domLocation = oldTerminus, pendingHeader, location
+}
+
+func (b *sliceTestBackend) GetPendingEtxsFromSub(hash common.Hash, location common.Location) (types.PendingEtxs, error) {
+	b.subLocation = location
+	return b.pendingEtxs, nil
+}
+
+func (b *sliceTestBackend) GetPendingEtxsRollupFromSub(hash common.Hash, location common.Location) (types.PendingEtxsRollup, error) {
+	b.subLocation = location
+	return b.rollup, nil
+}
+
+func (b *sliceTestBackend) GetManifest(blockHash common.Hash) (types.BlockManifest, error) {
+	return types.BlockManifest{blockHash, common.Hash{0x01}}, nil
+}
+
+func (b *sliceTestBackend) GenerateRecoveryPendingHeader(pendingHeader *types.WorkObject, checkpointHashes types.Termini) error {
+	b.recoveryPh, b.recoveryHashes = pendingHeader, checkpointHashes
+	return nil
+}
+
+// newSliceTestWorkObject creates a work object that survives the protobuf
+// round trip with its hash unchanged.
+func newSliceTestWorkObject(number int64, location common.Location) *types.WorkObject {
+	wo := types.EmptyHeader(common.ZONE_CTX)
+	wo.WorkObjectHeader().SetNumber(big.NewInt(number))
+	wo.WorkObjectHeader().SetLocation(location)
+	wo.Header().SetCoinbase(common.ZeroAddress(common.Location{0, 0}))
+	wo.SetTx(nil)
+	return wo
+}
+
+func newSliceTestEtx(index uint16) *types.Transaction {
+	to := common.ZeroAddress(common.Location{0, 0})
+	return types.NewTx(&types.ExternalTx{OriginatingTxHash: common.Hash{0xe7}, ETXIndex: index, Gas: 21000, To: &to, Value: new(big.Int), Sender: to})
+}
+
+func newSliceTestTermini() types.Termini {
+	termini := types.EmptyTermini()
+	termini.SetDomTerminiAtIndex(common.Hash{0xd0}, 0)
+	termini.SetSubTerminiAtIndex(common.Hash{0x50}, 1)
+	return termini
+}
+
+// newSliceTestServer serves the slice api of the backend over http and dials
+// it from the prime and from the first zone of the region.
+func newSliceTestServer(t *testing.T, backend *sliceTestBackend) (prime *SliceClient, zone *SliceClient) {
+	server := rpc.NewServer(log.Global)
+	require.NoError(t, server.RegisterName("slice", quaiapi.NewSliceAPI(backend)))
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+	secret := make([]byte, 32)
+	prime, err := DialSlice(httpServer.URL, secret, common.Location{}, sliceTestLocation, log.Global)
+	require.NoError(t, err)
+	zone, err = DialSlice(httpServer.URL, secret, common.Location{0, 0}, sliceTestLocation, log.Global)
+	require.NoError(t, err)
+	t.Cleanup(prime.Close)
+	t.Cleanup(zone.Close)
+	return prime, zone
+}
+
+func TestSliceClient(t *testing.T) {
+	backend := &sliceTestBackend{}
+	pending := types.PendingEtxs{Header: newSliceTestWorkObject(3, common.Location{0, 0}), Etxs: types.Transactions{newSliceTestEtx(1), newSliceTestEtx(2)}}
+	backend.pendingEtxs = pending
+	backend.rollup = types.PendingEtxsRollup{Header: pending.Header, EtxsRollup: pending.Etxs}
+	prime, zone := newSliceTestServer(t, backend)
+
+	// The prime appends its block to the region
+	block := newSliceTestWorkObject(5, common.Location{})
+	domPh := newSliceTestWorkObject(6, common.Location{})
+	manifest := types.BlockManifest{common.Hash{0x0a}, common.Hash{0x0b}}
+	inbound := types.Transactions{newSliceTestEtx(3)}
+	etxs, subReorg, setHead, err := prime.Append(context.Background(), block, manifest, domPh, common.Hash{0xdd}, true, inbound)
+	require.NoError(t, err)
+	require.Equal(t, block.Hash(), backend.appended.Hash())
+	require.Equal(t, manifest, backend.manifest)
+	require.Equal(t, domPh.Hash(), backend.domPh.Hash())
+	require.Equal(t, common.Hash{0xdd}, backend.domTerminus)
+	require.True(t, backend.domOrigin)
+	require.Len(t, backend.inboundEtxs, 1)
+	require.Equal(t, inbound[0].Hash(), backend.inboundEtxs[0].Hash())
+	require.True(t, subReorg)
+	require.False(t, setHead)
+	require.Len(t, etxs, len(pending.Etxs))
+	for i, etx := range etxs {
+		require.Equal(t, pending.Etxs[i].Hash(), etx.Hash())
+	}
+
+	// The prime relays its pending header, the empty prime location must
+	// survive the hex encoding
+	ph := types.NewPendingHeader(newSliceTestWorkObject(7, common.Location{}), newSliceTestTermini())
+	prime.SubRelayPendingHeader(context.Background(), ph, big.NewInt(42), common.Location{}, true, common.PRIME_CTX)
+	require.NotNil(t, backend.relayedPh.WorkObject())
+	require.Equal(t, ph.WorkObject().Hash(), backend.relayedPh.WorkObject().Hash())
+	require.Equal(t, ph.Termini().DomTermini(), backend.relayedPh.Termini().DomTermini())
+	require.Equal(t, ph.Termini().SubTermini(), backend.relayedPh.Termini().SubTermini())
+	require.Equal(t, int64(42), backend.relayEntropy.Int64())
+	require.NotNil(t, backend.relayLocation)
+	require.True(t, common.Location{}.Equal(backend.relayLocation))
+	require.Equal(t, common.PRIME_CTX, backend.relayLocation.Context())
+	require.True(t, backend.relaySubReorg)
+	require.Equal(t, common.PRIME_CTX, backend.relayOrder)
+
+	// The zone updates its dom with its own location
+	zonePh := types.NewPendingHeader(newSliceTestWorkObject(8, common.Location{0, 0}), newSliceTestTermini())
+	zone.UpdateDom(common.Hash{0x77}, zonePh, common.Location{0, 0})
+	require.Equal(t, common.Hash{0x77}, backend.oldTerminus)
+	require.Equal(t, zonePh.WorkObject().Hash(), backend.domPhUpdate.WorkObject().Hash())
+	require.True(t, common.Location{0, 0}.Equal(backend.domLocation))
+
+	// The prime fetches the pending etxs of a region block
+	pEtxs, err := prime.GetPendingEtxsFromSub(pending.Header.Hash(), sliceTestLocation)
+	require.NoError(t, err)
+	require.True(t, sliceTestLocation.Equal(backend.subLocation))
+	require.Equal(t, pending.Header.Hash(), pEtxs.Header.Hash())
+	require.Len(t, pEtxs.Etxs, len(pending.Etxs))
+	for i, etx := range pEtxs.Etxs {
+		require.Equal(t, pending.Etxs[i].Hash(), etx.Hash())
+	}
+	rollup, err := prime.GetPendingEtxsRollupFromSub(pending.Header.Hash(), common.Location{0, 1})
+	require.NoError(t, err)
+	require.True(t, common.Location{0, 1}.Equal(backend.subLocation))
+	require.Equal(t, pending.Header.Hash(), rollup.Header.Hash())
+	require.Len(t, rollup.EtxsRollup, len(pending.Etxs))
+
+	// The prime asks for the manifest of a region block
+	blockManifest, err := prime.GetManifest(common.Hash{0x99})
+	require.NoError(t, err)
+	require.Equal(t, types.BlockManifest{common.Hash{0x99}, common.Hash{0x01}}, blockManifest)
+
+	// The prime regenerates the pending header of the region
+	recoveryPh := newSliceTestWorkObject(9, common.Location{})
+	checkpoints := newSliceTestTermini()
+	require.NoError(t, prime.GenerateRecoveryPendingHeader(recoveryPh, checkpoints))
+	require.Equal(t, recoveryPh.Hash(), backend.recoveryPh.Hash())
+	require.Equal(t, checkpoints.DomTermini(), backend.recoveryHashes.DomTermini())
+	require.Equal(t, checkpoints.SubTermini(), backend.recoveryHashes.SubTermini())
+}
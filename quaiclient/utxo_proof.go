@@ -0,0 +1,123 @@
+package quaiclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/crypto"
+	"github.com/dominant-strategies/go-quai/ethdb/memorydb"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/rlp"
+	"github.com/dominant-strategies/go-quai/trie"
+)
+
+// UtxoEntry is an entry of the UTXO set as returned by quai_getUtxoProof
+type UtxoEntry struct {
+	Denomination hexutil.Uint64 `json:"denomination"`
+	Address      hexutil.Bytes  `json:"address"`
+	Lock         *hexutil.Big   `json:"lock"`
+}
+
+// UtxoProof is the Merkle-proof of an outpoint against the UTXO root of a
+// block as returned by quai_getUtxoProof
+type UtxoProof struct {
+	TxHash      common.Hash     `json:"txHash"`
+	Index       hexutil.Uint64  `json:"index"`
+	Entry       *UtxoEntry      `json:"entry"` // nil if the outpoint is not in the UTXO set
+	Proof       []hexutil.Bytes `json:"proof"`
+	UtxoRoot    common.Hash     `json:"utxoRoot"`
+	BlockHash   common.Hash     `json:"blockHash"`
+	BlockNumber hexutil.Uint64  `json:"blockNumber"`
+}
+
+// GetUtxoProof returns the Merkle-proof of the outpoint against the UTXO root
+// of the block with the given number, or of the latest block if nil. The
+// proof must be checked with Verify against the UTXO root of a trusted header.
+func (ec *Client) GetUtxoProof(ctx context.Context, txHash common.Hash, index uint16, blockNumber *big.Int) (*UtxoProof, error) {
+	var proof *UtxoProof
+	err := ec.c.CallContext(ctx, &proof, "quai_getUtxoProof", txHash, hexutil.Uint64(index), toBlockNumArg(blockNumber))
+	if err != nil {
+		return nil, err
+	}
+	if proof == nil {
+		return nil, errors.New("no utxo proof returned")
+	}
+	return proof, nil
+}
+
+// Verify checks the proof against the UTXO root of a trusted header. It
+// returns the entry of the outpoint, or nil if the proof shows the outpoint is
+// not in the UTXO set, and fails if the entry reported by the node does not
+// match the proof.
+func (p *UtxoProof) Verify(utxoRoot common.Hash) (*types.UtxoEntry, error) {
+	if p.UtxoRoot != utxoRoot {
+		return nil, fmt.Errorf("proof is against utxo root %x, expected %x", p.UtxoRoot, utxoRoot)
+	}
+	if p.Index > types.MaxOutputIndex {
+		return nil, fmt.Errorf("invalid output index %d", p.Index)
+	}
+	proof := make([][]byte, len(p.Proof))
+	for i, node := range p.Proof {
+		proof[i] = node
+	}
+	entry, err := VerifyUtxoProof(utxoRoot, p.TxHash, uint16(p.Index), proof)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Entry.matches(entry) {
+		return nil, errors.New("utxo entry does not match the proof")
+	}
+	return entry, nil
+}
+
+// matches returns true if the reported entry is the proven one
+func (e *UtxoEntry) matches(entry *types.UtxoEntry) bool {
+	if e == nil || entry == nil {
+		return e == nil && entry == nil
+	}
+	lock, provenLock := (*big.Int)(e.Lock), entry.Lock
+	if lock == nil {
+		lock = new(big.Int)
+	}
+	if provenLock == nil {
+		provenLock = new(big.Int)
+	}
+	return uint64(e.Denomination) == uint64(entry.Denomination) &&
+		bytes.Equal(e.Address, entry.Address) &&
+		lock.Cmp(provenLock) == 0
+}
+
+// VerifyUtxoProof checks the Merkle-proof of the outpoint against the UTXO
+// root. It returns the entry of the outpoint, or nil if the proof shows the
+// outpoint is not in the UTXO set.
+func VerifyUtxoProof(utxoRoot common.Hash, txHash common.Hash, index uint16, proof [][]byte) (*types.UtxoEntry, error) {
+	// The empty trie has no node to prove the absence with
+	if utxoRoot == types.EmptyRootHash {
+		return nil, nil
+	}
+	proofDb := memorydb.New(log.Global)
+	for _, node := range proof {
+		if err := proofDb.Put(crypto.Keccak256(node), node); err != nil {
+			return nil, err
+		}
+	}
+	// The UTXO trie is a secure trie, its keys are hashed
+	value, err := trie.VerifyProof(utxoRoot, crypto.Keccak256(types.UtxoKey(txHash, index)), proofDb)
+	if err != nil {
+		return nil, fmt.Errorf("invalid utxo proof: %w", err)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	entry := new(types.UtxoEntry)
+	if err := rlp.DecodeBytes(value, entry); err != nil {
+		return nil, fmt.Errorf("invalid utxo entry in proof: %w", err)
+	}
+	return entry, nil
+}
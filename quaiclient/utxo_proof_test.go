@@ -0,0 +1,181 @@
+package quaiclient
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/dominant-strategies/go-quai/common"
+	"github.com/dominant-strategies/go-quai/common/hexutil"
+	"github.com/dominant-strategies/go-quai/core/rawdb"
+	"github.com/dominant-strategies/go-quai/core/state"
+	"github.com/dominant-strategies/go-quai/core/types"
+	"github.com/dominant-strategies/go-quai/crypto"
+	"github.com/dominant-strategies/go-quai/ethdb/memorydb"
+	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/trie"
+	"github.com/stretchr/testify/require"
+)
+
+var utxoProofLocation = common.Location{0, 0}
+
+// utxoProofAddress returns a Qi address of the zone of the tests
+func utxoProofAddress(b byte) []byte {
+	address := make([]byte, common.AddressLength)
+	address[1] = 0x80 // Qi ledger
+	address[common.AddressLength-1] = b
+	return address
+}
+
+// newUtxoProofState creates a UTXO set holding the given outpoints and
+// returns the state and its committed UTXO root
+func newUtxoProofState(t *testing.T, entries map[types.OutPoint]*types.UtxoEntry) (*state.StateDB, common.Hash) {
+	db := state.NewDatabase(rawdb.NewMemoryDatabase(log.Global))
+	statedb, err := state.New(common.Hash{}, common.Hash{}, common.Hash{}, db, db, db, nil, nil, utxoProofLocation, log.Global)
+	require.NoError(t, err)
+	for outpoint, entry := range entries {
+		require.NoError(t, statedb.CreateUTXO(outpoint.TxHash, outpoint.Index, entry))
+	}
+	root, err := statedb.CommitUTXOs()
+	require.NoError(t, err)
+	return statedb, root
+}
+
+// newUtxoProof builds the proof returned by quai_getUtxoProof for the
+// outpoint
+func newUtxoProof(t *testing.T, statedb *state.StateDB, root common.Hash, outpoint types.OutPoint) *UtxoProof {
+	proof, err := statedb.GetUTXOProof(outpoint.TxHash, outpoint.Index)
+	require.NoError(t, err)
+	result := &UtxoProof{
+		TxHash:   outpoint.TxHash,
+		Index:    hexutil.Uint64(outpoint.Index),
+		UtxoRoot: root,
+	}
+	for _, node := range proof {
+		result.Proof = append(result.Proof, node)
+	}
+	if entry := statedb.GetUTXO(outpoint.TxHash, outpoint.Index); entry != nil {
+		result.Entry = &UtxoEntry{
+			Denomination: hexutil.Uint64(entry.Denomination),
+			Address:      entry.Address,
+			Lock:         (*hexutil.Big)(entry.Lock),
+		}
+	}
+	return result
+}
+
+func TestUtxoProof(t *testing.T) {
+	entries := make(map[types.OutPoint]*types.UtxoEntry)
+	for i := 0; i < 32; i++ {
+		outpoint := types.OutPoint{TxHash: common.BigToHash(big.NewInt(int64(i))), Index: uint16(i % 3)}
+		entries[outpoint] = &types.UtxoEntry{Denomination: uint8(i % 10), Address: utxoProofAddress(byte(i)), Lock: big.NewInt(int64(i))}
+	}
+	statedb, root := newUtxoProofState(t, entries)
+
+	// Every outpoint of the set is proven with its entry
+	for outpoint, want := range entries {
+		entry, err := newUtxoProof(t, statedb, root, outpoint).Verify(root)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		require.Equal(t, want.Denomination, entry.Denomination)
+		require.Equal(t, want.Address, entry.Address)
+		require.Zero(t, want.Lock.Cmp(entry.Lock))
+	}
+
+	// An outpoint absent from the set is proven absent, including an output
+	// of a transaction whose other outputs are in the set
+	for _, outpoint := range []types.OutPoint{
+		{TxHash: common.BigToHash(big.NewInt(1000)), Index: 0},
+		{TxHash: common.BigToHash(big.NewInt(1)), Index: 2},
+	} {
+		proof := newUtxoProof(t, statedb, root, outpoint)
+		require.Nil(t, proof.Entry)
+		entry, err := proof.Verify(root)
+		require.NoError(t, err)
+		require.Nil(t, entry)
+	}
+}
+
+func TestUtxoProofKeyHashing(t *testing.T) {
+	outpoint := types.OutPoint{TxHash: common.BigToHash(big.NewInt(7)), Index: 1}
+	statedb, root := newUtxoProofState(t, map[types.OutPoint]*types.UtxoEntry{
+		outpoint: {Denomination: 3, Address: utxoProofAddress(7), Lock: big.NewInt(0)},
+	})
+	proof := newUtxoProof(t, statedb, root, outpoint)
+
+	// The proof follows the path of the hashed outpoint key
+	entry, err := VerifyUtxoProof(root, outpoint.TxHash, outpoint.Index, toBytes(proof.Proof))
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+
+	// and does not show the entry at the raw key
+	proofDb := memorydb.New(log.Global)
+	for _, node := range proof.Proof {
+		require.NoError(t, proofDb.Put(crypto.Keccak256(node), node))
+	}
+	value, err := trie.VerifyProof(root, types.UtxoKey(outpoint.TxHash, outpoint.Index), proofDb)
+	require.True(t, err != nil || value == nil)
+}
+
+func TestUtxoProofTampered(t *testing.T) {
+	outpoint := types.OutPoint{TxHash: common.BigToHash(big.NewInt(1)), Index: 0}
+	entries := map[types.OutPoint]*types.UtxoEntry{
+		outpoint: {Denomination: 5, Address: utxoProofAddress(1), Lock: big.NewInt(0)},
+	}
+	for i := 2; i < 16; i++ {
+		entries[types.OutPoint{TxHash: common.BigToHash(big.NewInt(int64(i))), Index: 0}] = &types.UtxoEntry{Denomination: 1, Address: utxoProofAddress(byte(i)), Lock: big.NewInt(0)}
+	}
+	statedb, root := newUtxoProofState(t, entries)
+
+	// A modified node no longer hashes to its reference
+	proof := newUtxoProof(t, statedb, root, outpoint)
+	last := proof.Proof[len(proof.Proof)-1]
+	last[len(last)-1] ^= 0x01
+	_, err := proof.Verify(root)
+	require.Error(t, err)
+
+	// A missing node breaks the path to the entry
+	proof = newUtxoProof(t, statedb, root, outpoint)
+	proof.Proof = proof.Proof[:len(proof.Proof)-1]
+	_, err = proof.Verify(root)
+	require.Error(t, err)
+
+	// An entry reported by the node which differs from the proven one
+	proof = newUtxoProof(t, statedb, root, outpoint)
+	proof.Entry.Denomination++
+	_, err = proof.Verify(root)
+	require.Error(t, err)
+
+	// A spent outpoint reported as unspent
+	absent := newUtxoProof(t, statedb, root, types.OutPoint{TxHash: common.BigToHash(big.NewInt(1000)), Index: 0})
+	absent.Entry = proof.Entry
+	_, err = absent.Verify(root)
+	require.Error(t, err)
+}
+
+func TestUtxoProofWrongRoot(t *testing.T) {
+	outpoint := types.OutPoint{TxHash: common.BigToHash(big.NewInt(1)), Index: 0}
+	statedb, root := newUtxoProofState(t, map[types.OutPoint]*types.UtxoEntry{
+		outpoint: {Denomination: 5, Address: utxoProofAddress(1), Lock: big.NewInt(0)},
+	})
+	_, otherRoot := newUtxoProofState(t, map[types.OutPoint]*types.UtxoEntry{
+		outpoint: {Denomination: 6, Address: utxoProofAddress(1), Lock: big.NewInt(0)},
+	})
+	proof := newUtxoProof(t, statedb, root, outpoint)
+
+	// The proof claims a root other than the trusted one
+	_, err := proof.Verify(otherRoot)
+	require.Error(t, err)
+
+	// The proof claims the trusted root but was built against another one
+	proof.UtxoRoot = otherRoot
+	_, err = proof.Verify(otherRoot)
+	require.Error(t, err)
+}
+
+func toBytes(proof []hexutil.Bytes) [][]byte {
+	nodes := make([][]byte, len(proof))
+	for i, node := range proof {
+		nodes[i] = node
+	}
+	return nodes
+}
@@ -27,6 +27,8 @@ import (
 	"time"
 
 	"github.com/dominant-strategies/go-quai/log"
+	"github.com/dominant-strategies/go-quai/metrics_config"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // handler handles JSON-RPC messages. There is one handler per connection. Note that
@@ -388,7 +390,9 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMes
 
 // runMethod runs the Go callback for an RPC method.
 func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value) *jsonrpcMessage {
+	ctx, span := metrics_config.StartSpan(ctx, "rpc "+msg.Method, attribute.String("rpc.method", msg.Method))
 	result, err := callb.call(ctx, msg.Method, args, h.log)
+	metrics_config.EndSpan(span, err)
 	if err != nil {
 		return msg.errorResponse(err)
 	}
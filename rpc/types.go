@@ -34,6 +34,8 @@ type API struct {
 	Version   string      // api version for DApp's
 	Service   interface{} // receiver instance which holds the methods
 	Public    bool        // indication if the methods must be considered safe for public use
+
+	Authenticated bool // whether the api should only be served on the authenticated endpoint
 }
 
 // ServerCodec implements reading, parsing and writing RPC messages for the server side of